@@ -2,11 +2,18 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"github.com/rs/zerolog/log"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,72 +28,470 @@ const (
 	PaginationPageQueryParam = "pagination-page"
 	// PaginationSizeQueryParam is the query parameter used to set page size in paginated endpoint
 	PaginationSizeQueryParam = "pagination-size"
+	// PageQueryParam is the short form of PaginationPageQueryParam
+	PageQueryParam = "page"
+	// PaginationNextHeader is the header containing the cursor of the next page in paginated endpoint
+	// (missing on last page)
+	PaginationNextHeader = "X-Pagination-Next"
+	// CursorAfterQueryParam is the query parameter used to set the cursor of the page to return
+	CursorAfterQueryParam = "after"
+	// CursorSizeQueryParam is the query parameter used to set page size when using cursors
+	CursorSizeQueryParam = "size"
+	// ContentHashQueryParam is the query parameter used to search resources by the SHA-256 of their body
+	ContentHashQueryParam = "content_hash"
+	// LanguageQueryParam is the query parameter used to search resources by the BCP-47 code of their language
+	LanguageQueryParam = "language"
+	// CharsetQueryParam is the query parameter used to search resources by the charset their body has been
+	// decoded from (e.g: windows-1252)
+	CharsetQueryParam = "charset"
+	// ExtractedKeywordsQueryParam is the query parameter used to search resources by their extracted keywords
+	// (comma separated, every keyword must match)
+	ExtractedKeywordsQueryParam = "extracted_keywords"
+	// SourceQueryParam is the query parameter used to search resources by how their URL has been discovered
+	// (e.g: crawler, seed or manual)
+	SourceQueryParam = "source"
+	// ResponseCodeQueryParam is the query parameter used to search resources by the HTTP status code of their response
+	ResponseCodeQueryParam = "response_code"
+	// MinSizeQueryParam is the query parameter used to search resources whose body is at least given size (in bytes)
+	MinSizeQueryParam = "min-size"
+	// MaxSizeQueryParam is the query parameter used to search resources whose body is at most given size (in bytes)
+	MaxSizeQueryParam = "max-size"
+
+	// DefaultConnectTimeout is the default maximum time to wait for the connection to the API to be established
+	DefaultConnectTimeout = 5 * time.Second
+	// DefaultRequestTimeout is the default maximum time to wait for an API request to complete
+	DefaultRequestTimeout = 30 * time.Second
+	// DefaultIdleConnTimeout is the default time after which an idle connection to the API is closed
+	DefaultIdleConnTimeout = 90 * time.Second
 
 	contentTypeJSON = "application/json"
 )
 
 // ResourceDto represent a resource as given by the API
 type ResourceDto struct {
-	URL   string    `json:"url"`
-	Body  string    `json:"body"`
-	Title string    `json:"title"`
-	Time  time.Time `json:"time"`
+	URL         string    `json:"url"`
+	Body        string    `json:"body"`
+	Title       string    `json:"title"`
+	Time        time.Time `json:"time"`
+	ContentHash string    `json:"content_hash,omitempty"`
+	// Truncated is true if the body has been truncated by the crawler (content is incomplete)
+	Truncated bool `json:"truncated,omitempty"`
+	// UserAgent is the user agent the resource has been crawled with (empty for the resources crawled by older crawlers)
+	UserAgent string `json:"user_agent,omitempty"`
+	// Language is the BCP-47 code of the language of the body (empty if it cannot be detected)
+	Language string `json:"language,omitempty"`
+	// Charset is the lower cased name of the charset the body has been decoded from to UTF-8 (e.g: windows-1252),
+	// empty for the resources crawled by older crawlers
+	Charset string `json:"charset,omitempty"`
+	// Keywords are the terms best describing the displayed text of the body, lower cased & best first
+	// (empty if not extracted)
+	Keywords []string `json:"keywords,omitempty"`
+	// Source tell how the URL of the resource has been discovered: crawler, seed or manual (empty if unknown)
+	Source string `json:"source,omitempty"`
+	// ResponseCode is the HTTP status code the URL answered with, before redirects are followed (e.g: 301 for a
+	// moved page, 404 for a missing one whose body is then empty). 0 for the resources crawled by older crawlers
+	ResponseCode int `json:"response_code"`
+	// BodyURL is the URL of the body once moved to the archive by tdsh-archiver, the body being then empty
+	BodyURL string `json:"body_url,omitempty"`
+}
+
+// SearchResourcesOptions select the resources to search. Empty fields match every resource
+type SearchResourcesOptions struct {
+	// URL is the base64 encoded URL of the resources
+	URL string
+	// Keyword must be contained in the body of the resources
+	Keyword string
+	// Title must be contained in the title of the resources
+	Title string
+	// Language is the BCP-47 code of the language of the resources
+	Language string
+	// Charset is the name of the charset the body of the resources has been decoded from (e.g: windows-1252)
+	Charset string
+	// ExtractedKeywords must all be extracted keywords of the resources
+	ExtractedKeywords []string
+	// Source tell how the URL of the resources has been discovered (e.g: crawler, seed or manual)
+	Source string
+	// ResponseCode is the HTTP status code of the response of the resources
+	ResponseCode int
+	// MinSize is the minimum body size of the resources, in bytes.
+	// the resources saved before the body size was stored never match a size filter
+	MinSize int64
+	// MaxSize is the maximum body size of the resources, in bytes
+	MaxSize int64
+	// StartDate & EndDate bound the crawl time of the resources
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// query returns the query parameters selecting the resources matching the options
+func (opts SearchResourcesOptions) query() url.Values {
+	params := url.Values{}
+
+	if opts.URL != "" {
+		params.Set("url", opts.URL)
+	}
+
+	if opts.Keyword != "" {
+		params.Set("keyword", opts.Keyword)
+	}
+
+	if opts.Title != "" {
+		params.Set("title", opts.Title)
+	}
+
+	if opts.Language != "" {
+		params.Set(LanguageQueryParam, opts.Language)
+	}
+
+	if opts.Charset != "" {
+		params.Set(CharsetQueryParam, opts.Charset)
+	}
+
+	if len(opts.ExtractedKeywords) > 0 {
+		params.Set(ExtractedKeywordsQueryParam, strings.Join(opts.ExtractedKeywords, ","))
+	}
+
+	if opts.Source != "" {
+		params.Set(SourceQueryParam, opts.Source)
+	}
+
+	if opts.ResponseCode != 0 {
+		params.Set(ResponseCodeQueryParam, strconv.Itoa(opts.ResponseCode))
+	}
+
+	if opts.MinSize != 0 {
+		params.Set(MinSizeQueryParam, strconv.FormatInt(opts.MinSize, 10))
+	}
+
+	if opts.MaxSize != 0 {
+		params.Set(MaxSizeQueryParam, strconv.FormatInt(opts.MaxSize, 10))
+	}
+
+	if !opts.StartDate.IsZero() {
+		params.Set("start-date", opts.StartDate.Format(time.RFC3339))
+	}
+
+	if !opts.EndDate.IsZero() {
+		params.Set("end-date", opts.EndDate.Format(time.RFC3339))
+	}
+
+	return params
+}
+
+// Match returns true if given resource is selected by the options. Keyword & title are matched case insensitively
+// as substrings, which may differ from the full-text search of the API
+func (opts SearchResourcesOptions) Match(res ResourceDto) bool {
+	if opts.URL != "" && EncodeURL(res.URL) != opts.URL {
+		return false
+	}
+	if opts.Keyword != "" && !strings.Contains(strings.ToLower(res.Body), strings.ToLower(opts.Keyword)) {
+		return false
+	}
+	if opts.Title != "" && !strings.Contains(strings.ToLower(res.Title), strings.ToLower(opts.Title)) {
+		return false
+	}
+	if opts.Language != "" && res.Language != opts.Language {
+		return false
+	}
+	if opts.Charset != "" && !strings.EqualFold(res.Charset, opts.Charset) {
+		return false
+	}
+	for _, keyword := range opts.ExtractedKeywords {
+		if !containsFold(res.Keywords, keyword) {
+			return false
+		}
+	}
+	if opts.Source != "" && res.Source != opts.Source {
+		return false
+	}
+	if opts.ResponseCode != 0 && res.ResponseCode != opts.ResponseCode {
+		return false
+	}
+	if opts.MinSize != 0 && int64(len(res.Body)) < opts.MinSize {
+		return false
+	}
+	if opts.MaxSize != 0 && int64(len(res.Body)) > opts.MaxSize {
+		return false
+	}
+	if !opts.StartDate.IsZero() && res.Time.Before(opts.StartDate) {
+		return false
+	}
+	if !opts.EndDate.IsZero() && res.Time.After(opts.EndDate) {
+		return false
+	}
+
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// BulkSearchRequestDto represent a bulk search request, URLs being base64 encoded
+type BulkSearchRequestDto struct {
+	URLs      []string  `json:"urls"`
+	StartDate time.Time `json:"start-date"`
+	EndDate   time.Time `json:"end-date"`
+}
+
+// StatsDto represent the crawl statistics as given by the API
+type StatsDto struct {
+	// ResourceCount is the total number of crawled resources
+	ResourceCount int64 `json:"resource_count"`
+	// HostCount is the number of distinct hosts crawled (approximate past 40000 hosts)
+	HostCount int64 `json:"host_count"`
+	// ResourceCountLast24h is the number of resources crawled in the last 24 hours
+	ResourceCountLast24h int64 `json:"resource_count_last_24h"`
+	// ResourceCountLast7d is the number of resources crawled in the last 7 days
+	ResourceCountLast7d int64 `json:"resource_count_last_7d"`
+	// ResourceCountLast30d is the number of resources crawled in the last 30 days
+	ResourceCountLast30d int64 `json:"resource_count_last_30d"`
+	// AverageBodySize is the average body size of the resources, in bytes
+	AverageBodySize float64 `json:"average_body_size"`
+	// TopHosts are the most crawled hosts, most crawled first
+	TopHosts []HostStatsDto `json:"top_hosts"`
+}
+
+// HostStatsDto represent the number of resources crawled for an host
+type HostStatsDto struct {
+	Host          string `json:"host"`
+	ResourceCount int64  `json:"resource_count"`
+}
+
+// HostDto represent a crawled host as given by the API
+type HostDto struct {
+	Host          string `json:"host"`
+	ResourceCount int64  `json:"resource_count"`
+	// LastCrawled is the time of the last crawled resource of the host
+	LastCrawled time.Time `json:"last_crawled"`
 }
 
-// Client is the interface to interact with the API process
+// CrawlHistoryDto summarize the crawls of an URL, successful or not, as recorded by the API
+type CrawlHistoryDto struct {
+	// Attempts is the number of times the URL has been crawled
+	Attempts int64 `json:"attempts"`
+	// StatusCodes is the number of crawls by response status code (0 if no response has been received)
+	StatusCodes map[int]int64 `json:"status_codes"`
+}
+
+// BodyURLDto represent the location of an archived resource body
+type BodyURLDto struct {
+	BodyURL string `json:"body_url"`
+}
+
+// Client is the interface to interact with the API process.
+// when the API answers with an error status, a *NotFoundError, *RateLimitedError or *ServerError is returned
 type Client interface {
-	SearchResources(url, keyword string, startDate, endDate time.Time,
-		paginationPage, paginationSize int) ([]ResourceDto, int64, error)
+	Search(filter ResourceFilter) ([]ResourceDto, int64, error)
+	// SearchResources returns the given page of resources matching given options
+	//
+	// Deprecated: use Search instead
+	SearchResources(opts SearchResourcesOptions, paginationPage, paginationSize int) ([]ResourceDto, int64, error)
+	SearchResourcesAfter(cursor string, size int, opts SearchResourcesOptions) ([]ResourceDto, string, error)
+	SearchResourcesBulk(urls []string, startDate, endDate time.Time) (map[string][]ResourceDto, error)
+	SearchResourcesByContentHash(contentHash string, size int) ([]ResourceDto, error)
+	GetResource(b64URL string) (*ResourceDto, error)
+	DeleteResource(b64URL string) error
+	// GetResourceBody returns the body of the last crawled resource with given base64 encoded URL
+	GetResourceBody(b64URL string) (string, error)
+	// SetResourceBodyURL replace the body of the last crawled resource with given base64 encoded URL by the URL
+	// where the body has been archived
+	SetResourceBodyURL(b64URL, bodyURL string) error
 	AddResource(res ResourceDto) (ResourceDto, error)
 	ScheduleURL(url string) error
+	// Deprecated: use Subscribe
+	WatchResources(ctx context.Context, filter ResourceFilter) (<-chan ResourceDto, error)
+	Subscribe(ctx context.Context, filter ResourceFilter) (<-chan ResourceDto, <-chan error)
+	GetStats() (StatsDto, error)
+	ListHosts(page, size int) ([]HostDto, int64, error)
+	// GetCrawlHistory returns the summary of the crawls of given base64 encoded URL (as published to url.todo)
+	GetCrawlHistory(b64URL string) (CrawlHistoryDto, error)
 }
 
 type client struct {
 	httpClient *http.Client
+	transport  *http.Transport
 	baseURL    string
+	withBody   bool
 }
 
-func (c *client) SearchResources(url, keyword string,
-	startDate, endDate time.Time, paginationPage, paginationSize int) ([]ResourceDto, int64, error) {
-	targetEndpoint := fmt.Sprintf("%s/v1/resources?", c.baseURL)
+// SearchResources returns the given page of resources
+//
+// Deprecated: use Search instead
+func (c *client) SearchResources(opts SearchResourcesOptions,
+	paginationPage, paginationSize int) ([]ResourceDto, int64, error) {
+	return c.Search(ResourceFilter{opts: opts, page: paginationPage, size: paginationSize})
+}
 
-	if url != "" {
-		targetEndpoint += fmt.Sprintf("url=%s&", url)
+// SearchResourcesAfter returns the page of resources following given cursor (empty for the first page),
+// with the cursor of the next page (empty once exhausted)
+func (c *client) SearchResourcesAfter(cursor string, size int,
+	opts SearchResourcesOptions) ([]ResourceDto, string, error) {
+	params := url.Values{}
+	if cursor != "" {
+		params.Set(CursorAfterQueryParam, cursor)
 	}
-
-	if keyword != "" {
-		targetEndpoint += fmt.Sprintf("keyword=%s&", keyword)
+	if size != 0 {
+		params.Set(CursorSizeQueryParam, strconv.Itoa(size))
 	}
 
-	if !startDate.IsZero() {
-		targetEndpoint += fmt.Sprintf("start-date=%s&", startDate.Format(time.RFC3339))
+	resources, next, _, err := c.search(params, opts)
+	return resources, next, err
+}
+
+// search returns the resources matching given options, paginated using given query parameters
+func (c *client) search(pagination url.Values, opts SearchResourcesOptions) ([]ResourceDto, string, int64, error) {
+	params := opts.query()
+	for key, values := range pagination {
+		params[key] = values
 	}
 
-	if !endDate.IsZero() {
-		targetEndpoint += fmt.Sprintf("end-date=%s&", endDate.Format(time.RFC3339))
+	if c.withBody {
+		params.Set("with-body", "true")
 	}
 
-	headers := map[string]string{}
+	targetEndpoint := fmt.Sprintf("%s/v1/resources?%s", c.baseURL, params.Encode())
 
-	if paginationPage != 0 {
-		headers[PaginationPageHeader] = strconv.Itoa(paginationPage)
+	var resources []ResourceDto
+	res, err := jsonGet(c.httpClient, targetEndpoint, map[string]string{}, &resources)
+	if err != nil {
+		return nil, "", 0, err
 	}
-	if paginationSize != 0 {
-		headers[PaginationSizeHeader] = strconv.Itoa(paginationSize)
+
+	count, err := strconv.ParseInt(res.Header.Get(PaginationCountHeader), 10, 64)
+	if err != nil {
+		return nil, "", 0, err
 	}
 
+	return resources, res.Header.Get(PaginationNextHeader), count, nil
+}
+
+// SearchResourcesByContentHash returns the first crawled resources whose body has given SHA-256 (hex encoded)
+func (c *client) SearchResourcesByContentHash(contentHash string, size int) ([]ResourceDto, error) {
+	targetEndpoint := fmt.Sprintf("%s/v1/resources?%s=%s&%s=%d", c.baseURL, ContentHashQueryParam,
+		url.QueryEscape(contentHash), CursorSizeQueryParam, size)
+
 	var resources []ResourceDto
-	res, err := jsonGet(c.httpClient, targetEndpoint, headers, &resources)
+	if _, err := jsonGet(c.httpClient, targetEndpoint, map[string]string{}, &resources); err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+func (c *client) SearchResourcesBulk(urls []string, startDate, endDate time.Time) (map[string][]ResourceDto, error) {
+	targetEndpoint := c.baseURL + bulkSearchPath
+
+	req := BulkSearchRequestDto{
+		URLs:      urls,
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	var resources map[string][]ResourceDto
+	_, err := jsonPost(c.httpClient, targetEndpoint, req, &resources)
+	return resources, err
+}
+
+// GetResource returns the last crawled resource with given base64 encoded URL, nil if never crawled
+func (c *client) GetResource(b64URL string) (*ResourceDto, error) {
+	targetEndpoint := fmt.Sprintf("%s/v1/resources/%s", c.baseURL, b64URL)
+	log.Trace().Str("verb", "GET").Str("url", targetEndpoint).Msg("")
+
+	r, err := c.httpClient.Get(targetEndpoint)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
+	defer r.Body.Close()
 
-	count, err := strconv.ParseInt(res.Header[PaginationCountHeader][0], 10, 64)
+	if r.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := checkResponse(r); err != nil {
+		return nil, err
+	}
+
+	var resource ResourceDto
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		return nil, err
+	}
+
+	return &resource, nil
+}
+
+// DeleteResource deletes every crawled resource with given base64 encoded URL
+func (c *client) DeleteResource(b64URL string) error {
+	targetEndpoint := fmt.Sprintf("%s/v1/resources/%s", c.baseURL, b64URL)
+	log.Trace().Str("verb", "DELETE").Str("url", targetEndpoint).Msg("")
+
+	req, err := http.NewRequest(http.MethodDelete, targetEndpoint, nil)
 	if err != nil {
-		return nil, 0, err
+		return err
+	}
+
+	r, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
 	}
+	defer r.Body.Close()
 
-	return resources, count, nil
+	// Deleting an URL never crawled is not an error
+	if r.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return checkResponse(r)
+}
+
+func (c *client) GetResourceBody(b64URL string) (string, error) {
+	targetEndpoint := fmt.Sprintf("%s/v1/resources/%s/body", c.baseURL, b64URL)
+	log.Trace().Str("verb", "GET").Str("url", targetEndpoint).Msg("")
+
+	r, err := c.httpClient.Get(targetEndpoint)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+
+	if err := checkResponse(r); err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (c *client) SetResourceBodyURL(b64URL, bodyURL string) error {
+	targetEndpoint := fmt.Sprintf("%s/v1/resources/%s/body-url", c.baseURL, b64URL)
+	log.Trace().Str("verb", "PUT").Str("url", targetEndpoint).Msg("")
+
+	b, err := json.Marshal(BodyURLDto{BodyURL: bodyURL})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, targetEndpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	r, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	return checkResponse(r)
 }
 
 func (c *client) AddResource(res ResourceDto) (ResourceDto, error) {
@@ -103,14 +508,193 @@ func (c *client) ScheduleURL(url string) error {
 	return err
 }
 
+// GetStats returns the crawl statistics
+func (c *client) GetStats() (StatsDto, error) {
+	targetEndpoint := fmt.Sprintf("%s/v1/stats", c.baseURL)
+
+	var stats StatsDto
+	_, err := jsonGet(c.httpClient, targetEndpoint, map[string]string{}, &stats)
+	return stats, err
+}
+
+// ListHosts returns the given page (starting at 1) of crawled hosts sorted by name,
+// and their total count (approximate past 40000 hosts)
+func (c *client) ListHosts(page, size int) ([]HostDto, int64, error) {
+	targetEndpoint := fmt.Sprintf("%s/v1/hosts?%s=%d&%s=%d", c.baseURL, PageQueryParam, page, CursorSizeQueryParam, size)
+
+	var hosts []HostDto
+	res, err := jsonGet(c.httpClient, targetEndpoint, map[string]string{}, &hosts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count, err := strconv.ParseInt(res.Header.Get(PaginationCountHeader), 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return hosts, count, nil
+}
+
+// GetCrawlHistory returns the summary of the crawls of given base64 encoded URL, no attempts if never crawled
+// (or if the API does not record the crawls)
+func (c *client) GetCrawlHistory(b64URL string) (CrawlHistoryDto, error) {
+	targetEndpoint := fmt.Sprintf("%s/v1/resources/%s/crawls", c.baseURL, b64URL)
+
+	var history CrawlHistoryDto
+	_, err := jsonGet(c.httpClient, targetEndpoint, map[string]string{}, &history)
+	return history, err
+}
+
+// ClientOption configure the Client
+type ClientOption func(c *client)
+
+// WithHeaders add given headers to every request made by the client
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(c *client) {
+		c.httpClient.Transport = &headerTransport{
+			base:    c.httpClient.Transport,
+			headers: headers,
+		}
+	}
+}
+
+// WithConnectTimeout set the maximum time to wait for the connection to the API to be established
+func WithConnectTimeout(timeout time.Duration) ClientOption {
+	return func(c *client) {
+		c.transport.DialContext = (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+}
+
+// WithTransport set the number of idle connections kept open to the API, which should match the number of
+// concurrent callers to avoid opening a new connection per request (default: 2). Idle connections are closed after
+// idleConnTimeout (0 means no limit). A maxConns of 0 disables the keep-alive: every request use a new connection
+func WithTransport(maxConns int, idleConnTimeout time.Duration) ClientOption {
+	return func(c *client) {
+		if maxConns <= 0 {
+			c.transport.DisableKeepAlives = true
+			return
+		}
+
+		c.transport.DisableKeepAlives = false
+		c.transport.MaxIdleConnsPerHost = maxConns
+		if c.transport.MaxIdleConns != 0 && c.transport.MaxIdleConns < maxConns {
+			c.transport.MaxIdleConns = maxConns
+		}
+		c.transport.IdleConnTimeout = idleConnTimeout
+	}
+}
+
+// WithRequestTimeout set the maximum time to wait for an API request to complete (0 means no timeout)
+func WithRequestTimeout(timeout time.Duration) ClientOption {
+	return func(c *client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithResourceBodies include the body of the resources returned by the searches
+func WithResourceBodies() ClientOption {
+	return func(c *client) {
+		c.withBody = true
+	}
+}
+
+// WithRoundTripper wrap the transport of the client using given function (e.g: to trace the requests)
+func WithRoundTripper(wrap func(base http.RoundTripper) http.RoundTripper) ClientOption {
+	return func(c *client) {
+		c.httpClient.Transport = wrap(c.httpClient.Transport)
+	}
+}
+
+// ParseHeaders parse given headers formatted as Name: value
+func ParseHeaders(values []string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid header %s (should be Name: value)", value)
+		}
+
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return headers, nil
+}
+
 // NewClient create a new Client instance to dial with the API located on given address
-func NewClient(baseURL string) Client {
-	return &client{
+func NewClient(baseURL string, opts ...ClientOption) Client {
+	// Cannot fail since no files are read
+	c, _ := NewClientWithTLS(baseURL, "", "", "", opts...)
+	return c
+}
+
+// NewClientWithTLS create a new Client instance to dial with the API located on given address
+// using given client certificate & CA certificate (PEM encoded files).
+// empty certFile & keyFile means no client certificate, empty caFile means system roots are used
+func NewClientWithTLS(baseURL, certFile, keyFile, caFile string, opts ...ClientOption) (Client, error) {
+	tlsConfig := &tls.Config{}
+
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading CA certificate: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no valid certificate found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DialContext = (&net.Dialer{
+		Timeout:   DefaultConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+
+	c := &client{
 		httpClient: &http.Client{
-			Timeout: time.Second * 10,
+			Timeout:   DefaultRequestTimeout,
+			Transport: transport,
 		},
-		baseURL: baseURL,
+		transport: transport,
+		baseURL:   baseURL,
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	return c, nil
+}
+
+// headerTransport add custom headers to the requests
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (ht *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip should not modify the request
+	req = req.Clone(req.Context())
+	for key, value := range ht.headers {
+		req.Header.Set(key, value)
+	}
+
+	return ht.base.RoundTrip(req)
 }
 
 func jsonGet(httpClient *http.Client, url string, headers map[string]string, response interface{}) (*http.Response, error) {
@@ -130,6 +714,11 @@ func jsonGet(httpClient *http.Client, url string, headers map[string]string, res
 	if err != nil {
 		return nil, err
 	}
+	defer r.Body.Close()
+
+	if err := checkResponse(r); err != nil {
+		return nil, err
+	}
 
 	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
 		return nil, err
@@ -154,6 +743,11 @@ func jsonPost(httpClient *http.Client, url string, request, response interface{}
 	if err != nil {
 		return nil, err
 	}
+	defer r.Body.Close()
+
+	if err := checkResponse(r); err != nil {
+		return nil, err
+	}
 
 	if response != nil {
 		if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
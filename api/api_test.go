@@ -0,0 +1,658 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert generate a certificate signed by parent (self-signed if parent is nil)
+func newTestCert(t *testing.T, serial int64, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.FailNow()
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "trandoshan-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         isCA,
+
+		BasicConstraintsValid: true,
+	}
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.FailNow()
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.FailNow()
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.FailNow()
+	}
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.FailNow()
+	}
+	return path
+}
+
+func TestNewClientWithTLS(t *testing.T) {
+	ca := newTestCert(t, 1, nil, true)
+	serverCert := newTestCert(t, 2, ca, false)
+	clientCert := newTestCert(t, 3, ca, false)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	tlsServerCert, err := tls.X509KeyPair(serverCert.certPEM, serverCert.keyPEM)
+	if err != nil {
+		t.FailNow()
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(PaginationCountHeader, "0")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{tlsServerCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caFile := writeFile(t, dir, "ca.pem", ca.certPEM)
+	certFile := writeFile(t, dir, "client.pem", clientCert.certPEM)
+	keyFile := writeFile(t, dir, "client-key.pem", clientCert.keyPEM)
+
+	// Valid client certificate
+	c, err := NewClientWithTLS(srv.URL, certFile, keyFile, caFile)
+	if err != nil {
+		t.FailNow()
+	}
+	if _, _, err := c.SearchResources(SearchResourcesOptions{}, 1, 1); err != nil {
+		t.Errorf("request with client certificate should succeed: %s", err)
+	}
+
+	// Missing client certificate
+	c, err = NewClientWithTLS(srv.URL, "", "", caFile)
+	if err != nil {
+		t.FailNow()
+	}
+	if _, _, err := c.SearchResources(SearchResourcesOptions{}, 1, 1); err == nil {
+		t.Error("request without client certificate should fail")
+	}
+
+	// Unknown CA
+	c, err = NewClientWithTLS(srv.URL, certFile, keyFile, "")
+	if err != nil {
+		t.FailNow()
+	}
+	if _, _, err := c.SearchResources(SearchResourcesOptions{}, 1, 1); err == nil {
+		t.Error("request with unknown server CA should fail")
+	}
+}
+
+func TestNewClientWithTLSInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	invalid := writeFile(t, dir, "invalid.pem", []byte("not a certificate"))
+
+	if _, err := NewClientWithTLS("https://localhost", "", "", filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("missing CA file should fail")
+	}
+	if _, err := NewClientWithTLS("https://localhost", "", "", invalid); err == nil {
+		t.Error("invalid CA file should fail")
+	}
+	if _, err := NewClientWithTLS("https://localhost", invalid, invalid, ""); err == nil {
+		t.Error("invalid client certificate should fail")
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	var received []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Clone())
+		w.Header().Set(PaginationCountHeader, "0")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, WithHeaders(map[string]string{
+		"Authorization": "Bearer token",
+		"X-API-Key":     "secret",
+	}))
+
+	if _, _, err := c.SearchResources(SearchResourcesOptions{}, 1, 1); err != nil {
+		t.FailNow()
+	}
+	if err := c.ScheduleURL("http://example.onion"); err != nil {
+		t.FailNow()
+	}
+
+	if len(received) != 2 {
+		t.FailNow()
+	}
+	for _, headers := range received {
+		if headers.Get("Authorization") != "Bearer token" || headers.Get("X-API-Key") != "secret" {
+			t.Errorf("missing custom headers: %v", headers)
+		}
+	}
+
+	// Client without option should not send them
+	received = nil
+	if err := NewClient(srv.URL).ScheduleURL("http://example.onion"); err != nil {
+		t.FailNow()
+	}
+	if len(received) != 1 || received[0].Get("X-API-Key") != "" {
+		t.Fail()
+	}
+}
+
+// pagedServer serve given resources by pages, using the index of the next resource as cursor
+func pagedServer(t *testing.T, resources []ResourceDto) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Paginated either using cursors or page numbers
+		start := 0
+		size, err := strconv.Atoi(r.URL.Query().Get(CursorSizeQueryParam))
+		if err != nil {
+			page, _ := strconv.Atoi(r.URL.Query().Get(PaginationPageQueryParam))
+			if size, err = strconv.Atoi(r.URL.Query().Get(PaginationSizeQueryParam)); err != nil || page < 1 {
+				t.Errorf("missing page size: %s", r.URL)
+			}
+			start = (page - 1) * size
+		}
+		if after := r.URL.Query().Get(CursorAfterQueryParam); after != "" {
+			start, _ = strconv.Atoi(after)
+		}
+		if start > len(resources) {
+			start = len(resources)
+		}
+
+		end := start + size
+		if end >= len(resources) {
+			end = len(resources)
+		} else {
+			w.Header().Set(PaginationNextHeader, strconv.Itoa(end))
+		}
+
+		w.Header().Set(PaginationCountHeader, strconv.Itoa(len(resources)))
+		_ = json.NewEncoder(w).Encode(resources[start:end])
+	}))
+}
+
+func TestSearchResourcesAfter(t *testing.T) {
+	resources := []ResourceDto{{URL: "http://a.onion"}, {URL: "http://b.onion"}, {URL: "http://c.onion"}}
+	srv := pagedServer(t, resources)
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	var urls []string
+	cursor := ""
+	for i := 0; i < 10; i++ {
+		page, next, err := c.SearchResourcesAfter(cursor, 2, SearchResourcesOptions{})
+		if err != nil {
+			t.FailNow()
+		}
+		for _, res := range page {
+			urls = append(urls, res.URL)
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if fmt.Sprint(urls) != "[http://a.onion http://b.onion http://c.onion]" {
+		t.Errorf("Got: %v", urls)
+	}
+}
+
+func TestSearchResourcesPage(t *testing.T) {
+	resources := []ResourceDto{{URL: "http://a.onion"}, {URL: "http://b.onion"}, {URL: "http://c.onion"}}
+	srv := pagedServer(t, resources)
+	defer srv.Close()
+
+	calls := 0
+	c := NewClient(srv.URL, WithRoundTripper(func(base http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return base.RoundTrip(req)
+		})
+	}))
+
+	// The page is requested directly rather than by following the cursors
+	page, count, err := c.SearchResources(SearchResourcesOptions{}, 2, 2)
+	if err != nil {
+		t.FailNow()
+	}
+	if count != 3 || len(page) != 1 || page[0].URL != "http://c.onion" {
+		t.Errorf("Got: %v (count: %d)", page, count)
+	}
+	if calls != 1 {
+		t.Errorf("Wanted: 1 request Got: %d", calls)
+	}
+
+	// Page after the last one
+	page, count, err = c.SearchResources(SearchResourcesOptions{}, 5, 2)
+	if err != nil || count != 3 || len(page) != 0 {
+		t.Errorf("Got: %v (count: %d)", page, count)
+	}
+}
+
+func TestSearchResourcesTitle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if title := r.URL.Query().Get("title"); title != "hidden wiki & co" {
+			t.Errorf("Wanted: hidden wiki & co Got: %s", title)
+		}
+		w.Header().Set(PaginationCountHeader, "0")
+		_ = json.NewEncoder(w).Encode([]ResourceDto{})
+	}))
+	defer srv.Close()
+
+	if _, _, err := NewClient(srv.URL).SearchResources(SearchResourcesOptions{Title: "hidden wiki & co"}, 1, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchResourcesLanguage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if language := r.URL.Query().Get(LanguageQueryParam); language != "zh-Hant" {
+			t.Errorf("Wanted: zh-Hant Got: %s", language)
+		}
+		w.Header().Set(PaginationCountHeader, "1")
+		_ = json.NewEncoder(w).Encode([]ResourceDto{{URL: "example.onion", Language: "zh-Hant"}})
+	}))
+	defer srv.Close()
+
+	res, _, err := NewClient(srv.URL).SearchResources(SearchResourcesOptions{Language: "zh-Hant"}, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Language != "zh-Hant" {
+		t.Errorf("unexpected resources: %+v", res)
+	}
+}
+
+func TestSearchResourcesCharset(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if charset := r.URL.Query().Get(CharsetQueryParam); charset != "windows-1252" {
+			t.Errorf("Wanted: windows-1252 Got: %s", charset)
+		}
+		w.Header().Set(PaginationCountHeader, "1")
+		_ = json.NewEncoder(w).Encode([]ResourceDto{{URL: "example.onion", Charset: "windows-1252"}})
+	}))
+	defer srv.Close()
+
+	res, _, err := NewClient(srv.URL).Search(NewFilter().Charset("windows-1252"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Charset != "windows-1252" {
+		t.Errorf("unexpected resources: %+v", res)
+	}
+}
+
+func TestSearchResourcesSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if source := r.URL.Query().Get(SourceQueryParam); source != "manual" {
+			t.Errorf("Wanted: manual Got: %s", source)
+		}
+		w.Header().Set(PaginationCountHeader, "1")
+		_ = json.NewEncoder(w).Encode([]ResourceDto{{URL: "example.onion", Source: "manual"}})
+	}))
+	defer srv.Close()
+
+	res, _, err := NewClient(srv.URL).SearchResources(SearchResourcesOptions{Source: "manual"}, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Source != "manual" {
+		t.Errorf("unexpected resources: %+v", res)
+	}
+}
+
+func TestSearchResourcesSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if minSize := r.URL.Query().Get(MinSizeQueryParam); minSize != "100" {
+			t.Errorf("Wanted: 100 Got: %s", minSize)
+		}
+		if maxSize, found := r.URL.Query()[MaxSizeQueryParam]; found {
+			t.Errorf("Unexpected max size: %s", maxSize)
+		}
+		w.Header().Set(PaginationCountHeader, "0")
+		_ = json.NewEncoder(w).Encode([]ResourceDto{})
+	}))
+	defer srv.Close()
+
+	if _, _, err := NewClient(srv.URL).SearchResources(SearchResourcesOptions{MinSize: 100}, 1, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchResourcesByContentHash(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hash := r.URL.Query().Get(ContentHashQueryParam); hash != "abc" {
+			t.Errorf("Wanted: abc Got: %s", hash)
+		}
+		if size := r.URL.Query().Get(CursorSizeQueryParam); size != "1" {
+			t.Errorf("Wanted: 1 Got: %s", size)
+		}
+		w.Header().Set(PaginationCountHeader, "2")
+		_ = json.NewEncoder(w).Encode([]ResourceDto{{URL: "canonical.onion", ContentHash: "abc"}})
+	}))
+	defer srv.Close()
+
+	resources, err := NewClient(srv.URL).SearchResourcesByContentHash("abc", 1)
+	if err != nil {
+		t.FailNow()
+	}
+	if len(resources) != 1 || resources[0].URL != "canonical.onion" {
+		t.Errorf("Got: %+v", resources)
+	}
+}
+
+func TestGetResource(t *testing.T) {
+	b64URL := EncodeURL("http://example.onion")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/resources/" + b64URL:
+			_ = json.NewEncoder(w).Encode(ResourceDto{URL: "http://example.onion", Title: "Example"})
+		case "/v1/resources/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	res, err := c.GetResource(b64URL)
+	if err != nil || res == nil {
+		t.FailNow()
+	}
+	if res.URL != "http://example.onion" || res.Title != "Example" {
+		t.Errorf("Got: %+v", res)
+	}
+
+	// Not crawled
+	if res, err := c.GetResource("bm90LWNyYXdsZWQ="); err != nil || res != nil {
+		t.Errorf("missing resource should return nil (got %+v, %v)", res, err)
+	}
+
+	if _, err := c.GetResource("error"); err == nil {
+		t.Error("server error should be returned")
+	}
+}
+
+func TestDeleteResource(t *testing.T) {
+	b64URL := EncodeURL("http://example.onion")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/resources/" + b64URL:
+			w.WriteHeader(http.StatusNoContent)
+		case "/v1/resources/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	if err := c.DeleteResource(b64URL); err != nil {
+		t.Error(err)
+	}
+
+	// Already deleted
+	if err := c.DeleteResource("bm90LWNyYXdsZWQ="); err != nil {
+		t.Errorf("missing resource should not be an error (got %v)", err)
+	}
+
+	if err := c.DeleteResource("error"); err == nil {
+		t.Error("server error should be returned")
+	}
+}
+
+// esLatency simulate the duration of an Elasticsearch query: searching resources
+// require two queries (count & search) while getting a resource only require one
+const esLatency = time.Millisecond
+
+func benchmarkServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource := ResourceDto{URL: "http://example.onion", Time: time.Now()}
+		if r.URL.Path == "/v1/resources" {
+			time.Sleep(2 * esLatency)
+			w.Header().Set(PaginationCountHeader, "1")
+			_ = json.NewEncoder(w).Encode([]ResourceDto{resource})
+			return
+		}
+
+		time.Sleep(esLatency)
+		_ = json.NewEncoder(w).Encode(resource)
+	}))
+}
+
+func BenchmarkSearchResources(b *testing.B) {
+	srv := benchmarkServer()
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	b64URL := EncodeURL("http://example.onion")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := c.SearchResources(SearchResourcesOptions{URL: b64URL}, 1, 1); err != nil {
+			b.FailNow()
+		}
+	}
+}
+
+func BenchmarkGetResource(b *testing.B) {
+	srv := benchmarkServer()
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	b64URL := EncodeURL("http://example.onion")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.GetResource(b64URL); err != nil {
+			b.FailNow()
+		}
+	}
+}
+
+// roundTripperFunc is an http.RoundTripper calling itself
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	cancelled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, WithRequestTimeout(100*time.Millisecond))
+
+	start := time.Now()
+	if _, err := c.GetResource("aHR0cDovL2V4YW1wbGUub25pb24="); err == nil {
+		t.Error("request should have timed out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request should have been cancelled after 100ms (took %s)", elapsed)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("request should have been cancelled on the server side")
+	}
+}
+
+func TestWithConnectTimeout(t *testing.T) {
+	// Non-routable address: the connection is never established
+	c := NewClient("http://10.255.255.1", WithConnectTimeout(100*time.Millisecond),
+		WithRequestTimeout(5*time.Second))
+
+	start := time.Now()
+	if _, err := c.GetResource("aHR0cDovL2V4YW1wbGUub25pb24="); err == nil {
+		t.Error("connection should have timed out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("connection should have been cancelled after 100ms (took %s)", elapsed)
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	var mutex sync.Mutex
+	conns := 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mutex.Lock()
+			defer mutex.Unlock()
+			conns++
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	// countConns returns the number of connections opened by given client to make requests from concurrent callers
+	countConns := func(c Client, callers int) int {
+		mutex.Lock()
+		conns = 0
+		mutex.Unlock()
+
+		var wg sync.WaitGroup
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					_, _ = c.GetResource("aHR0cDovL2V4YW1wbGUub25pb24=")
+				}
+			}()
+		}
+		wg.Wait()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		return conns
+	}
+
+	if count := countConns(NewClient(srv.URL, WithTransport(8, time.Minute)), 8); count > 8 {
+		t.Errorf("Wanted: at most 8 connections Got: %d", count)
+	}
+	if count := countConns(NewClient(srv.URL, WithTransport(0, time.Minute)), 1); count != 10 {
+		t.Errorf("Wanted: 10 connections Got: %d", count)
+	}
+}
+
+func TestWithRoundTripper(t *testing.T) {
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer srv.Close()
+
+	wrapped := 0
+	c := NewClient(srv.URL, WithRoundTripper(func(base http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			wrapped++
+			req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+			return base.RoundTrip(req)
+		})
+	}))
+
+	if err := c.ScheduleURL("http://example.onion"); err != nil {
+		t.FailNow()
+	}
+	if wrapped != 1 || traceparent == "" {
+		t.Errorf("request should have been made using the wrapped transport (calls: %d)", wrapped)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders([]string{"X-API-Key: secret", "Authorization:Bearer a:b"})
+	if err != nil {
+		t.FailNow()
+	}
+	if len(headers) != 2 || headers["X-API-Key"] != "secret" || headers["Authorization"] != "Bearer a:b" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+
+	for _, invalid := range []string{"X-API-Key", ": value"} {
+		if _, err := ParseHeaders([]string{invalid}); err == nil {
+			t.Errorf("%s should not be a valid header", invalid)
+		}
+	}
+}
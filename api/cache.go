@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	lru "github.com/hashicorp/golang-lru"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// bulkSearchPath is the path of the bulk search endpoint, read-only despite using POST
+const bulkSearchPath = "/v1/resources/search/bulk"
+
+// dateQueryParams are the query parameters truncated by the cache key
+var dateQueryParams = []string{"start-date", "end-date"}
+
+// WithCache keep the JSON responses of up to size GET requests in memory for given ttl, keyed on the request URL
+// with its query parameters sorted and its dates truncated to the ttl (so that the searches made relative to the
+// current time, e.g: the refresh delay lookups, share their entry), unless the server forbids it using
+// Cache-Control: no-store. The cache is cleared by the requests made by the client
+// which may change the resources (POST, PUT, DELETE...), the bulk searches excepted. A size of 0 disables the cache
+func WithCache(size int, ttl time.Duration) ClientOption {
+	return func(c *client) {
+		if size <= 0 || ttl <= 0 {
+			return
+		}
+
+		// Cannot fail since size is positive
+		cache, _ := lru.New(size)
+		c.httpClient.Transport = &cacheTransport{
+			base:  c.httpClient.Transport,
+			cache: cache,
+			ttl:   ttl,
+			now:   time.Now,
+		}
+	}
+}
+
+// cachedResponse is a response kept by the cache
+type cachedResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+	expiresAt  time.Time
+}
+
+// cacheTransport returns the cached responses of the GET requests while they are fresh
+type cacheTransport struct {
+	base  http.RoundTripper
+	cache *lru.Cache
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+func (ct *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		if mutating(req) {
+			ct.cache.Purge()
+		}
+		return ct.base.RoundTrip(req)
+	}
+
+	key := cacheKey(req.URL, ct.ttl)
+	if value, exists := ct.cache.Get(key); exists {
+		cached := value.(*cachedResponse)
+		if ct.now().Before(cached.expiresAt) {
+			return cached.response(req), nil
+		}
+		ct.cache.Remove(key)
+	}
+
+	res, err := ct.base.RoundTrip(req)
+	if err != nil || !cacheable(res) {
+		return res, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := &cachedResponse{
+		statusCode: res.StatusCode,
+		header:     res.Header,
+		body:       body,
+		expiresAt:  ct.now().Add(ct.ttl),
+	}
+	ct.cache.Add(key, cached)
+
+	return cached.response(req), nil
+}
+
+// cacheKey returns the key of given request URL: its query parameters are sorted and the dates truncated to given
+// granularity, the invalid ones being kept as is
+func cacheKey(u *url.URL, granularity time.Duration) string {
+	params := u.Query()
+	for _, param := range dateQueryParams {
+		date, err := time.Parse(time.RFC3339, params.Get(param))
+		if err != nil {
+			continue
+		}
+		params.Set(param, date.Truncate(granularity).Format(time.RFC3339))
+	}
+
+	key := *u
+	key.RawQuery = params.Encode()
+	return key.String()
+}
+
+// mutating returns true if given request may change the resources: the POST requests other than the bulk searches,
+// and the PUT, PATCH & DELETE requests
+func mutating(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	case http.MethodPost:
+		return !strings.HasSuffix(req.URL.Path, bulkSearchPath)
+	default:
+		return true
+	}
+}
+
+// response returns a new response to given request
+func (cr *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", cr.statusCode, http.StatusText(cr.statusCode)),
+		StatusCode:    cr.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cr.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(cr.body)),
+		ContentLength: int64(len(cr.body)),
+		Request:       req,
+	}
+}
+
+// cacheable returns true if given response is a successful JSON response that may be stored
+func cacheable(res *http.Response) bool {
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err != nil ||
+		mediaType != "application/json" {
+		return false
+	}
+
+	for _, directive := range strings.Split(res.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return false
+		}
+	}
+
+	return true
+}
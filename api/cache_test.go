@@ -0,0 +1,165 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCachedClient returns a client caching the responses of given handler, with the number of requests received
+// by the server and a function moving the clock of the cache forward
+func newCachedClient(t *testing.T, handler http.HandlerFunc) (Client, *int64, func(time.Duration)) {
+	var calls int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Now()
+	c := NewClient(srv.URL, WithCache(10, time.Minute)).(*client)
+	c.httpClient.Transport.(*cacheTransport).now = func() time.Time { return now }
+
+	return c, &calls, func(d time.Duration) { now = now.Add(d) }
+}
+
+func writeResources(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if r.Method == http.MethodPost {
+		_, _ = w.Write([]byte("{}"))
+		return
+	}
+
+	w.Header().Set(PaginationCountHeader, "1")
+	_, _ = w.Write([]byte(`[{"url":"` + r.URL.Query().Get("url") + `"}]`))
+}
+
+func TestWithCache(t *testing.T) {
+	c, calls, advance := newCachedClient(t, writeResources)
+
+	search := func(url string) {
+		resources, count, err := c.Search(NewFilter().URL(url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 || len(resources) != 1 || resources[0].URL != url {
+			t.Errorf("unexpected search result: %d %+v", count, resources)
+		}
+	}
+
+	search("aHR0cDovL2Eub25pb24=")
+	search("aHR0cDovL2Eub25pb24=")
+	if *calls != 1 {
+		t.Errorf("Wanted: 1 call Got: %d", *calls)
+	}
+
+	// Requests are keyed on their URL
+	search("aHR0cDovL2Iub25pb24=")
+	if *calls != 2 {
+		t.Errorf("Wanted: 2 calls Got: %d", *calls)
+	}
+
+	// Responses expire after the TTL
+	advance(59 * time.Second)
+	search("aHR0cDovL2Eub25pb24=")
+	if *calls != 2 {
+		t.Errorf("Wanted: 2 calls Got: %d", *calls)
+	}
+	advance(time.Second)
+	search("aHR0cDovL2Eub25pb24=")
+	if *calls != 3 {
+		t.Errorf("Wanted: 3 calls Got: %d", *calls)
+	}
+
+	// Bulk searches don't change the resources
+	if _, err := c.SearchResourcesBulk([]string{"aHR0cDovL2Eub25pb24="}, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	search("aHR0cDovL2Eub25pb24=")
+	if *calls != 4 {
+		t.Errorf("Wanted: 4 calls Got: %d", *calls)
+	}
+
+	// Writes clear the cache
+	if _, err := c.AddResource(ResourceDto{URL: "http://a.onion"}); err != nil {
+		t.Fatal(err)
+	}
+	search("aHR0cDovL2Eub25pb24=")
+	if *calls != 6 {
+		t.Errorf("Wanted: 6 calls Got: %d", *calls)
+	}
+}
+
+func TestWithCacheDates(t *testing.T) {
+	c, calls, _ := newCachedClient(t, writeResources)
+
+	// The lookups made a few seconds apart share the same key
+	now := time.Date(2021, 1, 1, 10, 0, 5, 0, time.UTC)
+	for _, offset := range []time.Duration{0, time.Second, 50 * time.Second} {
+		startDate := now.Add(offset)
+		if _, _, err := c.Search(NewFilter().URL("aHR0cDovL2Eub25pb24=").After(startDate)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("Wanted: 1 call Got: %d", *calls)
+	}
+
+	// Dates in another TTL window are searched again
+	if _, _, err := c.Search(NewFilter().URL("aHR0cDovL2Eub25pb24=").After(now.Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("Wanted: 2 calls Got: %d", *calls)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	u, _ := url.Parse("http://api/v1/resources?url=a&start-date=2021-01-01T10%3A00%3A42Z&end-date=invalid")
+	want := "http://api/v1/resources?end-date=invalid&start-date=2021-01-01T10%3A00%3A00Z&url=a"
+	if key := cacheKey(u, time.Minute); key != want {
+		t.Errorf("Wanted: %s Got: %s", want, key)
+	}
+}
+
+func TestWithCacheNotCacheable(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"no-store", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "private, no-store")
+			writeResources(w, r)
+		}},
+		{"error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}},
+		{"not JSON", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set(PaginationCountHeader, "0")
+			_, _ = w.Write([]byte("[]"))
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, calls, _ := newCachedClient(t, test.handler)
+
+			_, _, _ = c.Search(NewFilter())
+			_, _, _ = c.Search(NewFilter())
+			if *calls != 2 {
+				t.Errorf("Wanted: 2 calls Got: %d", *calls)
+			}
+		})
+	}
+}
+
+func TestWithCacheDisabled(t *testing.T) {
+	c := NewClient("http://localhost", WithCache(0, time.Minute)).(*client)
+	if _, ok := c.httpClient.Transport.(*cacheTransport); ok {
+		t.Error("cache should be disabled")
+	}
+}
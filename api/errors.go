@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySize is the maximum number of bytes of the response body kept in a ServerError
+const maxErrorBodySize = 1024
+
+// NotFoundError is returned when the requested API resource does not exist (404)
+type NotFoundError struct {
+	URL string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s not found", e.URL)
+}
+
+// RateLimitedError is returned when the API rejects the request because too many requests have been made (429)
+type RateLimitedError struct {
+	// RetryAfter is the delay to wait before retrying, as given by the Retry-After header (0 if missing)
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter == 0 {
+		return "rate limited"
+	}
+	return fmt.Sprintf("rate limited, retry after %s", e.RetryAfter)
+}
+
+// ServerError is returned when the API answers with an unexpected status code (e.g: 500 or 503)
+type ServerError struct {
+	StatusCode int
+	// Body is the beginning of the response body
+	Body string
+}
+
+func (e *ServerError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
+// checkResponse returns the error matching the status code of given response, nil if successful
+func checkResponse(r *http.Response) error {
+	switch {
+	case r.StatusCode >= 200 && r.StatusCode < 300:
+		return nil
+	case r.StatusCode == http.StatusNotFound:
+		return &NotFoundError{URL: r.Request.URL.String()}
+	case r.StatusCode == http.StatusTooManyRequests:
+		return &RateLimitedError{RetryAfter: parseRetryAfter(r.Header.Get("Retry-After"), time.Now())}
+	default:
+		b, _ := ioutil.ReadAll(io.LimitReader(r.Body, maxErrorBodySize))
+		return &ServerError{StatusCode: r.StatusCode, Body: strings.TrimSpace(string(b))}
+	}
+}
+
+// parseRetryAfter returns the delay given by a Retry-After header (delay in seconds or HTTP date),
+// 0 if missing or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
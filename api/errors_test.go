@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientNotFoundError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	_, err := c.GetStats()
+	var notFoundErr *NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Fatalf("Wanted: NotFoundError Got: %v", err)
+	}
+	if notFoundErr.URL != srv.URL+"/v1/stats" {
+		t.Errorf("Wanted: %s/v1/stats Got: %s", srv.URL, notFoundErr.URL)
+	}
+
+	// An URL never crawled is not an error
+	if res, err := c.GetResource("dGVzdA=="); res != nil || err != nil {
+		t.Errorf("Wanted: nil, nil Got: %v, %v", res, err)
+	}
+	if err := c.DeleteResource("dGVzdA=="); err != nil {
+		t.Errorf("Wanted: nil Got: %v", err)
+	}
+}
+
+func TestClientRateLimitedError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	calls := map[string]func() error{
+		"SearchResources": func() error {
+			_, _, err := c.SearchResources(SearchResourcesOptions{}, 1, 1)
+			return err
+		},
+		"GetResource": func() error {
+			_, err := c.GetResource("dGVzdA==")
+			return err
+		},
+		"ScheduleURL": func() error {
+			return c.ScheduleURL("http://example.onion")
+		},
+	}
+
+	for name, call := range calls {
+		var rateLimitedErr *RateLimitedError
+		if err := call(); !errors.As(err, &rateLimitedErr) {
+			t.Errorf("%s: Wanted: RateLimitedError Got: %v", name, err)
+			continue
+		}
+		if rateLimitedErr.RetryAfter != 2*time.Minute {
+			t.Errorf("%s: Wanted: 2m0s Got: %s", name, rateLimitedErr.RetryAfter)
+		}
+	}
+}
+
+func TestClientServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("elasticsearch is down\n" + strings.Repeat("a", 2*maxErrorBodySize)))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	calls := map[string]func() error{
+		"AddResource": func() error {
+			_, err := c.AddResource(ResourceDto{URL: "http://example.onion"})
+			return err
+		},
+		"DeleteResource": func() error {
+			return c.DeleteResource("dGVzdA==")
+		},
+		"SearchResourcesBulk": func() error {
+			_, err := c.SearchResourcesBulk([]string{"dGVzdA=="}, time.Time{}, time.Time{})
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		var serverErr *ServerError
+		if err := call(); !errors.As(err, &serverErr) {
+			t.Errorf("%s: Wanted: ServerError Got: %v", name, err)
+			continue
+		}
+		if serverErr.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s: Wanted: 503 Got: %d", name, serverErr.StatusCode)
+		}
+		if !strings.HasPrefix(serverErr.Body, "elasticsearch is down") || len(serverErr.Body) > maxErrorBodySize {
+			t.Errorf("%s: unexpected body (%d bytes): %.30s", name, len(serverErr.Body), serverErr.Body)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"0":                             0,
+		"-5":                            0,
+		"Fri, 01 Jan 2021 12:01:30 GMT": 90 * time.Second,
+		"Fri, 01 Jan 2021 11:00:00 GMT": 0,
+		"tomorrow":                      0,
+	}
+
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("%q: Wanted: %s Got: %s", value, want, got)
+		}
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	tests := map[error]string{
+		&NotFoundError{URL: "http://api/v1/stats"}:         "http://api/v1/stats not found",
+		&RateLimitedError{}:                                "rate limited",
+		&RateLimitedError{RetryAfter: time.Second}:         "rate limited, retry after 1s",
+		&ServerError{StatusCode: 500}:                      "unexpected status code 500",
+		&ServerError{StatusCode: 503, Body: "maintenance"}: "unexpected status code 503: maintenance",
+	}
+
+	for err, want := range tests {
+		if err.Error() != want {
+			t.Errorf("Wanted: %s Got: %s", want, err.Error())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultFilterPageSize is the page size of the filters whose pagination is not set
+const DefaultFilterPageSize = 20
+
+// ResourceFilter select the resources to search, built using method chaining:
+//
+//	api.NewFilter().Keywords("market").After(t1).Before(t2).MinSize(100).Page(1, 20)
+//
+// Each method returns a modified copy: a filter can be used as the base of several others
+type ResourceFilter struct {
+	opts SearchResourcesOptions
+	page int
+	size int
+}
+
+// NewFilter returns a filter matching every resource, returning their first page
+func NewFilter() ResourceFilter {
+	return ResourceFilter{page: 1, size: DefaultFilterPageSize}
+}
+
+// URL select the resources with given base64 encoded URL
+func (f ResourceFilter) URL(b64URL string) ResourceFilter {
+	f.opts.URL = b64URL
+	return f
+}
+
+// Keywords select the resources whose body contains given keywords
+func (f ResourceFilter) Keywords(keywords string) ResourceFilter {
+	f.opts.Keyword = keywords
+	return f
+}
+
+// Title select the resources whose title contains given text
+func (f ResourceFilter) Title(title string) ResourceFilter {
+	f.opts.Title = title
+	return f
+}
+
+// Language select the resources whose body is written in the language with given BCP-47 code
+func (f ResourceFilter) Language(language string) ResourceFilter {
+	f.opts.Language = language
+	return f
+}
+
+// Charset select the resources whose body has been decoded from given charset (e.g: utf-8 or windows-1252)
+func (f ResourceFilter) Charset(charset string) ResourceFilter {
+	f.opts.Charset = charset
+	return f
+}
+
+// ExtractedKeywords select the resources having every given keyword among their extracted keywords
+func (f ResourceFilter) ExtractedKeywords(keywords ...string) ResourceFilter {
+	f.opts.ExtractedKeywords = append([]string(nil), keywords...)
+	return f
+}
+
+// Source select the resources whose URL has been discovered from given source (e.g: crawler, seed or manual)
+func (f ResourceFilter) Source(source string) ResourceFilter {
+	f.opts.Source = source
+	return f
+}
+
+// ResponseCode select the resources whose response had given HTTP status code
+func (f ResourceFilter) ResponseCode(code int) ResourceFilter {
+	f.opts.ResponseCode = code
+	return f
+}
+
+// MinSize select the resources whose body is at least given size (in bytes)
+func (f ResourceFilter) MinSize(size int64) ResourceFilter {
+	f.opts.MinSize = size
+	return f
+}
+
+// MaxSize select the resources whose body is at most given size (in bytes)
+func (f ResourceFilter) MaxSize(size int64) ResourceFilter {
+	f.opts.MaxSize = size
+	return f
+}
+
+// After select the resources crawled after given time
+func (f ResourceFilter) After(t time.Time) ResourceFilter {
+	f.opts.StartDate = t
+	return f
+}
+
+// Before select the resources crawled before given time
+func (f ResourceFilter) Before(t time.Time) ResourceFilter {
+	f.opts.EndDate = t
+	return f
+}
+
+// Page select the page of resources to return (starting at 1) and its size
+func (f ResourceFilter) Page(page, size int) ResourceFilter {
+	f.page = page
+	f.size = size
+	return f
+}
+
+// Options returns the search options of the filter
+func (f ResourceFilter) Options() SearchResourcesOptions {
+	return f.opts
+}
+
+// Pagination returns the page (starting at 1) and page size selected by the filter
+func (f ResourceFilter) Pagination() (int, int) {
+	return f.page, f.size
+}
+
+// Query returns the query parameters of the search request of the filter, without the pagination cursor
+func (f ResourceFilter) Query() url.Values {
+	params := f.opts.query()
+	if f.size != 0 {
+		params.Set(CursorSizeQueryParam, strconv.Itoa(f.size))
+	}
+
+	return params
+}
+
+// Search returns the resources selected by given filter, and the total count of matching resources
+func (c *client) Search(filter ResourceFilter) ([]ResourceDto, int64, error) {
+	params := url.Values{}
+	params.Set(PaginationPageQueryParam, strconv.Itoa(filter.page))
+	params.Set(PaginationSizeQueryParam, strconv.Itoa(filter.size))
+
+	resources, _, count, err := c.search(params, filter.opts)
+	return resources, count, err
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResourceFilterQuery(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 2, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		filter ResourceFilter
+		want   string
+	}{
+		{NewFilter(), "size=20"},
+		{
+			NewFilter().URL("aHR0cDovL2V4YW1wbGUub25pb24=").Keywords("silk road").Page(1, 10),
+			"keyword=silk+road&size=10&url=aHR0cDovL2V4YW1wbGUub25pb24%3D",
+		},
+		{
+			NewFilter().After(start).Before(end),
+			"end-date=2021-02-01T12%3A30%3A00Z&size=20&start-date=2021-01-01T00%3A00%3A00Z",
+		},
+		{
+			NewFilter().Title("hidden wiki & co").Language("en").Source("seed").MinSize(100).MaxSize(2048),
+			"language=en&max-size=2048&min-size=100&size=20&source=seed&title=hidden+wiki+%26+co",
+		},
+		{
+			NewFilter().ResponseCode(404),
+			"response_code=404&size=20",
+		},
+		{
+			NewFilter().Charset("utf-16le"),
+			"charset=utf-16le&size=20",
+		},
+		{
+			NewFilter().ExtractedKeywords("market", "bitcoin"),
+			"extracted_keywords=market%2Cbitcoin&size=20",
+		},
+	}
+	for _, test := range tests {
+		if query := test.filter.Query().Encode(); query != test.want {
+			t.Errorf("Wanted: %s Got: %s", test.want, query)
+		}
+	}
+}
+
+func TestResourceFilterCopy(t *testing.T) {
+	base := NewFilter().Keywords("market")
+	withSize := base.MinSize(100)
+
+	if base.Options().MinSize != 0 {
+		t.Error("base filter should not have been modified")
+	}
+	if opts := withSize.Options(); opts.Keyword != "market" || opts.MinSize != 100 {
+		t.Errorf("Got: %+v", opts)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keyword := r.URL.Query().Get("keyword"); keyword != "silk" {
+			t.Errorf("Wanted: silk Got: %s", keyword)
+		}
+		if minSize := r.URL.Query().Get(MinSizeQueryParam); minSize != "100" {
+			t.Errorf("Wanted: 100 Got: %s", minSize)
+		}
+		if page := r.URL.Query().Get(PaginationPageQueryParam); page != "2" {
+			t.Errorf("Wanted: 2 Got: %s", page)
+		}
+		if size := r.URL.Query().Get(PaginationSizeQueryParam); size != "5" {
+			t.Errorf("Wanted: 5 Got: %s", size)
+		}
+		w.Header().Set(PaginationCountHeader, "1")
+		_ = json.NewEncoder(w).Encode([]ResourceDto{{URL: "example.onion"}})
+	}))
+	defer srv.Close()
+
+	res, count, err := NewClient(srv.URL).Search(NewFilter().Keywords("silk").MinSize(100).Page(2, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || len(res) != 1 || res[0].URL != "example.onion" {
+		t.Errorf("unexpected resources: %+v (count: %d)", res, count)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+// DefaultLocalURI is the address of the API server started locally (e.g: using docker compose)
+const DefaultLocalURI = "http://localhost:15005"
+
+// GetClientFlags returns the flags configuring the client created by NewClientFromContext. --api-uri is required
+func GetClientFlags() []cli.Flag {
+	return clientFlags(&cli.StringFlag{
+		Name:     "api-uri",
+		Usage:    "URI to the API server",
+		Required: true,
+	})
+}
+
+// GetLocalClientFlags returns the flags of GetClientFlags, --api-uri defaulting to DefaultLocalURI
+// (e.g: for the command line tools)
+func GetLocalClientFlags() []cli.Flag {
+	return clientFlags(&cli.StringFlag{
+		Name:  "api-uri",
+		Usage: "URI to the API server",
+		Value: DefaultLocalURI,
+	})
+}
+
+func clientFlags(uriFlag cli.Flag) []cli.Flag {
+	return []cli.Flag{
+		uriFlag,
+		&cli.StringFlag{
+			Name:  "api-cert",
+			Usage: "Path to the client certificate used to authenticate against the API server",
+		},
+		&cli.StringFlag{
+			Name:  "api-key",
+			Usage: "Path to the client certificate key used to authenticate against the API server",
+		},
+		&cli.StringFlag{
+			Name:  "api-ca",
+			Usage: "Path to the CA certificate used to verify the API server (default to system roots)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "api-header",
+			Usage: "Header to add to every request made to the API server (e.g: X-API-Key: secret). Can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "api-hmac-secret",
+			Usage: "Shared secret used to sign the requests made to the API server",
+		},
+		&cli.DurationFlag{
+			Name:  "api-connect-timeout",
+			Usage: "Maximum time to wait for the connection to the API server to be established",
+			Value: DefaultConnectTimeout,
+		},
+		&cli.DurationFlag{
+			Name:  "api-request-timeout",
+			Usage: "Maximum time to wait for a request to the API server to complete (0 = no timeout)",
+			Value: DefaultRequestTimeout,
+		},
+		&cli.IntFlag{
+			Name:  "api-rate-limit-retries",
+			Usage: "Number of times a request rate limited by the API server (429) is retried after the delay it gives",
+			Value: DefaultRetryCount,
+		},
+	}
+}
+
+// NewClientFromContext create a new Client instance using the flags returned by GetClientFlags.
+// given options are applied after the ones set by the flags
+func NewClientFromContext(ctx *cli.Context, opts ...ClientOption) (Client, error) {
+	headers, err := ParseHeaders(ctx.StringSlice("api-header"))
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append([]ClientOption{
+		WithHeaders(headers),
+		WithHMAC(ctx.String("api-hmac-secret")),
+		WithConnectTimeout(ctx.Duration("api-connect-timeout")),
+		WithRequestTimeout(ctx.Duration("api-request-timeout")),
+		WithRetry(ctx.Int("api-rate-limit-retries")),
+	}, opts...)
+
+	return NewClientWithTLS(ctx.String("api-uri"), ctx.String("api-cert"), ctx.String("api-key"),
+		ctx.String("api-ca"), opts...)
+}
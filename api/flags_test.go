@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/urfave/cli/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClientFromContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("X-API-Key"); key != "secret" {
+			t.Errorf("Wanted: secret Got: %s", key)
+		}
+		if r.Header.Get(SignatureHeader) == "" {
+			t.Error("request should be signed")
+		}
+		if r.URL.Query().Get("with-body") != "true" {
+			t.Error("extra options should be applied")
+		}
+		w.Header().Set(PaginationCountHeader, "0")
+		_ = json.NewEncoder(w).Encode([]ResourceDto{})
+	}))
+	defer srv.Close()
+
+	called := false
+	app := &cli.App{
+		Flags: GetClientFlags(),
+		Action: func(ctx *cli.Context) error {
+			called = true
+			c, err := NewClientFromContext(ctx, WithResourceBodies())
+			if err != nil {
+				return err
+			}
+			_, _, err = c.Search(NewFilter())
+			return err
+		},
+	}
+
+	args := []string{"app", "--api-uri", srv.URL, "--api-header", "X-API-Key: secret", "--api-hmac-secret", "hmac"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Error("action should have been called")
+	}
+
+	// Invalid headers are rejected
+	app.Action = func(ctx *cli.Context) error {
+		_, err := NewClientFromContext(ctx)
+		return err
+	}
+	if err := app.Run([]string{"app", "--api-uri", srv.URL, "--api-header", "invalid"}); err == nil {
+		t.Error("invalid header should be rejected")
+	}
+}
+
+func TestGetLocalClientFlags(t *testing.T) {
+	app := &cli.App{
+		Flags: GetLocalClientFlags(),
+		Action: func(ctx *cli.Context) error {
+			if uri := ctx.String("api-uri"); uri != DefaultLocalURI {
+				t.Errorf("Wanted: %s Got: %s", DefaultLocalURI, uri)
+			}
+			return nil
+		},
+	}
+
+	if err := app.Run([]string{"app"}); err != nil {
+		t.Fatal(err)
+	}
+}
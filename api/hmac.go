@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// TimestampHeader is the header containing the time (unix seconds) at which the request has been signed
+	TimestampHeader = "X-Timestamp"
+	// SignatureHeader is the header containing the HMAC-SHA256 signature of the request (hex encoded)
+	SignatureHeader = "X-Signature"
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of given request parts using given secret.
+// the request URI is the path along with the query string (e.g: /v1/resources?size=10)
+func Sign(secret, method, requestURI, timestamp string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + timestamp + "\n" + hex.EncodeToString(bodySum[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WithHMAC sign every request made by the client using given shared secret (empty secret means no signature)
+func WithHMAC(secret string) ClientOption {
+	return func(c *client) {
+		if secret == "" {
+			return
+		}
+
+		c.httpClient.Transport = &hmacTransport{
+			base:   c.httpClient.Transport,
+			secret: secret,
+			now:    time.Now,
+		}
+	}
+}
+
+// hmacTransport add the timestamp & signature headers to the requests
+type hmacTransport struct {
+	base   http.RoundTripper
+	secret string
+	now    func() time.Time
+}
+
+func (ht *hmacTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip should not modify the request
+	req = req.Clone(req.Context())
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		body = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	timestamp := strconv.FormatInt(ht.now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(ht.secret, req.Method, req.URL.RequestURI(), timestamp, body))
+
+	return ht.base.RoundTrip(req)
+}
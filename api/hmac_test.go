@@ -0,0 +1,61 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWithHMAC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestamp := r.Header.Get(TimestampHeader)
+		signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(signedAt, 0)) > time.Minute {
+			t.Errorf("invalid timestamp: %s", timestamp)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if want := Sign("secret", r.Method, r.URL.RequestURI(), timestamp, body); r.Header.Get(SignatureHeader) != want {
+			t.Errorf("%s %s: Wanted: %s Got: %s", r.Method, r.URL, want, r.Header.Get(SignatureHeader))
+		}
+		if r.Method == http.MethodPost && string(body) != `"http://example.onion"` {
+			t.Errorf("body should be sent unchanged, got: %s", body)
+		}
+
+		w.Header().Set(PaginationCountHeader, "0")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, WithHMAC("secret"))
+	if err := c.ScheduleURL("http://example.onion"); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := c.SearchResources(SearchResourcesOptions{Keyword: "keyword"}, 1, 10); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	sig := Sign("secret", "POST", "/v1/urls", "1609556645", []byte("body"))
+	if len(sig) != 64 {
+		t.Errorf("Wanted: 64 hex characters Got: %s", sig)
+	}
+
+	// Every part should be signed
+	others := []string{
+		Sign("other", "POST", "/v1/urls", "1609556645", []byte("body")),
+		Sign("secret", "GET", "/v1/urls", "1609556645", []byte("body")),
+		Sign("secret", "POST", "/v1/urls?a=b", "1609556645", []byte("body")),
+		Sign("secret", "POST", "/v1/urls", "1609556646", []byte("body")),
+		Sign("secret", "POST", "/v1/urls", "1609556645", []byte("other")),
+	}
+	for i, other := range others {
+		if other == sig {
+			t.Errorf("signature %d should be different", i)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// DefaultRetryCount is the default number of times a rate limited request is retried
+const DefaultRetryCount = 3
+
+// WithRetry retry up to count times the requests rate limited by the API (429) answering with a Retry-After header,
+// once the delay it gives has elapsed. Should be given after WithHMAC so that the retried requests are signed again.
+// A count of 0 disables the retries
+func WithRetry(count int) ClientOption {
+	return func(c *client) {
+		if count <= 0 {
+			return
+		}
+
+		c.httpClient.Transport = &retryTransport{
+			base:  c.httpClient.Transport,
+			count: count,
+			now:   time.Now,
+		}
+	}
+}
+
+// retryTransport retry the rate limited requests after the delay given by the API
+type retryTransport struct {
+	base  http.RoundTripper
+	count int
+	now   func() time.Time
+}
+
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := rt.base.RoundTrip(req)
+		if err != nil || res.StatusCode != http.StatusTooManyRequests || attempt >= rt.count {
+			return res, err
+		}
+
+		retryAfter := res.Header.Get("Retry-After")
+		if retryAfter == "" {
+			return res, nil
+		}
+		delay := parseRetryAfter(retryAfter, rt.now())
+
+		// Do not wait if the request would time out (or be cancelled) before being retried
+		ctx := req.Context()
+		if deadline, ok := ctx.Deadline(); ok && rt.now().Add(delay).After(deadline) {
+			return res, nil
+		}
+
+		// The body has been consumed by the previous attempt
+		retryReq := req
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return res, nil
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return res, nil
+			}
+			retryReq = req.Clone(ctx)
+			retryReq.Body = body
+		}
+
+		// Release the connection before waiting
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxErrorBodySize))
+		_ = res.Body.Close()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		req = retryReq
+	}
+}
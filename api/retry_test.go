@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRateLimitedServer returns a server answering 429 with given Retry-After header to the first limited requests,
+// then 200, with the number of requests received
+func newRateLimitedServer(t *testing.T, limited int64, retryAfter string) (*httptest.Server, *int64) {
+	var calls int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) <= limited {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		// Echo the body to check it is sent again
+		b, _ := ioutil.ReadAll(r.Body)
+		if len(b) == 0 {
+			b = []byte("{}")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+func TestWithRetry(t *testing.T) {
+	srv, calls := newRateLimitedServer(t, 2, "0")
+
+	c := NewClient(srv.URL, WithRetry(3))
+	res, err := c.AddResource(ResourceDto{URL: "https://example.onion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.URL != "https://example.onion" {
+		t.Errorf("Wanted: https://example.onion Got: %s", res.URL)
+	}
+	if *calls != 3 {
+		t.Errorf("Wanted: 3 calls Got: %d", *calls)
+	}
+}
+
+func TestWithRetryExhausted(t *testing.T) {
+	srv, calls := newRateLimitedServer(t, 5, "0")
+
+	c := NewClient(srv.URL, WithRetry(2))
+	var rateLimitedErr *RateLimitedError
+	if err := c.ScheduleURL("https://example.onion"); !errors.As(err, &rateLimitedErr) {
+		t.Errorf("Wanted: *RateLimitedError Got: %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("Wanted: 3 calls Got: %d", *calls)
+	}
+}
+
+func TestWithRetryDisabled(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		count      int
+		retryAfter string
+	}{
+		{"no retry count", 0, "0"},
+		{"no Retry-After header", 3, ""},
+	} {
+		srv, calls := newRateLimitedServer(t, 1, test.retryAfter)
+
+		c := NewClient(srv.URL, WithRetry(test.count))
+		var rateLimitedErr *RateLimitedError
+		if err := c.ScheduleURL("https://example.onion"); !errors.As(err, &rateLimitedErr) {
+			t.Errorf("%s: Wanted: *RateLimitedError Got: %v", test.name, err)
+		}
+		if *calls != 1 {
+			t.Errorf("%s: Wanted: 1 call Got: %d", test.name, *calls)
+		}
+	}
+}
+
+func TestWithRetryDelay(t *testing.T) {
+	srv, calls := newRateLimitedServer(t, 1, "1")
+
+	start := time.Now()
+	if _, err := NewClient(srv.URL, WithRetry(1)).GetStats(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("request should have been retried after 1s, took %s", elapsed)
+	}
+	if *calls != 2 {
+		t.Errorf("Wanted: 2 calls Got: %d", *calls)
+	}
+}
+
+func TestWithRetryHTTPDate(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv, calls := newRateLimitedServer(t, 1, now.Add(time.Minute).Format(http.TimeFormat))
+
+	rt := &retryTransport{base: http.DefaultTransport, count: 1, now: func() time.Time { return now }}
+
+	// The request is cancelled while waiting the minute given by the header
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := rt.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted: %s Got: %v", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wait should have been interrupted, took %s", elapsed)
+	}
+	if *calls != 1 {
+		t.Errorf("Wanted: 1 call Got: %d", *calls)
+	}
+}
+
+func TestWithRetryDeadline(t *testing.T) {
+	srv, calls := newRateLimitedServer(t, 1, "60")
+
+	// Waiting would exceed the request timeout: the 429 is returned right away
+	start := time.Now()
+	var rateLimitedErr *RateLimitedError
+	if _, err := NewClient(srv.URL, WithRetry(1), WithRequestTimeout(5*time.Second)).GetStats(); !errors.As(err,
+		&rateLimitedErr) || rateLimitedErr.RetryAfter != time.Minute {
+		t.Errorf("Wanted: rate limited, retry after 1m0s Got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request should not have been retried, took %s", elapsed)
+	}
+	if *calls != 1 {
+		t.Errorf("Wanted: 1 call Got: %d", *calls)
+	}
+}
+
+func TestWithRetrySigned(t *testing.T) {
+	var calls int64
+	var timestamps []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestamps = append(timestamps, r.Header.Get(TimestampHeader))
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("secret", r.Method, r.URL.RequestURI(), r.Header.Get(TimestampHeader), b) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	// The retried request should be signed again
+	if err := NewClient(srv.URL, WithHMAC("secret"), WithRetry(1)).ScheduleURL("https://example.onion"); err != nil {
+		t.Fatal(err)
+	}
+	if len(timestamps) != 2 || timestamps[0] == timestamps[1] {
+		t.Errorf("Wanted: 2 different timestamps Got: %v", timestamps)
+	}
+}
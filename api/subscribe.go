@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+const (
+	// LastEventIDHeader is the header giving the ID of the last event received by a reconnecting stream client
+	LastEventIDHeader = "Last-Event-ID"
+	// GapEvent is the type of the server-sent events telling that resources may have been missed
+	GapEvent = "gap"
+
+	// subscribeErrorBufferSize is the number of errors kept until read
+	subscribeErrorBufferSize = 16
+)
+
+// ErrResourcesMissed is reported when resources may have been missed while disconnected from the stream
+// (e.g: the API has been restarted) or because the resources were not read fast enough
+var ErrResourcesMissed = errors.New("resources may have been missed")
+
+// Subscribe returns a channel receiving the resources saved from now on and matching given filter (the pagination
+// is ignored), in the order they have been saved. The stream is reconnected with exponential backoff if lost: the
+// resources saved meanwhile are received once reconnected, if still kept by the API (ErrResourcesMissed is reported
+// otherwise).
+// The connection errors are reported on the error channel, without blocking: they are dropped if not read.
+// Both channels are closed once given context is done, or if the API rejects the filter
+func (c *client) Subscribe(ctx context.Context, filter ResourceFilter) (<-chan ResourceDto, <-chan error) {
+	return c.subscribe(ctx, filter, nil)
+}
+
+// subscribe implements Subscribe. If connected is not nil, the result of the first connection is sent to it and the
+// channels are closed if it fails
+func (c *client) subscribe(ctx context.Context, filter ResourceFilter,
+	connected chan<- error) (<-chan ResourceDto, <-chan error) {
+	params := filter.opts.query()
+	if c.withBody {
+		params.Set("with-body", "true")
+	}
+	targetEndpoint := fmt.Sprintf("%s/v1/resources/stream?%s", c.baseURL, params.Encode())
+
+	// The stream is long-lived: the request timeout does not apply
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+
+	resources := make(chan ResourceDto)
+	errs := make(chan error, subscribeErrorBufferSize)
+
+	report := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(resources)
+
+		lastEventID := ""
+		backoff := WatchInitialBackoff
+		for {
+			body, err := openStream(ctx, &httpClient, targetEndpoint, lastEventID)
+			if connected != nil {
+				connected <- err
+				connected = nil
+				if err != nil {
+					return
+				}
+			}
+			if err == nil {
+				backoff = WatchInitialBackoff
+
+				err = readEvents(body, func(event serverEvent) error {
+					if event.event == GapEvent {
+						report(ErrResourcesMissed)
+						return nil
+					}
+
+					var resource ResourceDto
+					if err := json.Unmarshal([]byte(event.data), &resource); err != nil {
+						log.Warn().Str("err", err.Error()).Msg("Error while un-marshaling streamed resource")
+						return nil
+					}
+
+					select {
+					case resources <- resource:
+						lastEventID = event.id
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				})
+				_ = body.Close()
+
+				if err != nil && ctx.Err() == nil {
+					err = fmt.Errorf("resource stream lost: %w", err)
+				}
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			report(err)
+
+			// Retrying won't help (e.g: invalid filter)
+			var notFoundErr *NotFoundError
+			var serverErr *ServerError
+			if errors.As(err, &notFoundErr) ||
+				(errors.As(err, &serverErr) && serverErr.StatusCode >= 400 && serverErr.StatusCode < 500) {
+				return
+			}
+
+			log.Debug().Err(err).Dur("backoff", backoff).Msg("Resource stream lost, reconnecting")
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > WatchMaxBackoff {
+				backoff = WatchMaxBackoff
+			}
+		}
+	}()
+
+	return resources, errs
+}
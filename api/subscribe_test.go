@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscribeReconnect(t *testing.T) {
+	var connections int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/resources/stream" {
+			t.Errorf("Wanted: /v1/resources/stream Got: %s", r.URL.Path)
+		}
+		if title := r.URL.Query().Get("title"); title != "forum" {
+			t.Errorf("Wanted: forum Got: %s", title)
+		}
+
+		w.Header().Set("Content-Type", contentTypeEventStream)
+
+		// The first stream is lost after two resources, the second one resume after the last received one
+		if n := atomic.AddInt32(&connections, 1); n == 1 {
+			if id := r.Header.Get(LastEventIDHeader); id != "" {
+				t.Errorf("Wanted: no Last-Event-ID Got: %s", id)
+			}
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+			_, _ = fmt.Fprint(w, "id: e-1\ndata: {\"url\":\"a.onion\"}\n\n")
+			_, _ = fmt.Fprint(w, "id: e-2\ndata: {\"url\":\"b.onion\"}\n\n")
+			return
+		}
+
+		if id := r.Header.Get(LastEventIDHeader); id != "e-2" {
+			t.Errorf("Wanted: e-2 Got: %s", id)
+		}
+		_, _ = fmt.Fprint(w, "id: e-3\ndata: {\"url\":\"c.onion\"}\n\n")
+		_, _ = fmt.Fprint(w, "id: e-4\ndata: {\"url\":\"d.onion\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resources, errs := NewClient(srv.URL).Subscribe(ctx, NewFilter().Title("forum"))
+
+	for _, want := range []string{"a.onion", "b.onion", "c.onion", "d.onion"} {
+		select {
+		case res := <-resources:
+			if res.URL != want {
+				t.Errorf("Wanted: %s Got: %s", want, res.URL)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("resource %s should have been received", want)
+		}
+	}
+
+	// The lost stream is reported
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("connection error should have been reported")
+		}
+	default:
+		t.Error("connection error should have been reported")
+	}
+
+	if n := atomic.LoadInt32(&connections); n != 2 {
+		t.Errorf("Wanted: 2 connections Got: %d", n)
+	}
+
+	// Both channels are closed once the context is done
+	cancel()
+	for _, ok := range []bool{isClosed(resources), isClosedErr(errs)} {
+		if !ok {
+			t.Error("channels should have been closed")
+		}
+	}
+}
+
+func TestSubscribeGap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeEventStream)
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: resources may have been missed\n\n", GapEvent)
+		_, _ = fmt.Fprint(w, "id: e-8\ndata: {\"url\":\"a.onion\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resources, errs := NewClient(srv.URL).Subscribe(ctx, NewFilter())
+
+	select {
+	case res := <-resources:
+		if res.URL != "a.onion" {
+			t.Errorf("Wanted: a.onion Got: %s", res.URL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("resource should have been received")
+	}
+
+	select {
+	case err := <-errs:
+		if err != ErrResourcesMissed {
+			t.Errorf("Wanted: %s Got: %s", ErrResourcesMissed, err)
+		}
+	default:
+		t.Error("missed resources should have been reported")
+	}
+}
+
+func TestSubscribeClientError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}))
+	defer srv.Close()
+
+	resources, errs := NewClient(srv.URL).Subscribe(context.Background(), NewFilter())
+
+	// Retrying won't help: the subscription ends
+	select {
+	case err := <-errs:
+		if _, ok := err.(*ServerError); !ok {
+			t.Errorf("Wanted: *ServerError Got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("error should have been reported")
+	}
+
+	if !isClosed(resources) {
+		t.Error("channel should have been closed")
+	}
+}
+
+func isClosed(ch <-chan ResourceDto) bool {
+	select {
+	case _, ok := <-ch:
+		return !ok
+	case <-time.After(5 * time.Second):
+		return false
+	}
+}
+
+func isClosedErr(ch <-chan error) bool {
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return true
+			}
+		case <-time.After(5 * time.Second):
+			return false
+		}
+	}
+}
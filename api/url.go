@@ -0,0 +1,19 @@
+package api
+
+import "encoding/base64"
+
+// EncodeURL returns given URL encoded as expected by the API endpoints & filters taking a base64 encoded URL
+// (URL-safe alphabet, padded)
+func EncodeURL(rawURL string) string {
+	return base64.URLEncoding.EncodeToString([]byte(rawURL))
+}
+
+// DecodeURL returns the URL encoded using EncodeURL
+func DecodeURL(b64URL string) (string, error) {
+	b, err := base64.URLEncoding.DecodeString(b64URL)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
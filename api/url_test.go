@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEncodeURL(t *testing.T) {
+	urls := []string{
+		"",
+		"example.onion",
+		"http://example.onion/index.php?id=1&sort=desc",
+		"http://example.onion/~user/??>>",
+		"http://例え.onion/パス",
+	}
+
+	for _, rawURL := range urls {
+		b64URL := EncodeURL(rawURL)
+
+		// Safe to use as path segment & query parameter
+		if strings.ContainsAny(b64URL, "+/") {
+			t.Errorf("%s: Wanted: URL-safe encoding Got: %s", rawURL, b64URL)
+		}
+		if b64URL != EncodeURL(rawURL) {
+			t.Errorf("%s: Wanted: padded encoding Got: %s", rawURL, b64URL)
+		}
+
+		decoded, err := DecodeURL(b64URL)
+		if err != nil || decoded != rawURL {
+			t.Errorf("Wanted: %s Got: %s (%v)", rawURL, decoded, err)
+		}
+	}
+}
+
+func TestDecodeURLInvalid(t *testing.T) {
+	// Standard encoding is not accepted
+	if _, err := DecodeURL(base64.StdEncoding.EncodeToString([]byte("http://example.onion/??>>"))); err == nil {
+		t.Error("standard encoding should not be decoded")
+	}
+	if _, err := DecodeURL("not base64!"); err == nil {
+		t.Error("invalid encoding should not be decoded")
+	}
+}
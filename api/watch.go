@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// WatchInitialBackoff is the delay before the first reconnection to the watch stream
+	WatchInitialBackoff = time.Second
+	// WatchMaxBackoff is the maximum delay between two reconnections to the watch stream
+	WatchMaxBackoff = time.Minute
+
+	contentTypeEventStream = "text/event-stream"
+)
+
+// WatchResources returns a channel receiving the resources saved from now on and matching given filter (the
+// pagination is ignored). The stream is reconnected with exponential backoff if lost.
+// The channel is closed once given context is done.
+// An error is returned if the first connection fails
+//
+// Deprecated: use Subscribe, which also reports the connection errors and the missed resources
+func (c *client) WatchResources(ctx context.Context, filter ResourceFilter) (<-chan ResourceDto, error) {
+	connected := make(chan error, 1)
+	resources, _ := c.subscribe(ctx, filter, connected)
+	if err := <-connected; err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+// openStream connect to given server-sent events endpoint and returns the response body.
+// lastEventID is the ID of the last received event (empty for none)
+func openStream(ctx context.Context, httpClient *http.Client, url, lastEventID string) (io.ReadCloser, error) {
+	log.Trace().Str("verb", "GET").Str("url", url).Msg("")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", contentTypeEventStream)
+	if lastEventID != "" {
+		req.Header.Set(LastEventIDHeader, lastEventID)
+	}
+
+	r, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkResponse(r); err != nil {
+		_ = r.Body.Close()
+		return nil, err
+	}
+
+	return r.Body, nil
+}
+
+// serverEvent is an event read from a server-sent events stream
+type serverEvent struct {
+	// id is the last event ID received (kept from the previous events if not set)
+	id    string
+	event string
+	data  string
+}
+
+// readEvents call given function with the events read from given server-sent events stream until it ends or the
+// function returns an error
+func readEvents(body io.Reader, handle func(event serverEvent) error) error {
+	reader := bufio.NewReader(body)
+
+	var event serverEvent
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// Empty line: dispatch the event
+		if line == "" {
+			if data.Len() > 0 {
+				event.data = data.String()
+				if err := handle(event); err != nil {
+					return err
+				}
+			}
+
+			event = serverEvent{id: event.id}
+			data.Reset()
+			continue
+		}
+
+		// Comments (keep-alive lines starting with a colon) are ignored
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "data":
+			data.WriteString(value)
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchResourcesReconnect(t *testing.T) {
+	var connections int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/resources/stream" {
+			t.Errorf("Wanted: /v1/resources/stream Got: %s", r.URL.Path)
+		}
+		if u := r.URL.Query().Get("url"); u != EncodeURL("example.onion") {
+			t.Errorf("invalid url filter: %s", u)
+		}
+
+		n := atomic.AddInt32(&connections, 1)
+
+		w.Header().Set("Content-Type", contentTypeEventStream)
+		_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		_, _ = fmt.Fprintf(w, "data: {\"url\":\"example.onion\",\"title\":\"%d\"}\n\n", n)
+		w.(http.Flusher).Flush()
+
+		// The first stream is lost, the second one is kept open
+		if n > 1 {
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resources, err := NewClient(srv.URL).WatchResources(ctx, NewFilter().URL(EncodeURL("example.onion")))
+	if err != nil {
+		t.FailNow()
+	}
+
+	for _, want := range []string{"1", "2"} {
+		select {
+		case res := <-resources:
+			if res.URL != "example.onion" || res.Title != want {
+				t.Errorf("Wanted: %s Got: %+v", want, res)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("resource %s should have been received", want)
+		}
+	}
+
+	if n := atomic.LoadInt32(&connections); n != 2 {
+		t.Errorf("Wanted: 2 connections Got: %d", n)
+	}
+}
+
+func TestWatchResourcesError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	if _, err := NewClient(srv.URL).WatchResources(context.Background(), NewFilter()); err == nil {
+		t.Error("first connection error should be returned")
+	}
+}
+
+func TestSearchResourcesOptionsMatch(t *testing.T) {
+	res := ResourceDto{URL: "example.onion", Title: "Hidden Wiki", Body: "Welcome to the WIKI", Language: "en",
+		Charset: "windows-1252", Keywords: []string{"wiki", "links"}, ResponseCode: 200}
+
+	tests := []struct {
+		opts SearchResourcesOptions
+		want bool
+	}{
+		{SearchResourcesOptions{}, true},
+		{SearchResourcesOptions{URL: EncodeURL("example.onion")}, true},
+		{SearchResourcesOptions{URL: EncodeURL("other.onion")}, false},
+		{SearchResourcesOptions{Keyword: "welcome", Title: "wiki", Language: "en"}, true},
+		{SearchResourcesOptions{Language: "ru"}, false},
+		{SearchResourcesOptions{Charset: "Windows-1252"}, true},
+		{SearchResourcesOptions{Charset: "utf-8"}, false},
+		{SearchResourcesOptions{ExtractedKeywords: []string{"Links", "wiki"}}, true},
+		{SearchResourcesOptions{ExtractedKeywords: []string{"wiki", "market"}}, false},
+		{SearchResourcesOptions{ResponseCode: 404}, false},
+		{SearchResourcesOptions{MinSize: 10, MaxSize: 19}, true},
+		{SearchResourcesOptions{MinSize: 20}, false},
+	}
+
+	for _, test := range tests {
+		if got := test.opts.Match(res); got != test.want {
+			t.Errorf("%+v: Wanted: %v Got: %v", test.opts, test.want, got)
+		}
+	}
+}
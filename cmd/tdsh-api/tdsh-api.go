@@ -2,11 +2,12 @@ package main
 
 import (
 	"github.com/creekorful/trandoshan/internal/api"
+	"github.com/creekorful/trandoshan/internal/util/config"
 	"os"
 )
 
 func main() {
-	app := api.GetApp()
+	app := config.Setup(api.GetApp())
 	if err := app.Run(os.Args); err != nil {
 		os.Exit(1)
 	}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/creekorful/trandoshan/internal/archiver"
+	"github.com/creekorful/trandoshan/internal/util/config"
+	"os"
+)
+
+func main() {
+	app := config.Setup(archiver.GetApp())
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(1)
+	}
+}
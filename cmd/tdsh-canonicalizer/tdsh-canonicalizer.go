@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/creekorful/trandoshan/internal/canonicalizer"
+	"github.com/creekorful/trandoshan/internal/util/config"
+	"os"
+)
+
+func main() {
+	app := config.Setup(canonicalizer.GetApp())
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(1)
+	}
+}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"github.com/creekorful/trandoshan/internal/crawler"
+	"github.com/creekorful/trandoshan/internal/util/config"
 	"os"
 )
 
 func main() {
-	app := crawler.GetApp()
+	app := config.Setup(crawler.GetApp())
 	if err := app.Run(os.Args); err != nil {
 		os.Exit(1)
 	}
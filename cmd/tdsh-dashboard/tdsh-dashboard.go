@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/creekorful/trandoshan/internal/dashboard"
+	"github.com/creekorful/trandoshan/internal/util/config"
+	"os"
+)
+
+func main() {
+	app := config.Setup(dashboard.GetApp())
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(1)
+	}
+}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"github.com/creekorful/trandoshan/internal/extractor"
+	"github.com/creekorful/trandoshan/internal/util/config"
 	"os"
 )
 
 func main() {
-	app := extractor.GetApp()
+	app := config.Setup(extractor.GetApp())
 	if err := app.Run(os.Args); err != nil {
 		os.Exit(1)
 	}
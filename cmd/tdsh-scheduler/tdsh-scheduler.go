@@ -2,11 +2,12 @@ package main
 
 import (
 	"github.com/creekorful/trandoshan/internal/scheduler"
+	"github.com/creekorful/trandoshan/internal/util/config"
 	"os"
 )
 
 func main() {
-	app := scheduler.GetApp()
+	app := config.Setup(scheduler.GetApp())
 	if err := app.Run(os.Args); err != nil {
 		os.Exit(1)
 	}
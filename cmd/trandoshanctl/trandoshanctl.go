@@ -2,11 +2,12 @@ package main
 
 import (
 	"github.com/creekorful/trandoshan/internal/trandoshanctl"
+	"github.com/creekorful/trandoshan/internal/util/config"
 	"os"
 )
 
 func main() {
-	app := trandoshanctl.GetApp()
+	app := config.Setup(trandoshanctl.GetApp())
 	if err := app.Run(os.Args); err != nil {
 		os.Exit(1)
 	}
@@ -1,19 +1,44 @@
 module github.com/creekorful/trandoshan
 
-go 1.14
+go 1.16
 
 require (
 	github.com/PuerkitoBio/purell v1.1.1
 	github.com/PuerkitoBio/urlesc v0.0.0-20170810143723-de5bf2ad4578 // indirect
+	github.com/abadojack/whatlanggo v1.0.1
+	github.com/alicebob/miniredis/v2 v2.14.3
+	github.com/bits-and-blooms/bloom/v3 v3.2.0
+	github.com/chzyer/readline v1.5.1
 	github.com/elastic/go-elasticsearch/v7 v7.6.0
-	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/fsnotify/fsnotify v1.4.9
+	github.com/go-redis/redis/v8 v8.11.4
+	github.com/golang-migrate/migrate/v4 v4.15.1
+	github.com/google/uuid v1.3.0
+	github.com/gorilla/websocket v1.4.2
+	github.com/hashicorp/golang-lru v0.5.4
 	github.com/labstack/echo/v4 v4.1.16
-	github.com/nats-io/nats-server/v2 v2.1.8 // indirect
-	github.com/nats-io/nats.go v1.10.0
+	github.com/lib/pq v1.10.4
+	github.com/minio/minio-go/v7 v7.0.10
+	github.com/nats-io/jwt v0.3.2 // indirect
+	github.com/nats-io/nats-server/v2 v2.8.4
+	github.com/nats-io/nats.go v1.17.0
+	github.com/nats-io/nkeys v0.3.0
 	github.com/olivere/elastic/v7 v7.0.20
+	github.com/prometheus/client_golang v1.7.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/zerolog v1.20.0
+	github.com/temoto/robotstxt v1.1.2
+	github.com/testcontainers/testcontainers-go v0.12.0
 	github.com/urfave/cli/v2 v2.2.0
-	github.com/valyala/fasthttp v1.9.0
 	github.com/xhit/go-str2duration/v2 v2.0.0
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.32.0
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+	golang.org/x/crypto v0.0.0-20220315160706-3147a52a75dd
+	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2
+	golang.org/x/time v0.0.0-20211116232009-f0f3c7e86c11
+	gopkg.in/yaml.v2 v2.4.0
 	mvdan.cc/xurls/v2 v2.1.0
 )
@@ -1 +1,467 @@
 package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic/v7"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	cursor, err := encodeCursor([]interface{}{float64(1609459200000), "doc-id"})
+	if err != nil {
+		t.FailNow()
+	}
+
+	sortValues, err := decodeCursor(cursor)
+	if err != nil {
+		t.FailNow()
+	}
+	if len(sortValues) != 2 {
+		t.FailNow()
+	}
+	// Timestamp should not be converted to float
+	if sortValues[0] != json.Number("1609459200000") || sortValues[1] != "doc-id" {
+		t.Errorf("Got: %v", sortValues)
+	}
+
+	for _, invalid := range []string{"not base64!", "bm90IGpzb24", "WzFd"} {
+		if _, err := decodeCursor(invalid); err == nil {
+			t.Errorf("cursor %s should be invalid", invalid)
+		}
+	}
+}
+
+func TestSearchResourcesSize(t *testing.T) {
+	// Fake Elasticsearch server evaluating the body size range of the queries
+	docs := []resourceIndex{
+		{URL: "stub.onion", BodySize: 50},
+		{URL: "small.onion", BodySize: 100},
+		{URL: "medium.onion", BodySize: 5000},
+		{URL: "large.onion", BodySize: 1000000},
+		{URL: "dump.onion", BodySize: 5000000},
+	}
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		var hits []map[string]interface{}
+		for i, doc := range docs {
+			if matchBodySize(req["query"], doc.BodySize) {
+				b, _ := json.Marshal(doc)
+				hits = append(hits, map[string]interface{}{
+					"_id": strconv.Itoa(i), "_source": json.RawMessage(b), "sort": []interface{}{i},
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/_count") {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"count": len(hits)})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"hits": map[string]interface{}{"total": map[string]interface{}{"value": len(hits)}, "hits": hits},
+		})
+	}))
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	e := echo.New()
+	e.GET("/v1/resources", searchResources(&elasticStorage{es: es}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	c := api.NewClient(srv.URL)
+	tests := []struct {
+		opts api.SearchResourcesOptions
+		want []string
+	}{
+		{api.SearchResourcesOptions{}, []string{"stub.onion", "small.onion", "medium.onion", "large.onion", "dump.onion"}},
+		{api.SearchResourcesOptions{MinSize: 100}, []string{"small.onion", "medium.onion", "large.onion", "dump.onion"}},
+		{api.SearchResourcesOptions{MaxSize: 1000000}, []string{"stub.onion", "small.onion", "medium.onion", "large.onion"}},
+		{api.SearchResourcesOptions{MinSize: 100, MaxSize: 1000000}, []string{"small.onion", "medium.onion", "large.onion"}},
+		{api.SearchResourcesOptions{MinSize: 10000, MaxSize: 100}, nil},
+	}
+	for _, test := range tests {
+		res, count, err := c.SearchResources(test.opts, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var urls []string
+		for _, r := range res {
+			urls = append(urls, r.URL)
+		}
+		if fmt.Sprint(urls) != fmt.Sprint(test.want) || count != int64(len(test.want)) {
+			t.Errorf("%+v: Wanted: %v Got: %v (count: %d)", test.opts, test.want, urls, count)
+		}
+	}
+
+	// Invalid sizes are rejected
+	for _, query := range []string{"min-size=abc", "max-size=-1"} {
+		r, err := http.Get(srv.URL + "/v1/resources?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = r.Body.Close()
+		if r.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: Wanted: %d Got: %d", query, http.StatusUnprocessableEntity, r.StatusCode)
+		}
+	}
+}
+
+func TestSearchResourcesResponseCode(t *testing.T) {
+	// Fake Elasticsearch server evaluating the response code term of the queries
+	docs := []resourceIndex{
+		{URL: "ok.onion", ResponseCode: 200},
+		{URL: "moved.onion", ResponseCode: 301},
+		{URL: "dead.onion", ResponseCode: 404},
+		{URL: "old.onion"},
+		{URL: "gone.onion", ResponseCode: 404},
+		{URL: "down.onion", ResponseCode: 503},
+	}
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		var hits []map[string]interface{}
+		for i, doc := range docs {
+			if matchResponseCode(req["query"], doc.ResponseCode) {
+				b, _ := json.Marshal(doc)
+				hits = append(hits, map[string]interface{}{
+					"_id": strconv.Itoa(i), "_source": json.RawMessage(b), "sort": []interface{}{i},
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/_count") {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"count": len(hits)})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"hits": map[string]interface{}{"total": map[string]interface{}{"value": len(hits)}, "hits": hits},
+		})
+	}))
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	e := echo.New()
+	e.GET("/v1/resources", searchResources(&elasticStorage{es: es}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	c := api.NewClient(srv.URL)
+	tests := []struct {
+		code int
+		want []string
+	}{
+		{0, []string{"ok.onion", "moved.onion", "dead.onion", "old.onion", "gone.onion", "down.onion"}},
+		{200, []string{"ok.onion"}},
+		{404, []string{"dead.onion", "gone.onion"}},
+		{500, nil},
+	}
+	for _, test := range tests {
+		res, count, err := c.Search(api.NewFilter().ResponseCode(test.code).Page(1, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var urls []string
+		for _, r := range res {
+			if test.code != 0 && r.ResponseCode != test.code {
+				t.Errorf("%d: Got: %d", test.code, r.ResponseCode)
+			}
+			urls = append(urls, r.URL)
+		}
+		if fmt.Sprint(urls) != fmt.Sprint(test.want) || count != int64(len(test.want)) {
+			t.Errorf("%d: Wanted: %v Got: %v (count: %d)", test.code, test.want, urls, count)
+		}
+	}
+
+	// Invalid response codes are rejected
+	for _, query := range []string{"response_code=abc", "response_code=42", "response_code=600"} {
+		r, err := http.Get(srv.URL + "/v1/resources?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = r.Body.Close()
+		if r.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: Wanted: %d Got: %d", query, http.StatusUnprocessableEntity, r.StatusCode)
+		}
+	}
+}
+
+// matchResponseCode returns true if the response_code term queries contained in given query match given code
+func matchResponseCode(query interface{}, code int) bool {
+	switch q := query.(type) {
+	case map[string]interface{}:
+		if term, ok := q["term"].(map[string]interface{}); ok {
+			if value, ok := term["response_code"].(float64); ok && int(value) != code {
+				return false
+			}
+		}
+		for _, v := range q {
+			if !matchResponseCode(v, code) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, v := range q {
+			if !matchResponseCode(v, code) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matchBodySize returns true if the body_size range queries contained in given query match given size
+func matchBodySize(query interface{}, size int) bool {
+	switch q := query.(type) {
+	case map[string]interface{}:
+		if r, ok := q["range"].(map[string]interface{}); ok {
+			if bounds, ok := r["body_size"].(map[string]interface{}); ok {
+				if from, ok := bounds["from"].(float64); ok && float64(size) < from {
+					return false
+				}
+				if to, ok := bounds["to"].(float64); ok && float64(size) > to {
+					return false
+				}
+			}
+		}
+		for _, v := range q {
+			if !matchBodySize(v, size) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, v := range q {
+			if !matchBodySize(v, size) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func TestSearchResourcesExtractedKeywords(t *testing.T) {
+	// Fake Elasticsearch server evaluating the keywords terms of the queries
+	docs := []resourceIndex{
+		{URL: "market.onion", Keywords: []string{"market", "books", "bitcoin"}},
+		{URL: "forum.onion", Keywords: []string{"forum", "privacy", "bitcoin"}},
+		{URL: "old.onion"},
+	}
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		var hits []map[string]interface{}
+		for i, doc := range docs {
+			if matchKeywords(req["query"], doc.Keywords) {
+				b, _ := json.Marshal(doc)
+				hits = append(hits, map[string]interface{}{
+					"_id": strconv.Itoa(i), "_source": json.RawMessage(b), "sort": []interface{}{i},
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/_count") {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"count": len(hits)})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"hits": map[string]interface{}{"total": map[string]interface{}{"value": len(hits)}, "hits": hits},
+		})
+	}))
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	e := echo.New()
+	e.GET("/v1/resources", searchResources(&elasticStorage{es: es}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	c := api.NewClient(srv.URL)
+	tests := []struct {
+		keywords []string
+		want     []string
+	}{
+		{nil, []string{"market.onion", "forum.onion", "old.onion"}},
+		{[]string{"bitcoin"}, []string{"market.onion", "forum.onion"}},
+		{[]string{"Bitcoin", " privacy "}, []string{"forum.onion"}},
+		{[]string{"market", "privacy"}, nil},
+	}
+	for _, test := range tests {
+		res, count, err := c.Search(api.NewFilter().ExtractedKeywords(test.keywords...).Page(1, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var urls []string
+		for _, r := range res {
+			urls = append(urls, r.URL)
+		}
+		if fmt.Sprint(urls) != fmt.Sprint(test.want) || count != int64(len(test.want)) {
+			t.Errorf("%v: Wanted: %v Got: %v (count: %d)", test.keywords, test.want, urls, count)
+		}
+	}
+}
+
+// matchKeywords returns true if the keywords term queries contained in given query match given keywords
+func matchKeywords(query interface{}, keywords []string) bool {
+	switch q := query.(type) {
+	case map[string]interface{}:
+		if term, ok := q["term"].(map[string]interface{}); ok {
+			if value, ok := term["keywords"].(string); ok && !containsString(keywords, value) {
+				return false
+			}
+		}
+		for _, v := range q {
+			if !matchKeywords(v, keywords) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, v := range q {
+			if !matchKeywords(v, keywords) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSearchResourcesCharset(t *testing.T) {
+	// Fake Elasticsearch server evaluating the charset term of the queries
+	docs := []resourceIndex{
+		{URL: "utf8.onion", Charset: "utf-8"},
+		{URL: "latin1.onion", Charset: "windows-1252"},
+		{URL: "utf16.onion", Charset: "utf-16le"},
+		{URL: "old.onion"},
+	}
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		var hits []map[string]interface{}
+		for i, doc := range docs {
+			if matchCharset(req["query"], doc.Charset) {
+				b, _ := json.Marshal(doc)
+				hits = append(hits, map[string]interface{}{
+					"_id": strconv.Itoa(i), "_source": json.RawMessage(b), "sort": []interface{}{i},
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/_count") {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"count": len(hits)})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"hits": map[string]interface{}{"total": map[string]interface{}{"value": len(hits)}, "hits": hits},
+		})
+	}))
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	e := echo.New()
+	e.GET("/v1/resources", searchResources(&elasticStorage{es: es}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	c := api.NewClient(srv.URL)
+	tests := []struct {
+		charset string
+		want    []string
+	}{
+		{"", []string{"utf8.onion", "latin1.onion", "utf16.onion", "old.onion"}},
+		{"windows-1252", []string{"latin1.onion"}},
+		{"UTF-16LE", []string{"utf16.onion"}},
+		{"shift_jis", nil},
+	}
+	for _, test := range tests {
+		res, count, err := c.Search(api.NewFilter().Charset(test.charset).Page(1, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var urls []string
+		for _, r := range res {
+			urls = append(urls, r.URL)
+		}
+		if fmt.Sprint(urls) != fmt.Sprint(test.want) || count != int64(len(test.want)) {
+			t.Errorf("%s: Wanted: %v Got: %v (count: %d)", test.charset, test.want, urls, count)
+		}
+	}
+}
+
+// matchCharset returns true if the charset term queries contained in given query match given charset
+func matchCharset(query interface{}, charset string) bool {
+	switch q := query.(type) {
+	case map[string]interface{}:
+		if term, ok := q["term"].(map[string]interface{}); ok {
+			if value, ok := term["charset"].(string); ok && value != charset {
+				return false
+			}
+		}
+		for _, v := range q {
+			if !matchCharset(v, charset) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, v := range q {
+			if !matchCharset(v, charset) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditBufferSize is the number of audit entries waiting to be written before new ones are dropped
+const auditBufferSize = 1024
+
+// auditEntry is the audit record of a write request, written as a JSON line
+type auditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	ClientIP  string    `json:"client_ip"`
+	// BodyHash is the hex encoded SHA-256 of the request body
+	BodyHash string `json:"body_hash"`
+	Status   int    `json:"status"`
+}
+
+// auditLog writes the audit entries in the background so that the requests are never blocked by the writer
+type auditLog struct {
+	entries chan auditEntry
+	wg      sync.WaitGroup
+}
+
+// openAuditLog returns the audit log appending to the file located at given path
+func openAuditLog(path string) (*auditLog, io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return newAuditLog(f, auditBufferSize), f, nil
+}
+
+// newAuditLog returns the audit log writing to w, bufferSize entries being buffered before new ones are dropped
+func newAuditLog(w io.Writer, bufferSize int) *auditLog {
+	a := &auditLog{entries: make(chan auditEntry, bufferSize)}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		encoder := json.NewEncoder(w)
+		for entry := range a.entries {
+			if err := encoder.Encode(entry); err != nil {
+				log.Err(err).Str("path", entry.Path).Msg("Error while writing audit entry")
+			}
+		}
+	}()
+
+	return a
+}
+
+// record queues given entry, dropping it if the buffer is full
+func (a *auditLog) record(entry auditEntry) {
+	select {
+	case a.entries <- entry:
+	default:
+		log.Warn().Str("method", entry.Method).Str("path", entry.Path).Msg("Audit log buffer full, dropping entry")
+	}
+}
+
+// close writes the queued entries then stops the audit log, no entry should be recorded afterwards
+func (a *auditLog) close() {
+	close(a.entries)
+	a.wg.Wait()
+}
+
+// auditMiddleware returns a middleware recording the write (non-GET) requests to given audit log
+func auditMiddleware(a *auditLog) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method == http.MethodGet || req.Method == http.MethodHead {
+				return next(c)
+			}
+
+			// Read the body to hash it then restore it for the handler
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return c.NoContent(http.StatusBadRequest)
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			hash := sha256.Sum256(body)
+
+			err = next(c)
+
+			// The errors are only turned into responses by the echo error handler, once the middlewares returned
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				}
+			}
+
+			a.record(auditEntry{
+				Timestamp: time.Now(),
+				Method:    req.Method,
+				Path:      req.URL.RequestURI(),
+				ClientIP:  c.RealIP(),
+				BodyHash:  hex.EncodeToString(hash[:]),
+				Status:    status,
+			})
+
+			return err
+		}
+	}
+}
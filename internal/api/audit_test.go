@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	audit := newAuditLog(&buf, 10)
+
+	e := echo.New()
+	e.Use(auditMiddleware(audit))
+	e.GET("/v1/resources", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e.POST("/v1/urls", func(c echo.Context) error {
+		// The body should still be readable
+		b, err := ioutil.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusCreated, string(b))
+	})
+	e.DELETE("/v1/resources/:b64url", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound)
+	})
+
+	start := time.Now()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/resources", nil)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/urls?a=b", strings.NewReader(`"https://example.onion"`))
+	req.RemoteAddr = "10.0.0.1:4242"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || rec.Body.String() != `"https://example.onion"` {
+		t.Errorf("Wanted: 201 \"https://example.onion\" Got: %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/v1/resources/aHR0cHM6Ly9leGFtcGxlLm9uaW9u", nil)
+	req.RemoteAddr = "10.0.0.2:4242"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Wanted: 404 Got: %d", rec.Code)
+	}
+
+	audit.close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit entry %s: %s", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	// The GET request should not be audited
+	if len(entries) != 2 {
+		t.Fatalf("Wanted: 2 entries Got: %d", len(entries))
+	}
+
+	bodyHash := sha256.Sum256([]byte(`"https://example.onion"`))
+	emptyHash := sha256.Sum256(nil)
+	wanted := []auditEntry{
+		{
+			Method:   http.MethodPost,
+			Path:     "/v1/urls?a=b",
+			ClientIP: "10.0.0.1",
+			BodyHash: hex.EncodeToString(bodyHash[:]),
+			Status:   http.StatusCreated,
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/v1/resources/aHR0cHM6Ly9leGFtcGxlLm9uaW9u",
+			ClientIP: "10.0.0.2",
+			BodyHash: hex.EncodeToString(emptyHash[:]),
+			Status:   http.StatusNotFound,
+		},
+	}
+	for i, entry := range entries {
+		if entry.Timestamp.Before(start) || entry.Timestamp.After(time.Now()) {
+			t.Errorf("invalid timestamp %s", entry.Timestamp)
+		}
+		entry.Timestamp = time.Time{}
+		if entry != wanted[i] {
+			t.Errorf("Wanted: %+v Got: %+v", wanted[i], entry)
+		}
+	}
+}
+
+// blockingWriter blocks the writes until unblock is closed
+type blockingWriter struct {
+	unblock chan struct{}
+	w       io.Writer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.w.Write(p)
+}
+
+func TestAuditMiddlewareNonBlocking(t *testing.T) {
+	var buf bytes.Buffer
+	w := &blockingWriter{unblock: make(chan struct{}), w: &buf}
+	audit := newAuditLog(w, 1)
+
+	e := echo.New()
+	e.Use(auditMiddleware(audit))
+	e.POST("/v1/urls", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	// The writer being blocked, the entries exceeding the buffer should be dropped without blocking the requests
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/urls", strings.NewReader(`"url"`)))
+			if rec.Code != http.StatusOK {
+				t.Errorf("Wanted: 200 Got: %d", rec.Code)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("requests should not have been blocked by the audit log")
+	}
+
+	close(w.unblock)
+	audit.close()
+
+	// At most the entry being written and the buffered one have been kept
+	if lines := strings.Count(buf.String(), "\n"); lines < 1 || lines > 2 {
+		t.Errorf("Wanted: 1 or 2 entries Got: %d", lines)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"net/url"
+)
+
+func getResourceBody(store storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rawURL, err := api.DecodeURL(c.Param("b64url"))
+		if err != nil {
+			log.Err(err).Msg("Error while decoding URL")
+			return c.NoContent(http.StatusUnprocessableEntity)
+		}
+
+		resource, err := store.lastResource(c.Request().Context(), rawURL)
+		if err != nil {
+			log.Err(err).Msg("Error while searching resource")
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		if resource == nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+
+		// The body has been moved to the archive
+		if resource.BodyURL != "" {
+			return c.Redirect(http.StatusSeeOther, resource.BodyURL)
+		}
+
+		return c.Blob(http.StatusOK, echo.MIMETextHTMLCharsetUTF8, []byte(resource.Body))
+	}
+}
+
+func setResourceBodyURL(store storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rawURL, err := api.DecodeURL(c.Param("b64url"))
+		if err != nil {
+			log.Err(err).Msg("Error while decoding URL")
+			return c.NoContent(http.StatusUnprocessableEntity)
+		}
+
+		var dto api.BodyURLDto
+		if err := json.NewDecoder(c.Request().Body).Decode(&dto); err != nil {
+			log.Err(err).Msg("Error while un-marshaling body URL")
+			return c.NoContent(http.StatusUnprocessableEntity)
+		}
+		if u, err := url.Parse(dto.BodyURL); err != nil || !u.IsAbs() {
+			return c.NoContent(http.StatusUnprocessableEntity)
+		}
+
+		log.Debug().Str("url", rawURL).Str("body-url", dto.BodyURL).Msg("Archiving resource body")
+
+		found, err := store.setBodyURL(c.Request().Context(), rawURL, dto.BodyURL)
+		if err != nil {
+			log.Err(err).Msg("Error while updating resource")
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		if !found {
+			return c.NoContent(http.StatusNotFound)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
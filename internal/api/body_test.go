@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic/v7"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newBodyESServer returns a fake Elasticsearch server storing given documents by ID, supporting the searches by URL
+// (returning the document whose URL is found in the query) and the partial updates
+func newBodyESServer(t *testing.T, docs map[string]map[string]interface{}) *httptest.Server {
+	var mutex sync.Mutex
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		// Partial update
+		if i := strings.Index(r.URL.Path, "/_update/"); i != -1 {
+			id := r.URL.Path[i+len("/_update/"):]
+			var req struct {
+				Doc map[string]interface{} `json:"doc"`
+			}
+			if err := json.Unmarshal(b, &req); err != nil {
+				t.Error(err)
+			}
+			for key, value := range req.Doc {
+				docs[id][key] = value
+			}
+			_, _ = w.Write([]byte(`{"_id": "` + id + `", "result": "updated"}`))
+			return
+		}
+
+		var hits []map[string]interface{}
+		for id, doc := range docs {
+			if strings.Contains(string(b), doc["url"].(string)) {
+				hits = append(hits, map[string]interface{}{"_id": id, "_source": doc})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"hits": map[string]interface{}{"total": map[string]interface{}{"value": len(hits)}, "hits": hits},
+		})
+	}))
+}
+
+func TestResourceBody(t *testing.T) {
+	docs := map[string]map[string]interface{}{
+		"1": {"url": "http://example.onion", "body": "<html>hello</html>", "body_size": 18},
+	}
+	esSrv := newBodyESServer(t, docs)
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	e := echo.New()
+	e.GET("/v1/resources/:b64url/body", getResourceBody(&elasticStorage{es: es}))
+	e.PUT("/v1/resources/:b64url/body-url", setResourceBodyURL(&elasticStorage{es: es}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	archiveSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html>archived</html>"))
+	}))
+	defer archiveSrv.Close()
+
+	c := api.NewClient(srv.URL)
+	b64URL := api.EncodeURL("http://example.onion")
+
+	body, err := c.GetResourceBody(b64URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "<html>hello</html>" {
+		t.Errorf("Wanted: <html>hello</html> Got: %s", body)
+	}
+
+	// Body is replaced by its URL, the body size being kept
+	if err := c.SetResourceBodyURL(b64URL, archiveSrv.URL+"/bucket/key"); err != nil {
+		t.Fatal(err)
+	}
+	if docs["1"]["body"] != "" || docs["1"]["body_url"] != archiveSrv.URL+"/bucket/key" || docs["1"]["body_size"] != 18 {
+		t.Errorf("unexpected document: %v", docs["1"])
+	}
+
+	// Body is now served from the archive
+	body, err = c.GetResourceBody(b64URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "<html>archived</html>" {
+		t.Errorf("Wanted: <html>archived</html> Got: %s", body)
+	}
+
+	// Never crawled
+	unknownURL := api.EncodeURL("http://unknown.onion")
+	var notFoundErr *api.NotFoundError
+	if _, err := c.GetResourceBody(unknownURL); !errors.As(err, &notFoundErr) {
+		t.Errorf("Wanted: *api.NotFoundError Got: %v", err)
+	}
+	if err := c.SetResourceBodyURL(unknownURL, archiveSrv.URL); !errors.As(err, &notFoundErr) {
+		t.Errorf("Wanted: *api.NotFoundError Got: %v", err)
+	}
+
+	// Body URL should be absolute
+	var serverErr *api.ServerError
+	if err := c.SetResourceBodyURL(b64URL, "bucket/key"); !errors.As(err, &serverErr) ||
+		serverErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Wanted: 422 Got: %v", err)
+	}
+}
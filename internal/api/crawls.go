@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/labstack/echo/v4"
+	"github.com/nats-io/nats.go"
+	"github.com/olivere/elastic/v7"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+// maxStatusCodeBuckets is the maximum number of distinct status codes counted in a crawl history
+const maxStatusCodeBuckets = 100
+
+var crawlsIndex = "crawls"
+
+// crawlsMapping is the mapping of the crawls index
+const crawlsMapping = `{
+	"mappings": {
+		"properties": {
+			"url": {"type": "keyword"},
+			"status_code": {"type": "integer"},
+			"time": {"type": "date"}
+		}
+	}
+}`
+
+// Represent a crawl outcome in elasticsearch
+type crawlIndex struct {
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status_code"`
+	Time       time.Time `json:"time"`
+}
+
+// recordCrawlResult returns the handler saving the crawl results published by the crawlers
+func recordCrawlResult(store storage) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		var resultMsg messaging.CrawlResultMsg
+		if err := natsutil.ReadJSON(msg, &resultMsg); err != nil {
+			log.Err(err).Msg("Error while reading crawl result")
+			return
+		}
+
+		if err := store.recordCrawl(context.Background(), resultMsg.URL, resultMsg.StatusCode,
+			resultMsg.Timestamp); err != nil {
+			log.Err(err).Str("url", resultMsg.URL).Msg("Error while saving crawl result")
+			return
+		}
+
+		log.Trace().Str("url", resultMsg.URL).Int("status-code", resultMsg.StatusCode).Msg("Saved crawl result")
+	}
+}
+
+// getCrawlHistory returns the number of crawls of an URL by status code
+func getCrawlHistory(store storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rawURL, err := api.DecodeURL(c.Param("b64url"))
+		if err != nil {
+			log.Err(err).Msg("Error while decoding URL")
+			return c.NoContent(http.StatusUnprocessableEntity)
+		}
+
+		history, err := store.getCrawlHistory(c.Request().Context(), rawURL)
+		if err != nil {
+			log.Err(err).Msg("Error while getting crawl history")
+			return c.NoContent(http.StatusInternalServerError)
+		}
+
+		return c.JSON(http.StatusOK, history)
+	}
+}
+
+func (s *elasticStorage) recordCrawl(ctx context.Context, url string, statusCode int, t time.Time) error {
+	doc := crawlIndex{URL: url, StatusCode: statusCode, Time: t}
+	_, err := s.es.Index().Index(crawlsIndex).BodyJson(doc).Do(ctx)
+	return err
+}
+
+func (s *elasticStorage) getCrawlHistory(ctx context.Context, url string) (api.CrawlHistoryDto, error) {
+	// Only the aggregation is needed
+	res, err := s.es.Search().
+		Index(crawlsIndex).
+		Query(elastic.NewTermQuery("url", url)).
+		Aggregation("status_codes", elastic.NewTermsAggregation().Field("status_code").Size(maxStatusCodeBuckets)).
+		TrackTotalHits(true).
+		Size(0).
+		Do(ctx)
+	if err != nil {
+		return api.CrawlHistoryDto{}, err
+	}
+
+	return readCrawlHistory(res), nil
+}
+
+// readCrawlHistory returns the crawl history from the result of the status codes aggregation
+func readCrawlHistory(res *elastic.SearchResult) api.CrawlHistoryDto {
+	history := api.CrawlHistoryDto{StatusCodes: map[int]int64{}}
+	if res.Hits != nil && res.Hits.TotalHits != nil {
+		history.Attempts = res.Hits.TotalHits.Value
+	}
+
+	if agg, found := res.Aggregations.Terms("status_codes"); found {
+		for _, bucket := range agg.Buckets {
+			// Numeric keys are decoded as float64
+			if code, ok := bucket.Key.(float64); ok {
+				history.StatusCodes[int(code)] = bucket.DocCount
+			}
+		}
+	}
+
+	return history
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic/v7"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetCrawlHistory(t *testing.T) {
+	// Fake Elasticsearch server returning the status codes aggregation
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body := string(b)
+		if !strings.HasPrefix(r.URL.Path, "/"+crawlsIndex+"/") {
+			t.Errorf("Wanted: %s index Got: %s", crawlsIndex, r.URL.Path)
+		}
+		if !strings.Contains(body, `"term":{"url":"http://example.onion"}`) || !strings.Contains(body, `"size":0`) {
+			t.Errorf("invalid search request: %s", body)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"hits": {"total": {"value": 5, "relation": "eq"}, "hits": []},
+			"aggregations": {
+				"status_codes": {"buckets": [{"key": 404, "doc_count": 3}, {"key": 200, "doc_count": 2}]}
+			}
+		}`))
+	}))
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	e := echo.New()
+	e.GET("/v1/resources/:b64url/crawls", getCrawlHistory(&elasticStorage{es: es}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	history, err := api.NewClient(srv.URL).
+		GetCrawlHistory(api.EncodeURL("http://example.onion"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := api.CrawlHistoryDto{Attempts: 5, StatusCodes: map[int]int64{404: 3, 200: 2}}
+	if mustMarshal(t, history) != mustMarshal(t, want) {
+		t.Errorf("Wanted: %+v Got: %+v", want, history)
+	}
+}
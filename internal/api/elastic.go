@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/olivere/elastic/v7"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"time"
+)
+
+// elasticStorage store the resources in the resources index of Elasticsearch
+type elasticStorage struct {
+	es *elastic.Client
+}
+
+func (s *elasticStorage) searchResources(ctx context.Context, q resourceQuery, from, size int, after []interface{},
+	withBody bool) ([]api.ResourceDto, int64, []interface{}, error) {
+	query := buildResourceQuery(q)
+
+	// Get total count
+	totalCount, err := s.es.Count(resourcesIndex).Query(query).Do(ctx)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Sort on a unique key so that the documents inserted meanwhile doesn't shift the pages
+	search := s.es.Search().
+		Index(resourcesIndex).
+		Query(query).
+		Sort("time", true).
+		Sort("_id", true).
+		From(from).
+		Size(size)
+	if after != nil {
+		search = search.SearchAfter(after...)
+	}
+
+	res, err := search.Do(ctx)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Full page: there may be a next one
+	var next []interface{}
+	if res.Hits != nil && len(res.Hits.Hits) == size && size > 0 {
+		next = res.Hits.Hits[len(res.Hits.Hits)-1].Sort
+	}
+
+	return readResources(res, withBody), totalCount, next, nil
+}
+
+func (s *elasticStorage) searchResourcesBulk(ctx context.Context, urls []string,
+	startDate, endDate time.Time) ([][]api.ResourceDto, error) {
+	// Build up one search request per URL
+	search := s.es.MultiSearch()
+	for _, url := range urls {
+		query := buildSearchQuery(url, "", "", "", startDate, endDate)
+		search.Add(elastic.NewSearchRequest().Index(resourcesIndex).Query(query).Size(defaultPaginationSize))
+	}
+
+	res, err := search.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Responses are returned in the same order as the requests
+	resources := make([][]api.ResourceDto, len(urls))
+	for i := range urls {
+		if i >= len(res.Responses) {
+			break
+		}
+		resources[i] = readResources(res.Responses[i], false)
+	}
+
+	return resources, nil
+}
+
+func (s *elasticStorage) lastResource(ctx context.Context, url string) (*api.ResourceDto, error) {
+	hit, err := s.lastHit(ctx, url)
+	if err != nil || hit == nil {
+		return nil, err
+	}
+
+	var doc resourceIndex
+	if err := json.Unmarshal(hit.Source, &doc); err != nil {
+		return nil, err
+	}
+
+	resource := doc.dto()
+	return &resource, nil
+}
+
+// lastHit returns the search hit of the last crawled resource of given URL (nil if never crawled)
+func (s *elasticStorage) lastHit(ctx context.Context, url string) (*elastic.SearchHit, error) {
+	// Only the last crawled resource is needed: no need to count them
+	res, err := s.es.Search().
+		Index(resourcesIndex).
+		Query(buildSearchQuery(url, "", "", "", time.Time{}, time.Time{})).
+		Sort("time", false).
+		Size(1).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Hits == nil || len(res.Hits.Hits) == 0 {
+		return nil, nil
+	}
+	return res.Hits.Hits[0], nil
+}
+
+func (s *elasticStorage) deleteResources(ctx context.Context, url string) (int64, error) {
+	res, err := s.es.DeleteByQuery(resourcesIndex).
+		Query(buildSearchQuery(url, "", "", "", time.Time{}, time.Time{})).
+		Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.Deleted, nil
+}
+
+func (s *elasticStorage) addResource(ctx context.Context, res api.ResourceDto) error {
+	// Create Elasticsearch document
+	doc := resourceIndex{
+		URL:          res.URL,
+		Body:         res.Body,
+		Title:        res.Title,
+		Time:         res.Time,
+		ContentHash:  res.ContentHash,
+		BodySize:     len(res.Body),
+		Truncated:    res.Truncated,
+		UserAgent:    res.UserAgent,
+		Language:     res.Language,
+		Charset:      res.Charset,
+		Keywords:     res.Keywords,
+		Source:       res.Source,
+		ResponseCode: res.ResponseCode,
+		BodyURL:      res.BodyURL,
+	}
+
+	_, err := s.es.Index().
+		Index(resourcesIndex).
+		BodyJson(doc).
+		Do(ctx)
+	return err
+}
+
+func (s *elasticStorage) setBodyURL(ctx context.Context, url, bodyURL string) (bool, error) {
+	hit, err := s.lastHit(ctx, url)
+	if err != nil || hit == nil {
+		return false, err
+	}
+
+	// The body size is kept as is
+	_, err = s.es.Update().
+		Index(resourcesIndex).
+		Id(hit.Id).
+		Doc(map[string]interface{}{"body": "", "body_url": bodyURL}).
+		Do(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// buildResourceQuery returns the Elasticsearch query matching given resource query
+func buildResourceQuery(q resourceQuery) elastic.Query {
+	query := buildSearchQuery(q.url, q.keyword, q.title, q.language, q.startDate, q.endDate)
+	if q.minSize != 0 || q.maxSize != 0 {
+		query = elastic.NewBoolQuery().Must(query, buildSizeQuery(q.minSize, q.maxSize))
+	}
+	if q.contentHash != "" {
+		log.Trace().Str("content_hash", q.contentHash).Msg("SearchQuery: Setting content hash")
+		query = elastic.NewBoolQuery().Must(query, elastic.NewTermQuery("content_hash", q.contentHash))
+	}
+	if q.charset != "" {
+		log.Trace().Str("charset", q.charset).Msg("SearchQuery: Setting charset")
+		query = elastic.NewBoolQuery().Must(query, elastic.NewTermQuery("charset", strings.ToLower(q.charset)))
+	}
+	for _, keyword := range q.extractedKeywords {
+		log.Trace().Str("keyword", keyword).Msg("SearchQuery: Setting keyword")
+		query = elastic.NewBoolQuery().Must(query, elastic.NewTermQuery("keywords", keyword))
+	}
+	if q.source != "" {
+		log.Trace().Str("source", q.source).Msg("SearchQuery: Setting source")
+		query = elastic.NewBoolQuery().Must(query, elastic.NewTermQuery("source", q.source))
+	}
+	if q.responseCode != 0 {
+		log.Trace().Int("response_code", q.responseCode).Msg("SearchQuery: Setting response code")
+		query = elastic.NewBoolQuery().Must(query, elastic.NewTermQuery("response_code", q.responseCode))
+	}
+
+	return query
+}
+
+func buildSearchQuery(url, keyword, title, language string, startDate, endDate time.Time) elastic.Query {
+	var queries []elastic.Query
+	if url != "" {
+		log.Trace().Str("url", url).Msg("SearchQuery: Setting url")
+		queries = append(queries, elastic.NewTermQuery("url", url))
+	}
+	if keyword != "" {
+		log.Trace().Str("body", keyword).Msg("SearchQuery: Setting body")
+		queries = append(queries, elastic.NewTermQuery("body", keyword))
+	}
+	if title != "" {
+		log.Trace().Str("title", title).Msg("SearchQuery: Setting title")
+		queries = append(queries, elastic.NewMatchQuery("title", title))
+	}
+	if language != "" {
+		log.Trace().Str("language", language).Msg("SearchQuery: Setting language")
+		queries = append(queries, elastic.NewTermQuery("language", language))
+	}
+	if !startDate.IsZero() || !endDate.IsZero() {
+		timeQuery := elastic.NewRangeQuery("time")
+
+		if !startDate.IsZero() {
+			log.Trace().Str("startDate", startDate.Format(time.RFC3339)).Msg("SearchQuery: Setting startDate")
+			timeQuery.Gte(startDate.Format(time.RFC3339))
+		}
+		if !endDate.IsZero() {
+			log.Trace().Str("endDate", endDate.Format(time.RFC3339)).Msg("SearchQuery: Setting endDate")
+			timeQuery.Lte(endDate.Format(time.RFC3339))
+		}
+		queries = append(queries, timeQuery)
+	}
+
+	// Handle specific case
+	if len(queries) == 0 {
+		return elastic.NewMatchAllQuery()
+	}
+	if len(queries) == 1 {
+		return queries[0]
+	}
+
+	// otherwise AND combine them
+	return elastic.NewBoolQuery().Must(queries...)
+}
+
+// buildSizeQuery returns the query matching the resources whose body size is within given bounds (0 = unbounded).
+// the resources saved without body size never match
+func buildSizeQuery(minSize, maxSize int64) elastic.Query {
+	sizeQuery := elastic.NewRangeQuery("body_size")
+	if minSize != 0 {
+		log.Trace().Int64("minSize", minSize).Msg("SearchQuery: Setting minSize")
+		sizeQuery.Gte(minSize)
+	}
+	if maxSize != 0 {
+		log.Trace().Int64("maxSize", maxSize).Msg("SearchQuery: Setting maxSize")
+		sizeQuery.Lte(maxSize)
+	}
+
+	return sizeQuery
+}
+
+func readResources(res *elastic.SearchResult, withBody bool) []api.ResourceDto {
+	var resources []api.ResourceDto
+	if res == nil || res.Hits == nil {
+		return resources
+	}
+
+	for _, hit := range res.Hits.Hits {
+		var doc resourceIndex
+		if err := json.Unmarshal(hit.Source, &doc); err != nil {
+			log.Warn().Str("err", err.Error()).Msg("Error while un-marshaling resource")
+			continue
+		}
+		resource := doc.dto()
+
+		// Remove body if not wanted
+		if !withBody {
+			resource.Body = ""
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources
+}
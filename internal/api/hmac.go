@@ -0,0 +1,54 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxSignatureAge is the maximum difference between the signature timestamp and the server time
+const maxSignatureAge = 5 * time.Minute
+
+// hmacAuth returns a middleware rejecting the requests not signed using given shared secret,
+// or signed more than maxSignatureAge ago (or in the future)
+func hmacAuth(secret string, now func() time.Time) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			timestamp := req.Header.Get(api.TimestampHeader)
+			signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				log.Debug().Str("uri", req.RequestURI).Msg("Rejecting request with missing or invalid timestamp")
+				return c.NoContent(http.StatusUnauthorized)
+			}
+
+			age := now().Sub(time.Unix(signedAt, 0))
+			if age > maxSignatureAge || age < -maxSignatureAge {
+				log.Debug().Str("uri", req.RequestURI).Dur("age", age).Msg("Rejecting expired request")
+				return c.NoContent(http.StatusUnauthorized)
+			}
+
+			// Read the body to check the signature then restore it for the handler
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return c.NoContent(http.StatusBadRequest)
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			expected := api.Sign(secret, req.Method, req.URL.RequestURI(), timestamp, body)
+			if !hmac.Equal([]byte(expected), []byte(req.Header.Get(api.SignatureHeader))) {
+				log.Debug().Str("uri", req.RequestURI).Msg("Rejecting request with invalid signature")
+				return c.NoContent(http.StatusUnauthorized)
+			}
+
+			return next(c)
+		}
+	}
+}
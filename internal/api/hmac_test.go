@@ -0,0 +1,94 @@
+package api
+
+import (
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMACAuth(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	e := echo.New()
+	e.Use(hmacAuth("secret", func() time.Time { return now }))
+	e.POST("/v1/urls", func(c echo.Context) error {
+		// The body should still be readable
+		b, err := ioutil.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(b))
+	})
+
+	signedRequest := func(secret string, signedAt time.Time, signedBody, body string) *http.Request {
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/v1/urls?a=b", strings.NewReader(body))
+		req.Header.Set(api.TimestampHeader, timestamp)
+		req.Header.Set(api.SignatureHeader, api.Sign(secret, http.MethodPost, "/v1/urls?a=b", timestamp, []byte(signedBody)))
+		return req
+	}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"valid", signedRequest("secret", now, `"url"`, `"url"`), http.StatusOK},
+		{"clock skew", signedRequest("secret", now.Add(4*time.Minute), `"url"`, `"url"`), http.StatusOK},
+		{"expired", signedRequest("secret", now.Add(-6*time.Minute), `"url"`, `"url"`), http.StatusUnauthorized},
+		{"future", signedRequest("secret", now.Add(6*time.Minute), `"url"`, `"url"`), http.StatusUnauthorized},
+		{"tampered body", signedRequest("secret", now, `"url"`, `"other"`), http.StatusUnauthorized},
+		{"wrong secret", signedRequest("other", now, `"url"`, `"url"`), http.StatusUnauthorized},
+		{"unsigned", httptest.NewRequest(http.MethodPost, "/v1/urls", strings.NewReader(`"url"`)), http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, test.req)
+
+		if rec.Code != test.status {
+			t.Errorf("%s: Wanted: %d Got: %d", test.name, test.status, rec.Code)
+		}
+		if rec.Code == http.StatusOK && rec.Body.String() != `"url"` {
+			t.Errorf("%s: Wanted: \"url\" Got: %s", test.name, rec.Body.String())
+		}
+	}
+
+	// Tampered query string
+	req := signedRequest("secret", now, `"url"`, `"url"`)
+	req.URL.RawQuery = "a=c"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("tampered query: Wanted: %d Got: %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestHMACAuthClient(t *testing.T) {
+	var called bool
+	e := echo.New()
+	e.Use(hmacAuth("secret", time.Now))
+	e.POST("/v1/urls", func(c echo.Context) error {
+		called = true
+		return c.NoContent(http.StatusOK)
+	})
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	if err := api.NewClient(srv.URL, api.WithHMAC("secret")).ScheduleURL("http://example.onion"); err != nil || !called {
+		t.Error("signed request should be accepted")
+	}
+
+	called = false
+	_ = api.NewClient(srv.URL).ScheduleURL("http://example.onion")
+	if called {
+		t.Error("unsigned request should be rejected")
+	}
+}
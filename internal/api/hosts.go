@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic/v7"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+// maxHostBuckets is the maximum number of hosts aggregated to return a page: later pages are empty
+const maxHostBuckets = 10000
+
+// hostsAggregations returns the aggregations listing the given page of hosts (sorted by name) and counting them
+func hostsAggregations(p pagination) map[string]elastic.Aggregation {
+	script := elastic.NewScript(hostScript)
+	aggs := map[string]elastic.Aggregation{
+		"host_count": elastic.NewCardinalityAggregation().Script(script).PrecisionThreshold(40000),
+	}
+
+	if p.page*p.size > maxHostBuckets {
+		return aggs
+	}
+
+	// The terms are aggregated up to the end of the requested page, which is then selected by the bucket sort
+	hosts := elastic.NewTermsAggregation().
+		Script(script).
+		Size(p.page*p.size).
+		OrderByKeyAsc().
+		SubAggregation("last_crawled", elastic.NewMaxAggregation().Field("time")).
+		SubAggregation("page", elastic.NewBucketSortAggregation().From((p.page-1)*p.size).Size(p.size))
+
+	aggs["hosts"] = hosts
+
+	return aggs
+}
+
+// readHosts returns the page of hosts and their total count from the result of the hosts aggregations
+func readHosts(res *elastic.SearchResult) ([]api.HostDto, int64) {
+	hosts := []api.HostDto{}
+	var count int64
+
+	if agg, found := res.Aggregations.Cardinality("host_count"); found && agg.Value != nil {
+		count = int64(*agg.Value)
+	}
+	if agg, found := res.Aggregations.Terms("hosts"); found {
+		for _, bucket := range agg.Buckets {
+			host, ok := bucket.Key.(string)
+			if !ok {
+				continue
+			}
+
+			dto := api.HostDto{Host: host, ResourceCount: bucket.DocCount}
+			if lastCrawled, found := bucket.Max("last_crawled"); found && lastCrawled.Value != nil {
+				dto.LastCrawled = time.Unix(0, int64(*lastCrawled.Value)*int64(time.Millisecond)).UTC()
+			}
+			hosts = append(hosts, dto)
+		}
+	}
+
+	return hosts, count
+}
+
+func listHosts(store storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p := readPagination(c)
+		if p.page < 1 {
+			p.page = 1
+		}
+
+		hosts, count, err := store.listHosts(c.Request().Context(), p)
+		if err != nil {
+			log.Err(err).Msg("Error while listing hosts")
+			return c.NoContent(http.StatusInternalServerError)
+		}
+
+		writePagination(c, p, count)
+
+		return c.JSON(http.StatusOK, hosts)
+	}
+}
+
+func (s *elasticStorage) listHosts(ctx context.Context, p pagination) ([]api.HostDto, int64, error) {
+	// Only the aggregations are needed
+	search := s.es.Search().
+		Index(resourcesIndex).
+		Query(elastic.NewMatchAllQuery()).
+		Size(0)
+	for name, agg := range hostsAggregations(p) {
+		search = search.Aggregation(name, agg)
+	}
+
+	res, err := search.Do(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hosts, count := readHosts(res)
+	return hosts, count, nil
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic/v7"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostsAggregations(t *testing.T) {
+	aggs := hostsAggregations(pagination{page: 3, size: 20})
+
+	src, err := aggs["hosts"].Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"aggregations":{"last_crawled":{"max":{"field":"time"}},"page":{"bucket_sort":{"from":40,"size":20}}},` +
+		`"terms":{"order":[{"_key":"asc"}],"script":{"source":` + mustMarshal(t, strings.TrimSpace(hostScript)) + `},"size":60}}`
+	if got := mustMarshal(t, src); got != want {
+		t.Errorf("Wanted: %s Got: %s", want, got)
+	}
+
+	if _, found := aggs["host_count"]; !found {
+		t.Error("hosts should be counted")
+	}
+
+	// Pages past the maximum number of buckets are not aggregated
+	if _, found := hostsAggregations(pagination{page: 101, size: 100})["hosts"]; found {
+		t.Error("hosts should not be aggregated")
+	}
+}
+
+// newHostsESServer returns a fake Elasticsearch server aggregating given hosts (sorted by name)
+func newHostsESServer(t *testing.T, hosts []api.HostDto) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Size         int `json:"size"`
+			Aggregations struct {
+				Hosts *struct {
+					Aggregations struct {
+						Page struct {
+							BucketSort struct {
+								From int `json:"from"`
+								Size int `json:"size"`
+							} `json:"bucket_sort"`
+						} `json:"page"`
+					} `json:"aggregations"`
+				} `json:"hosts"`
+			} `json:"aggregations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if req.Size != 0 {
+			t.Errorf("Wanted: 0 hits Got: %d", req.Size)
+		}
+
+		var buckets []string
+		if req.Aggregations.Hosts != nil {
+			from, size := req.Aggregations.Hosts.Aggregations.Page.BucketSort.From, req.Aggregations.Hosts.Aggregations.Page.BucketSort.Size
+			for i := from; i < from+size && i < len(hosts); i++ {
+				buckets = append(buckets, fmt.Sprintf(`{"key": %q, "doc_count": %d, "last_crawled": {"value": %d}}`,
+					hosts[i].Host, hosts[i].ResourceCount, hosts[i].LastCrawled.UnixNano()/int64(time.Millisecond)))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{
+			"hits": {"total": {"value": 0, "relation": "gte"}, "hits": []},
+			"aggregations": {
+				"host_count": {"value": %d},
+				"hosts": {"buckets": [%s]}
+			}
+		}`, len(hosts), strings.Join(buckets, ","))
+	}))
+}
+
+func TestListHosts(t *testing.T) {
+	var hosts []api.HostDto
+	for i := 0; i < 5; i++ {
+		hosts = append(hosts, api.HostDto{
+			Host:          fmt.Sprintf("host%d.onion", i),
+			ResourceCount: int64(10 * (i + 1)),
+			LastCrawled:   time.Date(2021, 3, i+1, 12, 0, 0, 0, time.UTC),
+		})
+	}
+
+	esSrv := newHostsESServer(t, hosts)
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	e := echo.New()
+	e.GET("/v1/hosts", listHosts(&elasticStorage{es: es}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	client := api.NewClient(srv.URL)
+
+	tests := []struct {
+		page int
+		want []api.HostDto
+	}{
+		{1, hosts[0:2]},
+		{2, hosts[2:4]},
+		{3, hosts[4:5]},
+		{4, []api.HostDto{}},
+	}
+	for _, test := range tests {
+		page, count, err := client.ListHosts(test.page, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 5 {
+			t.Errorf("page %d: Wanted: 5 hosts Got: %d", test.page, count)
+		}
+		if mustMarshal(t, page) != mustMarshal(t, test.want) {
+			t.Errorf("page %d: Wanted: %+v Got: %+v", test.page, test.want, page)
+		}
+	}
+
+	// Pages past the maximum number of buckets are empty but still counted
+	page, count, err := client.ListHosts(maxHostBuckets, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 || len(page) != 0 {
+		t.Errorf("Got: %+v (count: %d)", page, count)
+	}
+}
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS resources (
+    id           BIGSERIAL PRIMARY KEY,
+    url          TEXT        NOT NULL,
+    body         TEXT        NOT NULL DEFAULT '',
+    title        TEXT        NOT NULL DEFAULT '',
+    time         TIMESTAMPTZ NOT NULL,
+    content_hash TEXT        NOT NULL DEFAULT '',
+    body_size    INTEGER     NOT NULL DEFAULT 0,
+    truncated    BOOLEAN     NOT NULL DEFAULT FALSE,
+    user_agent   TEXT        NOT NULL DEFAULT '',
+    language     TEXT        NOT NULL DEFAULT '',
+    charset      TEXT        NOT NULL DEFAULT '',
+    keywords     TEXT[]      NOT NULL DEFAULT '{}',
+    source       TEXT        NOT NULL DEFAULT '',
+    status_code  INTEGER     NOT NULL DEFAULT 0,
+    body_url     TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS resources_url_time_idx ON resources (url, time DESC);
+CREATE INDEX IF NOT EXISTS resources_time_id_idx ON resources (time, id);
+CREATE INDEX IF NOT EXISTS resources_content_hash_idx ON resources (content_hash);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS crawls (
+    id          BIGSERIAL PRIMARY KEY,
+    url         TEXT        NOT NULL,
+    status_code INTEGER     NOT NULL DEFAULT 0,
+    time        TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS crawls_url_idx ON crawls (url);
@@ -0,0 +1 @@
+ALTER TABLE resources RENAME COLUMN response_code TO status_code;
@@ -0,0 +1 @@
+ALTER TABLE resources RENAME COLUMN status_code TO response_code;
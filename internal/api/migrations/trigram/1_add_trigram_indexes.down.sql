@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS resources_title_trgm_idx;
+DROP INDEX IF EXISTS resources_body_trgm_idx;
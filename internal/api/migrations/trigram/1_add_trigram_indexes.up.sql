@@ -0,0 +1,4 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS resources_body_trgm_idx ON resources USING GIN (body gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS resources_title_trgm_idx ON resources USING GIN (title gin_trgm_ops);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS resources_title_tsv_idx;
+DROP INDEX IF EXISTS resources_body_tsv_idx;
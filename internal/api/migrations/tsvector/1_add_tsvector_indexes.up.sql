@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS resources_body_tsv_idx ON resources USING GIN (to_tsvector('simple', body));
+CREATE INDEX IF NOT EXISTS resources_title_tsv_idx ON resources USING GIN (to_tsvector('simple', title));
@@ -0,0 +1,389 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildResourceWhere(t *testing.T) {
+	where, args := buildResourceWhere(resourceQuery{}, ftsTSVector)
+	if where != "" || args != nil {
+		t.Errorf("Wanted: empty clause Got: %s %v", where, args)
+	}
+
+	startDate := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	where, args = buildResourceWhere(resourceQuery{
+		keyword:           "onion",
+		startDate:         startDate,
+		charset:           "UTF-8",
+		extractedKeywords: []string{"forum", "market"},
+	}, ftsTSVector)
+
+	wantedWhere := " WHERE to_tsvector('simple', body) @@ plainto_tsquery('simple', $1) AND time >= $2" +
+		" AND lower(charset) = $3 AND $4 = ANY(keywords) AND $5 = ANY(keywords)"
+	if where != wantedWhere {
+		t.Errorf("Wanted: %s Got: %s", wantedWhere, where)
+	}
+
+	wantedArgs := []interface{}{"onion", startDate, "utf-8", "forum", "market"}
+	if !reflect.DeepEqual(args, wantedArgs) {
+		t.Errorf("Wanted: %v Got: %v", wantedArgs, args)
+	}
+}
+
+func TestBuildResourceWhereTrigram(t *testing.T) {
+	where, args := buildResourceWhere(resourceQuery{keyword: `100%_\`, title: "Forum"}, ftsTrigram)
+
+	wantedWhere := " WHERE body ILIKE $1 AND title ILIKE $2"
+	if where != wantedWhere {
+		t.Errorf("Wanted: %s Got: %s", wantedWhere, where)
+	}
+
+	wantedArgs := []interface{}{`%100\%\_\\%`, "%Forum%"}
+	if !reflect.DeepEqual(args, wantedArgs) {
+		t.Errorf("Wanted: %v Got: %v", wantedArgs, args)
+	}
+}
+
+func TestMigrationsFTSEngines(t *testing.T) {
+	for _, engine := range []string{ftsTSVector, ftsTrigram} {
+		entries, err := fs.ReadDir(migrations, "migrations/"+engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			t.Errorf("no migrations for the %s engine", engine)
+		}
+	}
+}
+
+func TestReadSortValues(t *testing.T) {
+	afterTime, afterID, err := readSortValues([]interface{}{"2021-01-01T10:00:00.5Z", json.Number("42")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !afterTime.Equal(time.Date(2021, 1, 1, 10, 0, 0, 500000000, time.UTC)) {
+		t.Errorf("Wrong time: %v", afterTime)
+	}
+	if afterID != 42 {
+		t.Errorf("Wanted: 42 Got: %d", afterID)
+	}
+
+	if _, _, err := readSortValues([]interface{}{json.Number("12"), json.Number("42")}); err == nil {
+		t.Error("Invalid cursor should be rejected")
+	}
+}
+
+// runPostgres start a PostgreSQL container and returns its DSN, the test is skipped if Docker is not available
+func runPostgres(t testing.TB) string {
+	if testing.Short() {
+		t.Skip("Skipping PostgreSQL integration test in short mode")
+	}
+
+	ctx := context.Background()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "postgres:13-alpine",
+			ExposedPorts: []string{"5432/tcp"},
+			Env:          map[string]string{"POSTGRES_USER": "tdsh", "POSTGRES_PASSWORD": "tdsh"},
+			WaitingFor: wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Skipf("Docker is not available: %s", err)
+	}
+	t.Cleanup(func() { _ = container.Terminate(ctx) })
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("postgres://tdsh:tdsh@%s:%s/tdsh?sslmode=disable", host, port.Port())
+}
+
+func TestPostgresStorage(t *testing.T) {
+	dsn := runPostgres(t)
+
+	store, err := openPostgresStorage(dsn, ftsTSVector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	// Migrating an up-to-date schema is a no-op
+	if err := migrateSchema(store.db, ftsTSVector); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the indexes of the engine in use are created
+	var extensions, tsvIndexes int
+	if err := store.db.QueryRow("SELECT count(*) FROM pg_extension WHERE extname = 'pg_trgm'").
+		Scan(&extensions); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.db.QueryRow("SELECT count(*) FROM pg_indexes WHERE indexname LIKE 'resources_%_tsv_idx'").
+		Scan(&tsvIndexes); err != nil {
+		t.Fatal(err)
+	}
+	if extensions != 0 || tsvIndexes != 2 {
+		t.Errorf("Wanted: no pg_trgm extension and 2 tsvector indexes Got: %d %d", extensions, tsvIndexes)
+	}
+
+	ctx := context.Background()
+	crawlTime := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, title := range []string{"Example forum", "Example market", "Another forum"} {
+		if err := store.addResource(ctx, api.ResourceDto{
+			URL:      "https://example.onion",
+			Body:     "Welcome to the " + title,
+			Title:    title,
+			Time:     crawlTime.Add(time.Duration(i) * time.Hour),
+			Charset:  "UTF-8",
+			Keywords: []string{"example"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Full text search & pagination
+	res, total, next, err := store.searchResources(ctx, resourceQuery{title: "forum"}, 0, 1, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(res) != 1 || res[0].Title != "Example forum" || res[0].Body != "" {
+		t.Fatalf("Wrong first page: %d %v", total, res)
+	}
+
+	cursor, err := encodeCursor(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, _, _, err = store.searchResources(ctx, resourceQuery{title: "forum"}, 0, 1, after, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Title != "Another forum" || res[0].Body != "Welcome to the Another forum" {
+		t.Fatalf("Wrong second page: %v", res)
+	}
+
+	// Keywords & charset filters
+	_, total, _, err = store.searchResources(ctx,
+		resourceQuery{charset: "utf-8", extractedKeywords: []string{"example"}}, 0, 10, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Errorf("Wanted: 3 Got: %d", total)
+	}
+
+	last, err := store.lastResource(ctx, "https://example.onion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.Title != "Another forum" {
+		t.Fatalf("Wrong last resource: %v", last)
+	}
+
+	ok, err := store.setBodyURL(ctx, "https://example.onion", "s3://bodies/example")
+	if err != nil || !ok {
+		t.Fatalf("Body URL not set: %v", err)
+	}
+	if last, _ = store.lastResource(ctx, "https://example.onion"); last.BodyURL != "s3://bodies/example" {
+		t.Errorf("Wanted: s3://bodies/example Got: %s", last.BodyURL)
+	}
+
+	bulk, err := store.searchResourcesBulk(ctx, []string{"https://example.onion", "https://unknown.onion"},
+		crawlTime.Add(time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bulk[0]) != 2 || len(bulk[1]) != 0 {
+		t.Errorf("Wrong bulk search result: %v", bulk)
+	}
+
+	count, err := store.deleteResources(ctx, "https://example.onion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Wanted: 3 Got: %d", count)
+	}
+	if last, _ = store.lastResource(ctx, "https://example.onion"); last != nil {
+		t.Errorf("Resource not deleted: %v", last)
+	}
+}
+
+func TestPostgresStorageTrigram(t *testing.T) {
+	dsn := runPostgres(t)
+
+	store, err := openPostgresStorage(dsn, ftsTrigram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	ctx := context.Background()
+	for _, title := range []string{"Marketplace", "Forum", "100% anonymous"} {
+		res := api.ResourceDto{URL: "https://example.onion", Title: title, Time: time.Now()}
+		if err := store.addResource(ctx, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Substrings are matched, whatever their case
+	res, total, _, err := store.searchResources(ctx, resourceQuery{title: "market"}, 0, 10, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || res[0].Title != "Marketplace" {
+		t.Errorf("Wrong search result: %d %v", total, res)
+	}
+
+	// The LIKE wildcards are matched literally
+	_, total, _, err = store.searchResources(ctx, resourceQuery{title: "%"}, 0, 10, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Errorf("Wanted: 1 Got: %d", total)
+	}
+}
+
+// BenchmarkPostgresSearch compare the keyword search of the full text search engines (using their GIN indexes) with
+// a naive scan (the trigram search without its indexes). Inserting 10M resources takes a while: use -benchtime 1x
+func BenchmarkPostgresSearch(b *testing.B) {
+	dsn := runPostgres(b)
+
+	store, err := openPostgresStorage(dsn, ftsTSVector)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer store.close()
+
+	// Create the indexes of both engines
+	if err := migrateSchema(store.db, ftsTrigram); err != nil {
+		b.Fatal(err)
+	}
+
+	// The SET statements apply to the session: use a single connection
+	store.db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	count := 0
+	for _, size := range []int{100000, 1000000, 10000000} {
+		// Grow the table up to size resources, one in 1000 containing the searched keyword
+		if _, err := store.db.ExecContext(ctx, `INSERT INTO resources (url, body, title, time)
+			SELECT 'https://' || i || '.onion', 'resource ' || i || CASE WHEN i % 1000 = 0 THEN ' needle' ELSE '' END,
+				'title ' || i, now() FROM generate_series($1::int, $2::int) AS i`, count+1, size); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := store.db.ExecContext(ctx, "ANALYZE resources"); err != nil {
+			b.Fatal(err)
+		}
+		count = size
+
+		for _, engine := range []string{ftsTSVector, ftsTrigram} {
+			store.ftsEngine = engine
+			b.Run(fmt.Sprintf("%s-%d", engine, size), func(b *testing.B) {
+				benchmarkSearch(ctx, b, store)
+			})
+		}
+
+		// Naive scan: same query with the trigram indexes disabled
+		store.ftsEngine = ftsTrigram
+		b.Run(fmt.Sprintf("scan-%d", size), func(b *testing.B) {
+			if _, err := store.db.ExecContext(ctx, "SET enable_bitmapscan = off"); err != nil {
+				b.Fatal(err)
+			}
+			defer store.db.ExecContext(ctx, "SET enable_bitmapscan = on")
+
+			benchmarkSearch(ctx, b, store)
+		})
+	}
+}
+
+func benchmarkSearch(ctx context.Context, b *testing.B, store *postgresStorage) {
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := store.searchResources(ctx, resourceQuery{keyword: "needle"}, 0, 50, nil, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPostgresStorageAggregations(t *testing.T) {
+	dsn := runPostgres(t)
+
+	store, err := openPostgresStorage(dsn, ftsTSVector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for _, res := range []api.ResourceDto{
+		{URL: "https://a.onion/index.html", Body: "1234", Time: now.Add(-48 * time.Hour)},
+		{URL: "https://a.onion/about.html", Body: "12", Time: now.Add(-time.Hour)},
+		{URL: "b.onion/no-protocol.html", Body: "123456", Time: now.Add(-60 * 24 * time.Hour)},
+	} {
+		if err := store.addResource(ctx, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := store.getStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ResourceCount != 3 || stats.HostCount != 2 || stats.ResourceCountLast24h != 1 ||
+		stats.ResourceCountLast7d != 2 || stats.ResourceCountLast30d != 2 || stats.AverageBodySize != 4 {
+		t.Errorf("Wrong stats: %+v", stats)
+	}
+	if len(stats.TopHosts) != 2 || stats.TopHosts[0] != (api.HostStatsDto{Host: "a.onion", ResourceCount: 2}) {
+		t.Errorf("Wrong top hosts: %+v", stats.TopHosts)
+	}
+
+	hosts, count, err := store.listHosts(ctx, pagination{page: 2, size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(hosts) != 1 || hosts[0].Host != "b.onion" || hosts[0].ResourceCount != 1 ||
+		!hosts[0].LastCrawled.Equal(now.Add(-60*24*time.Hour)) {
+		t.Errorf("Wrong hosts: %d %+v", count, hosts)
+	}
+
+	for _, statusCode := range []int{404, 0, 404, 200} {
+		if err := store.recordCrawl(ctx, "https://a.onion/index.html", statusCode, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := store.getCrawlHistory(ctx, "https://a.onion/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Attempts != 4 || history.StatusCodes[404] != 2 || history.StatusCodes[0] != 1 ||
+		history.StatusCodes[200] != 1 {
+		t.Errorf("Wrong crawl history: %+v", history)
+	}
+}
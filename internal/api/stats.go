@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic/v7"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+const topHostsSize = 10
+
+// hostScript extract the host of the resource URL, stored with or without protocol.
+// URLs longer than the keyword limit (256 characters) are not indexed as keyword: they are ignored
+const hostScript = `
+if (doc['url.keyword'].size() == 0) {
+	return null;
+}
+String u = doc['url.keyword'].value;
+int i = u.indexOf('://');
+if (i >= 0) {
+	u = u.substring(i + 3);
+}
+i = u.indexOf('/');
+return i >= 0 ? u.substring(0, i) : u;
+`
+
+// statsAggregations returns the aggregations computing the crawl statistics, by name
+func statsAggregations() map[string]elastic.Aggregation {
+	script := elastic.NewScript(hostScript)
+
+	return map[string]elastic.Aggregation{
+		"host_count": elastic.NewCardinalityAggregation().Script(script).PrecisionThreshold(40000),
+		"top_hosts":  elastic.NewTermsAggregation().Script(script).Size(topHostsSize),
+		"last_24h":   elastic.NewFilterAggregation().Filter(elastic.NewRangeQuery("time").Gte("now-24h")),
+		"last_7d":    elastic.NewFilterAggregation().Filter(elastic.NewRangeQuery("time").Gte("now-7d")),
+		"last_30d":   elastic.NewFilterAggregation().Filter(elastic.NewRangeQuery("time").Gte("now-30d")),
+		"body_size":  elastic.NewAvgAggregation().Field("body_size"),
+	}
+}
+
+// readStats returns the crawl statistics from the result of the statistics aggregations
+func readStats(res *elastic.SearchResult) api.StatsDto {
+	stats := api.StatsDto{
+		ResourceCount: res.TotalHits(),
+		TopHosts:      []api.HostStatsDto{},
+	}
+
+	if agg, found := res.Aggregations.Cardinality("host_count"); found && agg.Value != nil {
+		stats.HostCount = int64(*agg.Value)
+	}
+	if agg, found := res.Aggregations.Terms("top_hosts"); found {
+		for _, bucket := range agg.Buckets {
+			host, ok := bucket.Key.(string)
+			if !ok {
+				continue
+			}
+			stats.TopHosts = append(stats.TopHosts, api.HostStatsDto{Host: host, ResourceCount: bucket.DocCount})
+		}
+	}
+	if agg, found := res.Aggregations.Filter("last_24h"); found {
+		stats.ResourceCountLast24h = agg.DocCount
+	}
+	if agg, found := res.Aggregations.Filter("last_7d"); found {
+		stats.ResourceCountLast7d = agg.DocCount
+	}
+	if agg, found := res.Aggregations.Filter("last_30d"); found {
+		stats.ResourceCountLast30d = agg.DocCount
+	}
+	if agg, found := res.Aggregations.Avg("body_size"); found && agg.Value != nil {
+		stats.AverageBodySize = *agg.Value
+	}
+
+	return stats
+}
+
+func getStats(store storage) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		stats, err := store.getStats(c.Request().Context())
+		if err != nil {
+			log.Err(err).Msg("Error while computing stats")
+			return c.NoContent(http.StatusInternalServerError)
+		}
+
+		return c.JSON(http.StatusOK, stats)
+	}
+}
+
+func (s *elasticStorage) getStats(ctx context.Context) (api.StatsDto, error) {
+	// Only the aggregations are needed
+	search := s.es.Search().
+		Index(resourcesIndex).
+		Query(elastic.NewMatchAllQuery()).
+		TrackTotalHits(true).
+		Size(0)
+	for name, agg := range statsAggregations() {
+		search = search.Aggregation(name, agg)
+	}
+
+	res, err := search.Do(ctx)
+	if err != nil {
+		return api.StatsDto{}, err
+	}
+
+	return readStats(res), nil
+}
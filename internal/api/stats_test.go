@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic/v7"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatsAggregations(t *testing.T) {
+	want := map[string]string{
+		"host_count": `{"cardinality":{"precision_threshold":40000,"script":{"source":` +
+			mustMarshal(t, strings.TrimSpace(hostScript)) + `}}}`,
+		"top_hosts": `{"terms":{"script":{"source":` + mustMarshal(t, strings.TrimSpace(hostScript)) + `},"size":10}}`,
+		"last_24h":  `{"filter":{"range":{"time":{"from":"now-24h","include_lower":true,"include_upper":true,"to":null}}}}`,
+		"last_7d":   `{"filter":{"range":{"time":{"from":"now-7d","include_lower":true,"include_upper":true,"to":null}}}}`,
+		"last_30d":  `{"filter":{"range":{"time":{"from":"now-30d","include_lower":true,"include_upper":true,"to":null}}}}`,
+		"body_size": `{"avg":{"field":"body_size"}}`,
+	}
+
+	aggs := statsAggregations()
+	if len(aggs) != len(want) {
+		t.Errorf("Wanted: %d aggregations Got: %d", len(want), len(aggs))
+	}
+
+	for name, agg := range aggs {
+		src, err := agg.Source()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mustMarshal(t, src); got != want[name] {
+			t.Errorf("%s: Wanted: %s Got: %s", name, want[name], got)
+		}
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	// Fake Elasticsearch server returning the aggregations results
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body := string(b)
+		if !strings.Contains(body, `"size":0`) || !strings.Contains(body, `"track_total_hits":true`) {
+			t.Errorf("invalid search request: %s", body)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"hits": {"total": {"value": 1500, "relation": "eq"}, "hits": []},
+			"aggregations": {
+				"host_count": {"value": 42},
+				"top_hosts": {"buckets": [{"key": "a.onion", "doc_count": 900}, {"key": "b.onion", "doc_count": 100}]},
+				"last_24h": {"doc_count": 10},
+				"last_7d": {"doc_count": 70},
+				"last_30d": {"doc_count": 300},
+				"body_size": {"value": 2048.5}
+			}
+		}`))
+	}))
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	e := echo.New()
+	e.GET("/v1/stats", getStats(&elasticStorage{es: es}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	stats, err := api.NewClient(srv.URL).GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := api.StatsDto{
+		ResourceCount:        1500,
+		HostCount:            42,
+		ResourceCountLast24h: 10,
+		ResourceCountLast7d:  70,
+		ResourceCountLast30d: 300,
+		AverageBodySize:      2048.5,
+		TopHosts:             []api.HostStatsDto{{Host: "a.onion", ResourceCount: 900}, {Host: "b.onion", ResourceCount: 100}},
+	}
+	if mustMarshal(t, stats) != mustMarshal(t, want) {
+		t.Errorf("Wanted: %+v Got: %+v", want, stats)
+	}
+}
+
+func TestReadStatsEmptyIndex(t *testing.T) {
+	var res elastic.SearchResult
+	if err := json.Unmarshal([]byte(`{
+		"hits": {"total": {"value": 0, "relation": "eq"}, "hits": []},
+		"aggregations": {
+			"host_count": {"value": 0},
+			"top_hosts": {"buckets": []},
+			"last_24h": {"doc_count": 0},
+			"last_7d": {"doc_count": 0},
+			"last_30d": {"doc_count": 0},
+			"body_size": {"value": null}
+		}
+	}`), &res); err != nil {
+		t.FailNow()
+	}
+
+	stats := readStats(&res)
+	if stats.ResourceCount != 0 || stats.AverageBodySize != 0 || stats.TopHosts == nil || len(stats.TopHosts) != 0 {
+		t.Errorf("Got: %+v", stats)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"time"
+)
+
+const (
+	storageElasticsearch = "elasticsearch"
+	storagePostgres      = "postgres"
+)
+
+// resourceQuery select the resources to search. Empty fields match every resource
+type resourceQuery struct {
+	url         string
+	keyword     string
+	title       string
+	language    string
+	contentHash string
+	charset     string
+	source      string
+	// extractedKeywords must all be extracted keywords of the resources
+	extractedKeywords []string
+	startDate         time.Time
+	endDate           time.Time
+	// minSize & maxSize bound the body size (0 = unbounded)
+	minSize      int64
+	maxSize      int64
+	responseCode int
+}
+
+// storage persists the crawled resources
+type storage interface {
+	// searchResources returns the resources matching given query sorted by crawl time, starting at from or after
+	// the given sort values, along with their total count and the sort values of the last returned resource
+	// if the page is full (nil otherwise)
+	searchResources(ctx context.Context, q resourceQuery, from, size int, after []interface{},
+		withBody bool) ([]api.ResourceDto, int64, []interface{}, error)
+	// searchResourcesBulk returns the resources crawled at each of given URLs between given dates, in the same order
+	searchResourcesBulk(ctx context.Context, urls []string, startDate, endDate time.Time) ([][]api.ResourceDto, error)
+	// lastResource returns the last crawled resource of given URL, body included (nil if never crawled)
+	lastResource(ctx context.Context, url string) (*api.ResourceDto, error)
+	// deleteResources deletes every crawled resource of given URL and returns their count
+	deleteResources(ctx context.Context, url string) (int64, error)
+	addResource(ctx context.Context, res api.ResourceDto) error
+	// setBodyURL replace the body of the last crawled resource of given URL by given URL, false if never crawled
+	setBodyURL(ctx context.Context, url, bodyURL string) (bool, error)
+
+	// getStats returns the crawl statistics of the resources
+	getStats(ctx context.Context) (api.StatsDto, error)
+	// listHosts returns the given page of crawled hosts sorted by name, and their total count
+	listHosts(ctx context.Context, p pagination) ([]api.HostDto, int64, error)
+	// recordCrawl saves the outcome of a crawl of given URL (status code 0 if no response has been received)
+	recordCrawl(ctx context.Context, url string, statusCode int, t time.Time) error
+	// getCrawlHistory returns the number of recorded crawls of given URL by status code
+	getCrawlHistory(ctx context.Context, url string) (api.CrawlHistoryDto, error)
+}
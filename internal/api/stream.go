@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"time"
+)
+
+// streamResources stream the saved resources matching the search query parameters as server-sent events identified
+// by their sequence number. The resources saved after the Last-Event-ID header are replayed first: a gap event is
+// sent when some of them are not kept anymore (or have been dropped because the watcher is too slow)
+func streamResources(hub *resourceHub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		opts, err := readStreamOptions(c)
+		if err != nil {
+			log.Err(err).Msg("Error while parsing stream filter")
+			return c.NoContent(http.StatusUnprocessableEntity)
+		}
+		withBody := c.QueryParam("with-body") == "true"
+
+		ch, replay, lastID, complete := hub.subscribeAfter(c.Request().Header.Get(api.LastEventIDHeader))
+		defer hub.unsubscribe(ch)
+
+		w := c.Response()
+		w.Header().Set(echo.HeaderContentType, "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		log.Debug().Str("remote", c.RealIP()).Int("replay", len(replay)).Msg("Stream client connected")
+
+		if !complete {
+			if err := writeGap(w); err != nil {
+				return nil
+			}
+		}
+
+		write := func(event hubEvent) error {
+			if !opts.Match(event.resource) {
+				return nil
+			}
+			return writeResource(w, hub.eventID(event), event.resource, withBody)
+		}
+
+		for _, event := range replay {
+			if err := write(event); err != nil {
+				return nil
+			}
+		}
+		w.Flush()
+
+		ticker := time.NewTicker(keepAliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				log.Debug().Str("remote", c.RealIP()).Msg("Stream client disconnected")
+				return nil
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+			case event := <-ch:
+				if event.id <= lastID {
+					continue
+				}
+				// Resources have been dropped by the hub
+				if event.id != lastID+1 {
+					if err := writeGap(w); err != nil {
+						return nil
+					}
+				}
+				lastID = event.id
+
+				if err := write(event); err != nil {
+					return nil
+				}
+			}
+			w.Flush()
+		}
+	}
+}
+
+// readStreamOptions returns the filter given by the search query parameters, the URL being base64 encoded
+func readStreamOptions(c echo.Context) (api.SearchResourcesOptions, error) {
+	opts := api.SearchResourcesOptions{
+		URL:               c.QueryParam("url"),
+		Keyword:           c.QueryParam("keyword"),
+		Title:             c.QueryParam("title"),
+		Language:          c.QueryParam(api.LanguageQueryParam),
+		Charset:           c.QueryParam(api.CharsetQueryParam),
+		ExtractedKeywords: readExtractedKeywords(c),
+		Source:            c.QueryParam(api.SourceQueryParam),
+	}
+
+	if _, err := api.DecodeURL(opts.URL); err != nil {
+		return opts, err
+	}
+
+	var err error
+	if opts.ResponseCode, err = readResponseCode(c); err != nil {
+		return opts, err
+	}
+	if opts.MinSize, err = readSize(c, api.MinSizeQueryParam); err != nil {
+		return opts, err
+	}
+	if opts.MaxSize, err = readSize(c, api.MaxSizeQueryParam); err != nil {
+		return opts, err
+	}
+
+	if val := c.QueryParam("start-date"); val != "" {
+		if opts.StartDate, err = time.Parse(time.RFC3339, val); err != nil {
+			return opts, err
+		}
+	}
+	if val := c.QueryParam("end-date"); val != "" {
+		if opts.EndDate, err = time.Parse(time.RFC3339, val); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+func writeResource(w io.Writer, eventID string, res api.ResourceDto, withBody bool) error {
+	if !withBody {
+		res.Body = ""
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		log.Err(err).Msg("Error while marshaling resource")
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", eventID, b)
+	return err
+}
+
+func writeGap(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: resources may have been missed\n\n", api.GapEvent)
+	return err
+}
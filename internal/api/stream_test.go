@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResourceHubSubscribeAfter(t *testing.T) {
+	hub := newResourceHub(2)
+	for _, u := range []string{"a.onion", "b.onion", "c.onion"} {
+		hub.publish(api.ResourceDto{URL: u})
+	}
+
+	tests := []struct {
+		lastEventID string
+		replay      []string
+		complete    bool
+	}{
+		{"", nil, true},
+		{hub.eventID(hubEvent{id: 3}), nil, true},
+		{hub.eventID(hubEvent{id: 2}), []string{"c.onion"}, true},
+		{hub.eventID(hubEvent{id: 1}), []string{"b.onion", "c.onion"}, true},
+		// a.onion is not kept anymore
+		{hub.eventID(hubEvent{id: 0}), []string{"b.onion", "c.onion"}, false},
+		// Unknown event IDs (e.g: before a restart)
+		{hub.eventID(hubEvent{id: 4}), nil, false},
+		{"other-1", nil, false},
+		{"invalid", nil, false},
+	}
+
+	for _, test := range tests {
+		ch, replay, lastID, complete := hub.subscribeAfter(test.lastEventID)
+		hub.unsubscribe(ch)
+
+		if lastID != 3 {
+			t.Errorf("Wanted: 3 Got: %d", lastID)
+		}
+		if complete != test.complete {
+			t.Errorf("%s: Wanted: %t Got: %t", test.lastEventID, test.complete, complete)
+		}
+
+		var urls []string
+		for _, event := range replay {
+			urls = append(urls, event.resource.URL)
+		}
+		if strings.Join(urls, ",") != strings.Join(test.replay, ",") {
+			t.Errorf("%s: Wanted: %v Got: %v", test.lastEventID, test.replay, urls)
+		}
+	}
+}
+
+func TestStreamResources(t *testing.T) {
+	hub := newResourceHub(10)
+	e := echo.New()
+	e.GET("/v1/resources/stream", streamResources(hub))
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	hub.publish(api.ResourceDto{URL: "a.onion", Title: "Forum A"})
+	hub.publish(api.ResourceDto{URL: "b.onion", Title: "Blog"})
+	hub.publish(api.ResourceDto{URL: "c.onion", Title: "Forum C"})
+
+	// Resume after a.onion: c.onion is replayed, then the new resources are streamed in order
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/resources/stream?title=forum", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(api.LastEventIDHeader, hub.eventID(hubEvent{id: 1}))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	reader := bufio.NewReader(res.Body)
+	want := fmt.Sprintf("id: %s\ndata: {\"url\":\"c.onion\"", hub.eventID(hubEvent{id: 3}))
+	if got := readEvent(t, reader); !strings.HasPrefix(got, want) {
+		t.Errorf("Wanted: %s Got: %s", want, got)
+	}
+
+	hub.publish(api.ResourceDto{URL: "d.onion", Title: "Other"})
+	hub.publish(api.ResourceDto{URL: "e.onion", Title: "Forum E"})
+
+	want = fmt.Sprintf("id: %s\ndata: {\"url\":\"e.onion\"", hub.eventID(hubEvent{id: 5}))
+	if got := readEvent(t, reader); !strings.HasPrefix(got, want) {
+		t.Errorf("Wanted: %s Got: %s", want, got)
+	}
+}
+
+func TestStreamResourcesGap(t *testing.T) {
+	hub := newResourceHub(10)
+	e := echo.New()
+	e.GET("/v1/resources/stream", streamResources(hub))
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	hub.publish(api.ResourceDto{URL: "a.onion"})
+
+	// Event ID of the API before a restart
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/resources/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(api.LastEventIDHeader, "previous-42")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	want := fmt.Sprintf("event: %s\n", api.GapEvent)
+	if got := readEvent(t, bufio.NewReader(res.Body)); !strings.HasPrefix(got, want) {
+		t.Errorf("Wanted: %s Got: %s", want, got)
+	}
+}
+
+func TestStreamResourcesInvalidFilter(t *testing.T) {
+	e := echo.New()
+	e.GET("/v1/resources/stream", streamResources(newResourceHub(0)))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/resources/stream?url="+
+		api.EncodeURL("a.onion")+"!", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Wanted: 422 Got: %d", rec.Code)
+	}
+}
+
+// readEvent returns the next server-sent event read from given reader, skipping the keep-alive comments
+func readEvent(t *testing.T, reader *bufio.Reader) string {
+	events := make(chan string, 1)
+	go func() {
+		var event strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				events <- event.String()
+				return
+			}
+			if strings.HasPrefix(line, ":") {
+				continue
+			}
+			if line == "\n" {
+				if event.Len() > 0 {
+					events <- event.String()
+					return
+				}
+				continue
+			}
+			event.WriteString(line)
+		}
+	}()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("event should have been received")
+		return ""
+	}
+}
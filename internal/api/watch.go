@@ -0,0 +1,125 @@
+package api
+
+import (
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/rs/zerolog/log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// keepAliveInterval is the interval between two comments sent to keep the idle watch streams open
+	keepAliveInterval = 15 * time.Second
+	// watcherBufferSize is the number of resources buffered for each watcher
+	watcherBufferSize = 100
+)
+
+// hubEvent is a saved resource along with its sequence number (starting at 1)
+type hubEvent struct {
+	id       uint64
+	resource api.ResourceDto
+}
+
+// resourceHub broadcast the saved resources to the watchers, keeping the last ones so that they can be replayed
+// to the watchers reconnecting
+type resourceHub struct {
+	watchers map[chan hubEvent]struct{}
+	// epoch identify the hub: the sequence numbers of another hub (e.g: before a restart) cannot be replayed
+	epoch       string
+	lastID      uint64
+	history     []hubEvent
+	historySize int
+	mutex       sync.Mutex
+}
+
+func newResourceHub(historySize int) *resourceHub {
+	return &resourceHub{
+		watchers:    map[chan hubEvent]struct{}{},
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		historySize: historySize,
+	}
+}
+
+// subscribeAfter subscribe to the resources published from now on, and returns the resources published after given
+// event ID (empty for none) which are still kept, along with the sequence number of the last published resource.
+// complete is false if some resources published after given event ID are not kept anymore
+func (h *resourceHub) subscribeAfter(lastEventID string) (ch chan hubEvent, replay []hubEvent, lastID uint64,
+	complete bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	ch = make(chan hubEvent, watcherBufferSize)
+	h.watchers[ch] = struct{}{}
+
+	if lastEventID == "" {
+		return ch, nil, h.lastID, true
+	}
+
+	epoch, id, ok := h.parseEventID(lastEventID)
+	if !ok || epoch != h.epoch || id > h.lastID {
+		return ch, nil, h.lastID, false
+	}
+
+	complete = id == h.lastID || (len(h.history) > 0 && h.history[0].id <= id+1)
+	for _, event := range h.history {
+		if event.id > id {
+			replay = append(replay, event)
+		}
+	}
+
+	return ch, replay, h.lastID, complete
+}
+
+func (h *resourceHub) unsubscribe(ch chan hubEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.watchers, ch)
+}
+
+// publish send given resource to every watcher without blocking:
+// the resource is dropped for the watchers whose buffer is full
+func (h *resourceHub) publish(res api.ResourceDto) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.lastID++
+	event := hubEvent{id: h.lastID, resource: res}
+
+	if h.historySize > 0 {
+		h.history = append(h.history, event)
+		if len(h.history) > h.historySize {
+			h.history = h.history[1:]
+		}
+	}
+
+	for ch := range h.watchers {
+		select {
+		case ch <- event:
+		default:
+			log.Warn().Str("url", res.URL).Msg("Watcher too slow, dropping resource")
+		}
+	}
+}
+
+// eventID returns the ID of the server-sent event of given hub event
+func (h *resourceHub) eventID(event hubEvent) string {
+	return fmt.Sprintf("%s-%d", h.epoch, event.id)
+}
+
+func (h *resourceHub) parseEventID(eventID string) (string, uint64, bool) {
+	i := strings.LastIndex(eventID, "-")
+	if i < 0 {
+		return "", 0, false
+	}
+
+	id, err := strconv.ParseUint(eventID[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return eventID[:i], id, true
+}
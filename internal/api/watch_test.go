@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic/v7"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWatchResources(t *testing.T) {
+	// Fake Elasticsearch server accepting every document
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"_index":"resources","_id":"1","_version":1,"result":"created"}`))
+	}))
+	defer esSrv.Close()
+
+	es, err := elastic.NewSimpleClient(elastic.SetURL(esSrv.URL))
+	if err != nil {
+		t.FailNow()
+	}
+
+	hub := newResourceHub(0)
+	e := echo.New()
+	e.POST("/v1/resources", addResource(&elasticStorage{es: es}, hub))
+	e.GET("/v1/resources/stream", streamResources(hub))
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := api.NewClient(srv.URL)
+	resources, err := client.WatchResources(ctx, api.NewFilter().Title("forum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Filtered out, then matching
+	for _, res := range []api.ResourceDto{
+		{URL: "example.onion", Title: "Example", Body: "hello"},
+		{URL: "forum.onion", Title: "Best Forum", Body: "hello"},
+	} {
+		if _, err := client.AddResource(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case res := <-resources:
+		if res.URL != "forum.onion" || res.Title != "Best Forum" {
+			t.Errorf("Wanted: forum.onion Got: %+v", res)
+		}
+		// Not requested
+		if res.Body != "" {
+			t.Error("body should not be sent")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("saved resource should have been received")
+	}
+
+	// The channel is closed once the context is done
+	cancel()
+	select {
+	case _, ok := <-resources:
+		if ok {
+			t.Error("no other resource should have been received")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("channel should have been closed")
+	}
+}
+
+func TestResourceHubSlowWatcher(t *testing.T) {
+	hub := newResourceHub(0)
+	ch, _, _, _ := hub.subscribeAfter("")
+
+	// Publishing should not block once the buffer is full
+	for i := 0; i < watcherBufferSize+10; i++ {
+		hub.publish(api.ResourceDto{URL: "example.onion"})
+	}
+	if len(ch) != watcherBufferSize {
+		t.Errorf("Wanted: %d Got: %d", watcherBufferSize, len(ch))
+	}
+
+	hub.unsubscribe(ch)
+	hub.publish(api.ResourceDto{URL: "example.onion"})
+	if len(ch) != watcherBufferSize {
+		t.Error("unsubscribed watcher should not receive resources")
+	}
+}
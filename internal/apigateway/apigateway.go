@@ -0,0 +1,177 @@
+package apigateway
+
+import (
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/time/rate"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GetApp return the API gateway app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-api-gateway",
+		Version: "0.5.0",
+		Usage:   "Trandoshan API gateway process",
+		Flags: []cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "api-uri",
+				Usage:    "URI to the API server the requests are forwarded to",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "listen-addr",
+				Usage: "Address on which to listen for the requests",
+				Value: ":8081",
+			},
+			&cli.Float64Flag{
+				Name:  "rate-limit-rps",
+				Usage: "Number of requests per second allowed per client IP",
+				Value: 10,
+			},
+			&cli.IntFlag{
+				Name:  "burst",
+				Usage: "Number of requests a client IP can make at once before being rate limited",
+				Value: 20,
+			},
+			&cli.IntFlag{
+				Name:  "max-clients",
+				Usage: "Maximum number of client IPs tracked, the least recently seen being forgotten",
+				Value: 10000,
+			},
+		},
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-api-gateway")
+
+	target, err := url.Parse(ctx.String("api-uri"))
+	if err != nil {
+		return fmt.Errorf("invalid --api-uri: %s", err)
+	}
+	log.Debug().Stringer("uri", target).Msg("Forwarding requests to API server")
+
+	rps := ctx.Float64("rate-limit-rps")
+	if rps <= 0 {
+		return fmt.Errorf("--rate-limit-rps should be positive")
+	}
+	if ctx.Int("burst") <= 0 {
+		return fmt.Errorf("--burst should be positive")
+	}
+
+	limiter, err := newIPLimiter(rate.Limit(rps), ctx.Int("burst"), ctx.Int("max-clients"))
+	if err != nil {
+		return err
+	}
+	log.Debug().Float64("rps", rps).Int("burst", ctx.Int("burst")).Msg("Rate limiting client IPs")
+
+	handler := logRequests(rateLimit(limiter, time.Now, httputil.NewSingleHostReverseProxy(target)))
+
+	log.Info().Str("addr", ctx.String("listen-addr")).Msg("Successfully initialized tdsh-api-gateway. Waiting for requests")
+
+	return http.ListenAndServe(ctx.String("listen-addr"), handler)
+}
+
+// ipLimiter keep a token bucket per client IP. Only the most recently seen IPs are tracked
+type ipLimiter struct {
+	limit    rate.Limit
+	burst    int
+	limiters *lru.Cache
+	mutex    sync.Mutex
+}
+
+func newIPLimiter(limit rate.Limit, burst, maxClients int) (*ipLimiter, error) {
+	limiters, err := lru.New(maxClients)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ipLimiter{limit: limit, burst: burst, limiters: limiters}, nil
+}
+
+// getLimiter return the limiter associated to given IP, creating it on first sight
+func (l *ipLimiter) getLimiter(ip string) *rate.Limiter {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if limiter, exist := l.limiters.Get(ip); exist {
+		return limiter.(*rate.Limiter)
+	}
+
+	limiter := rate.NewLimiter(l.limit, l.burst)
+	l.limiters.Add(ip, limiter)
+	return limiter
+}
+
+// rateLimit returns the handler answering 429 to the clients which have exhausted their bucket, along with the
+// number of seconds to wait before retrying
+func rateLimit(limiter *ipLimiter, now func() time.Time, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := now()
+		reservation := limiter.getLimiter(clientIP(r)).ReserveN(t, 1)
+		if delay := reservation.DelayFrom(t); delay > 0 {
+			// The token is not consumed by rejected requests
+			reservation.CancelAt(t)
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the IP of the client which has made given request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusRecorder keep track of the status code written by an handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests returns the handler logging every request along with its status code & latency
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		log.Info().
+			Str("ip", clientIP(r)).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", recorder.status).
+			Dur("latency", time.Since(start)).
+			Msg("Request handled")
+	})
+}
@@ -0,0 +1,145 @@
+package apigateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// request sends a request from given client IP through given handler and returns the response
+func request(handler http.Handler, ip string) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, "/v1/resources", nil)
+	req.RemoteAddr = ip + ":12345"
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter, err := newIPLimiter(1, 2, 10)
+	if err != nil {
+		t.FailNow()
+	}
+
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	handler := rateLimit(limiter, func() time.Time { return now }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	// Burst is allowed
+	for i := 0; i < 2; i++ {
+		if res := request(handler, "10.0.0.1"); res.StatusCode != http.StatusOK {
+			t.Errorf("Wanted: 200 Got: %d", res.StatusCode)
+		}
+	}
+
+	// Bucket is exhausted
+	res := request(handler, "10.0.0.1")
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Wanted: 429 Got: %d", res.StatusCode)
+	}
+	if retryAfter := res.Header.Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("Wanted: 1 Got: %s", retryAfter)
+	}
+	if calls != 2 {
+		t.Errorf("Wanted: 2 forwarded requests Got: %d", calls)
+	}
+
+	// Other clients have their own bucket
+	if res := request(handler, "10.0.0.2"); res.StatusCode != http.StatusOK {
+		t.Errorf("Wanted: 200 Got: %d", res.StatusCode)
+	}
+
+	// Rejected requests do not consume tokens: a single one is available after a second
+	now = now.Add(time.Second)
+	if res := request(handler, "10.0.0.1"); res.StatusCode != http.StatusOK {
+		t.Errorf("Wanted: 200 Got: %d", res.StatusCode)
+	}
+	if res := request(handler, "10.0.0.1"); res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Wanted: 429 Got: %d", res.StatusCode)
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	// One request every 10 seconds
+	limiter, err := newIPLimiter(0.1, 1, 10)
+	if err != nil {
+		t.FailNow()
+	}
+
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	handler := rateLimit(limiter, func() time.Time { return now }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request(handler, "10.0.0.1")
+
+	now = now.Add(2500 * time.Millisecond)
+	res := request(handler, "10.0.0.1")
+	if retryAfter := res.Header.Get("Retry-After"); retryAfter != "8" {
+		t.Errorf("Wanted: 8 Got: %s", retryAfter)
+	}
+}
+
+func TestIPLimiterEviction(t *testing.T) {
+	limiter, err := newIPLimiter(1, 1, 2)
+	if err != nil {
+		t.FailNow()
+	}
+
+	first := limiter.getLimiter("10.0.0.1")
+	if limiter.getLimiter("10.0.0.1") != first {
+		t.Error("limiter should be reused")
+	}
+
+	limiter.getLimiter("10.0.0.2")
+	limiter.getLimiter("10.0.0.3")
+	if limiter.limiters.Len() != 2 {
+		t.Errorf("Wanted: 2 tracked IPs Got: %d", limiter.limiters.Len())
+	}
+	if limiter.getLimiter("10.0.0.1") == first {
+		t.Error("least recently seen IP should have been forgotten")
+	}
+}
+
+func TestGateway(t *testing.T) {
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/resources" || r.URL.Query().Get("keyword") != "market" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer apiSrv.Close()
+
+	target, err := url.Parse(apiSrv.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	limiter, err := newIPLimiter(1, 1, 10)
+	if err != nil {
+		t.FailNow()
+	}
+
+	srv := httptest.NewServer(logRequests(rateLimit(limiter, time.Now, httputil.NewSingleHostReverseProxy(target))))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/v1/resources?keyword=market")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusTeapot {
+		t.Errorf("Wanted: 418 Got: %d", res.StatusCode)
+	}
+
+	res, err = http.Get(srv.URL + "/v1/resources?keyword=market")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Wanted: 429 Got: %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,263 @@
+package archiver
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/creekorful/trandoshan/internal/util/retry"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// protocolRegex match the protocol removed from the URLs of the resources by the extractor
+	protocolRegex = regexp.MustCompile("https?://")
+
+	// errNotSaved is returned while the crawled resource has not been saved by the extractor
+	errNotSaved = errors.New("resource not saved")
+)
+
+// GetApp return the archiver app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-archiver",
+		Version: "0.5.0",
+		Usage:   "Trandoshan archiver process",
+		Flags: append([]cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "nats-uri",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
+				Required: true,
+			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.StringFlag{
+				Name:     "s3-endpoint",
+				Usage:    "URI to the S3 compatible server (e.g: https://s3.amazonaws.com or http://minio:9000)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "s3-region",
+				Usage: "Region of the bucket",
+				Value: "us-east-1",
+			},
+			&cli.StringFlag{
+				Name:     "s3-bucket",
+				Usage:    "Name of the bucket where the bodies are stored",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "s3-access-key",
+				Usage: "Access key used to authenticate against the S3 server",
+			},
+			&cli.StringFlag{
+				Name:  "s3-secret-key",
+				Usage: "Secret key used to authenticate against the S3 server",
+			},
+			&cli.StringFlag{
+				Name:  "metrics-addr",
+				Usage: "Address on which to expose the prometheus metrics (e.g: :9090)",
+			},
+		}, api.GetClientFlags()...),
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-archiver")
+
+	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
+	log.Debug().Str("uri", ctx.String("api-uri")).Msg("Using API server")
+
+	// Create the API client
+	apiClient, err := api.NewClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Create the S3 client
+	s3Client, err := newS3Client(ctx.String("s3-endpoint"), ctx.String("s3-region"),
+		ctx.String("s3-access-key"), ctx.String("s3-secret-key"))
+	if err != nil {
+		return err
+	}
+
+	bucket := ctx.String("s3-bucket")
+	exists, err := s3Client.BucketExists(context.Background(), bucket)
+	if err != nil {
+		return fmt.Errorf("error while checking bucket %s: %s", bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", bucket)
+	}
+	log.Debug().Str("endpoint", ctx.String("s3-endpoint")).Str("bucket", bucket).Msg("Using S3 bucket")
+
+	// Create the NATS subscriber
+	sub, err := natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	defer heartbeat.Start(ctx, sub)()
+
+	if addr := ctx.String("metrics-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing metrics")
+		if err := natsutil.StartMetricsServer(addr, sub); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Msg("Successfully initialized tdsh-archiver. Waiting for crawl results")
+
+	a := newArchiver(apiClient, s3Client, bucket)
+	if err := sub.QueueSubscribe(messaging.CrawlResultSubject, "archivers", handleMessage(a)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// newS3Client returns the client of the S3 compatible server with given URI, using HTTPS unless its scheme is http
+func newS3Client(endpoint, region, accessKey, secretKey string) (*minio.Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid --s3-endpoint: %s", endpoint)
+	}
+
+	return minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: u.Scheme != "http",
+		Region: region,
+	})
+}
+
+// archiver move the body of the crawled resources from the API to a S3 bucket
+type archiver struct {
+	apiClient api.Client
+	s3Client  *minio.Client
+	bucket    string
+	// waitOpts configure the wait for the resource to be saved by the extractor
+	waitOpts retry.Options
+}
+
+func newArchiver(apiClient api.Client, s3Client *minio.Client, bucket string) *archiver {
+	return &archiver{
+		apiClient: apiClient,
+		s3Client:  s3Client,
+		bucket:    bucket,
+		waitOpts: retry.Options{
+			Count:        5,
+			InitialDelay: time.Second,
+			MaxDelay:     10 * time.Second,
+			Multiplier:   2,
+			Jitter:       0.2,
+		},
+	}
+}
+
+// handleMessage returns the handler archiving the body of the successfully crawled resources
+func handleMessage(a *archiver) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		var resultMsg messaging.CrawlResultMsg
+		if err := natsutil.ReadMsg(msg, &resultMsg); err != nil {
+			log.Err(err).Msg("Error while reading message")
+			return err
+		}
+
+		// Failing URLs are not saved
+		if resultMsg.StatusCode == 0 || resultMsg.StatusCode > 302 {
+			return nil
+		}
+
+		return a.archive(ctx, resultMsg)
+	}
+}
+
+// archive store the body of the resource crawled according to given result in the bucket, and replace it
+// by its URL in the API
+func (a *archiver) archive(ctx context.Context, result messaging.CrawlResultMsg) error {
+	b64URL := api.EncodeURL(protocolRegex.ReplaceAllLiteralString(result.URL, ""))
+
+	// The crawler publishes the result before the resource is saved by the extractor
+	var resource *api.ResourceDto
+	err := retry.Do(func() error {
+		res, err := a.apiClient.GetResource(b64URL)
+		if err != nil {
+			return err
+		}
+		if res == nil || res.Time.Before(result.Timestamp) {
+			return errNotSaved
+		}
+
+		resource = res
+		return nil
+	}, a.waitOpts)
+	if err == errNotSaved {
+		// e.g: content type not allowed
+		log.Debug().Str("url", result.URL).Msg("Resource has not been saved, skipping")
+		return nil
+	}
+	if err != nil {
+		log.Err(err).Str("url", result.URL).Msg("Error while getting resource")
+		return err
+	}
+
+	if resource.BodyURL != "" {
+		log.Debug().Str("url", result.URL).Msg("Resource has already been archived")
+		return nil
+	}
+
+	body, err := a.apiClient.GetResourceBody(b64URL)
+	if err != nil {
+		log.Err(err).Str("url", result.URL).Msg("Error while getting resource body")
+		return err
+	}
+
+	key := objectKey(result)
+	if _, err := a.s3Client.PutObject(ctx, a.bucket, key, strings.NewReader(body), int64(len(body)),
+		minio.PutObjectOptions{ContentType: "text/html; charset=utf-8"}); err != nil {
+		log.Err(err).Str("url", result.URL).Msg("Error while storing resource body")
+		return err
+	}
+
+	bodyURL := *a.s3Client.EndpointURL()
+	bodyURL.Path = path.Join("/", a.bucket, key)
+
+	if err := a.apiClient.SetResourceBodyURL(b64URL, bodyURL.String()); err != nil {
+		log.Err(err).Str("url", result.URL).Msg("Error while setting resource body URL")
+		return err
+	}
+
+	log.Debug().Str("url", result.URL).Str("body-url", bodyURL.String()).Msg("Successfully archived resource body")
+
+	return nil
+}
+
+// objectKey returns the key of the object storing the body of the resource crawled according to given result:
+// the bodies of an URL are grouped by the SHA-256 of the URL and named after the crawl time
+func objectKey(result messaging.CrawlResultMsg) string {
+	return fmt.Sprintf("%x/%d.html", sha256.Sum256([]byte(result.URL)), result.Timestamp.UnixNano())
+}
@@ -0,0 +1,255 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/retry"
+	"github.com/nats-io/nats.go"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a mock S3 server storing the uploaded objects in memory
+type fakeS3 struct {
+	objects map[string]string
+	mutex   sync.Mutex
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		b = decodeChunks(b)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.objects[r.URL.Path] = string(b)
+
+	w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// decodeChunks returns the payload of given aws-chunked body, made of <hex size>;chunk-signature=<sig>\r\n<data>\r\n
+// chunks ending with an empty one
+func decodeChunks(b []byte) []byte {
+	var payload []byte
+	for {
+		i := bytes.Index(b, []byte("\r\n"))
+		if i == -1 {
+			return payload
+		}
+
+		size, err := strconv.ParseInt(string(bytes.SplitN(b[:i], []byte(";"), 2)[0]), 16, 64)
+		if err != nil || size == 0 {
+			return payload
+		}
+
+		payload = append(payload, b[i+2:i+2+int(size)]...)
+		b = b[i+2+int(size)+2:]
+	}
+}
+
+// fakeAPI is a mock API serving a single resource, saved after given number of calls
+type fakeAPI struct {
+	b64URL   string
+	resource api.ResourceDto
+	body     string
+	// savedAfter is the number of calls before the resource is found
+	savedAfter int
+
+	calls   int
+	bodyURL string
+	mutex   sync.Mutex
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/resources/"+a.b64URL:
+		a.calls++
+		if a.calls <= a.savedAfter {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(a.resource)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/resources/"+a.b64URL+"/body":
+		_, _ = w.Write([]byte(a.body))
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/resources/"+a.b64URL+"/body-url":
+		var dto api.BodyURLDto
+		if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		a.bodyURL = dto.BodyURL
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestArchiver returns an archiver using given fake API and a fake S3 server, to be closed once done
+func newTestArchiver(t *testing.T, apiHandler *fakeAPI) (*archiver, *fakeS3, func()) {
+	apiSrv := httptest.NewServer(apiHandler)
+	s3 := &fakeS3{objects: map[string]string{}}
+	s3Srv := httptest.NewServer(s3)
+
+	s3Client, err := newS3Client(s3Srv.URL, "us-east-1", "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newArchiver(api.NewClient(apiSrv.URL), s3Client, "bodies")
+	a.waitOpts = retry.Options{Count: 3, InitialDelay: time.Millisecond, Multiplier: 1}
+
+	return a, s3, func() {
+		apiSrv.Close()
+		s3Srv.Close()
+	}
+}
+
+func resultMsg(t *testing.T, result messaging.CrawlResultMsg) *nats.Msg {
+	b, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &nats.Msg{Data: b}
+}
+
+func TestHandleMessage(t *testing.T) {
+	crawled := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	apiHandler := &fakeAPI{
+		b64URL:     api.EncodeURL("example.onion/index.html"),
+		resource:   api.ResourceDto{URL: "example.onion/index.html", Time: crawled.Add(time.Second)},
+		body:       "<html>hello</html>",
+		savedAfter: 2,
+	}
+
+	a, s3, closeAll := newTestArchiver(t, apiHandler)
+	defer closeAll()
+
+	result := messaging.CrawlResultMsg{URL: "http://example.onion/index.html", StatusCode: 200, Timestamp: crawled}
+	if err := handleMessage(a)(context.Background(), nil, resultMsg(t, result)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resource has been waited for
+	if apiHandler.calls != 3 {
+		t.Errorf("Wanted: 3 calls Got: %d", apiHandler.calls)
+	}
+
+	key := fmt.Sprintf("/bodies/%s", objectKey(result))
+	if s3.objects[key] != "<html>hello</html>" {
+		t.Errorf("body should have been stored at %s: %v", key, s3.objects)
+	}
+	if !strings.HasSuffix(apiHandler.bodyURL, key) || !strings.HasPrefix(apiHandler.bodyURL, "http://127.0.0.1") {
+		t.Errorf("unexpected body URL: %s", apiHandler.bodyURL)
+	}
+}
+
+func TestHandleMessageSkip(t *testing.T) {
+	crawled := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	b64URL := api.EncodeURL("example.onion")
+
+	tests := []struct {
+		name       string
+		resource   api.ResourceDto
+		savedAfter int
+		statusCode int
+		wantCalls  int
+	}{
+		{"failed", api.ResourceDto{Time: crawled.Add(time.Second)}, 0, 404, 0},
+		{"no response", api.ResourceDto{Time: crawled.Add(time.Second)}, 0, 0, 0},
+		// e.g: content type not allowed
+		{"never saved", api.ResourceDto{Time: crawled.Add(time.Second)}, 10, 200, 4},
+		{"previous crawl", api.ResourceDto{Time: crawled.Add(-time.Hour)}, 0, 200, 4},
+		{"already archived", api.ResourceDto{Time: crawled.Add(time.Second), BodyURL: "http://s3/b/k"}, 0, 200, 1},
+	}
+	for _, test := range tests {
+		apiHandler := &fakeAPI{b64URL: b64URL, resource: test.resource, body: "body", savedAfter: test.savedAfter}
+		a, s3, closeAll := newTestArchiver(t, apiHandler)
+
+		result := messaging.CrawlResultMsg{URL: "https://example.onion", StatusCode: test.statusCode, Timestamp: crawled}
+		if err := handleMessage(a)(context.Background(), nil, resultMsg(t, result)); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+
+		if apiHandler.calls != test.wantCalls {
+			t.Errorf("%s: Wanted: %d calls Got: %d", test.name, test.wantCalls, apiHandler.calls)
+		}
+		if len(s3.objects) != 0 || apiHandler.bodyURL != "" {
+			t.Errorf("%s: body should not have been archived", test.name)
+		}
+
+		closeAll()
+	}
+}
+
+func TestHandleMessageS3Error(t *testing.T) {
+	crawled := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	apiHandler := &fakeAPI{
+		b64URL:   api.EncodeURL("example.onion"),
+		resource: api.ResourceDto{Time: crawled.Add(time.Second)},
+		body:     "body",
+	}
+
+	a, _, closeAll := newTestArchiver(t, apiHandler)
+	defer closeAll()
+
+	// Rejected by the fake server
+	s3Client, err := newS3Client(a.s3Client.EndpointURL().String(), "us-east-1", "wrong", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.s3Client = s3Client
+
+	result := messaging.CrawlResultMsg{URL: "http://example.onion", StatusCode: 200, Timestamp: crawled}
+	if err := handleMessage(a)(context.Background(), nil, resultMsg(t, result)); err == nil {
+		t.Error("error should have been returned")
+	}
+	if apiHandler.bodyURL != "" {
+		t.Error("body URL should not have been set")
+	}
+}
+
+func TestNewS3Client(t *testing.T) {
+	c, err := newS3Client("http://minio:9000", "us-east-1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := c.EndpointURL(); u.Scheme != "http" || u.Host != "minio:9000" {
+		t.Errorf("unexpected endpoint: %s", u)
+	}
+
+	if c, err = newS3Client("https://s3.amazonaws.com", "us-east-1", "", ""); err != nil || c.EndpointURL().Scheme != "https" {
+		t.Errorf("unexpected client: %v %v", c, err)
+	}
+
+	if _, err := newS3Client("minio:9000", "us-east-1", "", ""); err == nil {
+		t.Error("endpoint without scheme should be rejected")
+	}
+}
@@ -0,0 +1,287 @@
+package bench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/creekorful/trandoshan/internal/util/onion"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// GetApp return the scheduler benchmark app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-scheduler-bench",
+		Version: "0.5.0",
+		Usage:   "Trandoshan scheduler load testing tool",
+		Description: "Publish synthetic URLs to url.found and measure the time until they are scheduled on url.todo.\n" +
+			"The scheduler under test should use the mock API server started by the tool (--api-addr)\n" +
+			"and no crawler should consume url.todo meanwhile.",
+		Flags: []cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "nats-uri",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
+				Required: true,
+			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			&cli.StringFlag{
+				Name:  "api-addr",
+				Usage: "Address on which to start the mock API server, for the scheduler to use as --api-uri",
+				Value: ":15006",
+			},
+			&cli.IntFlag{
+				Name:  "rate",
+				Usage: "Number of URLs published per second",
+				Value: 100,
+			},
+			&cli.DurationFlag{
+				Name:  "duration",
+				Usage: "Duration during which URLs are published",
+				Value: 30 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "Maximum time to wait for the published URLs to be scheduled once publishing is over",
+				Value: 10 * time.Second,
+			},
+		},
+		Action: execute,
+	}
+}
+
+func execute(c *cli.Context) error {
+	logging.ConfigureLogger(c)
+
+	if c.Int("rate") <= 0 {
+		return fmt.Errorf("invalid rate %d (should be positive)", c.Int("rate"))
+	}
+
+	log.Info().Str("ver", c.App.Version).Msg("Starting tdsh-scheduler-bench")
+
+	// Start the mock API server
+	l, err := net.Listen("tcp", c.String("api-addr"))
+	if err != nil {
+		log.Err(err).Str("addr", c.String("api-addr")).Msg("Error while starting mock API server")
+		return err
+	}
+	srv := &http.Server{Handler: newMockAPIHandler()}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	log.Info().Str("addr", l.Addr().String()).Msg("Mock API server started")
+
+	// Connect to the NATS server
+	nc, err := natsutil.Connect(c.String("nats-uri"), natsutil.GetOptions(c)...)
+	if err != nil {
+		log.Err(err).Str("uri", c.String("nats-uri")).Msg("Error while connecting to NATS server")
+		return err
+	}
+	defer nc.Close()
+
+	b := newBenchmark(time.Now().UnixNano())
+
+	sub, err := nc.Subscribe(messaging.URLTodoSubject, b.handleTodo)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	if err := b.publish(nc, c.Int("rate"), c.Duration("duration")); err != nil {
+		return err
+	}
+
+	b.wait(c.Duration("timeout"))
+
+	return b.report(os.Stdout)
+}
+
+// newMockAPIHandler returns an handler mocking the API as if no URL had ever been crawled
+func newMockAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	// Search & bulk search
+	mux.HandleFunc("/v1/resources", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(api.PaginationCountHeader, "0")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	})
+	mux.HandleFunc("/v1/resources/search/bulk", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	})
+	// Last crawled resource
+	mux.HandleFunc("/v1/resources/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	return mux
+}
+
+// benchmark track the URLs published and the time they took to be scheduled
+type benchmark struct {
+	runID int64
+
+	published map[string]time.Time
+	latencies []time.Duration
+	mutex     sync.Mutex
+
+	// done is closed once every published URL has been scheduled
+	done       chan struct{}
+	publishing bool
+}
+
+func newBenchmark(runID int64) *benchmark {
+	return &benchmark{
+		runID:      runID,
+		published:  map[string]time.Time{},
+		done:       make(chan struct{}),
+		publishing: true,
+	}
+}
+
+// publish publish unique URLs to url.found at given rate (per second) for given duration
+func (b *benchmark) publish(nc *nats.Conn, rate int, duration time.Duration) error {
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+	deadline := time.After(duration)
+	for i := 0; ; i++ {
+		select {
+		case <-deadline:
+			b.stopPublishing()
+			log.Info().Int("count", i).Msg("Publishing over")
+			return nil
+		case <-ticker.C:
+		}
+
+		// Unique (and valid) onion address so that the URLs are never deduplicated nor rate limited
+		url := fmt.Sprintf("http://%s.onion", benchAddress(b.runID, i))
+
+		b.mutex.Lock()
+		b.published[url] = time.Now()
+		b.mutex.Unlock()
+
+		if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{URL: url}); err != nil {
+			return err
+		}
+	}
+}
+
+// benchAddress returns the v3 onion address of the i-th URL published by given run
+func benchAddress(runID int64, i int) string {
+	pubKey := make([]byte, 32)
+	binary.BigEndian.PutUint64(pubKey, uint64(runID))
+	binary.BigEndian.PutUint64(pubKey[8:], uint64(i))
+
+	return onion.V3Address(pubKey)
+}
+
+func (b *benchmark) stopPublishing() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.publishing = false
+	b.checkDone()
+}
+
+// handleTodo record the latency of the published URLs once scheduled
+func (b *benchmark) handleTodo(msg *nats.Msg) {
+	var todoMsg messaging.URLTodoMsg
+	if err := natsutil.ReadJSON(msg, &todoMsg); err != nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Ignore the URLs not published by this run
+	publishedAt, exists := b.published[todoMsg.URL]
+	if !exists {
+		return
+	}
+	delete(b.published, todoMsg.URL)
+
+	b.latencies = append(b.latencies, time.Since(publishedAt))
+	b.checkDone()
+}
+
+// checkDone close the done channel if everything has been published & scheduled (lock must be held)
+func (b *benchmark) checkDone() {
+	if !b.publishing && len(b.published) == 0 {
+		select {
+		case <-b.done:
+		default:
+			close(b.done)
+		}
+	}
+}
+
+// wait until every published URL has been scheduled, or given timeout
+func (b *benchmark) wait(timeout time.Duration) {
+	select {
+	case <-b.done:
+	case <-time.After(timeout):
+		log.Warn().Msg("Timeout while waiting for URLs to be scheduled")
+	}
+}
+
+// report write the latency percentiles
+func (b *benchmark) report(out io.Writer) error {
+	b.mutex.Lock()
+	latencies := append([]time.Duration{}, b.latencies...)
+	missing := len(b.published)
+	b.mutex.Unlock()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Scheduled\t%d\n", len(latencies))
+	fmt.Fprintf(w, "Missing\t%d\n", missing)
+	if len(latencies) > 0 {
+		fmt.Fprintf(w, "Min\t%s\n", latencies[0])
+		for _, p := range []float64{50, 90, 99} {
+			fmt.Fprintf(w, "p%.0f\t%s\n", p, percentile(latencies, p))
+		}
+		fmt.Fprintf(w, "Max\t%s\n", latencies[len(latencies)-1])
+	}
+
+	return w.Flush()
+}
+
+// percentile returns the p-th percentile (nearest rank) of given sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
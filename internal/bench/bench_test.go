@@ -0,0 +1,113 @@
+package bench
+
+import (
+	"bytes"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := map[float64]time.Duration{
+		0:   time.Millisecond,
+		50:  50 * time.Millisecond,
+		90:  90 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+	}
+	for p, want := range tests {
+		if got := percentile(latencies, p); got != want {
+			t.Errorf("p%.0f: Wanted: %s Got: %s", p, want, got)
+		}
+	}
+
+	if percentile(nil, 50) != 0 {
+		t.Error("percentile of no latencies should be 0")
+	}
+	if got := percentile([]time.Duration{time.Second}, 99); got != time.Second {
+		t.Errorf("Wanted: 1s Got: %s", got)
+	}
+}
+
+func TestMockAPI(t *testing.T) {
+	srv := httptest.NewServer(newMockAPIHandler())
+	defer srv.Close()
+
+	c := api.NewClient(srv.URL)
+	b64URL := api.EncodeURL("http://example.onion")
+
+	if res, count, err := c.SearchResources(api.SearchResourcesOptions{URL: b64URL}, 1, 1); err != nil ||
+		len(res) != 0 || count != 0 {
+		t.Errorf("search should find nothing: %v %d %v", res, count, err)
+	}
+	if res, err := c.GetResource(b64URL); err != nil || res != nil {
+		t.Errorf("resource should not be found: %v %v", res, err)
+	}
+	if res, err := c.SearchResourcesBulk([]string{b64URL}, time.Time{}, time.Time{}); err != nil ||
+		len(res[b64URL]) != 0 {
+		t.Errorf("bulk search should find nothing: %v %v", res, err)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	// Fake scheduler scheduling every URL
+	if _, err := nc.Subscribe(messaging.URLFoundSubject, func(msg *nats.Msg) {
+		var foundMsg messaging.URLFoundMsg
+		if err := natsutil.ReadJSON(msg, &foundMsg); err != nil {
+			t.Error(err)
+			return
+		}
+		_ = natsutil.PublishMsg(nc, &messaging.URLTodoMsg{URL: foundMsg.URL})
+	}); err != nil {
+		t.FailNow()
+	}
+
+	b := newBenchmark(1)
+	if _, err := nc.Subscribe(messaging.URLTodoSubject, b.handleTodo); err != nil {
+		t.FailNow()
+	}
+
+	// URLs not published by the benchmark should be ignored
+	_ = natsutil.PublishMsg(nc, &messaging.URLTodoMsg{URL: "http://other.onion"})
+
+	if err := b.publish(nc, 100, 200*time.Millisecond); err != nil {
+		t.FailNow()
+	}
+	b.wait(5 * time.Second)
+
+	var out bytes.Buffer
+	if err := b.report(&out); err != nil {
+		t.FailNow()
+	}
+
+	if len(b.latencies) < 10 || len(b.published) != 0 {
+		t.Errorf("Wanted: every URL scheduled Got: %d scheduled, %d missing", len(b.latencies), len(b.published))
+	}
+	for _, line := range []string{"Scheduled", "Missing    0", "p50", "p90", "p99"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("report should contain %s: %s", line, out.String())
+		}
+	}
+}
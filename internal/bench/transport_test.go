@@ -0,0 +1,68 @@
+package bench
+
+import (
+	"github.com/creekorful/trandoshan/api"
+	"github.com/rs/zerolog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// BenchmarkAPIClientTransport compare the throughput of the API client searching URLs from concurrent callers
+// using the default transport (2 idle connections kept per host) and a transport keeping one idle connection
+// per caller. Run with -benchtime to make the connection churn visible, e.g:
+//
+//	go test ./internal/bench -run none -bench APIClientTransport -benchtime 10000x
+func BenchmarkAPIClientTransport(b *testing.B) {
+	const callers = 32
+
+	// Logging would dominate the measures
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer zerolog.SetGlobalLevel(level)
+
+	srv := httptest.NewServer(newMockAPIHandler())
+	defer srv.Close()
+
+	b64URL := api.EncodeURL("http://example.onion")
+
+	benchmarks := []struct {
+		name string
+		opts []api.ClientOption
+	}{
+		{"default", nil},
+		{"tuned", []api.ClientOption{api.WithTransport(callers, api.DefaultIdleConnTimeout)}},
+		{"no-keep-alive", []api.ClientOption{api.WithTransport(0, api.DefaultIdleConnTimeout)}},
+	}
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			c := api.NewClient(srv.URL, bench.opts...)
+			filter := api.NewFilter().URL(b64URL).Page(1, 1)
+
+			requests := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range requests {
+						if _, _, err := c.Search(filter); err != nil {
+							b.Error(err)
+						}
+					}
+				}()
+			}
+
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				requests <- struct{}{}
+			}
+			close(requests)
+			wg.Wait()
+
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "req/s")
+		})
+	}
+}
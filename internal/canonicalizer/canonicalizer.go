@@ -0,0 +1,172 @@
+package canonicalizer
+
+import (
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/purell"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"net/url"
+	"strings"
+)
+
+// GetApp return the canonicalizer app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-canonicalizer",
+		Version: "0.5.0",
+		Usage:   "Trandoshan canonicalizer process",
+		Flags: []cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "nats-uri",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
+				Required: true,
+			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.StringSliceFlag{
+				Name:  "strip-params",
+				Usage: "Query parameters to remove from the URLs, a trailing * matching any suffix (e.g: utm_*,fbclid)",
+				Value: cli.NewStringSlice("utm_*"),
+			},
+			&cli.BoolFlag{
+				Name:  "keep-www",
+				Usage: "Do not remove the www. prefix of the hostnames",
+			},
+			&cli.StringFlag{
+				Name:  "metrics-addr",
+				Usage: "Address on which to expose the prometheus metrics (e.g: :9090)",
+			},
+		},
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-canonicalizer")
+
+	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
+
+	c := &canonicalizer{
+		stripParams: ctx.StringSlice("strip-params"),
+		removeWWW:   !ctx.Bool("keep-www"),
+	}
+	log.Debug().Strs("strip-params", c.stripParams).Bool("remove-www", c.removeWWW).Msg("Canonicalizing URLs")
+
+	// Create the NATS subscriber
+	sub, err := natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	defer heartbeat.Start(ctx, sub)()
+
+	if addr := ctx.String("metrics-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing metrics")
+		if err := natsutil.StartMetricsServer(addr, sub); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Msg("Successfully initialized tdsh-canonicalizer. Waiting for URLs")
+
+	if err := sub.QueueSubscribe(messaging.URLFoundSubject, "canonicalizers", handleMessage(c)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// handleMessage returns the handler publishing the canonicalized found URLs to url.canonical
+func handleMessage(c *canonicalizer) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		var urlMsg messaging.URLFoundMsg
+		if err := natsutil.ReadMsg(msg, &urlMsg); err != nil {
+			return err
+		}
+
+		canonicalURL, err := c.canonicalize(urlMsg.URL)
+		if err != nil {
+			log.Debug().Str("url", urlMsg.URL).Str("err", err.Error()).Msg("Skipping invalid URL")
+			return err
+		}
+
+		log.Trace().Str("url", urlMsg.URL).Str("canonical", canonicalURL).Msg("Publishing canonical URL")
+
+		// Depth, priority & retries are kept as is
+		urlMsg.URL = canonicalURL
+		return natsutil.PublishJSON(nc, messaging.URLCanonicalSubject, &urlMsg)
+	}
+}
+
+// canonicalizer rewrite the URLs so that the different forms of the same URL are identical
+type canonicalizer struct {
+	// stripParams are the query parameters to remove, a trailing * matching any suffix
+	stripParams []string
+	// removeWWW remove the www. prefix of the hostnames
+	removeWWW bool
+}
+
+// canonicalize returns the canonical form of given absolute URL: scheme & hostname lowercased, default port,
+// dot segments and stripped parameters removed, query sorted & percent-encoding normalized
+func (c *canonicalizer) canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Hostname() == "" {
+		return "", fmt.Errorf("%s is not an absolute URL", rawURL)
+	}
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for param := range query {
+			if c.shouldStrip(param) {
+				query.Del(param)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	flags := purell.FlagsSafe | purell.FlagRemoveDotSegments
+	if c.removeWWW {
+		flags |= purell.FlagRemoveWWW
+	}
+
+	// The hostname may be left empty by the removal of the www. prefix
+	canonicalURL := purell.NormalizeURL(u, flags)
+	if cu, err := url.Parse(canonicalURL); err != nil || cu.Hostname() == "" {
+		return "", fmt.Errorf("%s has no valid canonical form", rawURL)
+	}
+
+	return canonicalURL, nil
+}
+
+// shouldStrip returns true if given query parameter should be removed
+func (c *canonicalizer) shouldStrip(param string) bool {
+	for _, pattern := range c.stripParams {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(param, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if param == pattern {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+//go:build go1.18
+// +build go1.18
+
+package canonicalizer
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func FuzzCanonicalize(f *testing.F) {
+	for _, seed := range []string{
+		"http://example.onion",
+		"HTTP://WWW.Example.ONION:80/a/./b/../c?utm_source=x&b=2&a=1#top",
+		"https://example.onion/t%41%2f?q=a%20b&utm_medium=",
+		"http://example.onion/a b?fbclid=1",
+		"http://[::1]:8080/%zz",
+		"/relative/path",
+	} {
+		f.Add(seed)
+	}
+
+	c := &canonicalizer{stripParams: []string{"utm_*", "fbclid"}, removeWWW: true}
+
+	f.Fuzz(func(t *testing.T, rawURL string) {
+		canonical, err := c.canonicalize(rawURL)
+		if err != nil {
+			return
+		}
+
+		u, err := url.Parse(canonical)
+		if err != nil {
+			t.Fatalf("%q: canonical URL %q should be valid: %s", rawURL, canonical, err)
+		}
+
+		if strings.HasPrefix(strings.ToLower(u.Host), "www.") {
+			t.Errorf("%q: www. prefix should have been removed: %q", rawURL, canonical)
+		}
+		for param := range u.Query() {
+			if c.shouldStrip(param) {
+				t.Errorf("%q: parameter %s should have been removed: %q", rawURL, param, canonical)
+			}
+		}
+
+		// Canonicalizing a canonical URL should not change it
+		again, err := c.canonicalize(canonical)
+		if err != nil {
+			t.Fatalf("%q: canonical URL %q should be canonicalizable: %s", rawURL, canonical, err)
+		}
+		if again != canonical {
+			t.Errorf("%q: canonicalization should be idempotent: %q then %q", rawURL, canonical, again)
+		}
+	})
+}
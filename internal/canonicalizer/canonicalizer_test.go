@@ -0,0 +1,108 @@
+package canonicalizer
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func TestCanonicalize(t *testing.T) {
+	c := &canonicalizer{stripParams: []string{"utm_*", "fbclid"}, removeWWW: true}
+
+	tests := map[string]string{
+		"http://example.onion":                                   "http://example.onion",
+		"HTTP://Example.ONION/Path":                              "http://example.onion/Path",
+		"http://example.onion:80/a/./b/../c":                     "http://example.onion/a/c",
+		"http://www.example.onion/":                              "http://example.onion/",
+		"http://example.onion/t%41%7e%c3%a9":                     "http://example.onion/tA~%C3%A9",
+		"http://example.onion/a b":                               "http://example.onion/a%20b",
+		"http://example.onion/?b=2&a=1":                          "http://example.onion/?a=1&b=2",
+		"http://example.onion/?utm_source=x&utm_medium=y&id=1":   "http://example.onion/?id=1",
+		"http://example.onion/?fbclid=abc":                       "http://example.onion/",
+		"http://example.onion/?fbclid2=abc":                      "http://example.onion/?fbclid2=abc",
+		"http://example.onion/?q=a%20b":                          "http://example.onion/?q=a+b",
+		"http://example.onion/#top":                              "http://example.onion/#top",
+		"https://www.example.onion:443/index.html?utm_campaign=": "https://example.onion/index.html",
+	}
+
+	for rawURL, want := range tests {
+		got, err := c.canonicalize(rawURL)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", rawURL, err)
+		}
+		if got != want {
+			t.Errorf("%s: Wanted: %s Got: %s", rawURL, want, got)
+		}
+	}
+
+	for _, rawURL := range []string{"example.onion/path", "/path", "http://%zz", "http://:80", "http://www.", ""} {
+		if _, err := c.canonicalize(rawURL); err == nil {
+			t.Errorf("%s: error should have been returned", rawURL)
+		}
+	}
+}
+
+func TestCanonicalizeKeepWWW(t *testing.T) {
+	c := &canonicalizer{}
+
+	got, err := c.canonicalize("http://www.example.onion/?utm_source=x")
+	if err != nil {
+		t.FailNow()
+	}
+	if got != "http://www.example.onion/?utm_source=x" {
+		t.Errorf("Wanted: http://www.example.onion/?utm_source=x Got: %s", got)
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	canonicalSub, err := nc.SubscribeSync(messaging.URLCanonicalSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := handleMessage(&canonicalizer{stripParams: []string{"utm_*"}, removeWWW: true})
+
+	b, err := json.Marshal(&messaging.URLFoundMsg{URL: "http://WWW.example.onion/?utm_source=x", Depth: 2, Priority: 1})
+	if err != nil {
+		t.FailNow()
+	}
+	if err := handler(context.Background(), nc, &nats.Msg{Data: b}); err != nil {
+		t.FailNow()
+	}
+
+	msg, err := canonicalSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("canonical URL should have been published")
+	}
+	var canonicalMsg messaging.URLFoundMsg
+	if err := natsutil.ReadJSON(msg, &canonicalMsg); err != nil {
+		t.FailNow()
+	}
+	if canonicalMsg.URL != "http://example.onion/" || canonicalMsg.Depth != 2 || canonicalMsg.Priority != 1 {
+		t.Errorf("unexpected canonical URL: %+v", canonicalMsg)
+	}
+
+	// Relative URLs cannot be canonicalized
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"/path"}`)}); err == nil {
+		t.Error("invalid URL should be returned as error")
+	}
+	if _, err := canonicalSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("invalid URL should not be published")
+	}
+}
@@ -0,0 +1,27 @@
+package crawler
+
+import (
+	"golang.org/x/net/html/charset"
+	"strings"
+)
+
+// byteOrderMark may start the decoded body, it is not part of the text
+const byteOrderMark = "\uFEFF"
+
+// decodeBody returns given body decoded to UTF-8, and the lower cased WHATWG name of its charset (e.g: utf-8,
+// windows-1252 or utf-16le). The charset is read from the byte order mark, the Content-Type header or the
+// <meta charset> tag, in that order. Bodies without any are either UTF-8 or windows-1252, as browsers do.
+// Latin-1 (iso-8859-1) is decoded as windows-1252, its superset
+func decodeBody(body []byte, contentType string) (string, string, error) {
+	encoding, name, _ := charset.DetermineEncoding(body, contentType)
+	if name == "utf-8" {
+		return strings.TrimPrefix(string(body), byteOrderMark), name, nil
+	}
+
+	decoded, err := encoding.NewDecoder().Bytes(body)
+	if err != nil {
+		return "", name, err
+	}
+
+	return strings.TrimPrefix(string(decoded), byteOrderMark), name, nil
+}
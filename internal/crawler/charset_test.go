@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// utf16Bytes returns given text encoded in UTF-16, starting with the byte order mark
+func utf16Bytes(text string, bigEndian bool) []byte {
+	var b []byte
+	for _, unit := range utf16.Encode([]rune(byteOrderMark + text)) {
+		if bigEndian {
+			b = append(b, byte(unit>>8), byte(unit))
+		} else {
+			b = append(b, byte(unit), byte(unit>>8))
+		}
+	}
+	return b
+}
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		body        []byte
+		contentType string
+		want        string
+		charset     string
+	}{
+		{[]byte("<html>Café</html>"), "text/html", "<html>Café</html>", "utf-8"},
+		{[]byte("\xef\xbb\xbf<html>Café</html>"), "text/html", "<html>Café</html>", "utf-8"},
+		{[]byte("<html>Caf\xe9</html>"), "text/html; charset=ISO-8859-1", "<html>Café</html>", "windows-1252"},
+		{
+			[]byte(`<html><meta charset="latin1">Caf` + "\xe9</html>"), "text/html",
+			`<html><meta charset="latin1">Café</html>`, "windows-1252",
+		},
+		// Unknown charset without meta tag
+		{[]byte("<html>Caf\xe9</html>"), "text/html", "<html>Café</html>", "windows-1252"},
+		{utf16Bytes("<html>Café 東京</html>", false), "text/html", "<html>Café 東京</html>", "utf-16le"},
+		{utf16Bytes("<html>Café 東京</html>", true), "text/html", "<html>Café 東京</html>", "utf-16be"},
+	}
+
+	for _, test := range tests {
+		body, charset, err := decodeBody(test.body, test.contentType)
+		if err != nil {
+			t.Errorf("%q: %s", test.body, err)
+			continue
+		}
+		if body != test.want || charset != test.charset {
+			t.Errorf("%q: Wanted: %s (%s) Got: %s (%s)", test.body, test.want, test.charset, body, charset)
+		}
+	}
+}
+
+func TestHandleMessageCharset(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latin1.html":
+			w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+			_, _ = w.Write([]byte("<html><title>Caf\xe9</title>Bienvenue au caf\xe9</html>"))
+		case "/utf16.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write(utf16Bytes("<html><title>Café</title><a href=\"/menu.html\">Menu</a></html>", false))
+		}
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	foundSub, err := nc.SubscribeSync(messaging.URLFoundSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize,
+		nil, nil, nil, nil)
+
+	tests := []struct {
+		path    string
+		charset string
+		body    string
+	}{
+		{"/latin1.html", "windows-1252", "<html><title>Café</title>Bienvenue au café</html>"},
+		{"/utf16.html", "utf-16le", "<html><title>Café</title><a href=\"/menu.html\">Menu</a></html>"},
+	}
+
+	for _, test := range tests {
+		if err := handler(context.Background(), nc, todoMsg(t, srv.URL+test.path, 0)); err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := resourceSub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("%s: resource should have been published", test.path)
+		}
+
+		var resMsg messaging.NewResourceMsg
+		if err := natsutil.ReadJSON(msg, &resMsg); err != nil {
+			t.FailNow()
+		}
+		if resMsg.Charset != test.charset || resMsg.Body != test.body || resMsg.Title != "Café" {
+			t.Errorf("%s: Wanted: %s (%s) Got: %s (%s), title: %s", test.path, test.body, test.charset,
+				resMsg.Body, resMsg.Charset, resMsg.Title)
+		}
+	}
+
+	// Links are extracted from the decoded body
+	msg, err := foundSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("link of the UTF-16 page should have been published")
+	}
+	var foundMsg messaging.URLFoundMsg
+	if err := natsutil.ReadJSON(msg, &foundMsg); err != nil || foundMsg.URL != srv.URL+"/menu.html" {
+		t.Errorf("Wanted: %s/menu.html Got: %s", srv.URL, foundMsg.URL)
+	}
+}
@@ -1,49 +1,152 @@
 package crawler
 
 import (
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
+	htmlutil "github.com/creekorful/trandoshan/internal/util/html"
 	"github.com/creekorful/trandoshan/internal/util/logging"
 	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
-	"github.com/valyala/fasthttp"
-	"github.com/valyala/fasthttp/fasthttpproxy"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
-const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; rv:68.0) Gecko/20100101 Firefox/68.0"
+const (
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; rv:68.0) Gecko/20100101 Firefox/68.0"
+	// defaultMaxBodySize is the default maximum number of bytes read from a response body
+	defaultMaxBodySize = 10 * 1024 * 1024
+)
+
+// errForbiddenContentType is returned when the content type of the crawled resource is not allowed
+var errForbiddenContentType = errors.New("forbidden content type")
+
+// errFailingResponse is returned when the response status code is a failure (above 302)
+var errFailingResponse = errors.New("non-managed error code")
 
 // GetApp return the crawler app
 func GetApp() *cli.App {
 	return &cli.App{
 		Name:    "tdsh-crawler",
-		Version: "0.4.0",
+		Version: "0.5.0",
 		Usage:   "Trandoshan crawler process",
 		Flags: []cli.Flag{
 			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
 			&cli.StringFlag{
 				Name:     "nats-uri",
-				Usage:    "URI to the NATS server",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
 				Required: true,
 			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.BoolFlag{
+				Name:  "use-jetstream",
+				Usage: "Use a JetStream durable consumer to read the URLs to crawl (required by the scheduler back-pressure)",
+			},
+			&cli.DurationFlag{
+				Name:  "jetstream-nak-delay",
+				Usage: "Delay before redelivery of an URL that failed to be crawled (JetStream only)",
+				Value: 10 * time.Second,
+			},
 			&cli.StringFlag{
-				Name:     "tor-uri",
-				Usage:    "URI to the TOR SOCKS proxy",
-				Required: true,
+				Name:  "tor-uri",
+				Usage: "URI to the TOR SOCKS proxy (e.g: 127.0.0.1:9050), ignored if --proxy-url is set",
+			},
+			&cli.StringFlag{
+				Name:  "proxy-url",
+				Usage: "URL of the SOCKS5 proxy to crawl through (e.g: socks5://127.0.0.1:9050)",
+			},
+			&cli.DurationFlag{
+				Name:    "connect-timeout",
+				Aliases: []string{"proxy-timeout"},
+				Usage:   "Timeout of the connections established through the proxy",
+				Value:   5 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "request-timeout",
+				Usage: "Timeout of the whole request, redirects and body included",
+				Value: 10 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "timeout-rules",
+				Usage: "YAML file mapping hostname regexes to connect and/or request timeouts, e.g: 'slow\\.onion$': {request: 1m}",
+			},
+			&cli.IntFlag{
+				Name:  "tor-retry-count",
+				Usage: "Number of times an URL failing because of the Tor circuit (SOCKS5 error or 503) is retried using new circuits",
+			},
+			&cli.StringFlag{
+				Name:  "tor-control-addr",
+				Usage: "Address of the Tor control port used to build new circuits before retrying (e.g: 127.0.0.1:9051)",
+			},
+			&cli.StringFlag{
+				Name:  "tor-control-password",
+				Usage: "Password used to authenticate against the Tor control port",
+			},
+			&cli.StringFlag{
+				Name:  "tor-new-circuit-cmd",
+				Usage: "Shell command used to build new Tor circuits before retrying, instead of the control port",
 			},
 			&cli.StringFlag{
 				Name:  "user-agent",
-				Usage: "User agent to use",
+				Usage: "User agent to use (overrides --user-agents-file)",
 				Value: defaultUserAgent,
 			},
+			&cli.StringFlag{
+				Name:  "user-agents-file",
+				Usage: "Newline-delimited file of user agents, one being picked at random for each request",
+			},
 			&cli.StringSliceFlag{
-				Name:  "allowed-ct",
-				Usage: "Content types allowed to crawl",
-				Value: cli.NewStringSlice("text/"),
+				Name:    "allowed-content-types",
+				Aliases: []string{"allowed-ct"},
+				Usage:   "Content types allowed to crawl (a type ending with / allows every subtype, e.g: text/)",
+				Value:   cli.NewStringSlice("text/html", "application/xhtml+xml"),
+			},
+			&cli.Int64Flag{
+				Name:  "max-body-size",
+				Usage: "Maximum number of bytes read from a response body, the rest being discarded (0 = no limit)",
+				Value: defaultMaxBodySize,
+			},
+			&cli.BoolFlag{
+				Name:  "respect-robots-txt",
+				Usage: "Do not crawl the URLs disallowed by the robots.txt of their host",
+			},
+			&cli.DurationFlag{
+				Name:  "robots-cache-ttl",
+				Usage: "Duration during which the robots.txt of an host is cached",
+				Value: time.Hour,
+			},
+			&cli.IntFlag{
+				Name:  "keyword-count",
+				Usage: "Number of keywords extracted from each crawled page (0 = disabled)",
+				Value: 10,
+			},
+			&cli.IntFlag{
+				Name:  "min-keyword-len",
+				Usage: "Minimum number of characters of the extracted keywords",
+				Value: 4,
+			},
+			&cli.StringFlag{
+				Name:  "metrics-addr",
+				Usage: "Address on which to expose the prometheus metrics (e.g: :9090)",
 			},
 		},
 		Action: execute,
@@ -56,102 +159,414 @@ func execute(ctx *cli.Context) error {
 	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-crawler")
 
 	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
-	log.Debug().Str("uri", ctx.String("tor-uri")).Msg("Using TOR proxy")
-	log.Debug().Strs("content-types", ctx.StringSlice("allowed-ct")).Msg("Allowed content types")
 
-	// Create the HTTP client
-	httpClient := &fasthttp.Client{
-		// Use given TOR proxy to reach the hidden services
-		Dial: fasthttpproxy.FasthttpSocksDialer(ctx.String("tor-uri")),
-		// Disable SSL verification since we do not really care about this
-		TLSConfig:    &tls.Config{InsecureSkipVerify: true},
-		ReadTimeout:  time.Second * 5,
-		WriteTimeout: time.Second * 5,
-		Name:         ctx.String("user-agent"),
+	proxyURL := ctx.String("proxy-url")
+	if proxyURL == "" {
+		if ctx.String("tor-uri") == "" {
+			return fmt.Errorf("either --proxy-url or --tor-uri should be set")
+		}
+		proxyURL = "socks5://" + ctx.String("tor-uri")
+	}
+	log.Debug().Str("url", proxyURL).Msg("Using proxy")
+	log.Debug().Strs("content-types", ctx.StringSlice("allowed-content-types")).Msg("Allowed content types")
+
+	agents := userAgents{ctx.String("user-agent")}
+	if path := ctx.String("user-agents-file"); path != "" && !ctx.IsSet("user-agent") {
+		fileAgents, err := readUserAgents(path)
+		if err != nil {
+			return err
+		}
+		agents = fileAgents
+	}
+	log.Debug().Int("count", len(agents)).Msg("Using user agents")
+
+	defaultTimeouts := timeouts{connect: ctx.Duration("connect-timeout"), request: ctx.Duration("request-timeout")}
+	if defaultTimeouts.connect <= 0 || defaultTimeouts.request <= 0 {
+		return fmt.Errorf("--connect-timeout and --request-timeout should be positive")
+	}
+	timeoutsByHost, err := loadTimeoutRules(ctx.String("timeout-rules"), defaultTimeouts)
+	if err != nil {
+		return err
+	}
+	log.Debug().Dur("connect", defaultTimeouts.connect).Dur("request", defaultTimeouts.request).
+		Int("rules", len(timeoutsByHost.rules)).Msg("Using timeouts")
+
+	// Create the HTTP client, the per-host request timeouts being applied using the request context
+	httpClient, err := newHTTPClient(proxyURL, defaultTimeouts.connect, timeoutsByHost.maxRequest())
+	if err != nil {
+		return err
+	}
+
+	var robots *robotsCache
+	if ctx.Bool("respect-robots-txt") {
+		log.Debug().Dur("ttl", ctx.Duration("robots-cache-ttl")).Msg("Respecting robots.txt")
+		// The robots.txt are matched against the first user agent: the rotated ones are usually browser user agents
+		robots = newRobotsCache(httpClient, agents[0], ctx.Duration("robots-cache-ttl"))
+	}
+
+	var retry *circuitRetry
+	if count := ctx.Int("tor-retry-count"); count > 0 {
+		retry = &circuitRetry{count: count}
+		if cmd := ctx.String("tor-new-circuit-cmd"); cmd != "" {
+			retry.renew = newCommandRenewer(cmd)
+		} else if addr := ctx.String("tor-control-addr"); addr != "" {
+			retry.renew = newControlPortRenewer(addr, ctx.String("tor-control-password"))
+		} else {
+			return fmt.Errorf("--tor-retry-count requires either --tor-control-addr or --tor-new-circuit-cmd")
+		}
+		log.Debug().Int("count", count).Msg("Retrying Tor circuit failures")
+	}
+
+	var keywords *keywordExtractor
+	if count := ctx.Int("keyword-count"); count > 0 {
+		keywords = newKeywordExtractor(count, ctx.Int("min-keyword-len"))
+		log.Debug().Int("count", count).Int("min-len", ctx.Int("min-keyword-len")).Msg("Extracting keywords")
 	}
 
 	// Create the NATS subscriber
-	sub, err := natsutil.NewSubscriber(ctx.String("nats-uri"))
+	var sub *natsutil.Connection
+	if ctx.Bool("use-jetstream") {
+		log.Debug().Msg("Using JetStream")
+		sub, err = natsutil.NewJetStreamConnection(ctx.String("nats-uri"), ctx.Duration("jetstream-nak-delay"),
+			natsutil.GetOptions(ctx)...)
+	} else {
+		sub, err = natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	}
 	if err != nil {
 		return err
 	}
 	defer sub.Close()
 
+	defer heartbeat.Start(ctx, sub)()
+
+	if addr := ctx.String("metrics-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing metrics")
+		if err := natsutil.StartMetricsServer(addr, sub); err != nil {
+			return err
+		}
+	}
+
 	log.Info().Msg("Successfully initialized tdsh-crawler. Waiting for URLs")
 
 	if err := sub.QueueSubscribe(messaging.URLTodoSubject, "crawlers",
-		handleMessage(httpClient, ctx.StringSlice("allowed-ct"))); err != nil {
+		handleMessage(httpClient, agents, ctx.StringSlice("allowed-content-types"),
+			ctx.Int64("max-body-size"), robots, retry, keywords, timeoutsByHost)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func handleMessage(httpClient *fasthttp.Client, allowedContentTypes []string) natsutil.MsgHandler {
-	return func(nc *nats.Conn, msg *nats.Msg) error {
+// handleMessage returns the handler crawling the URLs, nil robots meaning robots.txt are ignored,
+// nil retry meaning Tor circuit failures are not retried, nil keywords meaning no keywords are extracted
+// and nil timeoutsByHost meaning only the HTTP client timeouts apply
+func handleMessage(httpClient *http.Client, agents userAgents, allowedContentTypes []string, maxBodySize int64,
+	robots *robotsCache, retry *circuitRetry, keywords *keywordExtractor,
+	timeoutsByHost *timeoutRules) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
 		var urlMsg messaging.URLTodoMsg
 		if err := natsutil.ReadMsg(msg, &urlMsg); err != nil {
 			return err
 		}
 
-		body, err := crawURL(httpClient, urlMsg.URL, allowedContentTypes)
+		if robots != nil {
+			u, err := url.Parse(urlMsg.URL)
+			if err != nil {
+				return err
+			}
+
+			if !robots.allowed(u) {
+				log.Debug().Str("url", urlMsg.URL).Msg("Skipping URL disallowed by robots.txt")
+				publishSkipped(nc, urlMsg, messaging.SkipReasonRobotsTxt)
+				return nil
+			}
+		}
+
+		userAgent := agents.pick()
+
+		// Apply the timeouts of the host, which may be longer or shorter than the default ones
+		crawlCtx := ctx
+		if timeoutsByHost != nil {
+			u, err := url.Parse(urlMsg.URL)
+			if err != nil {
+				return err
+			}
+
+			hostTimeouts := timeoutsByHost.get(u.Hostname())
+			var cancel context.CancelFunc
+			crawlCtx, cancel = context.WithTimeout(withConnectTimeout(ctx, hostTimeouts.connect), hostTimeouts.request)
+			defer cancel()
+		}
+
+		var page crawledPage
+		var err error
+		for attempt := 1; ; attempt++ {
+			start := time.Now()
+			page, err = crawURL(crawlCtx, httpClient, urlMsg.URL, userAgent, allowedContentTypes, maxBodySize)
+			publishResult(nc, urlMsg, page.statusCode, time.Since(start), err)
+
+			if retry == nil || attempt > retry.count || !isCircuitError(page.statusCode, err) || crawlCtx.Err() != nil {
+				break
+			}
+
+			log.Debug().Str("url", urlMsg.URL).Int("attempt", attempt).Str("err", err.Error()).
+				Msg("Tor circuit failure, retrying using new circuits")
+			if err := retry.renew(ctx); err != nil {
+				log.Warn().Str("err", err.Error()).Msg("Error while building new Tor circuits")
+			}
+		}
+
+		if errors.Is(err, errForbiddenContentType) {
+			log.Debug().Str("url", urlMsg.URL).Str("err", err.Error()).Msg("Skipping URL")
+			publishSkipped(nc, urlMsg, messaging.SkipReasonContentType)
+			return nil
+		}
 		if err != nil {
 			log.Err(err).Str("url", urlMsg.URL).Msg("Error while crawling url")
+			publishFailed(nc, urlMsg, err)
+
+			// Save the failing response too (without body), so that it can be searched by its response code
+			if errors.Is(err, errFailingResponse) {
+				if err := natsutil.PublishMsg(nc, &messaging.NewResourceMsg{
+					URL:          urlMsg.URL,
+					Depth:        urlMsg.Depth,
+					UserAgent:    userAgent,
+					Source:       urlMsg.Source,
+					ResponseCode: page.responseCode,
+					TraceID:      urlMsg.TraceID,
+				}); err != nil {
+					log.Err(err).Msg("Error while publishing failing resource")
+				}
+			}
+
 			return err
 		}
 
+		if page.truncated {
+			log.Warn().Str("url", urlMsg.URL).Int64("max-body-size", maxBodySize).Msg("Body truncated")
+		}
+
+		body := page.body
+		title, err := htmlutil.ExtractTitle(strings.NewReader(body))
+		if err != nil {
+			log.Warn().Str("url", urlMsg.URL).Str("err", err.Error()).Msg("Error while extracting title")
+		}
+
+		// The language is detected & the keywords extracted on the displayed text only
+		language := ""
+		var pageKeywords []string
+		if text, err := htmlutil.ExtractText(strings.NewReader(body)); err == nil {
+			language = detectLanguage(text)
+			if keywords != nil {
+				pageKeywords = keywords.extract(text)
+			}
+		} else {
+			log.Warn().Str("url", urlMsg.URL).Str("err", err.Error()).Msg("Error while extracting text")
+		}
+
 		// Publish resource body
 		res := messaging.NewResourceMsg{
-			URL:  urlMsg.URL,
-			Body: body,
+			URL:          urlMsg.URL,
+			Body:         body,
+			Title:        title,
+			ContentHash:  contentHash(body),
+			Truncated:    page.truncated,
+			Depth:        urlMsg.Depth,
+			UserAgent:    userAgent,
+			Language:     language,
+			Charset:      page.charset,
+			Keywords:     pageKeywords,
+			Source:       urlMsg.Source,
+			ResponseCode: page.responseCode,
+			TraceID:      urlMsg.TraceID,
 		}
 		if err := natsutil.PublishMsg(nc, &res); err != nil {
 			log.Err(err).Msg("Error while publishing resource body")
 		}
 
+		// Then publish the found links, relative ones being resolved against the URL after redirects
+		links, err := htmlutil.ExtractLinks(strings.NewReader(body), page.url)
+		if err != nil {
+			log.Err(err).Str("url", urlMsg.URL).Msg("Error while extracting links")
+			return nil
+		}
+
+		for _, link := range links {
+			log.Trace().Str("url", link).Msg("Publishing found URL")
+
+			if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{
+				URL:    link,
+				Depth:  urlMsg.Depth + 1,
+				Source: messaging.SourceCrawler,
+			}); err != nil {
+				log.Warn().Str("url", link).Str("err", err.Error()).Msg("Error while publishing URL")
+			}
+		}
+
 		return nil
 	}
 }
 
-func crawURL(httpClient *fasthttp.Client, url string, allowedContentTypes []string) (string, error) {
-	log.Debug().Str("url", url).Msg("Processing URL")
+func publishSkipped(nc *nats.Conn, urlMsg messaging.URLTodoMsg, reason messaging.SkipReason) {
+	skipped := messaging.URLSkippedMsg{
+		URL:       urlMsg.URL,
+		Reason:    reason,
+		Timestamp: time.Now(),
+		TraceID:   urlMsg.TraceID,
+	}
+	if err := natsutil.PublishMsg(nc, &skipped); err != nil {
+		log.Err(err).Msg("Error while publishing skipped URL")
+	}
+}
+
+// publishFailed publish given URL to url.failed, allowing it to be retried
+func publishFailed(nc *nats.Conn, urlMsg messaging.URLTodoMsg, err error) {
+	failed := messaging.URLFailedMsg{
+		URL:       urlMsg.URL,
+		Depth:     urlMsg.Depth,
+		Retries:   urlMsg.Retries,
+		Source:    urlMsg.Source,
+		Error:     err.Error(),
+		Timestamp: time.Now(),
+		TraceID:   urlMsg.TraceID,
+	}
+	if err := natsutil.PublishMsg(nc, &failed); err != nil {
+		log.Err(err).Msg("Error while publishing failed URL")
+	}
+}
+
+// publishResult publish the outcome of the crawling of given URL
+func publishResult(nc *nats.Conn, urlMsg messaging.URLTodoMsg, statusCode int, latency time.Duration, err error) {
+	result := messaging.CrawlResultMsg{
+		URL:        urlMsg.URL,
+		StatusCode: statusCode,
+		LatencyMs:  latency.Milliseconds(),
+		TLSError:   isTLSError(err),
+		TimedOut:   isTimeoutError(err),
+		Timestamp:  time.Now(),
+		TraceID:    urlMsg.TraceID,
+	}
+	if result.TimedOut {
+		crawlerTimeouts.Inc()
+	}
+	if err := natsutil.PublishMsg(nc, &result); err != nil {
+		log.Err(err).Msg("Error while publishing crawl result")
+	}
+}
+
+// crawledPage is the outcome of an URL crawling
+type crawledPage struct {
+	// body is decoded to UTF-8
+	body string
+	// charset is the name of the charset the body has been decoded from (e.g: windows-1252)
+	charset string
+	// url is the URL the body has been read from once redirects are followed
+	url *url.URL
+	// statusCode is the response status code (0 if no response has been received)
+	statusCode int
+	// responseCode is the status code of the first response, before redirects are followed
+	responseCode int
+	// truncated is true if the body was larger than the maximum body size
+	truncated bool
+}
 
-	// Query the website
-	req := fasthttp.AcquireRequest()
-	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
+// crawURL returns the page read from given URL. The status code is set even if an error is returned.
+// At most maxBodySize bytes of the body are read (0 = no limit), the request is aborted once ctx is cancelled
+func crawURL(ctx context.Context, httpClient *http.Client, rawURL, userAgent string, allowedContentTypes []string,
+	maxBodySize int64) (crawledPage, error) {
+	log.Debug().Str("url", rawURL).Msg("Processing URL")
 
-	req.SetRequestURI(url)
+	// Query the website (redirects are followed by the client)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return crawledPage{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
 
-	if err := httpClient.Do(req, resp); err != nil {
-		return "", err
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return crawledPage{}, err
 	}
+	defer resp.Body.Close()
 
-	switch code := resp.StatusCode(); {
-	case code > 302:
-		return "", fmt.Errorf("non-managed error code %d", code)
-	// follow redirect
-	case code == 301 || code == 302:
-		if location := string(resp.Header.Peek("Location")); location != "" {
-			return crawURL(httpClient, location, allowedContentTypes)
-		}
+	page := crawledPage{url: resp.Request.URL, statusCode: resp.StatusCode, responseCode: resp.StatusCode}
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		page.responseCode = req.Response.StatusCode
 	}
 
-	// Determinate if content type is allowed
-	allowed := false
-	contentType := string(resp.Header.Peek("Content-Type"))
-	for _, allowedContentType := range allowedContentTypes {
-		if strings.Contains(contentType, allowedContentType) {
-			allowed = true
-			break
-		}
+	if code := resp.StatusCode; code > 302 {
+		return page, fmt.Errorf("%w %d", errFailingResponse, code)
+	}
+
+	// Determinate if content type is allowed before reading the body
+	contentType := resp.Header.Get("Content-Type")
+	if !isContentTypeAllowed(contentType, allowedContentTypes) {
+		return page, fmt.Errorf("%w: %s", errForbiddenContentType, contentType)
+	}
+
+	// Read one more byte to detect truncation
+	var reader io.Reader = resp.Body
+	if maxBodySize > 0 {
+		reader = io.LimitReader(resp.Body, maxBodySize+1)
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return page, err
+	}
+	if maxBodySize > 0 && int64(len(body)) > maxBodySize {
+		body = body[:maxBodySize]
+		page.truncated = true
+	}
+
+	if page.body, page.charset, err = decodeBody(body, contentType); err != nil {
+		return page, fmt.Errorf("error while decoding body: %w", err)
+	}
+
+	return page, nil
+}
+
+// isTLSError returns true if given error has been caused by the TLS layer (handshake, certificate, etc...)
+func isTLSError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var recordHeaderErr tls.RecordHeaderError
+	var certificateErr x509.CertificateInvalidError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &recordHeaderErr) || errors.As(err, &certificateErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) {
+		return true
+	}
+
+	// The TLS alerts are not exported, and the record header errors are replaced by the HTTP client
+	return strings.Contains(err.Error(), "tls: ") || strings.Contains(err.Error(), "HTTP response to HTTPS client")
+}
+
+// contentHash returns the hex encoded SHA-256 of given body. Line endings and surrounding whitespaces are
+// ignored so that the same page served with different line endings has the same hash
+func contentHash(body string) string {
+	body = strings.TrimSpace(strings.ReplaceAll(body, "\r\n", "\n"))
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// isContentTypeAllowed returns true if given Content-Type header value match one of the allowed content types
+func isContentTypeAllowed(contentType string, allowedContentTypes []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
 	}
 
-	if !allowed {
-		err := fmt.Errorf("forbidden content type : %s", contentType)
-		return "", err
+	for _, allowedContentType := range allowedContentTypes {
+		allowedContentType = strings.ToLower(strings.TrimSpace(allowedContentType))
+		if mediaType == allowedContentType ||
+			(strings.HasSuffix(allowedContentType, "/") && strings.HasPrefix(mediaType, allowedContentType)) {
+			return true
+		}
 	}
 
-	return string(resp.Body()), nil
+	return false
 }
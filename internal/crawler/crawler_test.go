@@ -0,0 +1,538 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var defaultContentTypes = []string{"text/html", "application/xhtml+xml"}
+
+func todoMsg(t *testing.T, url string, depth int) *nats.Msg {
+	b, err := json.Marshal(&messaging.URLTodoMsg{URL: url, Depth: depth})
+	if err != nil {
+		t.FailNow()
+	}
+	return &nats.Msg{Subject: messaging.URLTodoSubject, Data: b}
+}
+
+func TestIsContentTypeAllowed(t *testing.T) {
+	tests := []struct {
+		contentType string
+		allowed     []string
+		want        bool
+	}{
+		{"text/html", defaultContentTypes, true},
+		{"text/html; charset=utf-8", defaultContentTypes, true},
+		{"TEXT/HTML", defaultContentTypes, true},
+		{"application/xhtml+xml", defaultContentTypes, true},
+		{"text/plain", defaultContentTypes, false},
+		{"image/png", defaultContentTypes, false},
+		{"application/pdf", defaultContentTypes, false},
+		{"", defaultContentTypes, false},
+		{"text/plain", []string{"text/"}, true},
+		{"image/png", []string{"text/"}, false},
+	}
+
+	for _, test := range tests {
+		if got := isContentTypeAllowed(test.contentType, test.allowed); got != test.want {
+			t.Errorf("%s (allowed: %v): Wanted: %t Got: %t", test.contentType, test.allowed, test.want, got)
+		}
+	}
+}
+
+func TestHandleMessageContentTypes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<html><head><title>Hello</title></head>hello</html>"))
+		case "/page.xhtml":
+			w.Header().Set("Content-Type", "application/xhtml+xml")
+			_, _ = w.Write([]byte("<html>xhtml</html>"))
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte{0x89, 0x50, 0x4e, 0x47})
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		case "/redirect":
+			http.Redirect(w, r, "/image.png", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	skippedSub, err := nc.SubscribeSync(messaging.URLSkippedSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, nil, nil, nil)
+
+	tests := []struct {
+		path    string
+		crawled bool
+		title   string
+	}{
+		{"/index.html", true, "Hello"},
+		{"/page.xhtml", true, ""},
+		{"/image.png", false, ""},
+		{"/doc.pdf", false, ""},
+		{"/redirect", false, ""},
+	}
+
+	for _, test := range tests {
+		if err := handler(context.Background(), nc, todoMsg(t, srv.URL+test.path, 1)); err != nil {
+			t.Errorf("%s: %s", test.path, err)
+			continue
+		}
+
+		if test.crawled {
+			msg, err := resourceSub.NextMsg(time.Second)
+			if err != nil {
+				t.Errorf("%s should have been crawled", test.path)
+				continue
+			}
+			var resMsg messaging.NewResourceMsg
+			if err := natsutil.ReadJSON(msg, &resMsg); err != nil || resMsg.URL != srv.URL+test.path ||
+				resMsg.Body == "" || resMsg.Title != test.title || resMsg.Depth != 1 ||
+				resMsg.ContentHash != contentHash(resMsg.Body) || resMsg.ResponseCode != http.StatusOK {
+				t.Errorf("%s: invalid resource %+v", test.path, resMsg)
+			}
+		} else {
+			msg, err := skippedSub.NextMsg(time.Second)
+			if err != nil {
+				t.Errorf("%s should have been skipped", test.path)
+				continue
+			}
+			var skippedMsg messaging.URLSkippedMsg
+			if err := natsutil.ReadJSON(msg, &skippedMsg); err != nil || skippedMsg.URL != srv.URL+test.path ||
+				skippedMsg.Reason != messaging.SkipReasonContentType {
+				t.Errorf("%s: invalid skipped URL %+v", test.path, skippedMsg)
+			}
+		}
+	}
+
+	// Nothing else should have been published
+	if _, err := resourceSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("skipped URLs should not be published as resources")
+	}
+}
+
+func TestHandleMessageErrorCode(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	if err := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, nil, nil, nil)(context.Background(), nil, todoMsg(t, srv.URL, 0)); err == nil {
+		t.Error("error code should be returned as error")
+	}
+}
+
+func TestHandleMessageFailed(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	failedSub, err := nc.SubscribeSync(messaging.URLFailedSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	b, err := json.Marshal(&messaging.URLTodoMsg{URL: srv.URL, Depth: 2, Retries: 1, Source: messaging.SourceSeed})
+	if err != nil {
+		t.FailNow()
+	}
+	msg := &nats.Msg{Subject: messaging.URLTodoSubject, Data: b}
+	if err := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, nil, nil, nil)(context.Background(), nc, msg); err == nil {
+		t.Error("error code should be returned as error")
+	}
+
+	failed, err := failedSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("failed URL should have been published")
+	}
+
+	var failedMsg messaging.URLFailedMsg
+	if err := natsutil.ReadJSON(failed, &failedMsg); err != nil {
+		t.FailNow()
+	}
+	if failedMsg.URL != srv.URL || failedMsg.Depth != 2 || failedMsg.Retries != 1 || failedMsg.Error == "" ||
+		failedMsg.Source != messaging.SourceSeed {
+		t.Errorf("unexpected failed URL: %+v", failedMsg)
+	}
+
+	// The failing response is saved too, without body
+	resource, err := resourceSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("failing resource should have been published")
+	}
+
+	var resMsg messaging.NewResourceMsg
+	if err := natsutil.ReadJSON(resource, &resMsg); err != nil {
+		t.FailNow()
+	}
+	if resMsg.URL != srv.URL || resMsg.ResponseCode != http.StatusNotFound || resMsg.Body != "" ||
+		resMsg.ContentHash != "" || resMsg.Source != messaging.SourceSeed {
+		t.Errorf("unexpected failing resource: %+v", resMsg)
+	}
+}
+
+func TestCrawURLRedirectResponseCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/found", http.StatusFound)
+		case "/found":
+			http.Redirect(w, r, "/index.html", http.StatusMovedPermanently)
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>hello</html>"))
+		}
+	}))
+	defer srv.Close()
+
+	for path, want := range map[string]int{"/moved": http.StatusFound, "/index.html": http.StatusOK} {
+		page, err := crawURL(context.Background(), srv.Client(), srv.URL+path, defaultUserAgent, defaultContentTypes,
+			defaultMaxBodySize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The status code is the one of the last response, the response code the one of the first
+		if page.statusCode != http.StatusOK || page.responseCode != want {
+			t.Errorf("%s: Wanted: 200 & %d Got: %d & %d", path, want, page.statusCode, page.responseCode)
+		}
+	}
+}
+
+func TestHandleMessageLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/dir/index.html", http.StatusFound)
+		case "/dir/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="about.html">about</a><a href="http://other.onion/">other</a>` +
+				`<a href="javascript:void(0)">js</a><a href="about.html#team">team</a>`))
+		}
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	foundSub, err := nc.SubscribeSync(messaging.URLFoundSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if err := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, nil, nil, nil)(context.Background(), nc, todoMsg(t, srv.URL+"/old", 2)); err != nil {
+		t.FailNow()
+	}
+
+	// Relative links are resolved against the URL after redirects
+	for _, want := range []string{srv.URL + "/dir/about.html", "http://other.onion/"} {
+		msg, err := foundSub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("%s should have been published", want)
+		}
+
+		var foundMsg messaging.URLFoundMsg
+		if err := natsutil.ReadJSON(msg, &foundMsg); err != nil {
+			t.FailNow()
+		}
+		if foundMsg.URL != want || foundMsg.Depth != 3 || foundMsg.Source != messaging.SourceCrawler {
+			t.Errorf("Wanted: %s (depth 3, crawler) Got: %+v", want, foundMsg)
+		}
+	}
+
+	if _, err := foundSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("no other URL should have been published")
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	hash := contentHash("<html>\nhello\n</html>")
+	if len(hash) != 64 {
+		t.Errorf("Wanted: 64 hex characters Got: %s", hash)
+	}
+
+	// Line endings and surrounding whitespaces should not change the hash
+	for _, body := range []string{"<html>\r\nhello\r\n</html>", "\n  <html>\nhello\n</html>\n\n"} {
+		if h := contentHash(body); h != hash {
+			t.Errorf("%q: Wanted: %s Got: %s", body, hash, h)
+		}
+	}
+
+	if contentHash("<html>\nworld\n</html>") == hash {
+		t.Error("different contents should have different hashes")
+	}
+}
+
+func TestHandleMessageCrawlResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>hello</html>"))
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resultSub, err := nc.SubscribeSync(messaging.CrawlResultSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, nil, nil, nil)
+
+	// Untrusted certificate
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSrv.Close()
+
+	// Speaking TLS to a plain HTTP server
+	httpsURL := strings.Replace(srv.URL, "http://", "https://", 1) + "/index.html"
+
+	tests := []struct {
+		url        string
+		statusCode int
+		tlsError   bool
+	}{
+		{srv.URL + "/index.html", http.StatusOK, false},
+		{srv.URL + "/image.png", http.StatusOK, false},
+		{srv.URL + "/missing.html", http.StatusNotFound, false},
+		{httpsURL, 0, true},
+		{tlsSrv.URL, 0, true},
+	}
+
+	for _, test := range tests {
+		_ = handler(context.Background(), nc, todoMsg(t, test.url, 0))
+
+		msg, err := resultSub.NextMsg(time.Second)
+		if err != nil {
+			t.Errorf("%s: crawl result should have been published", test.url)
+			continue
+		}
+
+		var result messaging.CrawlResultMsg
+		if err := natsutil.ReadJSON(msg, &result); err != nil {
+			t.FailNow()
+		}
+		if result.URL != test.url || result.StatusCode != test.statusCode || result.TLSError != test.tlsError ||
+			result.LatencyMs < 0 || result.Timestamp.IsZero() {
+			t.Errorf("%s: invalid crawl result %+v", test.url, result)
+		}
+	}
+}
+
+func TestHandleMessageTraceID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html>hello</html>"))
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	resultSub, err := nc.SubscribeSync(messaging.CrawlResultSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	b, err := json.Marshal(&messaging.URLTodoMsg{URL: srv.URL, TraceID: "7f3c2a9e-0d4b-4e61-8a2f-5b9c1d0e3f47"})
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, nil, nil, nil)
+	if err := handler(context.Background(), nc, &nats.Msg{Subject: messaging.URLTodoSubject, Data: b}); err != nil {
+		t.Fatal(err)
+	}
+
+	var resource messaging.NewResourceMsg
+	msg, err := resourceSub.NextMsg(time.Second)
+	if err != nil || natsutil.ReadJSON(msg, &resource) != nil {
+		t.Fatal("resource should have been published")
+	}
+	if resource.TraceID != "7f3c2a9e-0d4b-4e61-8a2f-5b9c1d0e3f47" {
+		t.Errorf("Wanted: 7f3c2a9e-0d4b-4e61-8a2f-5b9c1d0e3f47 Got: %s", resource.TraceID)
+	}
+
+	var result messaging.CrawlResultMsg
+	msg, err = resultSub.NextMsg(time.Second)
+	if err != nil || natsutil.ReadJSON(msg, &result) != nil {
+		t.Fatal("crawl result should have been published")
+	}
+	if result.TraceID != "7f3c2a9e-0d4b-4e61-8a2f-5b9c1d0e3f47" {
+		t.Errorf("Wanted: 7f3c2a9e-0d4b-4e61-8a2f-5b9c1d0e3f47 Got: %s", result.TraceID)
+	}
+}
+
+func TestIsTLSError(t *testing.T) {
+	if isTLSError(nil) {
+		t.Error("nil error is not a TLS error")
+	}
+	if isTLSError(errors.New("connection refused")) {
+		t.Error("network error is not a TLS error")
+	}
+	if !isTLSError(fmt.Errorf("Get: %w", tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"})) {
+		t.Error("wrapped record header error is a TLS error")
+	}
+	if !isTLSError(errors.New("remote error: tls: handshake failure")) {
+		t.Error("TLS alert is a TLS error")
+	}
+}
+
+func TestCrawURLMaxBodySize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/large.html":
+			_, _ = w.Write([]byte(strings.Repeat("a", 1024*1024)))
+		case "/exact.html":
+			_, _ = w.Write([]byte(strings.Repeat("a", 1024)))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path        string
+		maxBodySize int64
+		size        int
+		truncated   bool
+	}{
+		{"/large.html", 1024, 1024, true},
+		{"/exact.html", 1024, 1024, false},
+		{"/large.html", 0, 1024 * 1024, false},
+	}
+
+	for _, test := range tests {
+		page, err := crawURL(context.Background(), srv.Client(), srv.URL+test.path, defaultUserAgent, defaultContentTypes, test.maxBodySize)
+		if err != nil {
+			t.Errorf("%s: %s", test.path, err)
+			continue
+		}
+		if len(page.body) != test.size || page.truncated != test.truncated {
+			t.Errorf("%s (max %d): Wanted: %d bytes (truncated: %v) Got: %d bytes (truncated: %v)", test.path,
+				test.maxBodySize, test.size, test.truncated, len(page.body), page.truncated)
+		}
+	}
+}
+
+func TestHandleMessageTruncated(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><title>Large</title>" + strings.Repeat("a", 10*1024*1024)))
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if err := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, 4096, nil, nil, nil, nil)(context.Background(), nc, todoMsg(t, srv.URL, 0)); err != nil {
+		t.FailNow()
+	}
+
+	msg, err := resourceSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("truncated resource should have been published")
+	}
+
+	var resMsg messaging.NewResourceMsg
+	if err := natsutil.ReadJSON(msg, &resMsg); err != nil {
+		t.FailNow()
+	}
+	if !resMsg.Truncated || len(resMsg.Body) != 4096 || resMsg.Title != "Large" {
+		t.Errorf("invalid resource: truncated: %v, body: %d bytes, title: %s", resMsg.Truncated, len(resMsg.Body),
+			resMsg.Title)
+	}
+}
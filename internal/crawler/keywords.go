@@ -0,0 +1,23 @@
+package crawler
+
+import (
+	"github.com/creekorful/trandoshan/internal/util/tfidf"
+)
+
+// keywordExtractor extract the keywords of the crawled pages, weighted against the pages crawled before
+type keywordExtractor struct {
+	corpus *tfidf.Corpus
+	// count is the number of keywords extracted per page
+	count int
+	// minLen is the minimum number of characters of a keyword
+	minLen int
+}
+
+func newKeywordExtractor(count, minLen int) *keywordExtractor {
+	return &keywordExtractor{corpus: tfidf.NewCorpus(tfidf.DefaultMaxTerms), count: count, minLen: minLen}
+}
+
+// extract returns the keywords of given plain text, best first
+func (ke *keywordExtractor) extract(text string) []string {
+	return ke.corpus.Keywords(text, ke.count, ke.minLen)
+}
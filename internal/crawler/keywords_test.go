@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleMessageKeywords(t *testing.T) {
+	pages := map[string]string{
+		"/market": `<html><head><title>Market</title><style>.market { color: red; }</style></head>
+<body><h1>Hidden market</h1><p>Books and music shipped worldwide. Every market order is encrypted.</p>
+<p>Browse the books: 2021 catalog.</p></body></html>`,
+		"/forum": `<html><head><title>Forum</title></head><body><h1>Privacy forum</h1>
+<p>Discuss privacy tools with the community. The forum rules: be nice, stay on topic, protect your privacy.</p>
+<script>var privacy = "tracking tracking tracking tracking";</script></body></html>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(pages[r.URL.Path]))
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize,
+		nil, nil, newKeywordExtractor(3, 4), nil)
+
+	// The markup, scripts & styles should not be taken into account
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/market", []string{"market", "books", "browse"}},
+		{"/forum", []string{"forum", "privacy", "community"}},
+	}
+	for _, test := range tests {
+		if err := handler(context.Background(), nc, todoMsg(t, srv.URL+test.path, 0)); err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := resourceSub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatal("resource should have been published")
+		}
+		var resMsg messaging.NewResourceMsg
+		if err := natsutil.ReadJSON(msg, &resMsg); err != nil {
+			t.FailNow()
+		}
+		if fmt.Sprint(resMsg.Keywords) != fmt.Sprint(test.want) {
+			t.Errorf("%s: Wanted: %v Got: %v", test.path, test.want, resMsg.Keywords)
+		}
+	}
+
+	// Disabled
+	handler = handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize,
+		nil, nil, nil, nil)
+	if err := handler(context.Background(), nc, todoMsg(t, srv.URL+"/market", 0)); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := resourceSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("resource should have been published")
+	}
+	var resMsg messaging.NewResourceMsg
+	if err := natsutil.ReadJSON(msg, &resMsg); err != nil {
+		t.FailNow()
+	}
+	if len(resMsg.Keywords) != 0 {
+		t.Errorf("Wanted: no keywords Got: %v", resMsg.Keywords)
+	}
+}
@@ -0,0 +1,27 @@
+package crawler
+
+import (
+	"github.com/abadojack/whatlanggo"
+	"unicode/utf8"
+)
+
+// minLanguageTextLength is the minimum number of characters needed to detect the language of a text
+const minLanguageTextLength = 20
+
+// detectLanguage returns the BCP-47 code of the language of given plain text (ISO 639-1 code, or ISO 639-3
+// code for the languages having none), empty if it cannot be reliably detected
+func detectLanguage(text string) string {
+	if utf8.RuneCountInString(text) < minLanguageTextLength {
+		return ""
+	}
+
+	info := whatlanggo.Detect(text)
+	if !info.IsReliable() {
+		return ""
+	}
+
+	if code := info.Lang.Iso6391(); code != "" {
+		return code
+	}
+	return info.Lang.Iso6393()
+}
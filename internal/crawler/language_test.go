@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"english", "Welcome to our hidden service. This website provides an anonymous and secure way to " +
+			"share documents with journalists without revealing your identity.", "en"},
+		{"russian", "Добро пожаловать на наш скрытый сервис. Этот сайт позволяет анонимно и безопасно " +
+			"передавать документы журналистам, не раскрывая своей личности.", "ru"},
+		{"chinese", "欢迎来到我们的隐藏服务。本网站提供一种匿名且安全的方式，让您在不暴露身份的情况下与记者分享文件。", "zh"},
+		{"too short", "Hello world", ""},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		if got := detectLanguage(test.text); got != test.want {
+			t.Errorf("%s: Wanted: %q Got: %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestHandleMessageLanguage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		// The markup & scripts should not be taken into account
+		_, _ = w.Write([]byte(`<html><head><title>Сервис</title><script>var message = "this is an english sentence";</script></head>
+<body><p>Добро пожаловать на наш скрытый сервис. Этот сайт позволяет анонимно и безопасно передавать документы журналистам, не раскрывая своей личности.</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, nil, nil, nil)
+	if err := handler(context.Background(), nc, todoMsg(t, srv.URL, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := resourceSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("resource should have been published")
+	}
+	var resMsg messaging.NewResourceMsg
+	if err := natsutil.ReadJSON(msg, &resMsg); err != nil {
+		t.FailNow()
+	}
+	if resMsg.Language != "ru" {
+		t.Errorf("Wanted: ru Got: %q", resMsg.Language)
+	}
+}
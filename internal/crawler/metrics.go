@@ -0,0 +1,11 @@
+package crawler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var crawlerTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "crawler_timeouts_total",
+	Help: "The total number of crawls aborted because the connection or the request timed out",
+})
@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"golang.org/x/net/proxy"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// newHTTPClient returns the client crawling the URLs through given SOCKS5 proxy (e.g: socks5://127.0.0.1:9050).
+// proxyTimeout is the default timeout of the connection established through the proxy (overridden by
+// withConnectTimeout), timeout the one of the whole request
+func newHTTPClient(proxyURL string, proxyTimeout, timeout time.Duration) (*http.Client, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, fmt.Errorf("unsupported proxy scheme %s (should be socks5)", u.Scheme)
+	}
+
+	dialer, err := proxy.FromURL(u, &net.Dialer{})
+	if err != nil {
+		return nil, err
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("proxy %s does not support dial cancellation", proxyURL)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			// The hostnames are resolved by the proxy, which is required to reach the hidden services
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				ctx, cancel := context.WithTimeout(ctx, connectTimeout(ctx, proxyTimeout))
+				defer cancel()
+
+				return contextDialer.DialContext(ctx, network, addr)
+			},
+			// Disable SSL verification since we do not really care about this
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		Timeout: timeout,
+	}, nil
+}
@@ -0,0 +1,186 @@
+package crawler
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// socks5Server is a minimal SOCKS5 proxy (no authentication, CONNECT only) connecting
+// every request to target and recording the requested addresses
+type socks5Server struct {
+	listener net.Listener
+	target   string
+	// delay is applied before answering the handshake
+	delay time.Duration
+
+	requested []string
+	mutex     sync.Mutex
+}
+
+func newSOCKS5Server(t *testing.T, target string) *socks5Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &socks5Server{listener: listener, target: target}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *socks5Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	// Greeting: version, methods count, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return
+	}
+
+	time.Sleep(s.delay)
+
+	if _, err := conn.Write([]byte{5, 0}); err != nil {
+		return
+	}
+
+	// Request: version, command, reserved, address type
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+
+	var host string
+	switch request[3] {
+	case 1: // IPv4
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3: // Domain name
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return
+		}
+		host = string(domain)
+	default:
+		return
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	s.requested = append(s.requested, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	s.mutex.Unlock()
+
+	target, err := net.Dial("tcp", s.target)
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+
+	go func() {
+		_, _ = io.Copy(target, conn)
+	}()
+	_, _ = io.Copy(conn, target)
+}
+
+func (s *socks5Server) requestedAddresses() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string{}, s.requested...)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<title>Hidden service</title>" + r.Host))
+	}))
+	defer srv.Close()
+
+	proxy := newSOCKS5Server(t, srv.Listener.Addr().String())
+	defer proxy.listener.Close()
+
+	httpClient, err := newHTTPClient("socks5://"+proxy.listener.Addr().String(), time.Second, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := crawURL(context.Background(), httpClient, "http://example.onion/index.html", defaultUserAgent,
+		[]string{"text/html"}, defaultMaxBodySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.body != "<title>Hidden service</title>example.onion" {
+		t.Errorf("unexpected body: %s", page.body)
+	}
+
+	// The hostname should be resolved by the proxy
+	requested := proxy.requestedAddresses()
+	if len(requested) != 1 || requested[0] != "example.onion:80" {
+		t.Errorf("Wanted: [example.onion:80] Got: %v", requested)
+	}
+}
+
+func TestNewHTTPClientProxyTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	proxy := newSOCKS5Server(t, srv.Listener.Addr().String())
+	proxy.delay = time.Second
+	defer proxy.listener.Close()
+
+	httpClient, err := newHTTPClient("socks5://"+proxy.listener.Addr().String(), 100*time.Millisecond, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := httpClient.Get("http://example.onion"); err == nil {
+		t.Error("proxy timeout should have been returned")
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("request should have timed out after the proxy timeout, took %s", elapsed)
+	}
+}
+
+func TestNewHTTPClientInvalidProxy(t *testing.T) {
+	for _, proxyURL := range []string{"http://127.0.0.1:8080", "127.0.0.1:9050", "socks5://%zz"} {
+		if _, err := newHTTPClient(proxyURL, time.Second, time.Second); err == nil {
+			t.Errorf("%s: error should have been returned", proxyURL)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/temoto/robotstxt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// robotsCache check the URLs against the robots.txt of their host, fetched once per ttl
+type robotsCache struct {
+	httpClient *http.Client
+	userAgent  string
+	ttl        time.Duration
+
+	// scheme://host -> rules
+	entries map[string]robotsEntry
+	mutex   sync.Mutex
+
+	now func() time.Time
+}
+
+type robotsEntry struct {
+	// nil means everything is allowed
+	group  *robotstxt.Group
+	expiry time.Time
+}
+
+func newRobotsCache(httpClient *http.Client, userAgent string, ttl time.Duration) *robotsCache {
+	return &robotsCache{
+		httpClient: httpClient,
+		userAgent:  userAgent,
+		ttl:        ttl,
+		entries:    map[string]robotsEntry{},
+		now:        time.Now,
+	}
+}
+
+// allowed returns true if the robots.txt of given URL host allows it to be crawled
+func (rc *robotsCache) allowed(u *url.URL) bool {
+	host := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+
+	rc.mutex.Lock()
+	entry, exists := rc.entries[host]
+	rc.mutex.Unlock()
+
+	if !exists || !rc.now().Before(entry.expiry) {
+		// Fetched without holding the lock since it may take a while through TOR
+		entry = robotsEntry{group: rc.fetch(host), expiry: rc.now().Add(rc.ttl)}
+
+		rc.mutex.Lock()
+		rc.entries[host] = entry
+		rc.mutex.Unlock()
+	}
+
+	return entry.group == nil || entry.group.Test(u.RequestURI())
+}
+
+// fetch returns the rules of the robots.txt of given host matching the user agent,
+// nil if the robots.txt cannot be read
+func (rc *robotsCache) fetch(host string) *robotstxt.Group {
+	req, err := http.NewRequest(http.MethodGet, host+"/robots.txt", nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", rc.userAgent)
+
+	resp, err := rc.httpClient.Do(req)
+	if err != nil {
+		log.Debug().Str("host", host).Str("err", err.Error()).Msg("Unable to fetch robots.txt")
+		return nil
+	}
+	defer resp.Body.Close()
+
+	// Unlike the library (which disallow everything), consider server errors as unreachable robots.txt
+	if resp.StatusCode >= http.StatusInternalServerError {
+		log.Debug().Str("host", host).Int("code", resp.StatusCode).Msg("Unable to fetch robots.txt")
+		return nil
+	}
+
+	data, err := robotstxt.FromResponse(resp)
+	if err != nil {
+		log.Debug().Str("host", host).Str("err", err.Error()).Msg("Unable to parse robots.txt")
+		return nil
+	}
+
+	return data.FindGroup(rc.userAgent)
+}
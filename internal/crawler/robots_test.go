@@ -0,0 +1,169 @@
+package crawler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const robotsTxt = `User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+
+User-agent: trandoshan
+Disallow: /
+`
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.FailNow()
+	}
+	return u
+}
+
+func TestRobotsCacheAllowed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte(robotsTxt))
+		}
+	}))
+	defer srv.Close()
+
+	rc := newRobotsCache(srv.Client(), defaultUserAgent, time.Hour)
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{"/", true},
+		{"/index.html?page=2", true},
+		{"/private/", false},
+		{"/private/secret.html", false},
+		{"/private/public.html", true},
+	}
+
+	for _, test := range tests {
+		if got := rc.allowed(mustParse(t, srv.URL+test.path)); got != test.allowed {
+			t.Errorf("%s: Wanted: %t Got: %t", test.path, test.allowed, got)
+		}
+	}
+
+	// Rules are matched against the user agent
+	rc = newRobotsCache(srv.Client(), "trandoshan/1.0", time.Hour)
+	if rc.allowed(mustParse(t, srv.URL+"/")) {
+		t.Error("trandoshan user agent should not be allowed")
+	}
+}
+
+func TestRobotsCacheUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	rc := newRobotsCache(srv.Client(), defaultUserAgent, time.Hour)
+
+	for _, rawURL := range []string{
+		srv.URL + "/private/",         // server error
+		notFound.URL + "/private/",    // missing robots.txt
+		"http://127.0.0.1:0/private/", // connection error
+	} {
+		if !rc.allowed(mustParse(t, rawURL)) {
+			t.Errorf("%s: unreachable robots.txt should allow everything", rawURL)
+		}
+	}
+}
+
+func TestRobotsCacheExpiry(t *testing.T) {
+	var fetched int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		_, _ = w.Write([]byte(robotsTxt))
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	rc := newRobotsCache(srv.Client(), defaultUserAgent, time.Minute)
+	rc.now = func() time.Time { return now }
+
+	rc.allowed(mustParse(t, srv.URL+"/a"))
+	rc.allowed(mustParse(t, srv.URL+"/b"))
+	if n := atomic.LoadInt32(&fetched); n != 1 {
+		t.Errorf("robots.txt should be cached (fetched %d times)", n)
+	}
+
+	now = now.Add(time.Minute)
+	rc.allowed(mustParse(t, srv.URL+"/c"))
+	if n := atomic.LoadInt32(&fetched); n != 2 {
+		t.Errorf("robots.txt should be fetched again once expired (fetched %d times)", n)
+	}
+}
+
+func TestHandleMessageRobotsTxt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte(robotsTxt))
+		case "/private/secret.html":
+			t.Error("disallowed URL should not be crawled")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>hello</html>"))
+		}
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	skippedSub, err := nc.SubscribeSync(messaging.URLSkippedSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	robots := newRobotsCache(srv.Client(), defaultUserAgent, time.Hour)
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, robots, nil, nil, nil)
+
+	if err := handler(context.Background(), nc, todoMsg(t, srv.URL+"/private/secret.html", 0)); err != nil {
+		t.FailNow()
+	}
+	msg, err := skippedSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("disallowed URL should have been skipped")
+	}
+	var skippedMsg messaging.URLSkippedMsg
+	if err := natsutil.ReadJSON(msg, &skippedMsg); err != nil || skippedMsg.Reason != messaging.SkipReasonRobotsTxt {
+		t.Errorf("invalid skipped URL %+v", skippedMsg)
+	}
+
+	if err := handler(context.Background(), nc, todoMsg(t, srv.URL+"/index.html", 0)); err != nil {
+		t.FailNow()
+	}
+	if _, err := resourceSub.NextMsg(time.Second); err != nil {
+		t.Error("allowed URL should have been crawled")
+	}
+}
@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/util/duration"
+	"github.com/creekorful/trandoshan/internal/util/rules"
+	"gopkg.in/yaml.v2"
+	"net"
+	"regexp"
+	"time"
+)
+
+// timeouts are the delays after which the crawling of an URL is aborted
+type timeouts struct {
+	// connect is the maximum time to establish the connection through the proxy
+	connect time.Duration
+	// request is the maximum time to crawl the URL, redirects and body included
+	request time.Duration
+}
+
+// timeoutRule associate timeouts to the hostnames matching a pattern
+type timeoutRule struct {
+	pattern  *regexp.Regexp
+	timeouts timeouts
+}
+
+// timeoutRules is an ordered list of timeout rules, the first matching rule wins
+type timeoutRules struct {
+	defaults timeouts
+	rules    []timeoutRule
+}
+
+// get returns the timeouts to apply to given hostname, the default ones if no rule matches
+func (tr *timeoutRules) get(hostname string) timeouts {
+	for _, rule := range tr.rules {
+		if rule.pattern.MatchString(hostname) {
+			return rule.timeouts
+		}
+	}
+
+	return tr.defaults
+}
+
+// maxRequest returns the longest request timeout of the rules
+func (tr *timeoutRules) maxRequest() time.Duration {
+	max := tr.defaults.request
+	for _, rule := range tr.rules {
+		if rule.timeouts.request > max {
+			max = rule.timeouts.request
+		}
+	}
+
+	return max
+}
+
+// loadTimeoutRules read & parse the timeout rules file located at given path, if any
+func loadTimeoutRules(path string, defaults timeouts) (*timeoutRules, error) {
+	tr := &timeoutRules{defaults: defaults}
+	if err := rules.Load(path, "timeout", tr.add); err != nil {
+		return nil, err
+	}
+
+	return tr, nil
+}
+
+// parseTimeoutRules parse given YAML (or JSON) content mapping hostname patterns to the connect and/or request
+// timeouts, e.g: '\.onion$': {connect: 30s, request: 2m}. The timeouts missing from a rule are the default ones.
+// order of the rules is preserved
+func parseTimeoutRules(content []byte, defaults timeouts) (*timeoutRules, error) {
+	tr := &timeoutRules{defaults: defaults}
+	if err := rules.Parse(content, "timeout", tr.add); err != nil {
+		return nil, err
+	}
+
+	return tr, nil
+}
+
+// add append the rule applying given timeouts to the hostnames matching given pattern
+func (tr *timeoutRules) add(pattern *regexp.Regexp, value interface{}) error {
+	values, ok := value.(yaml.MapSlice)
+	if !ok {
+		return errors.New("should map connect and/or request to a duration")
+	}
+
+	rule := timeoutRule{pattern: pattern, timeouts: tr.defaults}
+	for _, value := range values {
+		timeout, err := duration.ParseStrict(fmt.Sprintf("%v", value.Value))
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid %v timeout %v", value.Key, value.Value)
+		}
+
+		switch value.Key {
+		case "connect":
+			rule.timeouts.connect = timeout
+		case "request":
+			rule.timeouts.request = timeout
+		default:
+			return fmt.Errorf("unknown timeout %v", value.Key)
+		}
+	}
+
+	tr.rules = append(tr.rules, rule)
+	return nil
+}
+
+type connectTimeoutKey struct{}
+
+// withConnectTimeout returns a context making the HTTP client use given connect timeout
+func withConnectTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, connectTimeoutKey{}, timeout)
+}
+
+// connectTimeout returns the connect timeout set using withConnectTimeout, defaultTimeout if none
+func connectTimeout(ctx context.Context, defaultTimeout time.Duration) time.Duration {
+	if timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+
+	return defaultTimeout
+}
+
+// isTimeoutError returns true if given error has been caused by a connect or request timeout
+func isTimeoutError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
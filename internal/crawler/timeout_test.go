@@ -0,0 +1,218 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeoutRules(t *testing.T) {
+	defaults := timeouts{connect: 5 * time.Second, request: 10 * time.Second}
+
+	rules, err := parseTimeoutRules([]byte(`
+'^slow\.onion$': {connect: 30s, request: 2m}
+'^fast\.onion$': {request: 2s}
+'\.onion$': {connect: 1m}
+`), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hostname string
+		timeouts timeouts
+	}{
+		{"slow.onion", timeouts{connect: 30 * time.Second, request: 2 * time.Minute}},
+		{"fast.onion", timeouts{connect: 5 * time.Second, request: 2 * time.Second}},
+		{"other.onion", timeouts{connect: time.Minute, request: 10 * time.Second}},
+		{"example.org", defaults},
+	}
+	for _, test := range tests {
+		if got := rules.get(test.hostname); got != test.timeouts {
+			t.Errorf("%s: Wanted: %+v Got: %+v", test.hostname, test.timeouts, got)
+		}
+	}
+
+	if rules.maxRequest() != 2*time.Minute {
+		t.Errorf("Wanted: 2m Got: %s", rules.maxRequest())
+	}
+}
+
+func TestParseTimeoutRulesInvalid(t *testing.T) {
+	defaults := timeouts{connect: 5 * time.Second, request: 10 * time.Second}
+
+	for _, content := range []string{
+		`'[a-': {request: 1m}`,
+		`'\.onion$': 1m`,
+		`'\.onion$': {request: forever}`,
+		`'\.onion$': {request: 0s}`,
+		`'\.onion$': {read: 1m}`,
+	} {
+		if _, err := parseTimeoutRules([]byte(content), defaults); err == nil {
+			t.Errorf("%s: error should have been returned", content)
+		}
+	}
+}
+
+func TestLoadTimeoutRulesNoFile(t *testing.T) {
+	defaults := timeouts{connect: 5 * time.Second, request: 10 * time.Second}
+
+	rules, err := loadTimeoutRules("", defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.get("example.onion") != defaults {
+		t.Errorf("Wanted: %+v Got: %+v", defaults, rules.get("example.onion"))
+	}
+}
+
+func TestIsTimeoutError(t *testing.T) {
+	if isTimeoutError(nil) {
+		t.Error("nil is not a timeout error")
+	}
+	if isTimeoutError(errors.New("connection refused")) {
+		t.Error("connection refused is not a timeout error")
+	}
+	if !isTimeoutError(fmt.Errorf("Get: %w", context.DeadlineExceeded)) {
+		t.Error("deadline exceeded should be a timeout error")
+	}
+	if !isTimeoutError(&net.OpError{Op: "dial", Err: timeoutErr{}}) {
+		t.Error("net timeout should be a timeout error")
+	}
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestHandleMessageTimeout(t *testing.T) {
+	// The slow server answers after 300ms
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html>slow</html>"))
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resultSub, err := nc.SubscribeSync(messaging.CrawlResultSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// localhost is allowed to be slow, 127.0.0.1 is not
+	rules, err := parseTimeoutRules([]byte(`'^localhost$': {request: 5s}`),
+		timeouts{connect: time.Second, request: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize,
+		nil, nil, nil, rules)
+
+	timedOut := testutil.ToFloat64(crawlerTimeouts)
+
+	start := time.Now()
+	if err := handler(context.Background(), nc, todoMsg(t, srv.URL, 0)); err == nil {
+		t.Error("timeout error should have been returned")
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("request should have timed out after the request timeout, took %s", elapsed)
+	}
+
+	msg, err := resultSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("crawl result should have been published")
+	}
+	var result messaging.CrawlResultMsg
+	if err := natsutil.ReadJSON(msg, &result); err != nil {
+		t.FailNow()
+	}
+	if !result.TimedOut || result.StatusCode != 0 {
+		t.Errorf("invalid crawl result %+v", result)
+	}
+	if testutil.ToFloat64(crawlerTimeouts) != timedOut+1 {
+		t.Errorf("Wanted: %f Got: %f", timedOut+1, testutil.ToFloat64(crawlerTimeouts))
+	}
+
+	// The rule of localhost overrides the default request timeout
+	localURL := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	if err := handler(context.Background(), nc, todoMsg(t, localURL, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = resultSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("crawl result should have been published")
+	}
+	result = messaging.CrawlResultMsg{}
+	if err := natsutil.ReadJSON(msg, &result); err != nil {
+		t.FailNow()
+	}
+	if result.TimedOut || result.StatusCode != http.StatusOK {
+		t.Errorf("invalid crawl result %+v", result)
+	}
+	if _, err := resourceSub.NextMsg(time.Second); err != nil {
+		t.Error("resource should have been published")
+	}
+	if testutil.ToFloat64(crawlerTimeouts) != timedOut+1 {
+		t.Errorf("Wanted: %f Got: %f", timedOut+1, testutil.ToFloat64(crawlerTimeouts))
+	}
+}
+
+func TestNewHTTPClientConnectTimeoutOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+	}))
+	defer srv.Close()
+
+	proxy := newSOCKS5Server(t, srv.Listener.Addr().String())
+	proxy.delay = 300 * time.Millisecond
+	defer proxy.listener.Close()
+
+	httpClient, err := newHTTPClient("socks5://"+proxy.listener.Addr().String(), 100*time.Millisecond, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default connect timeout is too short for the proxy
+	ctx := context.Background()
+	if _, err := crawURL(ctx, httpClient, "http://example.onion", defaultUserAgent, defaultContentTypes,
+		defaultMaxBodySize); !isTimeoutError(err) {
+		t.Errorf("timeout error should have been returned, got %v", err)
+	}
+
+	// While the one set on the context is long enough
+	ctx = withConnectTimeout(ctx, 2*time.Second)
+	if _, err := crawURL(ctx, httpClient, "http://example.onion", defaultUserAgent, defaultContentTypes,
+		defaultMaxBodySize); err != nil {
+		t.Errorf("connection should not have timed out: %s", err)
+	}
+}
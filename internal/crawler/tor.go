@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// torControlTimeout is the maximum time to wait for the Tor control port to build new circuits
+const torControlTimeout = 10 * time.Second
+
+// circuitRetry retry the URLs failing because of a temporary Tor circuit failure, using fresh circuits
+type circuitRetry struct {
+	// count is the number of retries after the first attempt
+	count int
+	// renew ask Tor to build new circuits
+	renew func(ctx context.Context) error
+}
+
+// isCircuitError returns true if the crawling failure may be caused by the Tor circuit: the SOCKS5 connection
+// to the hidden service has failed, or the hidden service is temporarily unavailable (503)
+func isCircuitError(statusCode int, err error) bool {
+	if err == nil {
+		return false
+	}
+	if statusCode == http.StatusServiceUnavailable {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && strings.HasPrefix(opErr.Op, "socks")
+}
+
+// newControlPortRenewer returns the function sending the NEWNYM signal to the Tor control port located at given
+// address (e.g: 127.0.0.1:9051), authenticating using given password (empty if not required)
+func newControlPortRenewer(addr, password string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, torControlTimeout)
+		defer cancel()
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Errorf("error while connecting to Tor control port: %s", err)
+		}
+		defer conn.Close()
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+
+		reader := bufio.NewReader(conn)
+		commands := []string{
+			fmt.Sprintf("AUTHENTICATE \"%s\"", strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(password)),
+			"SIGNAL NEWNYM",
+		}
+		for _, command := range commands {
+			if _, err := fmt.Fprintf(conn, "%s\r\n", command); err != nil {
+				return fmt.Errorf("error while writing to Tor control port: %s", err)
+			}
+
+			reply, err := reader.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("error while reading from Tor control port: %s", err)
+			}
+			if reply = strings.TrimRight(reply, "\r\n"); !strings.HasPrefix(reply, "250") {
+				return fmt.Errorf("tor control port rejected %s: %s", strings.Fields(command)[0], reply)
+			}
+		}
+
+		_, _ = fmt.Fprint(conn, "QUIT\r\n")
+		return nil
+	}
+}
+
+// newCommandRenewer returns the function running given shell command to build new circuits
+func newCommandRenewer(command string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, torControlTimeout)
+		defer cancel()
+
+		if out, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput(); err != nil {
+			return fmt.Errorf("error while running new circuit command: %s (%s)", err, strings.TrimSpace(string(out)))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,284 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// torControlMock is a fake Tor control port recording the received commands
+type torControlMock struct {
+	listener net.Listener
+	password string
+
+	commands []string
+	mutex    sync.Mutex
+}
+
+func newTorControlMock(t *testing.T, password string) *torControlMock {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	m := &torControlMock{listener: l, password: password}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+
+	return m
+}
+
+func (m *torControlMock) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+
+		m.mutex.Lock()
+		m.commands = append(m.commands, command)
+		m.mutex.Unlock()
+
+		switch {
+		case strings.HasPrefix(command, "AUTHENTICATE"):
+			if command != fmt.Sprintf("AUTHENTICATE \"%s\"", m.password) {
+				_, _ = fmt.Fprint(conn, "515 Authentication failed: Password did not match HashedControlPassword value\r\n")
+				return
+			}
+			_, _ = fmt.Fprint(conn, "250 OK\r\n")
+		case command == "SIGNAL NEWNYM":
+			_, _ = fmt.Fprint(conn, "250 OK\r\n")
+		case command == "QUIT":
+			_, _ = fmt.Fprint(conn, "250 closing connection\r\n")
+			return
+		default:
+			_, _ = fmt.Fprintf(conn, "510 Unrecognized command \"%s\"\r\n", command)
+		}
+	}
+}
+
+func (m *torControlMock) newnymCount() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	count := 0
+	for _, command := range m.commands {
+		if command == "SIGNAL NEWNYM" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestControlPortRenewer(t *testing.T) {
+	m := newTorControlMock(t, "secret")
+
+	if err := newControlPortRenewer(m.listener.Addr().String(), "secret")(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count := m.newnymCount(); count != 1 {
+		t.Errorf("Wanted: 1 NEWNYM Got: %d", count)
+	}
+
+	if err := newControlPortRenewer(m.listener.Addr().String(), "wrong")(context.Background()); err == nil {
+		t.Error("authentication failure should be returned")
+	}
+	if count := m.newnymCount(); count != 1 {
+		t.Errorf("Wanted: 1 NEWNYM Got: %d", count)
+	}
+}
+
+func TestControlPortRenewerUnavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	if err := newControlPortRenewer(addr, "")(context.Background()); err == nil {
+		t.Error("unavailable control port should be returned as error")
+	}
+}
+
+func TestCommandRenewer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "renewed")
+
+	if err := newCommandRenewer("touch " + path)(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := newCommandRenewer("ls " + path)(context.Background()); err != nil {
+		t.Error("command should have been run")
+	}
+
+	if err := newCommandRenewer("exit 1")(context.Background()); err == nil {
+		t.Error("command failure should be returned")
+	}
+}
+
+func TestIsCircuitError(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		err        error
+		want       bool
+	}{
+		{http.StatusOK, nil, false},
+		{http.StatusServiceUnavailable, errors.New("non-managed error code 503"), true},
+		{http.StatusNotFound, errors.New("non-managed error code 404"), false},
+		{0, &net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("host unreachable")}, true},
+		{0, fmt.Errorf("wrapped: %w", &net.OpError{Op: "socks connect", Err: errors.New("connection refused")}), true},
+		{0, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, false},
+		{0, errors.New("tls: handshake failure"), false},
+	}
+	for _, test := range tests {
+		if got := isCircuitError(test.statusCode, test.err); got != test.want {
+			t.Errorf("%d %v: Wanted: %t Got: %t", test.statusCode, test.err, test.want, got)
+		}
+	}
+}
+
+func TestHandleMessageCircuitRetry(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><head><title>Hello</title></head>hello</html>"))
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	m := newTorControlMock(t, "")
+	retry := &circuitRetry{count: 2, renew: newControlPortRenewer(m.listener.Addr().String(), "")}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, retry, nil, nil)
+	if err := handler(context.Background(), nc, todoMsg(t, srv.URL, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 3 {
+		t.Errorf("Wanted: 3 requests Got: %d", requests)
+	}
+	if count := m.newnymCount(); count != 2 {
+		t.Errorf("Wanted: 2 NEWNYM Got: %d", count)
+	}
+
+	msg, err := resSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("resource should have been published")
+	}
+	var res messaging.NewResourceMsg
+	if err := natsutil.ReadMsg(msg, &res); err != nil {
+		t.FailNow()
+	}
+	if res.Title != "Hello" {
+		t.Errorf("Wanted: Hello Got: %s", res.Title)
+	}
+}
+
+func TestHandleMessageCircuitRetryExhausted(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	failedSub, err := nc.SubscribeSync(messaging.URLFailedSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	m := newTorControlMock(t, "")
+	retry := &circuitRetry{count: 2, renew: newControlPortRenewer(m.listener.Addr().String(), "")}
+
+	handler := handleMessage(srv.Client(), userAgents{defaultUserAgent}, defaultContentTypes, defaultMaxBodySize, nil, retry, nil, nil)
+	if err := handler(context.Background(), nc, todoMsg(t, srv.URL, 0)); err == nil {
+		t.Error("error code should be returned as error")
+	}
+
+	if requests != 3 {
+		t.Errorf("Wanted: 3 requests Got: %d", requests)
+	}
+
+	msg, err := failedSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("failed URL should have been published")
+	}
+	var failed messaging.URLFailedMsg
+	if err := natsutil.ReadMsg(msg, &failed); err != nil {
+		t.FailNow()
+	}
+	if failed.URL != srv.URL {
+		t.Errorf("Wanted: %s Got: %s", srv.URL, failed.URL)
+	}
+
+	// Other errors are not retried
+	requests = 0
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer notFound.Close()
+
+	if err := handler(context.Background(), nc, todoMsg(t, notFound.URL, 0)); err == nil {
+		t.Error("error code should be returned as error")
+	}
+	if requests != 1 {
+		t.Errorf("Wanted: 1 request Got: %d", requests)
+	}
+}
@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// randomIndex is replaced in tests
+var randomIndex = rand.Intn
+
+// userAgents is the list of user agents from which one is picked at random for each request
+type userAgents []string
+
+// pick returns a random user agent
+func (ua userAgents) pick() string {
+	if len(ua) == 1 {
+		return ua[0]
+	}
+	return ua[randomIndex(len(ua))]
+}
+
+// readUserAgents read the user agents from given newline-delimited file
+func readUserAgents(path string) (userAgents, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening %s: %s", path, err)
+	}
+	defer f.Close()
+
+	var agents userAgents
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines & comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		agents = append(agents, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading %s: %s", path, err)
+	}
+
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("no user agent found in %s", path)
+	}
+
+	return agents, nil
+}
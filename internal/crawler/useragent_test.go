@@ -0,0 +1,157 @@
+package crawler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUserAgentsPickUniform(t *testing.T) {
+	agents := userAgents{"agent-1", "agent-2", "agent-3", "agent-4"}
+
+	const picks = 40000
+	counts := map[string]int{}
+	for i := 0; i < picks; i++ {
+		counts[agents.pick()]++
+	}
+
+	if len(counts) != len(agents) {
+		t.Fatalf("every user agent should have been picked: %v", counts)
+	}
+
+	// Each user agent should be picked about picks/len(agents) times: allow a 5% deviation
+	expected := float64(picks) / float64(len(agents))
+	for agent, count := range counts {
+		if math.Abs(float64(count)-expected) > expected*0.05 {
+			t.Errorf("%s: picked %d times, expected about %.0f", agent, count, expected)
+		}
+	}
+}
+
+func TestUserAgentsPickSingle(t *testing.T) {
+	agents := userAgents{"agent"}
+	for i := 0; i < 10; i++ {
+		if agent := agents.pick(); agent != "agent" {
+			t.Errorf("Wanted: agent Got: %s", agent)
+		}
+	}
+}
+
+func TestReadUserAgents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trandoshan-useragents")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "user-agents.txt")
+	content := "# Browsers\nMozilla/5.0 (X11; Linux x86_64)\n\n  Mozilla/5.0 (Windows NT 10.0)  \nMozilla/5.0 (X11; Linux x86_64)\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.FailNow()
+	}
+
+	agents, err := readUserAgents(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Duplicates are kept to allow weighting the user agents
+	want := userAgents{"Mozilla/5.0 (X11; Linux x86_64)", "Mozilla/5.0 (Windows NT 10.0)", "Mozilla/5.0 (X11; Linux x86_64)"}
+	if len(agents) != len(want) {
+		t.Fatalf("Wanted: %v Got: %v", want, agents)
+	}
+	for i := range want {
+		if agents[i] != want[i] {
+			t.Errorf("Wanted: %s Got: %s", want[i], agents[i])
+		}
+	}
+
+	// Empty file
+	if err := ioutil.WriteFile(path, []byte("# nothing\n\n"), 0644); err != nil {
+		t.FailNow()
+	}
+	if _, err := readUserAgents(path); err == nil {
+		t.Error("empty file should be rejected")
+	}
+
+	if _, err := readUserAgents(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("missing file should be rejected")
+	}
+}
+
+func TestHandleMessageUserAgent(t *testing.T) {
+	var received []string
+	var mutex sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		received = append(received, r.UserAgent())
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<title>Hello</title>"))
+	}))
+	defer srv.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	resourceSub, err := nc.SubscribeSync(messaging.NewResourceSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// Pick the user agents in order
+	next := 0
+	randomIndex = func(n int) int {
+		next = (next + 1) % n
+		return next
+	}
+	defer func() { randomIndex = rand.Intn }()
+
+	handler := handleMessage(srv.Client(), userAgents{"agent-1", "agent-2"}, defaultContentTypes, defaultMaxBodySize, nil, nil, nil, nil)
+
+	for i, want := range []string{"agent-2", "agent-1", "agent-2"} {
+		if err := handler(context.Background(), nc, todoMsg(t, srv.URL, 0)); err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := resourceSub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatal("resource should have been published")
+		}
+		var resMsg messaging.NewResourceMsg
+		if err := natsutil.ReadJSON(msg, &resMsg); err != nil {
+			t.FailNow()
+		}
+
+		if resMsg.UserAgent != want {
+			t.Errorf("resource %d: Wanted: %s Got: %s", i, want, resMsg.UserAgent)
+		}
+
+		mutex.Lock()
+		if received[i] != want {
+			t.Errorf("request %d: Wanted: %s Got: %s", i, want, received[i])
+		}
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,143 @@
+package dashboard
+
+import (
+	"context"
+	_ "embed" // embed the dashboard page
+	"encoding/json"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"net/http"
+	"time"
+)
+
+//go:embed index.html
+var indexPage []byte
+
+// GetApp return the dashboard app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-dashboard",
+		Version: "0.5.0",
+		Usage:   "Trandoshan dashboard process",
+		Flags: []cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "nats-uri",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
+				Required: true,
+			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.StringFlag{
+				Name:  "listen-addr",
+				Usage: "Address on which to expose the dashboard",
+				Value: ":8083",
+			},
+			&cli.IntFlag{
+				Name:  "max-clients",
+				Usage: "Maximum number of browsers connected at the same time",
+				Value: 100,
+			},
+		},
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-dashboard")
+
+	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
+
+	// Create the NATS subscriber
+	sub, err := natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	defer heartbeat.Start(ctx, sub)()
+
+	h := newHub(ctx.Int("max-clients"))
+	log.Debug().Int("max-clients", h.maxClients).Msg("Accepting clients")
+
+	addr := ctx.String("listen-addr")
+	go func() {
+		if err := http.ListenAndServe(addr, handler(h)); err != nil {
+			log.Err(err).Str("addr", addr).Msg("Error while serving dashboard")
+		}
+	}()
+
+	log.Info().Str("addr", addr).Msg("Successfully initialized tdsh-dashboard. Waiting for crawl activity")
+
+	// Every dashboard should receive every event: no queue group
+	errs := make(chan error, 2)
+	go func() {
+		errs <- sub.QueueSubscribe(messaging.URLFoundSubject, "", handleMessage(h, func() natsutil.Msg {
+			return &messaging.URLFoundMsg{}
+		}))
+	}()
+	go func() {
+		errs <- sub.QueueSubscribe(messaging.CrawlResultSubject, "", handleMessage(h, func() natsutil.Msg {
+			return &messaging.CrawlResultMsg{}
+		}))
+	}()
+
+	return <-errs
+}
+
+// event is the JSON document sent to the browsers for each received message
+type event struct {
+	Subject string       `json:"subject"`
+	Time    time.Time    `json:"time"`
+	Data    natsutil.Msg `json:"data"`
+}
+
+// handleMessage returns the handler broadcasting the messages decoded using given constructor
+func handleMessage(h *hub, newMsg func() natsutil.Msg) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		m := newMsg()
+		if err := natsutil.ReadMsg(msg, m); err != nil {
+			log.Err(err).Msg("Error while reading message")
+			return err
+		}
+
+		b, err := json.Marshal(event{Subject: m.Subject(), Time: time.Now(), Data: m})
+		if err != nil {
+			return err
+		}
+
+		h.broadcast(b)
+		return nil
+	}
+}
+
+func handler(h *hub) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(indexPage)
+	})
+	mux.HandleFunc("/ws", h.serveWS)
+
+	return mux
+}
+
+var upgrader = websocket.Upgrader{}
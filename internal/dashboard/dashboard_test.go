@@ -0,0 +1,75 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleMessage(t *testing.T) {
+	h := newHub(1)
+	c, err := h.register()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := handleMessage(h, func() natsutil.Msg {
+		return &messaging.CrawlResultMsg{}
+	})
+
+	msg := &nats.Msg{Data: []byte(`{"url":"https://example.onion","status_code":200,"latency_ms":42}`)}
+	if err := handler(context.Background(), nil, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var e struct {
+		Subject string                   `json:"subject"`
+		Data    messaging.CrawlResultMsg `json:"data"`
+	}
+	if err := json.Unmarshal(<-c.send, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != messaging.CrawlResultSubject || e.Data.URL != "https://example.onion" ||
+		e.Data.StatusCode != 200 || e.Data.LatencyMs != 42 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	// Invalid messages are not broadcast
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte("{")}); err == nil {
+		t.Error("invalid message should be rejected")
+	}
+	if len(c.send) != 0 {
+		t.Error("invalid message should not be broadcast")
+	}
+}
+
+func TestIndexPage(t *testing.T) {
+	srv := httptest.NewServer(handler(newHub(1)))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("unexpected response: %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	res, err = http.Get(srv.URL + "/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Wanted: 404 Got: %d", res.StatusCode)
+	}
+}
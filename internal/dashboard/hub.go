@@ -0,0 +1,133 @@
+package dashboard
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// clientBufferSize is the number of events a client may lag behind before being dropped
+	clientBufferSize = 16
+	// writeTimeout is the maximum time to write an event to a client
+	writeTimeout = 10 * time.Second
+)
+
+// errTooManyClients is returned when registering a client while --max-clients are connected
+var errTooManyClients = errors.New("too many clients")
+
+// client is a connected browser
+type client struct {
+	send chan []byte
+}
+
+// hub broadcast the events to the connected clients. The broadcast never blocks: the clients not keeping up are
+// dropped
+type hub struct {
+	maxClients int
+	clients    map[*client]struct{}
+	mutex      sync.Mutex
+}
+
+func newHub(maxClients int) *hub {
+	return &hub{
+		maxClients: maxClients,
+		clients:    map[*client]struct{}{},
+	}
+}
+
+// register returns a new client receiving the broadcast events
+func (h *hub) register() (*client, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.clients) >= h.maxClients {
+		return nil, errTooManyClients
+	}
+
+	c := &client{send: make(chan []byte, clientBufferSize)}
+	h.clients[c] = struct{}{}
+
+	return c, nil
+}
+
+// unregister stop sending events to given client, closing its channel. no-op if already dropped
+func (h *hub) unregister(c *client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.remove(c)
+}
+
+func (h *hub) remove(c *client) {
+	if _, exists := h.clients[c]; exists {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// broadcast send given event to the connected clients, dropping the ones whose buffer is full
+func (h *hub) broadcast(event []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for c := range h.clients {
+		select {
+		case c.send <- event:
+		default:
+			log.Debug().Msg("Dropping slow client")
+			h.remove(c)
+		}
+	}
+}
+
+// count returns the number of connected clients
+func (h *hub) count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return len(h.clients)
+}
+
+// serveWS upgrade the request to a WebSocket connection and write the broadcast events to it until the client
+// disconnects or is dropped
+func (h *hub) serveWS(w http.ResponseWriter, r *http.Request) {
+	c, err := h.register()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied
+		h.unregister(c)
+		return
+	}
+	defer conn.Close()
+
+	log.Debug().Str("addr", r.RemoteAddr).Msg("Client connected")
+
+	// The client messages are discarded: read them to detect the disconnection
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				h.unregister(c)
+				return
+			}
+		}
+	}()
+
+	for event := range c.send {
+		_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := conn.WriteMessage(websocket.TextMessage, event); err != nil {
+			h.unregister(c)
+			break
+		}
+	}
+
+	log.Debug().Str("addr", r.RemoteAddr).Msg("Client disconnected")
+}
@@ -0,0 +1,141 @@
+package dashboard
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBroadcast(t *testing.T) {
+	h := newHub(10)
+
+	c1, err := h.register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := h.register()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.broadcast([]byte("event"))
+
+	for _, c := range []*client{c1, c2} {
+		if event := <-c.send; string(event) != "event" {
+			t.Errorf("Wanted: event Got: %s", event)
+		}
+	}
+}
+
+func TestBroadcastSlowClient(t *testing.T) {
+	h := newHub(10)
+
+	slow, err := h.register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := h.register()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow client never reads: the broadcast should not block once its buffer is full
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < clientBufferSize+1; i++ {
+			h.broadcast([]byte("event"))
+			<-fast.send
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast should not block")
+	}
+
+	if h.count() != 1 {
+		t.Errorf("Wanted: 1 client Got: %d", h.count())
+	}
+
+	// The buffered events are still readable, then the channel is closed
+	count := 0
+	for range slow.send {
+		count++
+	}
+	if count != clientBufferSize {
+		t.Errorf("Wanted: %d events Got: %d", clientBufferSize, count)
+	}
+
+	// Unregistering a dropped client is a no-op
+	h.unregister(slow)
+	h.unregister(fast)
+	if h.count() != 0 {
+		t.Errorf("Wanted: 0 client Got: %d", h.count())
+	}
+}
+
+func TestMaxClients(t *testing.T) {
+	h := newHub(1)
+
+	c, err := h.register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.register(); err != errTooManyClients {
+		t.Errorf("Wanted: %s Got: %v", errTooManyClients, err)
+	}
+
+	h.unregister(c)
+	if _, err := h.register(); err != nil {
+		t.Errorf("Wanted: nil Got: %s", err)
+	}
+}
+
+func TestServeWS(t *testing.T) {
+	h := newHub(1)
+
+	srv := httptest.NewServer(handler(h))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the client to be registered
+	for h.count() != 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Only one client is allowed
+	_, res, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err == nil || res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Wanted: 503 Got: %v", err)
+	}
+
+	h.broadcast([]byte(`{"subject":"url.found"}`))
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, b, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"subject":"url.found"}` {
+		t.Errorf("Wanted: {\"subject\":\"url.found\"} Got: %s", b)
+	}
+
+	// The client is unregistered once disconnected
+	_ = conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for h.count() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if h.count() != 0 {
+		t.Errorf("Wanted: 0 client Got: %d", h.count())
+	}
+}
@@ -0,0 +1,127 @@
+package dequeuer
+
+import (
+	"context"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+// GetApp return the dequeuer app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-dequeuer",
+		Version: "0.5.0",
+		Usage:   "Trandoshan dequeuer process",
+		Flags: []cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "nats-uri",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
+				Required: true,
+			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "Number of crawl failures after which an URL is published to the dead-letter queue",
+				Value: 3,
+			},
+			&cli.StringFlag{
+				Name:  "metrics-addr",
+				Usage: "Address on which to expose the prometheus metrics (e.g: :9090)",
+			},
+		},
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	if ctx.Int("max-failures") <= 0 {
+		return fmt.Errorf("invalid max failures %d (should be positive)", ctx.Int("max-failures"))
+	}
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-dequeuer")
+
+	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
+	log.Debug().Int("max-failures", ctx.Int("max-failures")).Msg("Retrying failed URLs")
+
+	// Create the NATS subscriber
+	sub, err := natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	defer heartbeat.Start(ctx, sub)()
+
+	// Keep the dead URLs until they are requeued
+	if err := sub.KeepUntilAcked(messaging.URLDeadSubject); err != nil {
+		log.Warn().Str("err", err.Error()).
+			Msg("Unable to create the dead-letter stream: dead URLs are lost unless dlq-requeue is running")
+	}
+
+	if addr := ctx.String("metrics-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing metrics")
+		if err := natsutil.StartMetricsServer(addr, sub); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Msg("Successfully initialized tdsh-dequeuer. Waiting for failed URLs")
+
+	if err := sub.QueueSubscribe(messaging.URLFailedSubject, "dequeuers",
+		handleMessage(ctx.Int("max-failures"))); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// handleMessage returns the handler publishing the failed URLs back to url.found,
+// or to url.dead once they have failed maxFailures times
+func handleMessage(maxFailures int) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		var failedMsg messaging.URLFailedMsg
+		if err := natsutil.ReadMsg(msg, &failedMsg); err != nil {
+			return err
+		}
+
+		foundMsg, retry := nextAttempt(failedMsg, maxFailures)
+		if !retry {
+			log.Warn().Str("url", failedMsg.URL).Int("failures", failedMsg.Retries+1).
+				Msg("Publishing URL to dead-letter queue")
+			return natsutil.PublishJSON(nc, messaging.URLDeadSubject, &foundMsg)
+		}
+
+		log.Debug().Str("url", failedMsg.URL).Str("err", failedMsg.Error).Int("retries", foundMsg.Retries).
+			Msg("Publishing URL back for retry")
+		return natsutil.PublishMsg(nc, &foundMsg)
+	}
+}
+
+// nextAttempt returns the message to publish for given failed URL, and whether it should be retried
+// (the URL has failed less than maxFailures times)
+func nextAttempt(failedMsg messaging.URLFailedMsg, maxFailures int) (messaging.URLFoundMsg, bool) {
+	failures := failedMsg.Retries + 1
+
+	return messaging.URLFoundMsg{
+		URL:     failedMsg.URL,
+		Depth:   failedMsg.Depth,
+		Retries: failures,
+		Source:  failedMsg.Source,
+		TraceID: failedMsg.TraceID,
+	}, failures < maxFailures
+}
@@ -0,0 +1,109 @@
+package dequeuer
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func TestNextAttempt(t *testing.T) {
+	tests := []struct {
+		retries     int
+		maxFailures int
+		wantRetries int
+		wantRetry   bool
+	}{
+		{0, 3, 1, true},
+		{1, 3, 2, true},
+		{2, 3, 3, false},
+		{5, 3, 6, false},
+		{0, 1, 1, false},
+	}
+
+	for _, test := range tests {
+		failedMsg := messaging.URLFailedMsg{URL: "http://example.onion", Depth: 2, Retries: test.retries,
+			Source: messaging.SourceSeed, TraceID: "trace"}
+
+		foundMsg, retry := nextAttempt(failedMsg, test.maxFailures)
+		if retry != test.wantRetry {
+			t.Errorf("retries %d, max %d: Wanted: %v Got: %v", test.retries, test.maxFailures, test.wantRetry, retry)
+		}
+		if foundMsg.Retries != test.wantRetries {
+			t.Errorf("retries %d: Wanted: %d Got: %d", test.retries, test.wantRetries, foundMsg.Retries)
+		}
+		if foundMsg.URL != failedMsg.URL || foundMsg.Depth != failedMsg.Depth || foundMsg.Source != failedMsg.Source ||
+			foundMsg.TraceID != failedMsg.TraceID {
+			t.Errorf("Wanted: %+v Got: %+v", failedMsg, foundMsg)
+		}
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	foundSub, err := nc.SubscribeSync(messaging.URLFoundSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	deadSub, err := nc.SubscribeSync(messaging.URLDeadSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := handleMessage(2)
+	failedMsg := func(retries int) *nats.Msg {
+		b, err := json.Marshal(&messaging.URLFailedMsg{URL: "http://example.onion", Retries: retries, Error: "timeout"})
+		if err != nil {
+			t.FailNow()
+		}
+		return &nats.Msg{Subject: messaging.URLFailedSubject, Data: b}
+	}
+
+	// First failure: the URL should be published back with an incremented retry count
+	if err := handler(context.Background(), nc, failedMsg(0)); err != nil {
+		t.FailNow()
+	}
+
+	msg, err := foundSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("URL should have been published back")
+	}
+	var foundMsg messaging.URLFoundMsg
+	if err := natsutil.ReadJSON(msg, &foundMsg); err != nil {
+		t.FailNow()
+	}
+	if foundMsg.URL != "http://example.onion" || foundMsg.Retries != 1 {
+		t.Errorf("unexpected URL: %+v", foundMsg)
+	}
+
+	// Second failure: max failures reached
+	if err := handler(context.Background(), nc, failedMsg(1)); err != nil {
+		t.FailNow()
+	}
+
+	if _, err := deadSub.NextMsg(time.Second); err != nil {
+		t.Error("URL should have been published to the dead-letter queue")
+	}
+	if _, err := foundSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("URL should not have been published back")
+	}
+
+	// Invalid message
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte("not json")}); err == nil {
+		t.Error("invalid message should be returned as error")
+	}
+}
@@ -0,0 +1,274 @@
+package exporter
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const pageSize = 100
+
+// csvColumns is the column order of the CSV export (bodies are not exported as CSV)
+var csvColumns = []string{"url", "title", "time"}
+
+// GetApp return the exporter app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-exporter",
+		Version: "0.5.0",
+		Usage:   "Trandoshan exporter process",
+		Flags: append([]cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "Format of the export (jsonl, csv)",
+				Value: "jsonl",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "Path to the export file (- for stdout, gzip compressed if ending with .gz)",
+				Value: "-",
+			},
+			&cli.TimestampFlag{
+				Name:   "start-date",
+				Usage:  "Only export the resources crawled since given date (e.g: 2021-01-02T15:04:05Z)",
+				Layout: time.RFC3339,
+			},
+			&cli.TimestampFlag{
+				Name:   "end-date",
+				Usage:  "Only export the resources crawled until given date (e.g: 2021-01-02T15:04:05Z)",
+				Layout: time.RFC3339,
+			},
+			&cli.StringFlag{
+				Name:  "hostname-filter",
+				Usage: "Only export the resources of given hostname (and its subdomains)",
+			},
+		}, api.GetClientFlags()...),
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-exporter")
+
+	log.Debug().Str("uri", ctx.String("api-uri")).Msg("Using API server")
+
+	format := ctx.String("format")
+	if format != "jsonl" && format != "csv" {
+		return fmt.Errorf("invalid format %s (should be jsonl or csv)", format)
+	}
+
+	// Bodies are only part of the JSONL export
+	var opts []api.ClientOption
+	if format == "jsonl" {
+		opts = append(opts, api.WithResourceBodies())
+	}
+
+	// Create the API client
+	apiClient, err := api.NewClientFromContext(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(ctx.String("output"))
+	if err != nil {
+		return err
+	}
+
+	e := &exporter{
+		apiClient: apiClient,
+		hostname:  strings.ToLower(ctx.String("hostname-filter")),
+	}
+	if startDate := ctx.Timestamp("start-date"); startDate != nil {
+		e.startDate = startDate.UTC()
+	}
+	if endDate := ctx.Timestamp("end-date"); endDate != nil {
+		e.endDate = endDate.UTC()
+	}
+
+	var w resourceWriter
+	if format == "csv" {
+		w = newCSVWriter(out)
+	} else {
+		w = newJSONLWriter(out)
+	}
+
+	count, err := e.export(w)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Err(err).Msg("Error while exporting resources")
+		return err
+	}
+
+	log.Info().Int("count", count).Str("output", ctx.String("output")).Msg("Successfully exported resources")
+
+	return nil
+}
+
+type exporter struct {
+	apiClient api.Client
+	startDate time.Time
+	endDate   time.Time
+	hostname  string
+}
+
+// export writes every matching resource using given writer, and returns the number of written resources
+func (e *exporter) export(w resourceWriter) (int, error) {
+	if err := w.begin(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	cursor := ""
+	for {
+		resources, next, err := e.apiClient.SearchResourcesAfter(cursor, pageSize, api.SearchResourcesOptions{
+			StartDate: e.startDate,
+			EndDate:   e.endDate,
+		})
+		if err != nil {
+			return count, err
+		}
+
+		for _, resource := range resources {
+			if !e.matchHostname(resource.URL) {
+				continue
+			}
+
+			if err := w.write(resource); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		log.Debug().Int("count", count).Msg("Exported resources")
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	return count, w.flush()
+}
+
+// matchHostname returns true if given resource URL (stored without protocol) belongs to the filtered hostname
+func (e *exporter) matchHostname(rawURL string) bool {
+	if e.hostname == "" {
+		return true
+	}
+
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	hostname := strings.ToLower(u.Hostname())
+	return hostname == e.hostname || strings.HasSuffix(hostname, "."+e.hostname)
+}
+
+// openOutput returns the writer to given path (- for stdout), gzip compressed if the path ends with .gz
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// gzipFile close both the gzip writer and the underlying file
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (gf *gzipFile) Close() error {
+	if err := gf.Writer.Close(); err != nil {
+		_ = gf.f.Close()
+		return err
+	}
+
+	return gf.f.Close()
+}
+
+// resourceWriter serialize the exported resources
+type resourceWriter interface {
+	begin() error
+	write(resource api.ResourceDto) error
+	flush() error
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	return &jsonlWriter{enc: json.NewEncoder(w)}
+}
+
+func (jw *jsonlWriter) begin() error {
+	return nil
+}
+
+func (jw *jsonlWriter) write(resource api.ResourceDto) error {
+	return jw.enc.Encode(resource)
+}
+
+func (jw *jsonlWriter) flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *csvWriter) begin() error {
+	return cw.w.Write(csvColumns)
+}
+
+func (cw *csvWriter) write(resource api.ResourceDto) error {
+	return cw.w.Write([]string{resource.URL, resource.Title, resource.Time.Format(time.RFC3339)})
+}
+
+func (cw *csvWriter) flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,191 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/creekorful/trandoshan/api"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var crawlTime = time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+
+// apiServer serve given resources two by two, using the index of the next resource as cursor
+func apiServer(t *testing.T, resources []api.ResourceDto) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/resources" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.URL.Query().Get("start-date") != "2021-01-01T00:00:00Z" || r.URL.Query().Get("end-date") != "2021-02-01T00:00:00Z" {
+			t.Errorf("invalid dates %s", r.URL.RawQuery)
+		}
+
+		start, _ := strconv.Atoi(r.URL.Query().Get(api.CursorAfterQueryParam))
+		end := start + 2
+		if end < len(resources) {
+			w.Header().Set(api.PaginationNextHeader, strconv.Itoa(end))
+		} else {
+			end = len(resources)
+		}
+
+		var page []api.ResourceDto
+		for _, resource := range resources[start:end] {
+			if r.URL.Query().Get("with-body") != "true" {
+				resource.Body = ""
+			}
+			page = append(page, resource)
+		}
+
+		w.Header().Set(api.PaginationCountHeader, strconv.Itoa(len(resources)))
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+}
+
+func newExporter(apiClient api.Client, hostname string) *exporter {
+	return &exporter{
+		apiClient: apiClient,
+		startDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		endDate:   time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+		hostname:  hostname,
+	}
+}
+
+var resources = []api.ResourceDto{
+	{URL: "example.onion/index.html", Title: "Example", Body: "<html>example</html>", Time: crawlTime},
+	{URL: "www.example.onion/about.html", Title: "About, \"us\"", Body: "<html>about</html>", Time: crawlTime},
+	{URL: "other.onion", Title: "Other", Body: "<html>other</html>", Time: crawlTime},
+	{URL: "https://notexample.onion", Title: "Not example", Body: "<html>not</html>", Time: crawlTime},
+	{URL: "EXAMPLE.onion:8080/upper", Title: "Upper", Body: "<html>upper</html>", Time: crawlTime},
+}
+
+func TestExportJSONL(t *testing.T) {
+	srv := apiServer(t, resources)
+	defer srv.Close()
+
+	var b bytes.Buffer
+	count, err := newExporter(api.NewClient(srv.URL, api.WithResourceBodies()), "").export(newJSONLWriter(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(resources) {
+		t.Errorf("Wanted: %d Got: %d", len(resources), count)
+	}
+
+	scanner := bufio.NewScanner(&b)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		var resource api.ResourceDto
+		if err := json.Unmarshal(scanner.Bytes(), &resource); err != nil {
+			t.Fatal(err)
+		}
+		if resource.URL != resources[i].URL || resource.Body != resources[i].Body || !resource.Time.Equal(crawlTime) {
+			t.Errorf("Wanted: %+v Got: %+v", resources[i], resource)
+		}
+	}
+	if i != len(resources) {
+		t.Errorf("Wanted: %d lines Got: %d", len(resources), i)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	srv := apiServer(t, resources)
+	defer srv.Close()
+
+	var b bytes.Buffer
+	count, err := newExporter(api.NewClient(srv.URL), "example.onion").export(newCSVWriter(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Wanted: 3 Got: %d", count)
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"url", "title", "time"},
+		{"example.onion/index.html", "Example", "2021-01-02T15:04:05Z"},
+		{"www.example.onion/about.html", "About, \"us\"", "2021-01-02T15:04:05Z"},
+		{"EXAMPLE.onion:8080/upper", "Upper", "2021-01-02T15:04:05Z"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Wanted: %v Got: %v", want, records)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Errorf("Wanted: %v Got: %v", want[i], records[i])
+				break
+			}
+		}
+	}
+}
+
+func TestExportAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if _, err := newExporter(api.NewClient(srv.URL), "").export(newJSONLWriter(ioutil.Discard)); err == nil {
+		t.Error("API error should be returned")
+	}
+}
+
+func TestOpenOutputGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tdsh-exporter")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"export.jsonl", "export.jsonl.gz"} {
+		path := filepath.Join(dir, name)
+
+		out, err := openOutput(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := out.Write([]byte("{}\n")); err != nil {
+			t.FailNow()
+		}
+		if err := out.Close(); err != nil {
+			t.FailNow()
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.FailNow()
+		}
+
+		var content []byte
+		if filepath.Ext(name) == ".gz" {
+			r, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("%s should be gzip compressed: %s", name, err)
+			}
+			content, err = ioutil.ReadAll(r)
+		} else {
+			content, err = ioutil.ReadAll(f)
+		}
+		_ = f.Close()
+
+		if err != nil || string(content) != "{}\n" {
+			t.Errorf("%s: invalid content %q", name, content)
+		}
+	}
+}
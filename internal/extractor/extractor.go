@@ -1,10 +1,12 @@
 package extractor
 
 import (
+	"context"
 	"fmt"
 	"github.com/PuerkitoBio/purell"
 	"github.com/creekorful/trandoshan/api"
 	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
 	"github.com/creekorful/trandoshan/internal/util/logging"
 	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
 	"github.com/nats-io/nats.go"
@@ -24,21 +26,32 @@ var (
 func GetApp() *cli.App {
 	return &cli.App{
 		Name:    "tdsh-extractor",
-		Version: "0.4.0",
+		Version: "0.5.0",
 		Usage:   "Trandoshan extractor process",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
 			&cli.StringFlag{
 				Name:     "nats-uri",
-				Usage:    "URI to the NATS server",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
 				Required: true,
 			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.BoolFlag{
+				Name: "publish-urls",
+				Usage: "Publish the URLs found in the text of the resources to url.found " +
+					"(the crawler already publishes the links of the pages)",
+			},
 			&cli.StringFlag{
-				Name:     "api-uri",
-				Usage:    "URI to the API server",
-				Required: true,
+				Name:  "metrics-addr",
+				Usage: "Address on which to expose the prometheus metrics (e.g: :9090)",
 			},
-		},
+		}, api.GetClientFlags()...),
 		Action: execute,
 	}
 }
@@ -52,27 +65,45 @@ func execute(ctx *cli.Context) error {
 	log.Debug().Str("uri", ctx.String("api-uri")).Msg("Using API server")
 
 	// Create the API client
-	apiClient := api.NewClient(ctx.String("api-uri"))
+	apiClient, err := api.NewClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Create the NATS subscriber
-	sub, err := natsutil.NewSubscriber(ctx.String("nats-uri"))
+	sub, err := natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
 	if err != nil {
 		return err
 	}
 	defer sub.Close()
 
+	defer heartbeat.Start(ctx, sub)()
+
+	if addr := ctx.String("metrics-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing metrics")
+		if err := natsutil.StartMetricsServer(addr, sub); err != nil {
+			return err
+		}
+	}
+
 	log.Info().Msg("Successfully initialized tdsh-extractor. Waiting for resources")
 
+	if ctx.Bool("publish-urls") {
+		log.Debug().Msg("Publishing the URLs found in the resources")
+	}
+
 	if err := sub.QueueSubscribe(messaging.NewResourceSubject, "extractors",
-		handleMessage(apiClient)); err != nil {
+		handleMessage(apiClient, ctx.Bool("publish-urls"))); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func handleMessage(apiClient api.Client) natsutil.MsgHandler {
-	return func(nc *nats.Conn, msg *nats.Msg) error {
+// handleMessage returns the handler saving the resources using the API, publishing the URLs they contain if
+// publishURLs is set (the links are published by the crawler otherwise)
+func handleMessage(apiClient api.Client, publishURLs bool) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
 		var resMsg messaging.NewResourceMsg
 		if err := natsutil.ReadMsg(msg, &resMsg); err != nil {
 			log.Err(err).Msg("Error while reading message")
@@ -95,13 +126,21 @@ func handleMessage(apiClient api.Client) natsutil.MsgHandler {
 			return err
 		}
 
+		if !publishURLs {
+			return nil
+		}
+
 		// Finally push found URLs
 		for _, url := range urls {
 			log.Trace().
 				Str("url", url).
 				Msg("Publishing found URL")
 
-			if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{URL: url}); err != nil {
+			if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{
+				URL:    url,
+				Depth:  resMsg.Depth + 1,
+				Source: messaging.SourceCrawler,
+			}); err != nil {
 				log.Warn().
 					Str("url", url).
 					Str("err", err.Error()).
@@ -115,10 +154,23 @@ func handleMessage(apiClient api.Client) natsutil.MsgHandler {
 
 func extractResource(msg messaging.NewResourceMsg) (api.ResourceDto, []string, error) {
 	resDto := api.ResourceDto{
-		URL:   protocolRegex.ReplaceAllLiteralString(msg.URL, ""),
-		Title: extractTitle(msg.Body),
-		Body:  msg.Body,
-		Time:  time.Now(),
+		URL:          protocolRegex.ReplaceAllLiteralString(msg.URL, ""),
+		Title:        msg.Title,
+		Body:         msg.Body,
+		Time:         time.Now(),
+		ContentHash:  msg.ContentHash,
+		Truncated:    msg.Truncated,
+		UserAgent:    msg.UserAgent,
+		Language:     msg.Language,
+		Charset:      msg.Charset,
+		Keywords:     msg.Keywords,
+		Source:       msg.Source,
+		ResponseCode: msg.ResponseCode,
+	}
+
+	// Resources published by older crawlers have no title
+	if resDto.Title == "" {
+		resDto.Title = extractTitle(msg.Body)
 	}
 
 	// Extract URLs
@@ -34,6 +34,74 @@ func TestExtractResource(t *testing.T) {
 	}
 }
 
+func TestExtractResourceCrawlerTitle(t *testing.T) {
+	msg := messaging.NewResourceMsg{
+		URL:   "https://example.org",
+		Body:  "<title>  Raw   title </title>",
+		Title: "Raw title",
+	}
+
+	resDto, _, err := extractResource(msg)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// Title extracted by the crawler take precedence
+	if resDto.Title != "Raw title" {
+		t.Errorf("Wanted: Raw title Got: %s", resDto.Title)
+	}
+}
+
+func TestExtractResourceTruncated(t *testing.T) {
+	msg := messaging.NewResourceMsg{
+		URL:       "https://example.org",
+		Body:      "<html><body>partial",
+		Truncated: true,
+	}
+
+	resDto, _, err := extractResource(msg)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if !resDto.Truncated {
+		t.Error("resource should be flagged as truncated")
+	}
+}
+
+func TestExtractResourceMetadata(t *testing.T) {
+	msg := messaging.NewResourceMsg{
+		URL:          "https://example.org",
+		Body:         "<html><body>hello",
+		UserAgent:    "Mozilla/5.0 (X11; Linux x86_64)",
+		Language:     "en",
+		Keywords:     []string{"hello"},
+		Source:       messaging.SourceManual,
+		ResponseCode: 200,
+	}
+
+	resDto, _, err := extractResource(msg)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if resDto.UserAgent != msg.UserAgent {
+		t.Errorf("Wanted: %s Got: %s", msg.UserAgent, resDto.UserAgent)
+	}
+	if resDto.Language != msg.Language {
+		t.Errorf("Wanted: %s Got: %s", msg.Language, resDto.Language)
+	}
+	if len(resDto.Keywords) != 1 || resDto.Keywords[0] != "hello" {
+		t.Errorf("Wanted: [hello] Got: %v", resDto.Keywords)
+	}
+	if resDto.Source != msg.Source {
+		t.Errorf("Wanted: %s Got: %s", msg.Source, resDto.Source)
+	}
+	if resDto.ResponseCode != msg.ResponseCode {
+		t.Errorf("Wanted: %d Got: %d", msg.ResponseCode, resDto.ResponseCode)
+	}
+}
+
 func TestExtractTitle(t *testing.T) {
 	c := "hello this <title>is A</title>TEST"
 	if val := extractTitle(c); val != "is A" {
@@ -1,17 +1,50 @@
 package messaging
 
+import "time"
+
 const (
 	// URLTodoSubject is the subject used when an URL is schedule for crawling
 	URLTodoSubject = "url.todo"
 	// URLFoundSubject is the subject used when an URL is extracted from resource
 	URLFoundSubject = "url.found"
+	// URLCanonicalSubject is the subject used when a found URL has been canonicalized (same message as url.found)
+	URLCanonicalSubject = "url.canonical"
+	// URLDeadSubject is the subject used when an URL has repeatedly failed to be scheduled
+	URLDeadSubject = "url.dead"
+	// URLDeferredSubject is the subject used when an URL cannot be scheduled yet (API unavailable, outside of crawl window)
+	URLDeferredSubject = "url.deferred"
+	// URLSkippedSubject is the subject used when an URL has not been crawled or scheduled
+	URLSkippedSubject = "url.skipped"
 	// NewResourceSubject is the subject used when a new resource has been crawled
 	NewResourceSubject = "resource.new"
+	// CrawlResultSubject is the subject used when an URL has been crawled, successfully or not
+	CrawlResultSubject = "crawl.result"
+	// URLFailedSubject is the subject used when an URL has failed to be crawled
+	URLFailedSubject = "url.failed"
+	// HeartbeatSubject is the subject used by the running services to tell they are alive
+	HeartbeatSubject = "service.heartbeat"
+)
+
+const (
+	// SourceCrawler the URL has been found in a crawled resource
+	SourceCrawler = "crawler"
+	// SourceSeed the URL has been read from a seed file (e.g: --seed-file or tdsh-seed-generator)
+	SourceSeed = "seed"
+	// SourceManual the URL has been scheduled by someone (e.g: trandoshanctl schedule)
+	SourceManual = "manual"
 )
 
 // URLTodoMsg represent an URL to crawl
 type URLTodoMsg struct {
 	URL string `json:"url"`
+	// Depth is the number of links followed from the seed URL
+	Depth int `json:"depth,omitempty"`
+	// Retries is the number of times the URL has been published back after failing to be crawled
+	Retries int `json:"retries,omitempty"`
+	// Source tell how the URL has been discovered (see SourceCrawler, etc...). empty if unknown
+	Source string `json:"source,omitempty"`
+	// TraceID is copied from the found URL, correlating the messages published for the URL
+	TraceID string `json:"trace_id,omitempty"`
 }
 
 // Subject returns the subject where message should be push
@@ -22,6 +55,16 @@ func (msg *URLTodoMsg) Subject() string {
 // URLFoundMsg represent a found URL
 type URLFoundMsg struct {
 	URL string `json:"url"`
+	// Depth is the number of links followed from the seed URL (0 if missing)
+	Depth int `json:"depth,omitempty"`
+	// Priority higher priority URLs are scheduled first (0 = normal)
+	Priority int `json:"priority,omitempty"`
+	// Retries is the number of times the URL has been published back after failing to be crawled
+	Retries int `json:"retries,omitempty"`
+	// Source tell how the URL has been discovered (see SourceCrawler, etc...). empty if unknown
+	Source string `json:"source,omitempty"`
+	// TraceID correlate the messages published for the same URL (generated by the scheduler if empty)
+	TraceID string `json:"trace_id,omitempty"`
 }
 
 // Subject returns the subject where message should be push
@@ -29,13 +72,133 @@ func (msg *URLFoundMsg) Subject() string {
 	return URLFoundSubject
 }
 
+// SkipReason explain why an URL has not been crawled or scheduled
+type SkipReason string
+
+const (
+	// SkipReasonAlreadyCrawled the URL has been crawled recently
+	SkipReasonAlreadyCrawled SkipReason = "already_crawled"
+	// SkipReasonBlacklisted the URL hostname is blacklisted (or not in the allowlist)
+	SkipReasonBlacklisted SkipReason = "blacklisted"
+	// SkipReasonTooDeep the URL is too far from the seed URL
+	SkipReasonTooDeep SkipReason = "too_deep"
+	// SkipReasonTLDNotAllowed the URL TLD is not allowed (e.g: clear web URL)
+	SkipReasonTLDNotAllowed SkipReason = "tld_not_allowed"
+	// SkipReasonDuplicate the URL has been received recently
+	SkipReasonDuplicate SkipReason = "duplicate"
+	// SkipReasonTooLong the URL is abnormally long
+	SkipReasonTooLong SkipReason = "too_long"
+	// SkipReasonFiltered the URL has been rejected by a custom filter
+	SkipReasonFiltered SkipReason = "filtered"
+	// SkipReasonContentType the resource content type is not allowed
+	SkipReasonContentType SkipReason = "content_type"
+	// SkipReasonDuplicateContent the URL content is the same as a page crawled at another URL
+	SkipReasonDuplicateContent SkipReason = "duplicate_content"
+	// SkipReasonRobotsTxt the URL is disallowed by the robots.txt of its host
+	SkipReasonRobotsTxt SkipReason = "robots_txt"
+	// SkipReasonDead the URL has never returned a 200 despite several crawls
+	SkipReasonDead SkipReason = "dead"
+	// SkipReasonInvalidOnion the URL hostname is not a valid v2 or v3 onion address (e.g: foo.onion)
+	SkipReasonInvalidOnion SkipReason = "invalid_onion"
+	// SkipReasonSchemeNotAllowed the URL scheme is not allowed (e.g: ftp://)
+	SkipReasonSchemeNotAllowed SkipReason = "scheme_not_allowed"
+)
+
+// URLSkippedMsg represent an URL which has not been crawled or scheduled
+type URLSkippedMsg struct {
+	URL       string     `json:"url"`
+	Reason    SkipReason `json:"reason"`
+	Timestamp time.Time  `json:"timestamp"`
+	// TraceID is the trace ID of the skipped URL
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// Subject returns the subject where message should be push
+func (msg *URLSkippedMsg) Subject() string {
+	return URLSkippedSubject
+}
+
 // NewResourceMsg represent a crawled resource
 type NewResourceMsg struct {
-	URL  string `json:"url"`
-	Body string `json:"body"`
+	URL         string `json:"url"`
+	Body        string `json:"body"`
+	Title       string `json:"title,omitempty"`
+	ContentHash string `json:"content_hash,omitempty"`
+	// Truncated is true if the body has been truncated to the maximum body size
+	Truncated bool `json:"truncated,omitempty"`
+	Depth     int  `json:"depth,omitempty"`
+	// UserAgent is the user agent the resource has been crawled with
+	UserAgent string `json:"user_agent,omitempty"`
+	// Language is the BCP-47 code of the language of the body (empty if it cannot be detected)
+	Language string `json:"language,omitempty"`
+	// Charset is the charset the body has been decoded from to UTF-8 (e.g: windows-1252)
+	Charset string `json:"charset,omitempty"`
+	// Keywords are the terms best describing the displayed text, best first (empty if not extracted)
+	Keywords []string `json:"keywords,omitempty"`
+	// Source tell how the URL of the resource has been discovered (empty if unknown)
+	Source string `json:"source,omitempty"`
+	// ResponseCode is the HTTP status code the URL answered with, before redirects are followed
+	ResponseCode int `json:"response_code,omitempty"`
+	// TraceID is the trace ID of the crawled URL
+	TraceID string `json:"trace_id,omitempty"`
 }
 
 // Subject returns the subject where message should be push
 func (msg *NewResourceMsg) Subject() string {
 	return NewResourceSubject
 }
+
+// CrawlResultMsg represent the outcome of an URL crawling
+type CrawlResultMsg struct {
+	URL string `json:"url"`
+	// StatusCode is the HTTP status code of the response (0 if no response has been received)
+	StatusCode int `json:"status_code"`
+	// LatencyMs is the time spent crawling the URL, redirects and body included, in milliseconds
+	LatencyMs int64 `json:"latency_ms"`
+	// TLSError is true if the crawling failed because of a TLS error
+	TLSError bool `json:"tls_error,omitempty"`
+	// TimedOut is true if the crawling has been aborted because the connection or the request timed out
+	TimedOut  bool      `json:"timed_out,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// TraceID is the trace ID of the crawled URL
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// Subject returns the subject where message should be push
+func (msg *CrawlResultMsg) Subject() string {
+	return CrawlResultSubject
+}
+
+// URLFailedMsg represent an URL which has failed to be crawled
+type URLFailedMsg struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth,omitempty"`
+	// Retries is the number of times the URL had been published back before this failure
+	Retries int `json:"retries,omitempty"`
+	// Source tell how the URL has been discovered (empty if unknown)
+	Source    string    `json:"source,omitempty"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+	// TraceID is the trace ID of the failed URL, kept when it is retried
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// Subject returns the subject where message should be push
+func (msg *URLFailedMsg) Subject() string {
+	return URLFailedSubject
+}
+
+// HeartbeatMsg is published periodically by a running service instance
+type HeartbeatMsg struct {
+	// Service is the name of the service (e.g: tdsh-crawler)
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+	Hostname  string    `json:"hostname"`
+	PID       int       `json:"pid"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Subject returns the subject where message should be push
+func (msg *HeartbeatMsg) Subject() string {
+	return HeartbeatSubject
+}
@@ -0,0 +1,145 @@
+package messaging
+
+import (
+	"encoding/json"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func TestURLSkippedMsgJSON(t *testing.T) {
+	msg := URLSkippedMsg{
+		URL:       "http://example.onion",
+		Reason:    SkipReasonTooDeep,
+		Timestamp: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	b, err := json.Marshal(&msg)
+	if err != nil {
+		t.FailNow()
+	}
+
+	want := `{"url":"http://example.onion","reason":"too_deep","timestamp":"2021-01-02T03:04:05Z"}`
+	if string(b) != want {
+		t.Errorf("Wanted: %s Got: %s", want, b)
+	}
+
+	var decoded URLSkippedMsg
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.FailNow()
+	}
+	if decoded.URL != msg.URL || decoded.Reason != msg.Reason || !decoded.Timestamp.Equal(msg.Timestamp) {
+		t.Errorf("Wanted: %+v Got: %+v", msg, decoded)
+	}
+
+	if (&msg).Subject() != "url.skipped" {
+		t.Fail()
+	}
+}
+
+func TestCrawlResultMsgJSON(t *testing.T) {
+	msgs := map[string]CrawlResultMsg{
+		`{"url":"http://example.onion","status_code":200,"latency_ms":1500,"timestamp":"2021-01-02T03:04:05Z"}`: {
+			URL:        "http://example.onion",
+			StatusCode: 200,
+			LatencyMs:  1500,
+			Timestamp:  time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		`{"url":"https://example.onion","status_code":0,"latency_ms":20,"tls_error":true,"timestamp":"2021-01-02T03:04:05Z"}`: {
+			URL:       "https://example.onion",
+			LatencyMs: 20,
+			TLSError:  true,
+			Timestamp: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}
+
+	for want, msg := range msgs {
+		b, err := json.Marshal(&msg)
+		if err != nil {
+			t.FailNow()
+		}
+		if string(b) != want {
+			t.Errorf("Wanted: %s Got: %s", want, b)
+		}
+
+		var decoded CrawlResultMsg
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.FailNow()
+		}
+		if decoded.URL != msg.URL || decoded.StatusCode != msg.StatusCode || decoded.LatencyMs != msg.LatencyMs ||
+			decoded.TLSError != msg.TLSError || !decoded.Timestamp.Equal(msg.Timestamp) {
+			t.Errorf("Wanted: %+v Got: %+v", msg, decoded)
+		}
+	}
+
+	if (&CrawlResultMsg{}).Subject() != "crawl.result" {
+		t.Fail()
+	}
+}
+
+func TestSourceNATSRoundTrip(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	tests := []struct {
+		msg     natsutil.Msg
+		decoded natsutil.Msg
+		source  func(msg natsutil.Msg) string
+	}{
+		{&URLFoundMsg{URL: "http://example.onion", Source: SourceManual}, &URLFoundMsg{},
+			func(msg natsutil.Msg) string { return msg.(*URLFoundMsg).Source }},
+		{&URLTodoMsg{URL: "http://example.onion", Source: SourceSeed}, &URLTodoMsg{},
+			func(msg natsutil.Msg) string { return msg.(*URLTodoMsg).Source }},
+		{&URLFailedMsg{URL: "http://example.onion", Source: SourceCrawler}, &URLFailedMsg{},
+			func(msg natsutil.Msg) string { return msg.(*URLFailedMsg).Source }},
+		{&NewResourceMsg{URL: "http://example.onion", Source: SourceSeed}, &NewResourceMsg{},
+			func(msg natsutil.Msg) string { return msg.(*NewResourceMsg).Source }},
+	}
+
+	for _, test := range tests {
+		sub, err := nc.SubscribeSync(test.msg.Subject())
+		if err != nil {
+			t.FailNow()
+		}
+
+		if err := natsutil.PublishMsg(nc, test.msg); err != nil {
+			t.FailNow()
+		}
+
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := natsutil.ReadMsg(msg, test.decoded); err != nil {
+			t.FailNow()
+		}
+
+		if want, got := test.source(test.msg), test.source(test.decoded); got != want {
+			t.Errorf("%s: Wanted: %s Got: %s", test.msg.Subject(), want, got)
+		}
+
+		_ = sub.Unsubscribe()
+	}
+}
+
+func TestSourceOmittedIfUnknown(t *testing.T) {
+	b, err := json.Marshal(&URLFoundMsg{URL: "http://example.onion"})
+	if err != nil {
+		t.FailNow()
+	}
+
+	// Older processes don't know about the source
+	if want := `{"url":"http://example.onion"}`; string(b) != want {
+		t.Errorf("Wanted: %s Got: %s", want, b)
+	}
+}
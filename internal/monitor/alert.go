@@ -0,0 +1,54 @@
+package monitor
+
+import "time"
+
+// alertStatus is the status reported by an alert
+type alertStatus string
+
+const (
+	// statusFiring the rate has been below the minimum rate for too long
+	statusFiring alertStatus = "firing"
+	// statusResolved the rate has been back to normal for long enough
+	statusResolved alertStatus = "resolved"
+)
+
+// alertState track for how long the rate has been below (or back above) the minimum rate.
+// to prevent flapping the status only changes once the rate has been on the other side of
+// the minimum rate for alertAfter
+type alertState struct {
+	minRate    float64
+	alertAfter time.Duration
+
+	firing bool
+	// since is the time the rate crossed the minimum rate (zero if it has not since the last status change)
+	since time.Time
+}
+
+// update returns the new status if it changed given the rate measured at given time, or an empty status
+func (s *alertState) update(rate float64, now time.Time) alertStatus {
+	// Is the rate on the side of the minimum rate which should change the status?
+	crossed := rate < s.minRate
+	if s.firing {
+		crossed = rate >= s.minRate
+	}
+
+	if !crossed {
+		s.since = time.Time{}
+		return ""
+	}
+
+	if s.since.IsZero() {
+		s.since = now
+	}
+	if now.Sub(s.since) < s.alertAfter {
+		return ""
+	}
+
+	s.firing = !s.firing
+	s.since = time.Time{}
+
+	if s.firing {
+		return statusFiring
+	}
+	return statusResolved
+}
@@ -0,0 +1,55 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertStateUpdate(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &alertState{minRate: 10, alertAfter: 5 * time.Minute}
+
+	steps := []struct {
+		elapsed time.Duration
+		rate    float64
+		want    alertStatus
+	}{
+		{0, 20, ""},
+		// Rate drops but not for long enough
+		{1 * time.Minute, 5, ""},
+		{4 * time.Minute, 5, ""},
+		{5 * time.Minute, 15, ""},
+		// Rate drops again: the delay restart
+		{6 * time.Minute, 5, ""},
+		{10 * time.Minute, 9.9, ""},
+		{11 * time.Minute, 0, statusFiring},
+		// Already firing
+		{12 * time.Minute, 0, ""},
+		// Rate back to normal but not for long enough
+		{13 * time.Minute, 10, ""},
+		{14 * time.Minute, 5, ""},
+		{15 * time.Minute, 12, ""},
+		{19 * time.Minute, 12, ""},
+		{20 * time.Minute, 12, statusResolved},
+		// Already resolved
+		{30 * time.Minute, 12, ""},
+	}
+
+	for _, step := range steps {
+		if got := s.update(step.rate, start.Add(step.elapsed)); got != step.want {
+			t.Errorf("%s (rate %f): Wanted: %q Got: %q", step.elapsed, step.rate, step.want, got)
+		}
+	}
+}
+
+func TestAlertStateUpdateNoDelay(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &alertState{minRate: 1}
+
+	if got := s.update(0, now); got != statusFiring {
+		t.Errorf("Wanted: %q Got: %q", statusFiring, got)
+	}
+	if got := s.update(1, now); got != statusResolved {
+		t.Errorf("Wanted: %q Got: %q", statusResolved, got)
+	}
+}
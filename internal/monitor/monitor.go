@@ -0,0 +1,222 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"net/http"
+	"time"
+)
+
+// GetApp return the monitor app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-monitor",
+		Version: "0.5.0",
+		Usage:   "Trandoshan monitor process",
+		Flags: []cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "nats-uri",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
+				Required: true,
+			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.DurationFlag{
+				Name:  "window",
+				Usage: "Duration of the sliding window over which the crawl rate is computed",
+				Value: 10 * time.Minute,
+			},
+			&cli.Float64Flag{
+				Name:  "min-rate",
+				Usage: "Minimum number of crawled URLs per minute under which the crawl throughput is considered low",
+				Value: 1,
+			},
+			&cli.DurationFlag{
+				Name:  "alert-after",
+				Usage: "Duration the crawl rate should stay below (or back above) the minimum rate before alerting",
+				Value: 5 * time.Minute,
+			},
+			&cli.StringFlag{
+				Name:     "webhook-url",
+				Usage:    "URL to which the alerts are POSTed as JSON",
+				Required: true,
+			},
+			&cli.DurationFlag{
+				Name:  "webhook-timeout",
+				Usage: "Timeout of the webhook calls",
+				Value: 10 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "metrics-addr",
+				Usage: "Address on which to expose the prometheus metrics (e.g: :9090)",
+			},
+		},
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	if ctx.Duration("window") <= 0 {
+		return fmt.Errorf("invalid window %s (should be positive)", ctx.Duration("window"))
+	}
+	if ctx.Float64("min-rate") <= 0 {
+		return fmt.Errorf("invalid min rate %f (should be positive)", ctx.Float64("min-rate"))
+	}
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-monitor")
+
+	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
+	log.Debug().Str("window", ctx.Duration("window").String()).
+		Float64("min-rate", ctx.Float64("min-rate")).
+		Str("alert-after", ctx.Duration("alert-after").String()).
+		Msg("Monitoring crawl rate")
+
+	// Create the NATS subscriber
+	sub, err := natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	defer heartbeat.Start(ctx, sub)()
+
+	if addr := ctx.String("metrics-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing metrics")
+		if err := natsutil.StartMetricsServer(addr, sub); err != nil {
+			return err
+		}
+	}
+
+	m := &monitor{
+		window:     newRateWindow(ctx.Duration("window"), time.Now),
+		state:      &alertState{minRate: ctx.Float64("min-rate"), alertAfter: ctx.Duration("alert-after")},
+		webhookURL: ctx.String("webhook-url"),
+		httpClient: &http.Client{Timeout: ctx.Duration("webhook-timeout")},
+		now:        time.Now,
+	}
+
+	// Check the rate each time the window slides
+	interval := m.window.bucketSize
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go m.run(interval, done)
+
+	log.Info().Msg("Successfully initialized tdsh-monitor. Waiting for crawl results")
+
+	if err := sub.QueueSubscribe(messaging.CrawlResultSubject, "monitors", handleMessage(m)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// handleMessage returns the handler counting the crawl results
+func handleMessage(m *monitor) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		var resultMsg messaging.CrawlResultMsg
+		if err := natsutil.ReadMsg(msg, &resultMsg); err != nil {
+			return err
+		}
+
+		m.window.add()
+		return nil
+	}
+}
+
+// alertPayload is the JSON body POSTed to the webhook
+type alertPayload struct {
+	Status alertStatus `json:"status"`
+	// Rate is the number of crawled URLs per minute over the window
+	Rate      float64   `json:"rate"`
+	MinRate   float64   `json:"min_rate"`
+	Window    string    `json:"window"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// monitor alert through a webhook when the crawl rate is too low, and when it is back to normal
+type monitor struct {
+	window     *rateWindow
+	state      *alertState
+	webhookURL string
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// run check the crawl rate every interval until done is closed
+func (m *monitor) run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := m.check(); err != nil {
+				log.Err(err).Msg("Error while sending alert")
+			}
+		}
+	}
+}
+
+// check compute the crawl rate and send an alert if the status has changed
+func (m *monitor) check() error {
+	rate := m.window.rate()
+	now := m.now()
+
+	status := m.state.update(rate, now)
+	log.Trace().Float64("rate", rate).Str("status", string(status)).Msg("Checked crawl rate")
+	if status == "" {
+		return nil
+	}
+
+	log.Warn().Str("status", string(status)).Float64("rate", rate).Msg("Crawl rate alert")
+
+	return m.sendAlert(&alertPayload{
+		Status:    status,
+		Rate:      rate,
+		MinRate:   m.state.minRate,
+		Window:    (m.window.bucketSize * windowBuckets).String(),
+		Timestamp: now,
+	})
+}
+
+func (m *monitor) sendAlert(payload *alertPayload) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	res, err := m.httpClient.Post(m.webhookURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
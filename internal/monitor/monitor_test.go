@@ -0,0 +1,109 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMonitorCheck(t *testing.T) {
+	var payloads []alertPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected webhook call: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+
+		var payload alertPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		payloads = append(payloads, payload)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	m := &monitor{
+		window:     newRateWindow(10*time.Minute, clock),
+		state:      &alertState{minRate: 1, alertAfter: time.Minute},
+		webhookURL: srv.URL,
+		httpClient: srv.Client(),
+		now:        clock,
+	}
+
+	// No crawl results for 2 minutes: the rate has been low since the first check
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Minute)
+		if err := m.check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("an alert should have been sent, got %d", len(payloads))
+	}
+	if payloads[0].Status != statusFiring || payloads[0].Rate != 0 || payloads[0].MinRate != 1 ||
+		payloads[0].Window != "10m0s" || !payloads[0].Timestamp.Equal(now) {
+		t.Errorf("unexpected alert: %+v", payloads[0])
+	}
+
+	// Crawl results are back
+	handler := handleMessage(m)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 10; j++ {
+			if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"https://example.onion"}`)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		now = now.Add(time.Minute)
+		if err := m.check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("a resolution should have been sent, got %d", len(payloads))
+	}
+	if payloads[1].Status != statusResolved || payloads[1].Rate < 1 {
+		t.Errorf("unexpected alert: %+v", payloads[1])
+	}
+}
+
+func TestMonitorCheckWebhookError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	m := &monitor{
+		window:     newRateWindow(10*time.Minute, clock),
+		state:      &alertState{minRate: 1},
+		webhookURL: srv.URL,
+		httpClient: srv.Client(),
+		now:        clock,
+	}
+
+	now = now.Add(time.Minute)
+	if err := m.check(); err == nil {
+		t.Error("webhook error should have been returned")
+	}
+}
+
+func TestHandleMessageInvalid(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := &monitor{window: newRateWindow(time.Minute, func() time.Time { return now })}
+
+	if err := handleMessage(m)(context.Background(), nil, &nats.Msg{Data: []byte("{")}); err == nil {
+		t.Error("invalid message should be returned as error")
+	}
+
+	now = now.Add(time.Minute)
+	if rate := m.window.rate(); rate != 0 {
+		t.Errorf("invalid message should not be counted, rate: %f", rate)
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// windowBuckets is the number of buckets of the sliding window
+const windowBuckets = 60
+
+// rateWindow count the events over a sliding window, using a ring buffer of fixed size buckets
+type rateWindow struct {
+	bucketSize time.Duration
+	now        func() time.Time
+
+	buckets []int
+	// head is the index of the bucket of the most recent events
+	head int
+	// headStart is the start time of the head bucket
+	headStart time.Time
+	// started is the time the window has been created at
+	started time.Time
+	mutex   sync.Mutex
+}
+
+func newRateWindow(window time.Duration, now func() time.Time) *rateWindow {
+	bucketSize := window / windowBuckets
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+
+	t := now()
+	return &rateWindow{
+		bucketSize: bucketSize,
+		now:        now,
+		buckets:    make([]int, windowBuckets),
+		headStart:  t.Truncate(bucketSize),
+		started:    t,
+	}
+}
+
+// add record an event happening now
+func (w *rateWindow) add() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.advance(w.now())
+	w.buckets[w.head]++
+}
+
+// rate returns the number of events per minute over the window.
+// until the window is full, the rate is computed over the time elapsed since its creation
+func (w *rateWindow) rate() float64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := w.now()
+	w.advance(now)
+
+	count := 0
+	for _, c := range w.buckets {
+		count += c
+	}
+
+	elapsed := now.Sub(w.started)
+	if window := w.bucketSize * windowBuckets; elapsed > window {
+		elapsed = window
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(count) / elapsed.Minutes()
+}
+
+// advance move the head to the bucket containing now, clearing the buckets expired meanwhile
+func (w *rateWindow) advance(now time.Time) {
+	elapsed := int(now.Sub(w.headStart) / w.bucketSize)
+	if elapsed <= 0 {
+		return
+	}
+
+	if elapsed > len(w.buckets) {
+		elapsed = len(w.buckets)
+	}
+	for i := 0; i < elapsed; i++ {
+		w.head = (w.head + 1) % len(w.buckets)
+		w.buckets[w.head] = 0
+	}
+
+	w.headStart = now.Truncate(w.bucketSize)
+}
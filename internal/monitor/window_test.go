@@ -0,0 +1,66 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRateWindow(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newRateWindow(10*time.Minute, func() time.Time { return now })
+
+	if rate := w.rate(); rate != 0 {
+		t.Errorf("empty window: Wanted: 0 Got: %f", rate)
+	}
+
+	// 10 events during the first minute: the rate is computed over the elapsed time
+	for i := 0; i < 10; i++ {
+		w.add()
+	}
+	now = now.Add(time.Minute)
+	if rate := w.rate(); rate != 10 {
+		t.Errorf("partial window: Wanted: 10 Got: %f", rate)
+	}
+
+	// 20 more events in the middle of the window
+	now = now.Add(4 * time.Minute)
+	for i := 0; i < 20; i++ {
+		w.add()
+	}
+	now = now.Add(time.Minute)
+	if rate := w.rate(); rate != 5 {
+		t.Errorf("partial window: Wanted: 5 Got: %f", rate)
+	}
+
+	// The first events have left the window
+	now = now.Add(4 * time.Minute)
+	if rate := w.rate(); rate != 2 {
+		t.Errorf("full window: Wanted: 2 Got: %f", rate)
+	}
+
+	// Every events have left the window
+	now = now.Add(time.Hour)
+	if rate := w.rate(); rate != 0 {
+		t.Errorf("expired window: Wanted: 0 Got: %f", rate)
+	}
+	w.add()
+	if rate := w.rate(); math.Abs(rate-0.1) > 1e-9 {
+		t.Errorf("reused window: Wanted: 0.1 Got: %f", rate)
+	}
+}
+
+func TestRateWindowBuckets(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newRateWindow(time.Minute, func() time.Time { return now })
+
+	// One event per second during two minutes: only the last minute is counted
+	for i := 0; i < 120; i++ {
+		w.add()
+		now = now.Add(time.Second)
+	}
+
+	if rate := w.rate(); rate != 59 {
+		t.Errorf("Wanted: 59 Got: %f", rate)
+	}
+}
@@ -0,0 +1,283 @@
+package reaper
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const pageSize = 100
+
+// GetApp return the reaper app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-reaper",
+		Version: "0.5.0",
+		Usage:   "Trandoshan reaper process",
+		Flags: append([]cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "tor-uri",
+				Usage:    "URI to the TOR SOCKS proxy",
+				Required: true,
+			},
+			&cli.DurationFlag{
+				Name:  "max-age",
+				Usage: "Age after which a resource is checked, and deleted if its host is not reachable anymore",
+				Value: 30 * 24 * time.Hour,
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "Delay between two checks of the stale resources",
+				Value: 24 * time.Hour,
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "Delay after which an host is considered not reachable",
+				Value: 30 * time.Second,
+			},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "Number of consecutive runs an host should not be reachable for its resources to be deleted",
+				Value: 3,
+			},
+		}, api.GetClientFlags()...),
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-reaper")
+
+	log.Debug().Str("uri", ctx.String("api-uri")).Msg("Using API server")
+	log.Debug().Str("uri", ctx.String("tor-uri")).Msg("Using TOR proxy")
+
+	// Create the API client
+	apiClient, err := api.NewClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Int("max-failures") < 1 {
+		return fmt.Errorf("--max-failures should be at least 1")
+	}
+
+	r := newReaper(apiClient, newHTTPClient(ctx.String("tor-uri"), ctx.Duration("timeout")), ctx.Duration("max-age"),
+		ctx.Int("max-failures"))
+
+	log.Debug().Dur("max-age", r.maxAge).Dur("interval", ctx.Duration("interval")).Int("max-failures", r.maxFailures).
+		Msg("Reaping resources")
+	log.Info().Msg("Successfully initialized tdsh-reaper")
+
+	terminate := make(chan os.Signal, 1)
+	signal.Notify(terminate, os.Interrupt, syscall.SIGTERM)
+
+	ticker := time.NewTicker(ctx.Duration("interval"))
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.reap(); err != nil {
+			log.Err(err).Msg("Error while reaping resources")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-terminate:
+			log.Info().Msg("Stopping tdsh-reaper")
+			return nil
+		}
+	}
+}
+
+// newHTTPClient returns the client used to reach the hidden services through given TOR proxy
+func newHTTPClient(torURI string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(&url.URL{Scheme: "socks5", Host: torURI}),
+			// Disable SSL verification since we do not really care about this
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		// Any response means the host is alive: no need to follow redirects
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: timeout,
+	}
+}
+
+type reaper struct {
+	apiClient  api.Client
+	httpClient *http.Client
+	maxAge     time.Duration
+	// maxFailures is the number of consecutive runs an host should be unreachable to be reaped
+	maxFailures int
+	// failures count the consecutive runs each stale host has not been reachable. It is kept in memory:
+	// restarting the reaper only delays the deletions
+	failures map[string]int
+}
+
+func newReaper(apiClient api.Client, httpClient *http.Client, maxAge time.Duration, maxFailures int) *reaper {
+	return &reaper{
+		apiClient:   apiClient,
+		httpClient:  httpClient,
+		maxAge:      maxAge,
+		maxFailures: maxFailures,
+		failures:    map[string]int{},
+	}
+}
+
+// reap deletes the resources crawled before max-age whose host has not been reachable for max-failures
+// consecutive runs, and returns the number of deleted URLs. The run is aborted, without deleting anything,
+// if the TOR proxy cannot be reached
+func (r *reaper) reap() (int, error) {
+	endDate := time.Now().Add(-r.maxAge)
+
+	// Collect the stale URLs first since deleting them would shift the pages
+	var urls []string
+	seen := map[string]bool{}
+	cursor := ""
+	for {
+		resources, next, err := r.apiClient.SearchResourcesAfter(cursor, pageSize, api.SearchResourcesOptions{EndDate: endDate})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, resource := range resources {
+			if !seen[resource.URL] {
+				seen[resource.URL] = true
+				urls = append(urls, resource.URL)
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	log.Debug().Int("count", len(urls)).Time("end-date", endDate).Msg("Found stale URLs")
+
+	// Group the URLs by host, each host being checked once per run
+	var hosts []string
+	urlsByHost := map[string][]string{}
+	for _, rawURL := range urls {
+		u, err := parseURL(rawURL)
+		if err != nil {
+			log.Warn().Str("url", rawURL).Msg("Ignoring invalid URL")
+			continue
+		}
+
+		hostURL := fmt.Sprintf("%s://%s/", u.Scheme, u.Host)
+		if _, exists := urlsByHost[hostURL]; !exists {
+			hosts = append(hosts, hostURL)
+		}
+		urlsByHost[hostURL] = append(urlsByHost[hostURL], rawURL)
+	}
+
+	// Check every host before deleting anything, so that a proxy outage doesn't delete the first hosts checked.
+	// The hosts which are not stale anymore are forgotten
+	failures := map[string]int{}
+	for _, hostURL := range hosts {
+		alive, err := r.isReachable(hostURL)
+		if err != nil {
+			return 0, fmt.Errorf("error while reaching TOR proxy, aborting run: %s", err)
+		}
+		if !alive {
+			failures[hostURL] = r.failures[hostURL] + 1
+		}
+	}
+	r.failures = failures
+
+	deleted := 0
+	for _, hostURL := range hosts {
+		if r.failures[hostURL] < r.maxFailures {
+			if r.failures[hostURL] > 0 {
+				log.Debug().Str("host", hostURL).Int("failures", r.failures[hostURL]).Msg("Host is not reachable")
+			}
+			continue
+		}
+
+		for _, rawURL := range urlsByHost[hostURL] {
+			if err := r.apiClient.DeleteResource(api.EncodeURL(rawURL)); err != nil {
+				log.Err(err).Str("url", rawURL).Msg("Error while deleting resource")
+				continue
+			}
+
+			log.Debug().Str("url", rawURL).Msg("Deleted resource")
+			deleted++
+		}
+	}
+
+	log.Info().Int("deleted", deleted).Int("stale", len(urls)).Msg("Successfully reaped resources")
+
+	return deleted, nil
+}
+
+// isReachable returns true if given host answer to an HEAD request, whatever the status code.
+// an error is returned if the TOR proxy itself cannot be reached, the host reachability being unknown
+func (r *reaper) isReachable(hostURL string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, hostURL, nil)
+	if err != nil {
+		return false, nil
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		if isProxyError(err) {
+			return false, err
+		}
+
+		log.Debug().Str("host", hostURL).Str("err", err.Error()).Msg("Host is not reachable")
+		return false, nil
+	}
+	defer resp.Body.Close()
+
+	return true, nil
+}
+
+// isProxyError returns true if given request error is caused by the connection to the TOR proxy: the hidden
+// services being reached through the proxy, the only connection dialed directly is the one to the proxy
+func isProxyError(err error) bool {
+	for err != nil {
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) {
+			return false
+		}
+		if opErr.Op == "dial" {
+			return true
+		}
+		err = opErr.Err
+	}
+
+	return false
+}
+
+// parseURL parse given resource URL, stored without protocol
+func parseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Host == "" {
+		u, err = url.Parse("http://" + rawURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in %s", rawURL)
+	}
+
+	return u, nil
+}
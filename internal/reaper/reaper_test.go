@@ -0,0 +1,310 @@
+package reaper
+
+import (
+	"encoding/json"
+	"github.com/creekorful/trandoshan/api"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// torProxyMock is a minimal SOCKS5 proxy resolving the hidden services to local addresses
+type torProxyMock struct {
+	listener net.Listener
+	hosts    map[string]string
+
+	mutex     sync.Mutex
+	requested map[string]int
+}
+
+func newTorProxyMock(t *testing.T, hosts map[string]string) *torProxyMock {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := &torProxyMock{listener: l, hosts: hosts, requested: map[string]int{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+
+	return p
+}
+
+func (p *torProxyMock) serve(conn net.Conn) {
+	defer conn.Close()
+
+	// Greeting: VER NMETHODS METHODS, answer with no authentication required
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return
+	}
+	if _, err := conn.Write([]byte{0x05, 0x00}); err != nil {
+		return
+	}
+
+	// Request: VER CMD RSV ATYP(domain) LEN HOST PORT
+	request := make([]byte, 5)
+	if _, err := io.ReadFull(conn, request); err != nil || request[3] != 0x03 {
+		return
+	}
+	host := make([]byte, request[4]+2)
+	if _, err := io.ReadFull(conn, host); err != nil {
+		return
+	}
+	// Port is ignored since each hidden service is mapped to a single address
+	hostname := string(host[:request[4]])
+
+	p.mutex.Lock()
+	p.requested[hostname]++
+	addr, exists := p.hosts[hostname]
+	p.mutex.Unlock()
+
+	if !exists {
+		// Host unreachable
+		_, _ = conn.Write([]byte{0x05, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer target.Close()
+
+	if _, err := conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+
+	go func() { _, _ = io.Copy(target, conn) }()
+	_, _ = io.Copy(conn, target)
+}
+
+func (p *torProxyMock) requests(hostname string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.requested[hostname]
+}
+
+// apiServerMock serve the resources and record the deleted ones
+type apiServerMock struct {
+	resources []api.ResourceDto
+
+	mutex   sync.Mutex
+	endDate time.Time
+	deleted []string
+}
+
+func (m *apiServerMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/resources":
+		endDate, err := time.Parse(time.RFC3339, r.URL.Query().Get("end-date"))
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		m.endDate = endDate
+
+		var resources []api.ResourceDto
+		for _, resource := range m.resources {
+			if !resource.Time.After(endDate) {
+				resources = append(resources, resource)
+			}
+		}
+		w.Header().Set(api.PaginationCountHeader, strconv.Itoa(len(resources)))
+		_ = json.NewEncoder(w).Encode(resources)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/resources/"):
+		rawURL, err := api.DecodeURL(strings.TrimPrefix(r.URL.Path, "/v1/resources/"))
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		m.deleted = append(m.deleted, rawURL)
+
+		var resources []api.ResourceDto
+		for _, resource := range m.resources {
+			if resource.URL != rawURL {
+				resources = append(resources, resource)
+			}
+		}
+		m.resources = resources
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestReap(t *testing.T) {
+	// Alive hidden service, answering with an error code to any request
+	hiddenService := httptest.NewServer(http.NotFoundHandler())
+	defer hiddenService.Close()
+
+	proxy := newTorProxyMock(t, map[string]string{
+		"alive.onion": hiddenService.Listener.Addr().String(),
+	})
+	defer proxy.listener.Close()
+
+	old := time.Now().Add(-48 * time.Hour)
+	apiServer := &apiServerMock{
+		resources: []api.ResourceDto{
+			{URL: "http://alive.onion/index.html", Time: old},
+			{URL: "http://dead.onion/index.html", Time: old},
+			{URL: "http://dead.onion/about.html", Time: old},
+			{URL: "http://dead.onion/about.html", Time: old.Add(time.Minute)},
+			{URL: "alive.onion/no-protocol.html", Time: old},
+			{URL: "gone.onion/no-protocol.html", Time: old},
+			{URL: "http://recent.onion", Time: time.Now()},
+		},
+	}
+	srv := httptest.NewServer(apiServer)
+	defer srv.Close()
+
+	r := newReaper(api.NewClient(srv.URL), newHTTPClient(proxy.listener.Addr().String(), time.Second),
+		24*time.Hour, 1)
+
+	deleted, err := r.reap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Errorf("Wanted: 3 Got: %d", deleted)
+	}
+
+	if apiServer.endDate.After(time.Now().Add(-24*time.Hour)) || apiServer.endDate.Before(time.Now().Add(-25*time.Hour)) {
+		t.Errorf("invalid end date %s", apiServer.endDate)
+	}
+
+	want := []string{"http://dead.onion/index.html", "http://dead.onion/about.html", "gone.onion/no-protocol.html"}
+	if len(apiServer.deleted) != len(want) {
+		t.Fatalf("Wanted: %v Got: %v", want, apiServer.deleted)
+	}
+	for i := range want {
+		if apiServer.deleted[i] != want[i] {
+			t.Errorf("Wanted: %v Got: %v", want, apiServer.deleted)
+			break
+		}
+	}
+
+	// Each host should be checked once, recent ones not at all
+	if n := proxy.requests("dead.onion"); n != 1 {
+		t.Errorf("dead.onion: Wanted: 1 Got: %d", n)
+	}
+	if n := proxy.requests("alive.onion"); n != 1 {
+		t.Errorf("alive.onion: Wanted: 1 Got: %d", n)
+	}
+	if n := proxy.requests("recent.onion"); n != 0 {
+		t.Errorf("recent.onion: Wanted: 0 Got: %d", n)
+	}
+}
+
+func TestReapAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	r := newReaper(api.NewClient(srv.URL), newHTTPClient("127.0.0.1:0", time.Second), 24*time.Hour, 1)
+
+	if _, err := r.reap(); err == nil {
+		t.Error("API error should be returned")
+	}
+}
+
+func TestReapConsecutiveFailures(t *testing.T) {
+	hiddenService := httptest.NewServer(http.NotFoundHandler())
+	defer hiddenService.Close()
+
+	hosts := map[string]string{"flaky.onion": hiddenService.Listener.Addr().String()}
+	proxy := newTorProxyMock(t, hosts)
+	defer proxy.listener.Close()
+
+	old := time.Now().Add(-48 * time.Hour)
+	apiServer := &apiServerMock{
+		resources: []api.ResourceDto{
+			{URL: "http://dead.onion/index.html", Time: old},
+			{URL: "http://flaky.onion/index.html", Time: old},
+		},
+	}
+	srv := httptest.NewServer(apiServer)
+	defer srv.Close()
+
+	r := newReaper(api.NewClient(srv.URL), newHTTPClient(proxy.listener.Addr().String(), time.Second),
+		24*time.Hour, 2)
+
+	// flaky.onion is down during the first run only
+	proxy.mutex.Lock()
+	delete(hosts, "flaky.onion")
+	proxy.mutex.Unlock()
+
+	for run, wanted := range []int{0, 1, 0} {
+		deleted, err := r.reap()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != wanted {
+			t.Errorf("run %d: Wanted: %d Got: %d", run, wanted, deleted)
+		}
+
+		proxy.mutex.Lock()
+		hosts["flaky.onion"] = hiddenService.Listener.Addr().String()
+		proxy.mutex.Unlock()
+	}
+
+	if len(apiServer.deleted) != 1 || apiServer.deleted[0] != "http://dead.onion/index.html" {
+		t.Errorf("Wanted: [http://dead.onion/index.html] Got: %v", apiServer.deleted)
+	}
+	if r.failures["http://flaky.onion/"] != 0 {
+		t.Errorf("flaky.onion failures should have been reset, Got: %d", r.failures["http://flaky.onion/"])
+	}
+}
+
+func TestReapProxyDown(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	apiServer := &apiServerMock{
+		resources: []api.ResourceDto{
+			{URL: "http://alive.onion/index.html", Time: old},
+			{URL: "http://other.onion/index.html", Time: old},
+		},
+	}
+	srv := httptest.NewServer(apiServer)
+	defer srv.Close()
+
+	// Nothing listening on the proxy address
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+	proxyAddr := l.Addr().String()
+	_ = l.Close()
+
+	r := newReaper(api.NewClient(srv.URL), newHTTPClient(proxyAddr, time.Second), 24*time.Hour, 1)
+	if _, err := r.reap(); err == nil {
+		t.Error("proxy error should be returned")
+	}
+
+	if len(apiServer.deleted) != 0 {
+		t.Errorf("Nothing should have been deleted, Got: %v", apiServer.deleted)
+	}
+	if len(r.failures) != 0 {
+		t.Errorf("Failures should not have been counted, Got: %v", r.failures)
+	}
+}
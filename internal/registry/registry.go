@@ -0,0 +1,205 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// timeoutFactor is the number of heartbeat intervals after which a silent instance is considered dead
+const timeoutFactor = 3
+
+// GetApp return the registry app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-registry",
+		Version: "0.5.0",
+		Usage:   "Trandoshan registry process",
+		Flags: []cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:     "nats-uri",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
+				Required: true,
+			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.StringFlag{
+				Name:  "listen-addr",
+				Usage: "Address on which to expose the live services",
+				Value: ":8082",
+			},
+		},
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-registry")
+
+	// The services are expected to use the same interval
+	interval := ctx.Duration("heartbeat-interval")
+	if interval <= 0 {
+		return fmt.Errorf("--heartbeat-interval should be positive")
+	}
+
+	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
+
+	// Create the NATS subscriber
+	sub, err := natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	defer heartbeat.Start(ctx, sub)()
+
+	r := newRegistry(timeoutFactor*interval, time.Now)
+	log.Debug().Stringer("timeout", r.timeout).Msg("Tracking live services")
+
+	addr := ctx.String("listen-addr")
+	go func() {
+		if err := http.ListenAndServe(addr, r.handler()); err != nil {
+			log.Err(err).Str("addr", addr).Msg("Error while serving live services")
+		}
+	}()
+
+	log.Info().Str("addr", addr).Msg("Successfully initialized tdsh-registry. Waiting for heartbeats")
+
+	// Every registry should receive every heartbeat: no queue group
+	if err := sub.QueueSubscribe(messaging.HeartbeatSubject, "", handleMessage(r)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// handleMessage returns the handler recording the received heartbeats
+func handleMessage(r *registry) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		var hbMsg messaging.HeartbeatMsg
+		if err := natsutil.ReadMsg(msg, &hbMsg); err != nil {
+			log.Err(err).Msg("Error while reading message")
+			return err
+		}
+
+		r.record(hbMsg)
+		return nil
+	}
+}
+
+// instance is a running instance of a service
+type instance struct {
+	Service  string `json:"service"`
+	Version  string `json:"version"`
+	Hostname string `json:"hostname"`
+	PID      int    `json:"pid"`
+	// LastSeen is the time at which the last heartbeat of the instance has been received
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// registry keep track of the live service instances
+type registry struct {
+	// timeout is the delay after which an instance not sending heartbeats is considered dead
+	timeout   time.Duration
+	instances map[string]instance
+	mutex     sync.Mutex
+	now       func() time.Time
+}
+
+func newRegistry(timeout time.Duration, now func() time.Time) *registry {
+	return &registry{
+		timeout:   timeout,
+		instances: map[string]instance{},
+		now:       now,
+	}
+}
+
+// record given heartbeat. The receiving time is used rather than the heartbeat timestamp so that the clocks of the
+// hosts don't need to be synchronized
+func (r *registry) record(msg messaging.HeartbeatMsg) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := fmt.Sprintf("%s/%s/%d", msg.Service, msg.Hostname, msg.PID)
+	if _, exists := r.instances[key]; !exists {
+		log.Info().Str("service", msg.Service).Str("hostname", msg.Hostname).Int("pid", msg.PID).Msg("New service instance")
+	}
+
+	r.instances[key] = instance{
+		Service:  msg.Service,
+		Version:  msg.Version,
+		Hostname: msg.Hostname,
+		PID:      msg.PID,
+		LastSeen: r.now(),
+	}
+}
+
+// live returns the instances which have sent an heartbeat within the timeout, sorted by service, hostname & PID.
+// the dead ones are forgotten
+func (r *registry) live() []instance {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+	instances := []instance{}
+	for key, inst := range r.instances {
+		if now.Sub(inst.LastSeen) > r.timeout {
+			log.Info().Str("service", inst.Service).Str("hostname", inst.Hostname).Int("pid", inst.PID).
+				Msg("Service instance is dead")
+			delete(r.instances, key)
+			continue
+		}
+		instances = append(instances, inst)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Service != instances[j].Service {
+			return instances[i].Service < instances[j].Service
+		}
+		if instances[i].Hostname != instances[j].Hostname {
+			return instances[i].Hostname < instances[j].Hostname
+		}
+		return instances[i].PID < instances[j].PID
+	})
+
+	return instances
+}
+
+func (r *registry) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/services", r.listServices)
+
+	return mux
+}
+
+// listServices returns the live service instances
+func (r *registry) listServices(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(r.live()); err != nil {
+		log.Err(err).Msg("Error while writing live services")
+	}
+}
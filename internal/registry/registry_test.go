@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func heartbeatMsg(t *testing.T, msg messaging.HeartbeatMsg) *nats.Msg {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &nats.Msg{Data: b}
+}
+
+func TestRegistryExpiry(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := newRegistry(90*time.Second, func() time.Time { return now })
+	handler := handleMessage(r)
+
+	crawler := messaging.HeartbeatMsg{Service: "tdsh-crawler", Hostname: "host1", PID: 1}
+	scheduler := messaging.HeartbeatMsg{Service: "tdsh-scheduler", Hostname: "host1", PID: 2}
+	for _, msg := range []messaging.HeartbeatMsg{scheduler, crawler} {
+		if err := handler(context.Background(), nil, heartbeatMsg(t, msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if live := r.live(); len(live) != 2 || live[0].Service != "tdsh-crawler" || live[1].Service != "tdsh-scheduler" {
+		t.Errorf("unexpected live instances: %+v", live)
+	}
+
+	// Heartbeats received within the timeout keep the crawler alive
+	now = now.Add(60 * time.Second)
+	if err := handler(context.Background(), nil, heartbeatMsg(t, crawler)); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(30 * time.Second)
+	if live := r.live(); len(live) != 2 {
+		t.Errorf("Wanted: 2 live instances Got: %+v", live)
+	}
+
+	// Scheduler has not been seen for more than the timeout
+	now = now.Add(time.Second)
+	live := r.live()
+	if len(live) != 1 || live[0].Service != "tdsh-crawler" {
+		t.Errorf("Wanted: only tdsh-crawler Got: %+v", live)
+	}
+	if !live[0].LastSeen.Equal(now.Add(-31 * time.Second)) {
+		t.Errorf("unexpected last seen time: %s", live[0].LastSeen)
+	}
+
+	// Then the crawler
+	now = now.Add(time.Minute)
+	if live := r.live(); len(live) != 0 {
+		t.Errorf("Wanted: no live instance Got: %+v", live)
+	}
+	if len(r.instances) != 0 {
+		t.Error("dead instances should be forgotten")
+	}
+
+	// Restarted instance
+	if err := handler(context.Background(), nil, heartbeatMsg(t, scheduler)); err != nil {
+		t.Fatal(err)
+	}
+	if live := r.live(); len(live) != 1 || live[0].Service != "tdsh-scheduler" {
+		t.Errorf("Wanted: only tdsh-scheduler Got: %+v", live)
+	}
+}
+
+func TestRegistryInstances(t *testing.T) {
+	r := newRegistry(time.Minute, time.Now)
+
+	// Instances of the same service are told apart by hostname & PID
+	r.record(messaging.HeartbeatMsg{Service: "tdsh-crawler", Hostname: "host2", PID: 1})
+	r.record(messaging.HeartbeatMsg{Service: "tdsh-crawler", Hostname: "host1", PID: 2})
+	r.record(messaging.HeartbeatMsg{Service: "tdsh-crawler", Hostname: "host1", PID: 1, Version: "0.4.0"})
+	r.record(messaging.HeartbeatMsg{Service: "tdsh-crawler", Hostname: "host1", PID: 1, Version: "0.5.0"})
+
+	live := r.live()
+	if len(live) != 3 {
+		t.Fatalf("Wanted: 3 live instances Got: %+v", live)
+	}
+	if live[0].Hostname != "host1" || live[0].PID != 1 || live[0].Version != "0.5.0" ||
+		live[1].Hostname != "host1" || live[1].PID != 2 || live[2].Hostname != "host2" {
+		t.Errorf("unexpected live instances: %+v", live)
+	}
+}
+
+func TestListServices(t *testing.T) {
+	r := newRegistry(time.Minute, time.Now)
+	r.record(messaging.HeartbeatMsg{Service: "tdsh-crawler", Version: "0.5.0", Hostname: "host1", PID: 42})
+
+	srv := httptest.NewServer(r.handler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/v1/services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var instances []instance
+	if err := json.NewDecoder(res.Body).Decode(&instances); err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].Service != "tdsh-crawler" || instances[0].Version != "0.5.0" ||
+		instances[0].Hostname != "host1" || instances[0].PID != 42 || instances[0].LastSeen.IsZero() {
+		t.Errorf("unexpected instances: %+v", instances)
+	}
+
+	res, err = http.Post(srv.URL+"/v1/services", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Wanted: 405 Got: %d", res.StatusCode)
+	}
+}
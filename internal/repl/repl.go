@@ -0,0 +1,337 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/chzyer/readline"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/trandoshanctl"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	"github.com/urfave/cli/v2"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	prompt = "tdsh> "
+	// hostsPageSize is the number of hosts listed per page
+	hostsPageSize = 20
+)
+
+var (
+	// protocolRegex match the protocol removed from the URLs of the resources by the extractor
+	protocolRegex = regexp.MustCompile("https?://")
+
+	// errExit is returned by the command leaving the shell
+	errExit = errors.New("exit")
+)
+
+// GetApp returns the Trandoshan interactive shell app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-cli",
+		Version: "0.5.0",
+		Usage:   "Trandoshan interactive shell",
+		Flags: append([]cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:  "history-file",
+				Usage: "Path to the file where the command history is kept (default: ~/.tdsh_history)",
+			},
+		}, api.GetLocalClientFlags()...),
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	apiClient, err := api.NewClientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	s := newShell(apiClient, os.Stdout)
+
+	// Commands piped to the shell are run without prompt
+	if !readline.IsTerminal(int(os.Stdin.Fd())) {
+		return s.run(newLineReader(os.Stdin))
+	}
+
+	historyFile := ctx.String("history-file")
+	if historyFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			historyFile = filepath.Join(home, ".tdsh_history")
+		}
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          prompt,
+		HistoryFile:     historyFile,
+		AutoComplete:    s.completer(),
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	fmt.Fprintf(s.out, "Connected to %s. Type help to list the commands.\n", ctx.String("api-uri"))
+
+	return s.run(rl)
+}
+
+// lineReader read the commands typed by the user
+type lineReader interface {
+	// Readline returns the next line, io.EOF once done or readline.ErrInterrupt on Ctrl-C
+	Readline() (string, error)
+}
+
+// scannerReader read the commands line by line from a non interactive input
+type scannerReader struct {
+	scanner *bufio.Scanner
+}
+
+func newLineReader(in io.Reader) lineReader {
+	return &scannerReader{scanner: bufio.NewScanner(in)}
+}
+
+func (sr *scannerReader) Readline() (string, error) {
+	if !sr.scanner.Scan() {
+		if err := sr.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return sr.scanner.Text(), nil
+}
+
+// command is a command available in the shell
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(args []string) error
+}
+
+// shell run the commands typed by the user against the API
+type shell struct {
+	apiClient api.Client
+	out       io.Writer
+	commands  []command
+}
+
+func newShell(apiClient api.Client, out io.Writer) *shell {
+	s := &shell{apiClient: apiClient, out: out}
+	s.commands = []command{
+		{"search", "<keywords>", "Search the resources containing given keywords", s.search},
+		{"get", "<url>", "Display the last crawled resource of given URL", s.get},
+		{"hosts", "[page]", "List the crawled hosts, sorted by name", s.hosts},
+		{"stats", "", "Display the crawl statistics", s.stats},
+		{"schedule", "<url>", "Schedule crawling for given URL", s.schedule},
+		{"help", "", "List the commands", s.help},
+		{"exit", "", "Leave the shell", func(args []string) error { return errExit }},
+	}
+
+	return s
+}
+
+// completer returns the completion of the command names
+func (s *shell) completer() readline.AutoCompleter {
+	var items []readline.PrefixCompleterInterface
+	for _, cmd := range s.commands {
+		items = append(items, readline.PcItem(cmd.name))
+	}
+
+	return readline.NewPrefixCompleter(items...)
+}
+
+// run execute the commands read from given reader until exit or the end of the input.
+// the errors of the commands are displayed and don't stop the shell
+func (s *shell) run(in lineReader) error {
+	for {
+		line, err := in.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.exec(line); err == errExit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(s.out, "Error: %s\n", err)
+		}
+	}
+}
+
+// exec run given command line
+func (s *shell) exec(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	for _, cmd := range s.commands {
+		if cmd.name == fields[0] {
+			return cmd.run(fields[1:])
+		}
+	}
+
+	return fmt.Errorf("unknown command %s (type help to list the commands)", fields[0])
+}
+
+func (s *shell) search(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: search <keywords>")
+	}
+
+	res, count, err := s.apiClient.Search(api.NewFilter().Keywords(strings.Join(args, " ")))
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		fmt.Fprintln(s.out, "No resources crawled (yet).")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tSTATUS\tCRAWLED\tTITLE")
+	for _, r := range res {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.URL, statusCode(r.ResponseCode), r.Time.Format(time.RFC3339), r.Title)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "\nTotal: %d\n", count)
+	return nil
+}
+
+func (s *shell) get(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: get <url>")
+	}
+
+	url := protocolRegex.ReplaceAllLiteralString(args[0], "")
+	r, err := s.apiClient.GetResource(api.EncodeURL(url))
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		fmt.Fprintf(s.out, "%s has not been crawled (yet).\n", args[0])
+		return nil
+	}
+
+	w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "URL\t%s\n", r.URL)
+	fmt.Fprintf(w, "Title\t%s\n", r.Title)
+	fmt.Fprintf(w, "Status\t%s\n", statusCode(r.ResponseCode))
+	fmt.Fprintf(w, "Crawled\t%s\n", r.Time.Format(time.RFC3339))
+	fmt.Fprintf(w, "Language\t%s\n", valueOrUnknown(r.Language))
+	fmt.Fprintf(w, "Source\t%s\n", valueOrUnknown(r.Source))
+	if r.BodyURL != "" {
+		fmt.Fprintf(w, "Body\tarchived at %s\n", r.BodyURL)
+	} else if r.Truncated {
+		fmt.Fprintf(w, "Body\t%d bytes (truncated)\n", len(r.Body))
+	} else {
+		fmt.Fprintf(w, "Body\t%d bytes\n", len(r.Body))
+	}
+
+	return w.Flush()
+}
+
+func (s *shell) hosts(args []string) error {
+	page := 1
+	if len(args) > 0 {
+		p, err := strconv.Atoi(args[0])
+		if err != nil || p < 1 {
+			return fmt.Errorf("usage: hosts [page]")
+		}
+		page = p
+	}
+
+	hosts, count, err := s.apiClient.ListHosts(page, hostsPageSize)
+	if err != nil {
+		return err
+	}
+
+	if len(hosts) == 0 {
+		fmt.Fprintln(s.out, "No hosts crawled (yet).")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tRESOURCES\tLAST CRAWLED")
+	for _, h := range hosts {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", h.Host, h.ResourceCount, h.LastCrawled.Format(time.RFC3339))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	pages := (count + hostsPageSize - 1) / hostsPageSize
+	fmt.Fprintf(s.out, "\nPage %d/%d (%d hosts)\n", page, pages, count)
+	return nil
+}
+
+func (s *shell) stats(args []string) error {
+	stats, err := s.apiClient.GetStats()
+	if err != nil {
+		return err
+	}
+
+	return trandoshanctl.PrintStats(s.out, stats)
+}
+
+func (s *shell) schedule(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: schedule <url>")
+	}
+
+	if err := s.apiClient.ScheduleURL(args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "Scheduled crawling for %s\n", args[0])
+	return nil
+}
+
+func (s *shell) help(args []string) error {
+	w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	for _, cmd := range s.commands {
+		fmt.Fprintf(w, "%s\t%s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.usage)
+	}
+
+	return w.Flush()
+}
+
+// statusCode format given HTTP status code (0 for the resources crawled by older crawlers)
+func statusCode(code int) string {
+	if code == 0 {
+		return "-"
+	}
+	return strconv.Itoa(code)
+}
+
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
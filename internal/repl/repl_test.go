@@ -0,0 +1,207 @@
+package repl
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/chzyer/readline"
+	"github.com/creekorful/trandoshan/api"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAPIServer returns a fake API server knowing a single resource
+func newAPIServer(t *testing.T) *httptest.Server {
+	crawled := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	resource := api.ResourceDto{
+		URL:          "example.onion/index.html",
+		Title:        "Example",
+		Body:         "<html>Hello</html>",
+		Time:         crawled,
+		Language:     "en",
+		ResponseCode: 200,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/resources", func(w http.ResponseWriter, r *http.Request) {
+		var res []api.ResourceDto
+		if r.URL.Query().Get("keyword") == "hello world" {
+			res = append(res, resource)
+		}
+
+		w.Header().Set(api.PaginationCountHeader, "1")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	mux.HandleFunc("/v1/resources/", func(w http.ResponseWriter, r *http.Request) {
+		b64URL := strings.TrimPrefix(r.URL.Path, "/v1/resources/")
+		if b64URL != api.EncodeURL("example.onion/index.html") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(resource)
+	})
+	mux.HandleFunc("/v1/hosts", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "2" || r.URL.Query().Get("size") != "20" {
+			t.Errorf("unexpected hosts request: %s", r.URL)
+		}
+
+		w.Header().Set(api.PaginationCountHeader, "21")
+		_ = json.NewEncoder(w).Encode([]api.HostDto{{Host: "example.onion", ResourceCount: 3, LastCrawled: crawled}})
+	})
+	mux.HandleFunc("/v1/stats", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(api.StatsDto{ResourceCount: 3, HostCount: 1})
+	})
+	mux.HandleFunc("/v1/urls", func(w http.ResponseWriter, r *http.Request) {
+		var url string
+		if err := json.NewDecoder(r.Body).Decode(&url); err != nil || url != "http://example.onion" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestShell(t *testing.T) {
+	srv := newAPIServer(t)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"search hello world", `URL                       STATUS  CRAWLED               TITLE
+example.onion/index.html  200     2021-03-01T12:00:00Z  Example
+
+Total: 1
+`},
+		{"search nothing", "No resources crawled (yet).\n"},
+		{"search", "Error: usage: search <keywords>\n"},
+		{"get https://example.onion/index.html", `URL       example.onion/index.html
+Title     Example
+Status    200
+Crawled   2021-03-01T12:00:00Z
+Language  en
+Source    unknown
+Body      18 bytes
+`},
+		{"get http://unknown.onion", "http://unknown.onion has not been crawled (yet).\n"},
+		{"hosts 2", `HOST           RESOURCES  LAST CRAWLED
+example.onion  3          2021-03-01T12:00:00Z
+
+Page 2/2 (21 hosts)
+`},
+		{"hosts zero", "Error: usage: hosts [page]\n"},
+		{"stats", "Resources             3\nHosts                 1\nResources (last 24h)  0\n" +
+			"Resources (last 7d)   0\nResources (last 30d)  0\nAverage body size     0 bytes\n"},
+		{"schedule http://example.onion", "Scheduled crawling for http://example.onion\n"},
+		{"schedule ftp://example.onion", "Error: unexpected status code 400\n"},
+		{"unknown", "Error: unknown command unknown (type help to list the commands)\n"},
+		{"  ", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			var out bytes.Buffer
+			s := newShell(api.NewClient(srv.URL), &out)
+
+			if err := s.run(newLineReader(strings.NewReader(test.input + "\n"))); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("Wanted: %q Got: %q", test.want, out.String())
+			}
+		})
+	}
+}
+
+func TestShellSession(t *testing.T) {
+	srv := newAPIServer(t)
+
+	var out bytes.Buffer
+	s := newShell(api.NewClient(srv.URL), &out)
+
+	// Errors don't stop the session, exit does
+	input := "unknown\nschedule http://example.onion\nexit\nschedule http://example.onion\n"
+	if err := s.run(newLineReader(strings.NewReader(input))); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Error: unknown command unknown (type help to list the commands)\n" +
+		"Scheduled crawling for http://example.onion\n"
+	if out.String() != want {
+		t.Errorf("Wanted: %q Got: %q", want, out.String())
+	}
+}
+
+// interruptReader returns an interruption before the lines of the wrapped reader
+type interruptReader struct {
+	lineReader
+	interrupted bool
+}
+
+func (ir *interruptReader) Readline() (string, error) {
+	if !ir.interrupted {
+		ir.interrupted = true
+		return "", readline.ErrInterrupt
+	}
+	return ir.lineReader.Readline()
+}
+
+func TestShellInterrupt(t *testing.T) {
+	var out bytes.Buffer
+	s := newShell(api.NewClient("http://localhost"), &out)
+
+	if err := s.run(&interruptReader{lineReader: newLineReader(strings.NewReader("help\n"))}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "search <keywords>") {
+		t.Errorf("the session should continue after an interruption, got: %s", out.String())
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	completer := newShell(nil, ioutil.Discard).completer()
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"s", []string{"earch ", "tats ", "chedule "}},
+		{"ho", []string{"sts "}},
+		{"x", nil},
+	}
+
+	for _, test := range tests {
+		candidates, _ := completer.Do([]rune(test.line), len(test.line))
+
+		var got []string
+		for _, c := range candidates {
+			got = append(got, string(c))
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: Wanted: %v Got: %v", test.line, test.want, got)
+		}
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	r := newLineReader(strings.NewReader("stats\nhosts 2"))
+
+	for _, want := range []string{"stats", "hosts 2"} {
+		line, err := r.Readline()
+		if err != nil || line != want {
+			t.Errorf("Wanted: %s Got: %s (%v)", want, line, err)
+		}
+	}
+	if _, err := r.Readline(); err != io.EOF {
+		t.Errorf("Wanted: EOF Got: %v", err)
+	}
+}
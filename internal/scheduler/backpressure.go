@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// crawlersQueue is the queue (JetStream durable consumer) of the crawlers reading url.todo
+const crawlersQueue = "crawlers"
+
+// backPressure delay the publication of the scheduled URLs while too many of them are waiting to be crawled,
+// preventing url.todo from growing unbounded when URLs are scheduled faster than they are crawled
+type backPressure struct {
+	// queueDepth returns the number of URLs waiting to be crawled
+	queueDepth func() (int64, error)
+	maxDepth   int64
+	delay      time.Duration
+}
+
+// wait block until the queue depth is below the maximum, checking it again every delay.
+// the URLs are not held back if the depth cannot be read
+func (bp *backPressure) wait(ctx context.Context, logger zerolog.Logger) error {
+	for {
+		depth, err := bp.queueDepth()
+		if err != nil {
+			schedulerErrors.WithLabelValues(errorKindQueueDepth).Inc()
+			logger.Warn().Str("err", err.Error()).Msg("Error while reading queue depth")
+			return nil
+		}
+		if depth < bp.maxDepth {
+			return nil
+		}
+
+		backPressureWaits.Inc()
+		logger.Debug().Int64("depth", depth).Int64("max", bp.maxDepth).Stringer("delay", bp.delay).
+			Msg("Queue is full, backing off")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(bp.delay):
+		}
+	}
+}
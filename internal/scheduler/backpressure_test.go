@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"testing"
+	"time"
+)
+
+func TestHandleMessageBackPressure(t *testing.T) {
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	var published []string
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		published = append(published, msg.(*messaging.URLTodoMsg).URL)
+		return nil
+	}
+
+	// The queue is full twice before the crawlers catch up
+	depths := []int64{150, 100, 99}
+	checks := 0
+	bp := &backPressure{
+		queueDepth: func() (int64, error) {
+			depth := depths[checks]
+			checks++
+			return depth, nil
+		},
+		maxDepth: 100,
+		delay:    20 * time.Millisecond,
+	}
+
+	waits := testutil.ToFloat64(backPressureWaits)
+	start := time.Now()
+
+	handler := newScheduler(apiClient, withPublisher(publisher), withBackPressure(bp)).handleMessage
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(published) != 1 || published[0] != "http://example.onion" {
+		t.Errorf("Wanted: [http://example.onion] Got: %v", published)
+	}
+	if checks != 3 {
+		t.Errorf("Wanted: 3 Got: %d", checks)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Scheduler should have backed off twice, took %s", elapsed)
+	}
+	if testutil.ToFloat64(backPressureWaits) != waits+2 {
+		t.Errorf("Wanted: %f Got: %f", waits+2, testutil.ToFloat64(backPressureWaits))
+	}
+}
+
+func TestBackPressureWait(t *testing.T) {
+	full := &backPressure{
+		queueDepth: func() (int64, error) { return 100, nil },
+		maxDepth:   100,
+		delay:      time.Hour,
+	}
+
+	// Blocks until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := full.wait(ctx, zerolog.Nop()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wanted: %v Got: %v", context.DeadlineExceeded, err)
+	}
+
+	// The URLs are not held back when the depth cannot be read
+	failing := &backPressure{
+		queueDepth: func() (int64, error) { return 0, errors.New("no responders available for request") },
+		maxDepth:   100,
+		delay:      time.Hour,
+	}
+	if err := failing.wait(context.Background(), zerolog.Nop()); err != nil {
+		t.Errorf("Wanted: nil Got: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"github.com/creekorful/trandoshan/api"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// searchBatcher accumulate resources searches in order to perform them using a single bulk API call.
+// a batch is sent once size searches are pending, or timeout after the first pending search
+type searchBatcher struct {
+	apiClient api.Client
+	size      int
+	timeout   time.Duration
+
+	// pending searches, grouped by refresh delay since they share the same date range
+	pending map[time.Duration][]*searchRequest
+	count   int
+	timer   *time.Timer
+	mutex   sync.Mutex
+}
+
+type searchRequest struct {
+	url    string
+	result chan searchResult
+}
+
+type searchResult struct {
+	resources []api.ResourceDto
+	err       error
+}
+
+func newSearchBatcher(apiClient api.Client, size int, timeout time.Duration) *searchBatcher {
+	return &searchBatcher{
+		apiClient: apiClient,
+		size:      size,
+		timeout:   timeout,
+		pending:   map[time.Duration][]*searchRequest{},
+	}
+}
+
+// search returns the resources matching given base64 encoded URL, crawled after now-delay
+// (-1 means no date restriction). the call blocks until the batch containing the search is sent
+func (sb *searchBatcher) search(b64URL string, delay time.Duration) ([]api.ResourceDto, error) {
+	req := &searchRequest{
+		url:    b64URL,
+		result: make(chan searchResult, 1),
+	}
+
+	sb.mutex.Lock()
+	sb.pending[delay] = append(sb.pending[delay], req)
+	sb.count++
+
+	if sb.count >= sb.size {
+		batch := sb.take()
+		sb.mutex.Unlock()
+		sb.send(batch)
+	} else {
+		if sb.timer == nil {
+			sb.timer = time.AfterFunc(sb.timeout, sb.flush)
+		}
+		sb.mutex.Unlock()
+	}
+
+	res := <-req.result
+	return res.resources, res.err
+}
+
+// flush send the pending searches
+func (sb *searchBatcher) flush() {
+	sb.mutex.Lock()
+	batch := sb.take()
+	sb.mutex.Unlock()
+
+	sb.send(batch)
+}
+
+// take returns the pending searches and reset the batch. mutex must be held
+func (sb *searchBatcher) take() map[time.Duration][]*searchRequest {
+	if sb.timer != nil {
+		sb.timer.Stop()
+		sb.timer = nil
+	}
+
+	batch := sb.pending
+	sb.pending = map[time.Duration][]*searchRequest{}
+	sb.count = 0
+
+	return batch
+}
+
+func (sb *searchBatcher) send(batch map[time.Duration][]*searchRequest) {
+	for delay, requests := range batch {
+		startDate := time.Time{}
+		if delay != -1 {
+			startDate = time.Now().Add(-delay)
+		}
+
+		urls := make([]string, len(requests))
+		for i, req := range requests {
+			urls[i] = req.url
+		}
+
+		log.Debug().Int("size", len(urls)).Msg("Sending bulk search")
+		resources, err := sb.apiClient.SearchResourcesBulk(urls, startDate, time.Time{})
+
+		for _, req := range requests {
+			req.result <- searchResult{resources: resources[req.url], err: err}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSearchBatcherSize(t *testing.T) {
+	var calls [][]string
+	var mutex sync.Mutex
+
+	apiClient := &apiClientMock{
+		searchResourcesBulk: func(urls []string, startDate, endDate time.Time) (map[string][]api.ResourceDto, error) {
+			mutex.Lock()
+			calls = append(calls, urls)
+			mutex.Unlock()
+
+			return map[string][]api.ResourceDto{"crawled": {{URL: "crawled"}}}, nil
+		},
+	}
+
+	// Long timeout: batch should be sent because of its size
+	sb := newSearchBatcher(apiClient, 3, time.Hour)
+
+	results := make([][]api.ResourceDto, 3)
+	var wg sync.WaitGroup
+	for i, u := range []string{"a", "crawled", "b"} {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			res, err := sb.search(u, -1)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = res
+		}(i, u)
+	}
+	wg.Wait()
+
+	if len(calls) != 1 || len(calls[0]) != 3 {
+		t.Fatalf("expected a single bulk call with 3 URLs, got %v", calls)
+	}
+
+	if len(results[0]) != 0 || len(results[1]) != 1 || len(results[2]) != 0 {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
+
+func TestSearchBatcherTimeout(t *testing.T) {
+	calls := 0
+	apiClient := &apiClientMock{
+		searchResourcesBulk: func(urls []string, startDate, endDate time.Time) (map[string][]api.ResourceDto, error) {
+			calls++
+			if len(urls) != 1 || urls[0] != "a" {
+				t.Errorf("unexpected urls: %v", urls)
+			}
+			return map[string][]api.ResourceDto{}, nil
+		},
+	}
+
+	sb := newSearchBatcher(apiClient, 10, 50*time.Millisecond)
+
+	start := time.Now()
+	if _, err := sb.search("a", -1); err != nil {
+		t.FailNow()
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("batch sent before timeout (elapsed: %s)", elapsed)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single bulk call, got %d", calls)
+	}
+}
+
+func TestSearchBatcherDelays(t *testing.T) {
+	startDates := map[string]time.Time{}
+	var mutex sync.Mutex
+
+	apiClient := &apiClientMock{
+		searchResourcesBulk: func(urls []string, startDate, endDate time.Time) (map[string][]api.ResourceDto, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, u := range urls {
+				startDates[u] = startDate
+			}
+			return nil, nil
+		},
+	}
+
+	sb := newSearchBatcher(apiClient, 2, time.Hour)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = sb.search("never", -1)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = sb.search("hourly", time.Hour)
+	}()
+	wg.Wait()
+
+	if !startDates["never"].IsZero() {
+		t.Error("no start date should be set when refresh is disabled")
+	}
+	if d := time.Since(startDates["hourly"]); d < time.Hour || d > time.Hour+time.Minute {
+		t.Errorf("wrong start date: %s", startDates["hourly"])
+	}
+}
+
+func TestSearchBatcherError(t *testing.T) {
+	apiClient := &apiClientMock{
+		searchResourcesBulk: func(urls []string, startDate, endDate time.Time) (map[string][]api.ResourceDto, error) {
+			return nil, fmt.Errorf("API unavailable")
+		},
+	}
+
+	sb := newSearchBatcher(apiClient, 1, time.Hour)
+	if _, err := sb.search("a", -1); err == nil {
+		t.Error("error should be returned to the caller")
+	}
+}
@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"github.com/bits-and-blooms/bloom/v3"
+	"sync"
+)
+
+// bloomFilter remember the URLs known to be crawled using a fixed amount of memory.
+// A miss means the URL has never been added, a hit means it probably was (false positives are possible)
+type bloomFilter struct {
+	filter *bloom.BloomFilter
+	mutex  sync.RWMutex
+}
+
+// newBloomFilter returns a bloom filter sized to hold given number of URLs with given false-positive rate
+func newBloomFilter(capacity uint, fpRate float64) *bloomFilter {
+	return &bloomFilter{filter: bloom.NewWithEstimates(capacity, fpRate)}
+}
+
+// test returns true if given URL has probably been added
+func (bf *bloomFilter) test(url string) bool {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	return bf.filter.TestString(url)
+}
+
+func (bf *bloomFilter) add(url string) {
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+
+	bf.filter.AddString(url)
+}
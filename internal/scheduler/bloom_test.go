@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const capacity = 10000
+
+	for _, fpRate := range []float64{0.01, 0.001} {
+		bf := newBloomFilter(capacity, fpRate)
+		for i := 0; i < capacity; i++ {
+			bf.add(fmt.Sprintf("http://%d.onion/index.html", i))
+		}
+
+		// No false negatives
+		for i := 0; i < capacity; i++ {
+			if !bf.test(fmt.Sprintf("http://%d.onion/index.html", i)) {
+				t.Fatalf("added URL %d should be found", i)
+			}
+		}
+
+		// False positives within bound (with a margin since the rate is an estimation)
+		const tested = 100000
+		falsePositives := 0
+		for i := 0; i < tested; i++ {
+			if bf.test(fmt.Sprintf("http://%d.onion/other.html", i)) {
+				falsePositives++
+			}
+		}
+		if rate := float64(falsePositives) / tested; rate > fpRate*1.5 {
+			t.Errorf("false-positive rate %f exceeds configured %f", rate, fpRate)
+		}
+	}
+}
+
+func TestHandleMessageBloomFilter(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	crawled := api.EncodeURL("http://crawled.onion")
+	searched := map[string]int{}
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			searched[url]++
+			if url == crawled {
+				return []api.ResourceDto{{}}, 1, nil
+			}
+			return nil, 0, nil
+		},
+	}
+
+	handler := newScheduler(apiClient, withBloomFilter(newBloomFilter(1000, 0.001))).handleMessage
+
+	// Each URL is received twice: the API should only be queried the first time
+	for i := 0; i < 2; i++ {
+		for _, u := range []string{"http://new.onion", "http://crawled.onion"} {
+			if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(fmt.Sprintf(`{"url":"%s"}`, u))}); err != nil {
+				t.FailNow()
+			}
+		}
+	}
+
+	for _, u := range []string{"http://new.onion", "http://crawled.onion"} {
+		if n := searched[api.EncodeURL(u)]; n != 1 {
+			t.Errorf("%s: Wanted 1 API call Got: %d", u, n)
+		}
+	}
+}
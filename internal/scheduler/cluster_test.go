@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+// runClusteredNATSServers start two embedded NATS servers (one per region) routed together
+func runClusteredNATSServers(t *testing.T) (*server.Server, *server.Server) {
+	euOpts := test.DefaultTestOptions
+	euOpts.ServerName = "eu"
+	euOpts.Port = -1
+	euOpts.Cluster.Name = "trandoshan"
+	euOpts.Cluster.Host = "127.0.0.1"
+	euOpts.Cluster.Port = -1
+	eu := test.RunServer(&euOpts)
+
+	usOpts := euOpts
+	usOpts.ServerName = "us"
+	usOpts.Port = -1
+	usOpts.Cluster.Port = -1
+	usOpts.Routes = server.RoutesFromStr("nats-route://" + eu.ClusterAddr().String())
+	us := test.RunServer(&usOpts)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for eu.NumRoutes() == 0 || us.NumRoutes() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("servers should have been routed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return eu, us
+}
+
+func TestClusteredScheduler(t *testing.T) {
+	eu, us := runClusteredNATSServers(t)
+	defer us.Shutdown()
+	defer eu.Shutdown()
+
+	// The scheduler runs in the EU region, the crawlers in the US one
+	sub, err := natsutil.NewConnection(eu.ClientURL(), natsutil.WithClusterRoutes(us.ClientURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	nc, err := nats.Connect(us.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	todoSub, err := nc.SubscribeSync(messaging.URLTodoSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+	handler := newScheduler(apiClient).handleMessage
+
+	done := make(chan error)
+	go func() {
+		done <- sub.QueueSubscribe(messaging.URLFoundSubject, "schedulers",
+			func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+				return handler(ctx, nc, msg)
+			})
+	}()
+
+	// schedule publish the given URL from the US region until it is scheduled
+	schedule := func(url string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{URL: url}); err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := todoSub.NextMsg(200 * time.Millisecond)
+			if err == nats.ErrTimeout {
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var todoMsg messaging.URLTodoMsg
+			if err := natsutil.ReadJSON(msg, &todoMsg); err != nil {
+				t.Fatal(err)
+			}
+			if todoMsg.URL != url {
+				t.Errorf("Wanted: %s Got: %s", url, todoMsg.URL)
+			}
+			return
+		}
+
+		t.Fatalf("%s should have been scheduled", url)
+	}
+
+	// The messages are routed across the regions
+	schedule("http://example.onion")
+
+	// The scheduler fails over to the US region once the EU one is down
+	eu.Shutdown()
+	schedule("http://other.onion")
+
+	sub.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("subscription should have been terminated")
+	}
+}
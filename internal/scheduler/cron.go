@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+// crawlWindow restrict the scheduling of the URLs to the window following each trigger of a cron schedule
+// (e.g: `0 22 * * *` with a 6h window schedule the URLs between 22:00 and 04:00)
+type crawlWindow struct {
+	schedule cron.Schedule
+	window   time.Duration
+	// now returns the current time, replaced by the tests
+	now func() time.Time
+}
+
+// newCrawlWindow returns the window lasting given duration after each trigger of given cron expression
+func newCrawlWindow(expr string, window time.Duration) (*crawlWindow, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("crawl window should be positive")
+	}
+
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &crawlWindow{schedule: schedule, window: window, now: time.Now}, nil
+}
+
+// open returns true if the last trigger of the schedule happened less than the window ago (true if there is no window)
+func (w *crawlWindow) open() bool {
+	if w == nil {
+		return true
+	}
+
+	now := w.now()
+	// First trigger after the start of the window ending now
+	return !w.schedule.Next(now.Add(-w.window)).After(now)
+}
+
+// nextOpening returns the time at which the window opens next
+func (w *crawlWindow) nextOpening() time.Time {
+	return w.schedule.Next(w.now())
+}
@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func TestNewCrawlWindow(t *testing.T) {
+	if _, err := newCrawlWindow("0 22 * * *", time.Hour); err != nil {
+		t.Errorf("expression should be valid: %s", err)
+	}
+	if _, err := newCrawlWindow("@daily", time.Hour); err != nil {
+		t.Errorf("descriptor should be valid: %s", err)
+	}
+	if _, err := newCrawlWindow("0 25 * * *", time.Hour); err == nil {
+		t.Error("expression should be invalid")
+	}
+	if _, err := newCrawlWindow("0 22 * * *", 0); err == nil {
+		t.Error("window should be invalid")
+	}
+}
+
+func TestCrawlWindowOpen(t *testing.T) {
+	// Every night from 22:00 to 04:00
+	window, err := newCrawlWindow("0 22 * * *", 6*time.Hour)
+	if err != nil {
+		t.FailNow()
+	}
+
+	tests := []struct {
+		now  time.Time
+		want bool
+	}{
+		{time.Date(2021, 3, 1, 21, 59, 59, 0, time.Local), false},
+		{time.Date(2021, 3, 1, 22, 0, 0, 0, time.Local), true},
+		{time.Date(2021, 3, 1, 23, 30, 0, 0, time.Local), true},
+		{time.Date(2021, 3, 2, 3, 59, 59, 0, time.Local), true},
+		{time.Date(2021, 3, 2, 4, 0, 0, 0, time.Local), false},
+		{time.Date(2021, 3, 2, 12, 0, 0, 0, time.Local), false},
+	}
+	for _, test := range tests {
+		now := test.now
+		window.now = func() time.Time { return now }
+
+		if open := window.open(); open != test.want {
+			t.Errorf("%s: Wanted: %v Got: %v", now, test.want, open)
+		}
+	}
+
+	window.now = func() time.Time { return time.Date(2021, 3, 2, 12, 0, 0, 0, time.Local) }
+	if next := window.nextOpening(); !next.Equal(time.Date(2021, 3, 2, 22, 0, 0, 0, time.Local)) {
+		t.Errorf("Wanted: 22:00 Got: %s", next)
+	}
+
+	var missing *crawlWindow
+	if !missing.open() {
+		t.Error("missing window should always be open")
+	}
+}
+
+func TestHandleMessageCrawlWindow(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	deferredSub, err := nc.SubscribeSync(messaging.URLDeferredSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	calls := 0
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			calls++
+			return nil, 0, nil
+		},
+	}
+
+	var published []string
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		published = append(published, msg.(*messaging.URLTodoMsg).URL)
+		return nil
+	}
+
+	window, err := newCrawlWindow("0 22 * * *", 6*time.Hour)
+	if err != nil {
+		t.FailNow()
+	}
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.Local)
+	window.now = func() time.Time { return now }
+
+	handler := newScheduler(apiClient, withPublisher(publisher), withCrawlWindow(window)).handleMessage
+
+	// Outside of the window: URL is deferred without calling the API
+	data := []byte(`{"url":"http://example.onion"}`)
+	if err := handler(context.Background(), nc, &nats.Msg{Data: data}); err != nil {
+		t.FailNow()
+	}
+
+	msg, err := deferredSub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	if string(msg.Data) != string(data) {
+		t.Errorf("Wanted: %s Got: %s", data, msg.Data)
+	}
+	if calls != 0 || len(published) != 0 {
+		t.Errorf("URL should not have been scheduled (%d calls, published: %v)", calls, published)
+	}
+
+	// Within the window: URL is scheduled
+	now = time.Date(2021, 3, 1, 23, 0, 0, 0, time.Local)
+	if err := handler(context.Background(), nc, &nats.Msg{Data: data}); err != nil {
+		t.FailNow()
+	}
+	if calls != 1 || len(published) != 1 || published[0] != "http://example.onion" {
+		t.Errorf("URL should have been scheduled (%d calls, published: %v)", calls, published)
+	}
+	if _, err := deferredSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("URL should not have been deferred")
+	}
+}
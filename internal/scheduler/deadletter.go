@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"sync"
+)
+
+// number of URLs for which failures are tracked
+const failureTrackerSize = 10000
+
+// failureTracker keep track of the number of scheduling failures per URL
+type failureTracker struct {
+	cache *lru.Cache
+	mutex sync.Mutex
+}
+
+func newFailureTracker(size int) (*failureTracker, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failureTracker{cache: cache}, nil
+}
+
+// increment increment the failure count of given URL and return the new count
+func (ft *failureTracker) increment(url string) int {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	count := 1
+	if val, exist := ft.cache.Get(url); exist {
+		count = val.(int) + 1
+	}
+	ft.cache.Add(url, count)
+
+	return count
+}
+
+// reset forget about the failures of given URL
+func (ft *failureTracker) reset(url string) {
+	ft.cache.Remove(url)
+}
+
+// withDeadLetter wrap given handler so that failing URLs are published back for retry,
+// and to the dead-letter subject once maxRetries failures have been reached.
+// since the failing message is taken care of, no error is returned once the URL is published
+func withDeadLetter(handler natsutil.MsgHandler, tracker *failureTracker, maxRetries int) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		var urlMsg messaging.URLFoundMsg
+		if err := natsutil.ReadJSON(msg, &urlMsg); err != nil {
+			return err
+		}
+
+		handlerErr := handler(ctx, nc, msg)
+		if handlerErr == nil {
+			tracker.reset(urlMsg.URL)
+			return nil
+		}
+		// Requeued URLs have not failed
+		if natsutil.IsRequeue(handlerErr) {
+			return handlerErr
+		}
+
+		log.Warn().Str("url", urlMsg.URL).Str("err", handlerErr.Error()).Msg("Error while scheduling URL")
+
+		if count := tracker.increment(urlMsg.URL); count < maxRetries {
+			// Publish back to the subject the URL has been received on
+			subject := msg.Subject
+			if subject == "" {
+				subject = messaging.URLFoundSubject
+			}
+
+			log.Debug().Str("url", urlMsg.URL).Int("failures", count).Msg("Publishing URL back for retry")
+			if err := natsutil.Republish(nc, subject, msg); err != nil {
+				return fmt.Errorf("error while publishing URL for retry: %s", err)
+			}
+		} else {
+			log.Warn().Str("url", urlMsg.URL).Int("failures", count).Msg("Publishing URL to dead-letter queue")
+			tracker.reset(urlMsg.URL)
+			if err := natsutil.Republish(nc, messaging.URLDeadSubject, msg); err != nil {
+				return fmt.Errorf("error while publishing URL to dead-letter queue: %s", err)
+			}
+		}
+
+		return nil
+	}
+}
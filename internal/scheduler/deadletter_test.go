@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+// runNATSServer start an embedded NATS server listening on a random port
+func runNATSServer() *server.Server {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	return test.RunServer(&opts)
+}
+
+func TestFailureTracker(t *testing.T) {
+	ft, err := newFailureTracker(2)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if ft.increment("a") != 1 || ft.increment("a") != 2 || ft.increment("b") != 1 {
+		t.Fail()
+	}
+
+	ft.reset("a")
+	if ft.increment("a") != 1 {
+		t.Fail()
+	}
+
+	// LRU should evict the oldest entry
+	ft.increment("c")
+	if ft.increment("b") != 1 {
+		t.Fail()
+	}
+}
+
+func TestWithDeadLetter(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	foundSub, err := nc.SubscribeSync(messaging.URLFoundSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	deadSub, err := nc.SubscribeSync(messaging.URLDeadSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	tracker, err := newFailureTracker(10)
+	if err != nil {
+		t.FailNow()
+	}
+
+	calls := 0
+	handler := withDeadLetter(func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		calls++
+		return errors.New("api is down")
+	}, tracker, 3)
+
+	msg := &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}
+
+	// First failures should publish URL back to the found subject
+	for i := 0; i < 2; i++ {
+		if err := handler(context.Background(), nc, msg); err != nil {
+			t.FailNow()
+		}
+
+		retryMsg, err := foundSub.NextMsg(time.Second)
+		if err != nil {
+			t.FailNow()
+		}
+		var urlMsg messaging.URLFoundMsg
+		if err := natsutil.ReadJSON(retryMsg, &urlMsg); err != nil || urlMsg.URL != "http://example.onion" {
+			t.Fail()
+		}
+	}
+
+	// Then the URL should be dead
+	if err := handler(context.Background(), nc, msg); err != nil {
+		t.FailNow()
+	}
+
+	deadMsg, err := deadSub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	if string(deadMsg.Data) != string(msg.Data) {
+		t.Fail()
+	}
+
+	if _, err := foundSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("URL should not have been published for retry")
+	}
+
+	if calls != 3 {
+		t.Fail()
+	}
+}
+
+func TestWithDeadLetterSuccess(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	foundSub, err := nc.SubscribeSync(">")
+	if err != nil {
+		t.FailNow()
+	}
+
+	tracker, err := newFailureTracker(10)
+	if err != nil {
+		t.FailNow()
+	}
+	tracker.increment("http://example.onion")
+
+	handler := withDeadLetter(func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		return nil
+	}, tracker, 3)
+
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err != nil {
+		t.FailNow()
+	}
+
+	// Nothing should be published on success
+	if _, err := foundSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Fail()
+	}
+
+	// And failures should be reset
+	if tracker.increment("http://example.onion") != 1 {
+		t.Fail()
+	}
+}
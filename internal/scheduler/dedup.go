@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-redis/redis/v8"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+const redisDedupKeyPrefix = "trandoshan:scheduler:"
+
+// dedupCache keep track of the recently scheduled URLs
+type dedupCache interface {
+	// seen returns true if given URL has already been seen during the window,
+	// otherwise the URL is marked as seen
+	seen(url string) bool
+	// forget remove given URL from the cache, so it may be processed again
+	forget(url string)
+}
+
+// memoryDedupCache is a bounded in-memory dedupCache, the least recently seen URLs being evicted first
+type memoryDedupCache struct {
+	// URL -> expiration time
+	cache  *lru.Cache
+	window time.Duration
+	mutex  sync.Mutex
+
+	now func() time.Time
+}
+
+func newMemoryDedupCache(size int, window time.Duration) (*memoryDedupCache, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryDedupCache{
+		cache:  cache,
+		window: window,
+		now:    time.Now,
+	}, nil
+}
+
+func (mc *memoryDedupCache) seen(url string) bool {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	now := mc.now()
+	if val, exist := mc.cache.Get(url); exist && now.Before(val.(time.Time)) {
+		return true
+	}
+
+	mc.cache.Add(url, now.Add(mc.window))
+	return false
+}
+
+func (mc *memoryDedupCache) forget(url string) {
+	mc.cache.Remove(url)
+}
+
+// add mark given URL as seen until expiry
+func (mc *memoryDedupCache) add(url string, expiry time.Time) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.cache.Add(url, expiry)
+}
+
+// redisDedupCache is a dedupCache shared by the schedulers using the same Redis server, surviving restarts
+type redisDedupCache struct {
+	client redis.Cmdable
+	ttl    time.Duration
+}
+
+func newRedisDedupCache(client redis.Cmdable, ttl time.Duration) *redisDedupCache {
+	return &redisDedupCache{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// seen returns false if Redis is unavailable: the URL is still looked up using the API
+func (rc *redisDedupCache) seen(url string) bool {
+	set, err := rc.client.SetNX(context.Background(), redisDedupKey(url), 1, rc.ttl).Result()
+	if err != nil {
+		log.Warn().Str("err", err.Error()).Msg("Error while checking URL in Redis")
+		return false
+	}
+
+	return !set
+}
+
+func (rc *redisDedupCache) forget(url string) {
+	if err := rc.client.Del(context.Background(), redisDedupKey(url)).Err(); err != nil {
+		log.Warn().Str("err", err.Error()).Msg("Error while removing URL from Redis")
+	}
+}
+
+// redisDedupKey returns the Redis key of given URL, hashed to keep the keys short
+func redisDedupKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return redisDedupKeyPrefix + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/go-redis/redis/v8"
+	"github.com/nats-io/nats.go"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupCacheWindow(t *testing.T) {
+	mc, err := newMemoryDedupCache(10, time.Minute)
+	if err != nil {
+		t.FailNow()
+	}
+
+	now := time.Now()
+	mc.now = func() time.Time { return now }
+
+	if mc.seen("http://example.onion") {
+		t.Error("URL should not have been seen")
+	}
+	if !mc.seen("http://example.onion") {
+		t.Error("URL should have been seen")
+	}
+	if mc.seen("http://other.onion") {
+		t.Error("URL should not have been seen")
+	}
+
+	// Window expired
+	now = now.Add(time.Minute)
+	if mc.seen("http://example.onion") {
+		t.Error("URL should have expired")
+	}
+	if !mc.seen("http://example.onion") {
+		t.Error("URL should have been seen")
+	}
+
+	mc.forget("http://example.onion")
+	if mc.seen("http://example.onion") {
+		t.Error("URL should have been forgotten")
+	}
+}
+
+func TestMemoryDedupCacheBounded(t *testing.T) {
+	mc, err := newMemoryDedupCache(2, time.Minute)
+	if err != nil {
+		t.FailNow()
+	}
+
+	for i := 0; i < 10; i++ {
+		mc.seen(fmt.Sprintf("http://%d.onion", i))
+	}
+
+	if mc.cache.Len() != 2 {
+		t.Errorf("Wanted: 2 Got: %d", mc.cache.Len())
+	}
+
+	// Oldest URL should have been evicted
+	if mc.seen("http://0.onion") {
+		t.Error("URL should have been evicted")
+	}
+}
+
+func TestMemoryDedupCacheConcurrent(t *testing.T) {
+	mc, err := newMemoryDedupCache(100, time.Minute)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// Only one goroutine should see each URL as new
+	var firsts int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if !mc.seen(fmt.Sprintf("http://%d.onion", j)) {
+					atomic.AddInt32(&firsts, 1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if firsts != 10 {
+		t.Errorf("Wanted: 10 Got: %d", firsts)
+	}
+}
+
+func TestHandleMessageDedup(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	var calls int32
+	var fail int32
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			atomic.AddInt32(&calls, 1)
+			if atomic.LoadInt32(&fail) == 1 {
+				return nil, 0, fmt.Errorf("api is down")
+			}
+			return nil, 0, nil
+		},
+	}
+
+	mc, err := newMemoryDedupCache(10, time.Minute)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := newScheduler(apiClient, withDedup(mc, nil)).handleMessage
+
+	// Same URL received concurrently should be searched only once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion/#top"}`)}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Wanted: 1 call Got: %d", calls)
+	}
+
+	// Failing URL should be processed again
+	atomic.StoreInt32(&fail, 1)
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://failing.onion"}`)}); err == nil {
+		t.FailNow()
+	}
+	atomic.StoreInt32(&fail, 0)
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://failing.onion"}`)}); err != nil {
+		t.FailNow()
+	}
+	if calls != 3 {
+		t.Errorf("Wanted: 3 calls Got: %d", calls)
+	}
+}
+
+func TestRedisDedupCache(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.FailNow()
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	rc := newRedisDedupCache(client, time.Hour)
+
+	if rc.seen("http://example.onion") {
+		t.Error("URL should not have been seen")
+	}
+	if !rc.seen("http://example.onion") {
+		t.Error("URL should have been seen")
+	}
+
+	// Key should be the SHA-256 of the URL, expiring after the TTL
+	key := redisDedupKey("http://example.onion")
+	if key != "trandoshan:scheduler:ad4fa3a6e8b8a63193bd941f0fe1be54db75995aa37dfda93b718148df004455" {
+		t.Errorf("invalid key: %s", key)
+	}
+	if ttl := mr.TTL(key); ttl != time.Hour {
+		t.Errorf("Wanted: %s Got: %s", time.Hour, ttl)
+	}
+
+	// Another scheduler sharing the server should see the URL
+	if !newRedisDedupCache(client, time.Hour).seen("http://example.onion") {
+		t.Error("URL should have been seen by another scheduler")
+	}
+
+	rc.forget("http://example.onion")
+	if rc.seen("http://example.onion") {
+		t.Error("URL should have been forgotten")
+	}
+
+	mr.FastForward(time.Hour)
+	if rc.seen("http://example.onion") {
+		t.Error("URL should have expired")
+	}
+
+	// Unavailable Redis should not prevent scheduling
+	mr.Close()
+	if rc.seen("http://other.onion") {
+		t.Error("URL should not be considered seen when Redis is unavailable")
+	}
+}
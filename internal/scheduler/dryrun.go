@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// decision is the outcome of the scheduling of an URL
+type decision string
+
+const (
+	decisionSchedule     decision = "schedule"
+	decisionSkipCrawled  decision = "skip (already crawled)"
+	decisionSkipPolicy   decision = "skip (blacklisted)"
+	decisionSkipDepth    decision = "skip (too deep)"
+	decisionSkipInvalid  decision = "skip (TLD not allowed)"
+	decisionSkipDup      decision = "skip (duplicate)"
+	decisionSkipLength   decision = "skip (URL too long)"
+	decisionSkipFilter   decision = "skip (filtered)"
+	decisionSkipBloom    decision = "skip (bloom filter)"
+	decisionSkipContent  decision = "skip (duplicate content)"
+	decisionSkipDead     decision = "skip (dead URL)"
+	decisionSkipOnion    decision = "skip (invalid onion address)"
+	decisionSkipScheme   decision = "skip (scheme not allowed)"
+	decisionDeferUnavail decision = "defer (API unavailable)"
+	decisionDeferWindow  decision = "defer (outside crawl window)"
+)
+
+// skipReasons map the skip decisions to the reason of the published url.skipped message
+var skipReasons = map[decision]messaging.SkipReason{
+	decisionSkipCrawled: messaging.SkipReasonAlreadyCrawled,
+	decisionSkipPolicy:  messaging.SkipReasonBlacklisted,
+	decisionSkipDepth:   messaging.SkipReasonTooDeep,
+	decisionSkipInvalid: messaging.SkipReasonTLDNotAllowed,
+	decisionSkipDup:     messaging.SkipReasonDuplicate,
+	decisionSkipLength:  messaging.SkipReasonTooLong,
+	decisionSkipFilter:  messaging.SkipReasonFiltered,
+	decisionSkipBloom:   messaging.SkipReasonAlreadyCrawled,
+	decisionSkipContent: messaging.SkipReasonDuplicateContent,
+	decisionSkipDead:    messaging.SkipReasonDead,
+	decisionSkipOnion:   messaging.SkipReasonInvalidOnion,
+	decisionSkipScheme:  messaging.SkipReasonSchemeNotAllowed,
+}
+
+// dryRunReport keep track of the decisions made while running in dry-run mode
+type dryRunReport struct {
+	counts map[decision]int
+	mutex  sync.Mutex
+}
+
+func newDryRunReport() *dryRunReport {
+	return &dryRunReport{counts: map[decision]int{}}
+}
+
+func (r *dryRunReport) record(d decision) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.counts[d]++
+}
+
+// print write the summary table of the decisions into given writer
+func (r *dryRunReport) print(w io.Writer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var decisions []string
+	total := 0
+	for d, count := range r.counts {
+		decisions = append(decisions, string(d))
+		total += count
+	}
+	sort.Strings(decisions)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "DECISION\tCOUNT")
+	for _, d := range decisions {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\n", d, r.counts[decision(d)])
+	}
+	_, _ = fmt.Fprintf(tw, "total\t%d\n", total)
+	_ = tw.Flush()
+}
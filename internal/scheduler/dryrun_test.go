@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDryRunReportPrint(t *testing.T) {
+	report := newDryRunReport()
+	report.record(decisionSchedule)
+	report.record(decisionSchedule)
+	report.record(decisionSkipCrawled)
+
+	var buf bytes.Buffer
+	report.print(&buf)
+
+	want := "DECISION                COUNT\n" +
+		"schedule                2\n" +
+		"skip (already crawled)  1\n" +
+		"total                   3\n"
+	if buf.String() != want {
+		t.Errorf("Wanted:\n%s\nGot:\n%s", want, buf.String())
+	}
+}
+
+func TestHandleMessageDryRun(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	// Listen on every subject
+	allSub, err := nc.SubscribeSync(">")
+	if err != nil {
+		t.FailNow()
+	}
+
+	path := writePatterns(t, "spam.onion\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	policy, err := loadURLPolicy(nil, "", path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			// Only crawled.onion is already crawled
+			if url == api.EncodeURL("http://crawled.onion") {
+				return []api.ResourceDto{{}}, 1, nil
+			}
+			return nil, 0, nil
+		},
+	}
+
+	report := newDryRunReport()
+	handler := newScheduler(apiClient, withPolicy(policy), withMaxDepth(1), withReport(report)).handleMessage
+
+	msgs := []string{
+		`{"url":"http://example.onion"}`,
+		`{"url":"http://other.onion"}`,
+		`{"url":"http://crawled.onion"}`,
+		`{"url":"http://spam.onion"}`,
+		`{"url":"http://deep.onion","depth":2}`,
+		`{"url":"http://example.com"}`,
+	}
+	for _, msg := range msgs {
+		if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(msg)}); err != nil {
+			t.FailNow()
+		}
+	}
+
+	// Nothing should have been published
+	if _, err := allSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("No message should have been published in dry-run mode")
+	}
+
+	want := map[decision]int{
+		decisionSchedule:    2,
+		decisionSkipCrawled: 1,
+		decisionSkipPolicy:  1,
+		decisionSkipDepth:   1,
+		decisionSkipInvalid: 1,
+	}
+	if fmt.Sprint(report.counts) != fmt.Sprint(want) {
+		t.Errorf("Wanted: %v Got: %v", want, report.counts)
+	}
+}
+
+func TestExecuteDryRunInterrupt(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	apiSrv := httptest.NewServer(http.NotFoundHandler())
+	defer apiSrv.Close()
+
+	var buf bytes.Buffer
+	app := GetApp()
+	app.Writer = &buf
+
+	done := make(chan error)
+	go func() {
+		done <- app.Run([]string{"tdsh-scheduler", "--nats-uri", s.ClientURL(), "--api-uri", apiSrv.URL,
+			"--dry-run"})
+	}()
+
+	// Wait for the scheduler to subscribe to the found URLs
+	for !hasSubscription(t, s, messaging.URLFoundSubject) {
+		select {
+		case err := <-done:
+			t.Fatalf("scheduler should not have stopped: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.FailNow()
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wanted: nil Got: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("scheduler should have stopped")
+	}
+
+	if !strings.HasPrefix(buf.String(), "DECISION") || !strings.Contains(buf.String(), "total") {
+		t.Errorf("dry-run summary should have been printed, got: %s", buf.String())
+	}
+}
+
+// hasSubscription returns true if a client of given server is subscribed to given subject
+func hasSubscription(t *testing.T, s *server.Server, subject string) bool {
+	connz, err := s.Connz(&server.ConnzOptions{Subscriptions: true})
+	if err != nil {
+		t.FailNow()
+	}
+
+	for _, conn := range connz.Conns {
+		for _, sub := range conn.Subs {
+			if sub == subject {
+				return true
+			}
+		}
+	}
+
+	return false
+}
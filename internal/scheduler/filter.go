@@ -0,0 +1,283 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/util/circuitbreaker"
+	"github.com/creekorful/trandoshan/internal/util/retry"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Filter decide whether an URL should be scheduled
+type Filter interface {
+	// ShouldSchedule returns false if given URL should not be scheduled
+	ShouldSchedule(ctx context.Context, u *url.URL) (bool, error)
+}
+
+type depthKey struct{}
+
+// contextWithDepth returns a context carrying given URL depth
+func contextWithDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, depthKey{}, depth)
+}
+
+// DepthFromContext returns the depth of the URL being filtered (0 if unknown)
+func DepthFromContext(ctx context.Context) int {
+	depth, _ := ctx.Value(depthKey{}).(int)
+	return depth
+}
+
+// apiGuard retry the failing API calls of the filters, through the circuit breaker shared by the filters.
+// a nil guard call the API once
+type apiGuard struct {
+	retryOpts retry.Options
+	breaker   *circuitbreaker.CircuitBreaker
+}
+
+// call execute given API call, retrying it on failure. circuitbreaker.ErrOpen is returned if the API is unavailable
+func (g *apiGuard) call(f func() error) error {
+	if g == nil {
+		return f()
+	}
+
+	return g.breaker.Execute(func() error {
+		return retry.Do(f, g.retryOpts)
+	})
+}
+
+// DepthFilter skip the URLs deeper than MaxDepth (-1 = unlimited)
+type DepthFilter struct {
+	MaxDepth int
+}
+
+// NewDepthFilter returns a filter skipping the URLs deeper than given max depth (-1 = unlimited)
+func NewDepthFilter(maxDepth int) *DepthFilter {
+	return &DepthFilter{MaxDepth: maxDepth}
+}
+
+// ShouldSchedule returns false if the URL is too deep
+func (f *DepthFilter) ShouldSchedule(ctx context.Context, u *url.URL) (bool, error) {
+	if depth := DepthFromContext(ctx); f.MaxDepth != -1 && depth > f.MaxDepth {
+		zerolog.Ctx(ctx).Trace().Stringer("url", u).Int("depth", depth).Msg("URL is too deep")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// BlacklistFilter skip the URLs whose hostname is not allowed by the allowlist & blacklist
+type BlacklistFilter struct {
+	policy *urlPolicy
+}
+
+// NewBlacklistFilter returns a filter using the hostname patterns files (e.g: *.example.onion) located at given
+// paths. empty path means the corresponding list is disabled
+func NewBlacklistFilter(allowlistPath, blacklistPath string) (*BlacklistFilter, error) {
+	policy, err := loadURLPolicy(nil, allowlistPath, blacklistPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlacklistFilter{policy: policy}, nil
+}
+
+// ShouldSchedule returns false if the URL hostname is not allowed
+func (f *BlacklistFilter) ShouldSchedule(ctx context.Context, u *url.URL) (bool, error) {
+	if !f.policy.allows(u.Hostname()) {
+		zerolog.Ctx(ctx).Trace().Stringer("url", u).Msg("URL is not allowed by policy")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// RefreshDelayFilter skip the URLs already crawled, unless the refresh delay of their hostname is over
+type RefreshDelayFilter struct {
+	apiClient    api.Client
+	refreshDelay time.Duration
+	refreshRules refreshRules
+	guard        *apiGuard
+	batcher      *searchBatcher
+	warmUp       *warmUp
+	// mutex protect the refresh delay, which may be changed using the management API
+	mutex sync.RWMutex
+}
+
+// NewRefreshDelayFilter returns a filter skipping the URLs crawled within given refresh delay (-1 = never refreshed)
+func NewRefreshDelayFilter(apiClient api.Client, refreshDelay time.Duration) *RefreshDelayFilter {
+	return &RefreshDelayFilter{apiClient: apiClient, refreshDelay: refreshDelay}
+}
+
+// delay returns the refresh delay to apply to given hostname (-1 = never refreshed)
+func (f *RefreshDelayFilter) delay(hostname string) time.Duration {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return f.refreshRules.delay(hostname, f.refreshDelay)
+}
+
+// defaultDelay returns the refresh delay applied when no refresh rule matches (-1 = never refreshed)
+func (f *RefreshDelayFilter) defaultDelay() time.Duration {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return f.refreshDelay
+}
+
+// setDefaultDelay change the refresh delay applied when no refresh rule matches (-1 = never refreshed)
+func (f *RefreshDelayFilter) setDefaultDelay(delay time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.refreshDelay = delay
+}
+
+// ShouldSchedule returns false if the URL has been crawled. circuitbreaker.ErrOpen is returned
+// if the API is unavailable
+func (f *RefreshDelayFilter) ShouldSchedule(ctx context.Context, u *url.URL) (bool, error) {
+	logger := zerolog.Ctx(ctx)
+
+	// If we want to allow re-schedule of existing crawled resources we need to retrieve only resources
+	// that are newer than now-refreshDelay.
+	delay := f.delay(u.Hostname())
+	startDate := time.Time{}
+	if delay != -1 {
+		startDate = time.Now().Add(-delay)
+	}
+
+	b64URI := api.EncodeURL(u.String())
+
+	ctx, span := tracer.Start(ctx, "api.search", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	var urls []api.ResourceDto
+	err := f.guard.call(func() error {
+		var err error
+		if f.warmUp.active() {
+			urls, err = f.warmUp.batcher.search(b64URI, delay)
+		} else if f.batcher != nil {
+			urls, err = f.batcher.search(b64URI, delay)
+		} else if delay == -1 {
+			// URL is never refreshed: only check its existence
+			var res *api.ResourceDto
+			if res, err = f.apiClient.GetResource(b64URI); res != nil {
+				urls = []api.ResourceDto{*res}
+			}
+		} else {
+			urls, _, err = f.apiClient.Search(api.NewFilter().URL(b64URI).After(startDate).Page(1, 1))
+		}
+		if err != nil {
+			logger.Debug().Str("err", err.Error()).Msg("Error while searching URL")
+		}
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	return len(urls) == 0, nil
+}
+
+// DuplicateContentFilter skip the URLs whose last crawled content is the same as a page crawled earlier at another URL
+// (e.g: mirrors). URLs never crawled are always scheduled since their content is unknown
+type DuplicateContentFilter struct {
+	apiClient api.Client
+	guard     *apiGuard
+}
+
+// NewDuplicateContentFilter returns a filter skipping the URLs whose content has first been crawled at another URL
+func NewDuplicateContentFilter(apiClient api.Client) *DuplicateContentFilter {
+	return &DuplicateContentFilter{apiClient: apiClient}
+}
+
+// ShouldSchedule returns false if the content of the URL has first been crawled at another URL.
+// circuitbreaker.ErrOpen is returned if the API is unavailable
+func (f *DuplicateContentFilter) ShouldSchedule(ctx context.Context, u *url.URL) (bool, error) {
+	var resource *api.ResourceDto
+	if err := f.guard.call(func() error {
+		var err error
+		resource, err = f.apiClient.GetResource(api.EncodeURL(u.String()))
+		return err
+	}); err != nil {
+		return false, err
+	}
+	if resource == nil || resource.ContentHash == "" {
+		return true, nil
+	}
+
+	// The URL crawled first with this content is the canonical one
+	var resources []api.ResourceDto
+	if err := f.guard.call(func() error {
+		var err error
+		resources, err = f.apiClient.SearchResourcesByContentHash(resource.ContentHash, 1)
+		return err
+	}); err != nil {
+		return false, err
+	}
+	if len(resources) > 0 && resources[0].URL != resource.URL {
+		zerolog.Ctx(ctx).Trace().Stringer("url", u).Str("canonical", resources[0].URL).Msg("URL content is duplicated")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// DeadURLFilter skip the URLs which have been crawled at least MinAttempts times without ever returning a 200.
+// the crawl history is only known if the API records the crawls (--record-crawls)
+type DeadURLFilter struct {
+	apiClient   api.Client
+	guard       *apiGuard
+	MinAttempts int
+}
+
+// NewDeadURLFilter returns a filter skipping the URLs which have been crawled at least given min attempts times
+// without ever returning a 200
+func NewDeadURLFilter(apiClient api.Client, minAttempts int) *DeadURLFilter {
+	return &DeadURLFilter{apiClient: apiClient, MinAttempts: minAttempts}
+}
+
+// ShouldSchedule returns false if the URL has never returned a 200 in MinAttempts crawls or more.
+// circuitbreaker.ErrOpen is returned if the API is unavailable
+func (f *DeadURLFilter) ShouldSchedule(ctx context.Context, u *url.URL) (bool, error) {
+	var history api.CrawlHistoryDto
+	if err := f.guard.call(func() error {
+		var err error
+		history, err = f.apiClient.GetCrawlHistory(api.EncodeURL(u.String()))
+		return err
+	}); err != nil {
+		return false, err
+	}
+
+	if history.Attempts >= int64(f.MinAttempts) && history.StatusCodes[http.StatusOK] == 0 {
+		zerolog.Ctx(ctx).Trace().Stringer("url", u).Int64("attempts", history.Attempts).Msg("URL is dead")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// filterDecision returns the decision made when given filter skip an URL
+func filterDecision(f Filter) decision {
+	switch f.(type) {
+	case *DepthFilter:
+		return decisionSkipDepth
+	case *BlacklistFilter:
+		return decisionSkipPolicy
+	case *RefreshDelayFilter:
+		return decisionSkipCrawled
+	case *DuplicateContentFilter:
+		return decisionSkipContent
+	case *DeadURLFilter:
+		return decisionSkipDead
+	default:
+		return decisionSkipFilter
+	}
+}
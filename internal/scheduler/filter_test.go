@@ -0,0 +1,322 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/util/circuitbreaker"
+	"github.com/creekorful/trandoshan/internal/util/retry"
+	"github.com/nats-io/nats.go"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hostFilter skip the URLs whose hostname contains given word
+type hostFilter struct {
+	word string
+	err  error
+}
+
+func (f *hostFilter) ShouldSchedule(ctx context.Context, u *url.URL) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	return !strings.Contains(u.Hostname(), f.word), nil
+}
+
+func TestDepthFilter(t *testing.T) {
+	u, _ := url.Parse("http://example.onion")
+
+	tests := []struct {
+		maxDepth int
+		depth    int
+		want     bool
+	}{
+		{-1, 100, true},
+		{2, 2, true},
+		{2, 3, false},
+		{0, 0, true},
+	}
+	for _, test := range tests {
+		f := &DepthFilter{MaxDepth: test.maxDepth}
+		ok, err := f.ShouldSchedule(contextWithDepth(context.Background(), test.depth), u)
+		if err != nil || ok != test.want {
+			t.Errorf("max depth %d, depth %d: Wanted: %t Got: %t", test.maxDepth, test.depth, test.want, ok)
+		}
+	}
+
+	if DepthFromContext(context.Background()) != 0 {
+		t.Error("missing depth should be 0")
+	}
+}
+
+func TestBlacklistFilter(t *testing.T) {
+	path := writePatterns(t, "spam.onion\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	f, err := NewBlacklistFilter("", path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	for u, want := range map[string]bool{"http://example.onion": true, "http://spam.onion/a": false} {
+		parsed, _ := url.Parse(u)
+		if ok, err := f.ShouldSchedule(context.Background(), parsed); err != nil || ok != want {
+			t.Errorf("%s: Wanted: %t Got: %t", u, want, ok)
+		}
+	}
+
+	// Nil policy should allow everything
+	parsed, _ := url.Parse("http://spam.onion")
+	if ok, err := (&BlacklistFilter{}).ShouldSchedule(context.Background(), parsed); err != nil || !ok {
+		t.Error("nil policy should allow every URL")
+	}
+}
+
+func TestRefreshDelayFilter(t *testing.T) {
+	apiClient := &apiClientMock{
+		searchResources: func(u, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			switch u {
+			case api.EncodeURL("http://error.onion"):
+				return nil, 0, errors.New("API down")
+			case api.EncodeURL("http://crawled.onion"):
+				return []api.ResourceDto{{}}, 1, nil
+			default:
+				return nil, 0, nil
+			}
+		},
+	}
+
+	f := &RefreshDelayFilter{apiClient: apiClient, refreshDelay: -1}
+
+	u, _ := url.Parse("http://new.onion")
+	if ok, err := f.ShouldSchedule(context.Background(), u); err != nil || !ok {
+		t.Error("new URL should be scheduled")
+	}
+	u, _ = url.Parse("http://crawled.onion")
+	if ok, err := f.ShouldSchedule(context.Background(), u); err != nil || ok {
+		t.Error("crawled URL should not be scheduled")
+	}
+	u, _ = url.Parse("http://error.onion")
+	if _, err := f.ShouldSchedule(context.Background(), u); err == nil {
+		t.Error("API error should be returned")
+	}
+}
+
+func TestRefreshDelayFilterGetResource(t *testing.T) {
+	var got, searched bool
+	apiClient := &apiClientMock{
+		getResource: func(b64URL string) (*api.ResourceDto, error) {
+			got = true
+			return &api.ResourceDto{}, nil
+		},
+		searchResources: func(u, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			searched = true
+			return nil, 0, nil
+		},
+	}
+
+	u, _ := url.Parse("http://example.onion")
+
+	// URLs never refreshed: existence check
+	f := &RefreshDelayFilter{apiClient: apiClient, refreshDelay: -1}
+	if ok, err := f.ShouldSchedule(context.Background(), u); err != nil || ok || !got || searched {
+		t.Error("existing URL should be checked using GetResource")
+	}
+
+	// Refreshed URLs: search using date range
+	got = false
+	f = &RefreshDelayFilter{apiClient: apiClient, refreshDelay: time.Hour}
+	if ok, err := f.ShouldSchedule(context.Background(), u); err != nil || !ok || got || !searched {
+		t.Error("refreshed URL should be searched")
+	}
+}
+
+func TestWithFilters(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	report := newDryRunReport()
+	handler := newScheduler(apiClient, withReport(report), withMaxDepth(1),
+		WithFilters(&hostFilter{word: "forum"})).handleMessage
+
+	msgs := []string{
+		`{"url":"http://example.onion"}`,
+		`{"url":"http://forum.onion"}`,
+		`{"url":"http://forum.onion","depth":2}`,
+	}
+	for _, msg := range msgs {
+		if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(msg)}); err != nil {
+			t.FailNow()
+		}
+	}
+
+	// Built-in filters should be applied first
+	want := map[decision]int{
+		decisionSchedule:   1,
+		decisionSkipFilter: 1,
+		decisionSkipDepth:  1,
+	}
+	if fmt.Sprint(report.counts) != fmt.Sprint(want) {
+		t.Errorf("Wanted: %v Got: %v", want, report.counts)
+	}
+
+	// Filter error should be returned
+	handler = newScheduler(apiClient, WithFilters(&hostFilter{err: errors.New("boom")})).handleMessage
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err == nil {
+		t.Error("filter error should be returned")
+	}
+}
+
+func TestDuplicateContentFilter(t *testing.T) {
+	resources := map[string]*api.ResourceDto{
+		"http://mirror.onion":    {URL: "mirror.onion", ContentHash: "abc"},
+		"http://canonical.onion": {URL: "canonical.onion", ContentHash: "abc"},
+		"http://unhashed.onion":  {URL: "unhashed.onion"},
+	}
+	apiClient := &apiClientMock{
+		getResource: func(b64URL string) (*api.ResourceDto, error) {
+			u, _ := api.DecodeURL(b64URL)
+			if u == "http://error.onion" {
+				return nil, errors.New("boom")
+			}
+			return resources[u], nil
+		},
+		searchResourcesByContentHash: func(contentHash string, size int) ([]api.ResourceDto, error) {
+			if contentHash != "abc" || size != 1 {
+				t.Errorf("Wanted: abc (size 1) Got: %s (size %d)", contentHash, size)
+			}
+			return []api.ResourceDto{*resources["http://canonical.onion"]}, nil
+		},
+	}
+
+	f := &DuplicateContentFilter{apiClient: apiClient}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://new.onion", true},
+		{"http://unhashed.onion", true},
+		{"http://canonical.onion", true},
+		{"http://mirror.onion", false},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if ok, err := f.ShouldSchedule(context.Background(), u); err != nil || ok != test.want {
+			t.Errorf("%s: Wanted: %v Got: %v (%v)", test.url, test.want, ok, err)
+		}
+	}
+
+	u, _ := url.Parse("http://error.onion")
+	if _, err := f.ShouldSchedule(context.Background(), u); err == nil {
+		t.Error("API error should be returned")
+	}
+
+	if d := filterDecision(f); d != decisionSkipContent {
+		t.Errorf("Wanted: %s Got: %s", decisionSkipContent, d)
+	}
+}
+
+func TestDeadURLFilter(t *testing.T) {
+	histories := map[string]api.CrawlHistoryDto{
+		"http://dead.onion":        {Attempts: 3, StatusCodes: map[int]int64{404: 3}},
+		"http://unreachable.onion": {Attempts: 4, StatusCodes: map[int]int64{0: 2, 500: 2}},
+		"http://flaky.onion":       {Attempts: 5, StatusCodes: map[int]int64{404: 4, 200: 1}},
+		"http://young.onion":       {Attempts: 2, StatusCodes: map[int]int64{404: 2}},
+	}
+	apiClient := &apiClientMock{
+		getCrawlHistory: func(b64URL string) (api.CrawlHistoryDto, error) {
+			u, _ := api.DecodeURL(b64URL)
+			if u == "http://error.onion" {
+				return api.CrawlHistoryDto{}, errors.New("boom")
+			}
+			return histories[u], nil
+		},
+	}
+
+	f := NewDeadURLFilter(apiClient, 3)
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://never-crawled.onion", true},
+		{"http://young.onion", true},
+		{"http://flaky.onion", true},
+		{"http://dead.onion", false},
+		{"http://unreachable.onion", false},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if ok, err := f.ShouldSchedule(context.Background(), u); err != nil || ok != test.want {
+			t.Errorf("%s: Wanted: %v Got: %v (%v)", test.url, test.want, ok, err)
+		}
+	}
+
+	u, _ := url.Parse("http://error.onion")
+	if _, err := f.ShouldSchedule(context.Background(), u); err == nil {
+		t.Error("API error should be returned")
+	}
+
+	if d := filterDecision(f); d != decisionSkipDead {
+		t.Errorf("Wanted: %s Got: %s", decisionSkipDead, d)
+	}
+}
+
+func TestAPIGuard(t *testing.T) {
+	calls := 0
+	apiClient := &apiClientMock{
+		getCrawlHistory: func(b64URL string) (api.CrawlHistoryDto, error) {
+			calls++
+			if calls%2 == 1 {
+				return api.CrawlHistoryDto{}, errors.New("boom")
+			}
+			return api.CrawlHistoryDto{}, nil
+		},
+		getResource: func(b64URL string) (*api.ResourceDto, error) {
+			calls++
+			return nil, errors.New("boom")
+		},
+	}
+
+	guard := &apiGuard{retryOpts: retry.Options{Count: 1}, breaker: circuitbreaker.New(1, time.Hour)}
+	u, _ := url.Parse("http://example.onion")
+
+	// Failing calls are retried
+	dead := NewDeadURLFilter(apiClient, 3)
+	dead.guard = guard
+	if ok, err := dead.ShouldSchedule(context.Background(), u); err != nil || !ok || calls != 2 {
+		t.Errorf("Wanted: scheduled after 2 calls Got: %v %v after %d calls", ok, err, calls)
+	}
+
+	// The circuit breaker is shared by the filters
+	calls = 0
+	content := NewDuplicateContentFilter(apiClient)
+	content.guard = guard
+	if _, err := content.ShouldSchedule(context.Background(), u); err == nil || calls != 2 {
+		t.Errorf("Wanted: API error after 2 calls Got: %v after %d calls", err, calls)
+	}
+	if _, err := dead.ShouldSchedule(context.Background(), u); err != circuitbreaker.ErrOpen || calls != 2 {
+		t.Errorf("Wanted: %v Got: %v", circuitbreaker.ErrOpen, err)
+	}
+}
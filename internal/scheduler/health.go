@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthChecker expose the liveness & readiness probes of the scheduler
+type healthChecker struct {
+	sub        *natsutil.Connection
+	apiURI     string
+	httpClient *http.Client
+}
+
+func newHealthChecker(sub *natsutil.Connection, apiURI string, timeout time.Duration) *healthChecker {
+	return &healthChecker{
+		sub:        sub,
+		apiURI:     apiURI,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// startHealthServer expose the health endpoints on given address
+func startHealthServer(addr string, hc *healthChecker) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", hc.healthz)
+	mux.HandleFunc("/readyz", hc.readyz)
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Err(err).Str("addr", addr).Msg("Error while serving health endpoints")
+		}
+	}()
+}
+
+// healthz check that the NATS connection is alive & the API is reachable
+func (hc *healthChecker) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, hc.checkLiveness())
+}
+
+// readyz check that the process is alive & the NATS subscriptions are active
+func (hc *healthChecker) readyz(w http.ResponseWriter, r *http.Request) {
+	err := hc.checkLiveness()
+	if err == nil && !hc.sub.IsSubscribed() {
+		err = fmt.Errorf("NATS subscription is not active")
+	}
+
+	writeHealth(w, err)
+}
+
+func (hc *healthChecker) checkLiveness() error {
+	if !hc.sub.IsConnected() {
+		return fmt.Errorf("NATS connection is not alive")
+	}
+
+	// Any response means the API is reachable
+	res, err := hc.httpClient.Head(hc.apiURI)
+	if err != nil {
+		return fmt.Errorf("API is not reachable: %s", err)
+	}
+	_ = res.Body.Close()
+
+	return nil
+}
+
+func writeHealth(w http.ResponseWriter, err error) {
+	status := healthStatus{Status: "ok"}
+	code := http.StatusOK
+	if err != nil {
+		status = healthStatus{Status: "error", Error: err.Error()}
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(status)
+}
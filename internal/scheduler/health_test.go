@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func checkHealth(t *testing.T, handler http.HandlerFunc, wantCode int, wantStatus string) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != wantCode {
+		t.Errorf("Wanted code: %d Got: %d", wantCode, rec.Code)
+	}
+
+	var status healthStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.FailNow()
+	}
+	if status.Status != wantStatus {
+		t.Errorf("Wanted status: %s Got: %s", wantStatus, status.Status)
+	}
+	if wantStatus == "error" && status.Error == "" {
+		t.Error("Error should be set")
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer apiServer.Close()
+
+	sub, err := natsutil.NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+
+	hc := newHealthChecker(sub, apiServer.URL, time.Second)
+
+	// Alive but not subscribed yet
+	checkHealth(t, hc.healthz, http.StatusOK, "ok")
+	checkHealth(t, hc.readyz, http.StatusServiceUnavailable, "error")
+
+	go func() {
+		_ = sub.QueueSubscribe("url.found", "schedulers", func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+			return nil
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	checkHealth(t, hc.healthz, http.StatusOK, "ok")
+	checkHealth(t, hc.readyz, http.StatusOK, "ok")
+
+	// API down
+	apiServer.Close()
+	checkHealth(t, hc.healthz, http.StatusServiceUnavailable, "error")
+	checkHealth(t, hc.readyz, http.StatusServiceUnavailable, "error")
+
+	// NATS down
+	sub.Close()
+	otherAPIServer := httptest.NewServer(http.NotFoundHandler())
+	defer otherAPIServer.Close()
+	hc.apiURI = otherAPIServer.URL
+	checkHealth(t, hc.healthz, http.StatusServiceUnavailable, "error")
+}
+
+func TestHealthCheckerTimeout(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer apiServer.Close()
+
+	sub, err := natsutil.NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	hc := newHealthChecker(sub, apiServer.URL, 50*time.Millisecond)
+
+	start := time.Now()
+	checkHealth(t, hc.healthz, http.StatusServiceUnavailable, "error")
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("Health check should have timed out (elapsed: %s)", elapsed)
+	}
+}
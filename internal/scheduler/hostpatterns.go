@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// hostPatterns is a reloadable list of hostname glob patterns (e.g: *.example.onion)
+// read from a newline-delimited file
+type hostPatterns struct {
+	path     string
+	patterns []string
+	mutex    sync.RWMutex
+}
+
+// loadHostPatterns read the patterns from the file located at given path
+func loadHostPatterns(path string) (*hostPatterns, error) {
+	hp := &hostPatterns{path: path}
+	if err := hp.reload(); err != nil {
+		return nil, err
+	}
+
+	return hp, nil
+}
+
+// reload read again the patterns from the file
+// current patterns are kept if the file cannot be read
+func (hp *hostPatterns) reload() error {
+	f, err := os.Open(hp.path)
+	if err != nil {
+		return fmt.Errorf("error while opening %s: %s", hp.path, err)
+	}
+	defer f.Close()
+
+	patterns, err := parseHostPatterns(f, hp.path)
+	if err != nil {
+		return err
+	}
+
+	hp.set(patterns)
+	return nil
+}
+
+// set replace the current patterns
+func (hp *hostPatterns) set(patterns []string) {
+	hp.mutex.Lock()
+	hp.patterns = patterns
+	hp.mutex.Unlock()
+}
+
+// list returns a copy of the current patterns
+func (hp *hostPatterns) list() []string {
+	hp.mutex.RLock()
+	defer hp.mutex.RUnlock()
+
+	return append([]string{}, hp.patterns...)
+}
+
+// parseHostPatterns read the newline-delimited patterns from given reader, source being used in errors
+func parseHostPatterns(r io.Reader, source string) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+
+		// Skip empty lines & comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Make sure pattern is valid
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s in %s: %s", line, source, err)
+		}
+
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading %s: %s", source, err)
+	}
+
+	return patterns, nil
+}
+
+// matches returns true if given hostname match at least one pattern
+func (hp *hostPatterns) matches(hostname string) bool {
+	if hp == nil {
+		return false
+	}
+
+	hp.mutex.RLock()
+	defer hp.mutex.RUnlock()
+
+	hostname = strings.ToLower(hostname)
+	for _, pattern := range hp.patterns {
+		if matched, _ := path.Match(pattern, hostname); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reloadOnSignal reload given patterns each time a signal is received
+func reloadOnSignal(signals <-chan os.Signal, lists ...*hostPatterns) {
+	for range signals {
+		reloadAll(lists...)
+	}
+}
+
+// reloadAll reload given patterns from their file, returning the first error
+// the lists which cannot be reloaded keep their current patterns
+func reloadAll(lists ...*hostPatterns) error {
+	var firstErr error
+	for _, list := range lists {
+		// Patterns set using the management API only are not backed by a file
+		if list == nil || list.path == "" {
+			continue
+		}
+
+		if err := list.reload(); err != nil {
+			log.Err(err).Str("path", list.path).Msg("Error while reloading patterns")
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		log.Info().Str("path", list.path).Msg("Successfully reloaded patterns")
+	}
+
+	return firstErr
+}
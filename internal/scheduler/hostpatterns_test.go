@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writePatterns(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "trandoshan")
+	if err != nil {
+		t.FailNow()
+	}
+
+	path := filepath.Join(dir, "patterns.txt")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.FailNow()
+	}
+
+	return path
+}
+
+func TestHostPatternsMatches(t *testing.T) {
+	path := writePatterns(t, "# spam services\nspam.onion\n\n*.honeypot.onion\nab?.onion\n  TRAP.onion  \n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	hp, err := loadHostPatterns(path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	tests := map[string]bool{
+		"spam.onion":           true,
+		"SPAM.onion":           true,
+		"notspam.onion":        false,
+		"a.honeypot.onion":     true,
+		"a.b.honeypot.onion":   true,
+		"honeypot.onion":       false,
+		"abc.onion":            true,
+		"abcd.onion":           false,
+		"trap.onion":           true,
+		"example.onion":        false,
+		"spam.onion.other.com": false,
+	}
+
+	for hostname, want := range tests {
+		if hp.matches(hostname) != want {
+			t.Errorf("%s: wanted %v", hostname, want)
+		}
+	}
+}
+
+func TestHostPatternsNil(t *testing.T) {
+	var hp *hostPatterns
+	if hp.matches("example.onion") {
+		t.Fail()
+	}
+}
+
+func TestHostPatternsInvalid(t *testing.T) {
+	path := writePatterns(t, "[a-\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	if _, err := loadHostPatterns(path); err == nil {
+		t.Fail()
+	}
+
+	if _, err := loadHostPatterns(filepath.Join(filepath.Dir(path), "missing.txt")); err == nil {
+		t.Fail()
+	}
+}
+
+func TestHostPatternsReload(t *testing.T) {
+	path := writePatterns(t, "spam.onion\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	hp, err := loadHostPatterns(path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if !hp.matches("spam.onion") || hp.matches("other.onion") {
+		t.FailNow()
+	}
+
+	if err := ioutil.WriteFile(path, []byte("other.onion\n"), 0644); err != nil {
+		t.FailNow()
+	}
+
+	signals := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		reloadOnSignal(signals, hp)
+		close(done)
+	}()
+
+	signals <- syscall.SIGHUP
+	close(signals)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.FailNow()
+	}
+
+	if hp.matches("spam.onion") || !hp.matches("other.onion") {
+		t.Fail()
+	}
+
+	// Invalid content should keep previous patterns
+	if err := ioutil.WriteFile(path, []byte("[a-\n"), 0644); err != nil {
+		t.FailNow()
+	}
+	if err := hp.reload(); err == nil {
+		t.Fail()
+	}
+	if !hp.matches("other.onion") {
+		t.Fail()
+	}
+}
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	errorKindDecode     = "decode"
+	errorKindParse      = "parse"
+	errorKindAPI        = "api"
+	errorKindPublish    = "publish"
+	errorKindFilter     = "filter"
+	errorKindShadow     = "shadow"
+	errorKindQueueDepth = "queue_depth"
+)
+
+var (
+	urlsReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scheduler_urls_received_total",
+		Help: "The total number of URLs received",
+	})
+	urlsPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scheduler_urls_published_total",
+		Help: "The total number of URLs scheduled for crawling",
+	})
+	backPressureWaits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scheduler_back_pressure_waits_total",
+		Help: "The total number of times the publication of an URL has been delayed because url.todo was full",
+	})
+	shadowPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "shadow_published_total",
+		Help: "The total number of URLs published to the shadow subject",
+	})
+	urlsRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scheduler_urls_rate_limited_total",
+		Help: "The total number of URLs requeued because their hostname has been rate limited",
+	})
+	urlsSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scheduler_urls_skipped_total",
+		Help: "The total number of URLs skipped because already crawled",
+	})
+	urlsRejectedLength = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scheduler_urls_rejected_length_total",
+		Help: "The total number of URLs rejected because too long",
+	})
+	invalidOnions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scheduler_invalid_onion_total",
+		Help: "The total number of URLs rejected because their hostname is not a valid onion address",
+	})
+	schedulerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_errors_total",
+		Help: "The total number of errors while scheduling URLs",
+	}, []string{"kind"})
+)
@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+	"time"
+)
+
+func TestMetricsPublished(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	received := testutil.ToFloat64(urlsReceived)
+	published := testutil.ToFloat64(urlsPublished)
+	skipped := testutil.ToFloat64(urlsSkipped)
+
+	handler := newScheduler(apiClient).handleMessage
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err != nil {
+		t.FailNow()
+	}
+
+	if testutil.ToFloat64(urlsReceived) != received+1 {
+		t.Fail()
+	}
+	if testutil.ToFloat64(urlsPublished) != published+1 {
+		t.Fail()
+	}
+	if testutil.ToFloat64(urlsSkipped) != skipped {
+		t.Fail()
+	}
+}
+
+func TestMetricsSkipped(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return []api.ResourceDto{{URL: "http://example.onion"}}, 1, nil
+		},
+	}
+
+	received := testutil.ToFloat64(urlsReceived)
+	published := testutil.ToFloat64(urlsPublished)
+	skipped := testutil.ToFloat64(urlsSkipped)
+
+	handler := newScheduler(apiClient).handleMessage
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err != nil {
+		t.FailNow()
+	}
+
+	if testutil.ToFloat64(urlsReceived) != received+1 {
+		t.Fail()
+	}
+	if testutil.ToFloat64(urlsPublished) != published {
+		t.Fail()
+	}
+	if testutil.ToFloat64(urlsSkipped) != skipped+1 {
+		t.Fail()
+	}
+}
+
+func TestMetricsErrors(t *testing.T) {
+	errors := testutil.ToFloat64(schedulerErrors.WithLabelValues(errorKindDecode))
+
+	handler := newScheduler(&apiClientMock{}).handleMessage
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`not json`)}); err == nil {
+		t.FailNow()
+	}
+
+	if testutil.ToFloat64(schedulerErrors.WithLabelValues(errorKindDecode)) != errors+1 {
+		t.Fail()
+	}
+}
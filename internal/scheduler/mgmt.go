@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"sort"
+)
+
+// configDto represent the scheduler configuration as given by the management API
+type configDto struct {
+	AllowedTLDs []string `json:"allowed_tlds"`
+	// Allowlist is null if every hostname is allowed
+	Allowlist []string `json:"allowlist"`
+	Blacklist []string `json:"blacklist"`
+	// RefreshDelay is empty if the URLs are never refreshed
+	RefreshDelay string `json:"refresh_delay"`
+	MaxDepth     int    `json:"max_depth"`
+	MaxURLLength int    `json:"max_url_length"`
+}
+
+// refreshDelayDto represent the refresh delay update request, empty delay meaning never
+type refreshDelayDto struct {
+	RefreshDelay string `json:"refresh_delay"`
+}
+
+type errorDto struct {
+	Error string `json:"error"`
+}
+
+// configManager expose the management API changing the scheduler configuration while running
+type configManager struct {
+	s *scheduler
+}
+
+func newConfigManager(s *scheduler) *configManager {
+	return &configManager{s: s}
+}
+
+// startManagementServer expose the management endpoints on given address
+func startManagementServer(addr string, cm *configManager) {
+	go func() {
+		if err := http.ListenAndServe(addr, cm.handler()); err != nil {
+			log.Err(err).Str("addr", addr).Msg("Error while serving management endpoints")
+		}
+	}()
+}
+
+func (cm *configManager) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", cm.getConfig)
+	mux.HandleFunc("/config/allowlist", cm.updateAllowlist)
+	mux.HandleFunc("/config/blacklist", cm.updateBlacklist)
+	mux.HandleFunc("/config/refresh-delay", cm.updateRefreshDelay)
+	mux.HandleFunc("/config/reload", cm.reload)
+
+	return mux
+}
+
+// getConfig dump the current configuration
+func (cm *configManager) getConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	config := configDto{
+		AllowedTLDs:  []string{defaultTLD},
+		Blacklist:    []string{},
+		MaxDepth:     cm.s.depth.MaxDepth,
+		MaxURLLength: cm.s.maxURLLength,
+	}
+
+	if p := cm.s.policy; p != nil {
+		if len(p.tlds) > 0 {
+			config.AllowedTLDs = nil
+			for tld := range p.tlds {
+				config.AllowedTLDs = append(config.AllowedTLDs, tld)
+			}
+			sort.Strings(config.AllowedTLDs)
+		}
+
+		p.mutex.RLock()
+		if p.allowlist != nil {
+			config.Allowlist = p.allowlist.list()
+		}
+		if p.blacklist != nil {
+			config.Blacklist = p.blacklist.list()
+		}
+		p.mutex.RUnlock()
+	}
+
+	if delay := cm.s.refresh.defaultDelay(); delay != -1 {
+		config.RefreshDelay = delay.String()
+	}
+
+	writeJSON(w, http.StatusOK, config)
+}
+
+// updateAllowlist replace the allowlist patterns by the newline-delimited patterns of the request body
+func (cm *configManager) updateAllowlist(w http.ResponseWriter, r *http.Request) {
+	cm.updateList(w, r, "allowlist", cm.s.policy.setAllowlist)
+}
+
+// updateBlacklist replace the blacklist patterns by the newline-delimited patterns of the request body
+func (cm *configManager) updateBlacklist(w http.ResponseWriter, r *http.Request) {
+	cm.updateList(w, r, "blacklist", cm.s.policy.setBlacklist)
+}
+
+func (cm *configManager) updateList(w http.ResponseWriter, r *http.Request, name string, set func([]string)) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	patterns, err := parseHostPatterns(r.Body, "request body")
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errorDto{Error: err.Error()})
+		return
+	}
+
+	set(patterns)
+	log.Info().Str("list", name).Int("count", len(patterns)).Msg("Successfully updated patterns")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reload read again the allowlist & blacklist from their file, as done on SIGHUP
+func (cm *configManager) reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := reloadAll(cm.s.policy.lists()...); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errorDto{Error: err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateRefreshDelay change the refresh delay applied to the hostnames matching no refresh rule
+func (cm *configManager) updateRefreshDelay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req refreshDelayDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorDto{Error: fmt.Sprintf("invalid request: %s", err)})
+		return
+	}
+
+	delay, err := parseRefreshDelay(req.RefreshDelay)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errorDto{Error: err.Error()})
+		return
+	}
+
+	// URLs cannot be removed from the bloom filter: they would never be refreshed
+	if cm.s.bloom != nil && delay != -1 {
+		writeJSON(w, http.StatusConflict, errorDto{Error: "refresh delay cannot be set when using a bloom filter"})
+		return
+	}
+
+	cm.s.refresh.setDefaultDelay(delay)
+	if delay != -1 {
+		log.Info().Stringer("delay", delay).Msg("Existing resources will be crawled again")
+	} else {
+		log.Info().Msg("Existing resources will NOT be crawled again")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,229 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestManagementServer(t *testing.T, opts ...Option) (*httptest.Server, *scheduler) {
+	policy, err := loadURLPolicy([]string{"onion", "i2p"}, "", "")
+	if err != nil {
+		t.FailNow()
+	}
+
+	s := newScheduler(&apiClientMock{}, append([]Option{withPolicy(policy)}, opts...)...)
+	return httptest.NewServer(newConfigManager(s).handler()), s
+}
+
+func doRequest(t *testing.T, method, url, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func getConfig(t *testing.T, url string) configDto {
+	res := doRequest(t, http.MethodGet, url+"/config", "")
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Wanted: %d Got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var config configDto
+	if err := json.NewDecoder(res.Body).Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	return config
+}
+
+func TestManagementGetConfig(t *testing.T) {
+	srv, _ := newTestManagementServer(t, withMaxDepth(3), withMaxURLLength(2048),
+		withRefresh(12*time.Hour, nil))
+	defer srv.Close()
+
+	want := configDto{
+		AllowedTLDs:  []string{"i2p", "onion"},
+		Blacklist:    []string{},
+		RefreshDelay: "12h0m0s",
+		MaxDepth:     3,
+		MaxURLLength: 2048,
+	}
+	if config := getConfig(t, srv.URL); !reflect.DeepEqual(config, want) {
+		t.Errorf("Wanted: %+v Got: %+v", want, config)
+	}
+
+	res := doRequest(t, http.MethodPost, srv.URL+"/config", "")
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Wanted: %d Got: %d", http.StatusMethodNotAllowed, res.StatusCode)
+	}
+}
+
+func TestManagementUpdateBlacklist(t *testing.T) {
+	srv, s := newTestManagementServer(t)
+	defer srv.Close()
+
+	if !s.policy.allows("spam.onion") {
+		t.Error("spam.onion should be allowed")
+	}
+
+	res := doRequest(t, http.MethodPost, srv.URL+"/config/blacklist", "# spam\nSPAM.onion\n*.honeypot.onion\n")
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Wanted: %d Got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	if s.policy.allows("spam.onion") || s.policy.allows("a.honeypot.onion") || !s.policy.allows("example.onion") {
+		t.Error("blacklist has not been applied")
+	}
+	if config := getConfig(t, srv.URL); !reflect.DeepEqual(config.Blacklist, []string{"spam.onion", "*.honeypot.onion"}) {
+		t.Errorf("Got: %v", config.Blacklist)
+	}
+
+	// Invalid patterns are rejected and current patterns are kept
+	res = doRequest(t, http.MethodPost, srv.URL+"/config/blacklist", "example.onion\n[invalid\n")
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Wanted: %d Got: %d", http.StatusUnprocessableEntity, res.StatusCode)
+	}
+	if s.policy.allows("spam.onion") || !s.policy.allows("example.onion") {
+		t.Error("blacklist should not have changed")
+	}
+
+	res = doRequest(t, http.MethodGet, srv.URL+"/config/blacklist", "")
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Wanted: %d Got: %d", http.StatusMethodNotAllowed, res.StatusCode)
+	}
+}
+
+func TestManagementUpdateAllowlist(t *testing.T) {
+	srv, s := newTestManagementServer(t)
+	defer srv.Close()
+
+	if config := getConfig(t, srv.URL); config.Allowlist != nil {
+		t.Errorf("Allowlist should be disabled, got: %v", config.Allowlist)
+	}
+
+	res := doRequest(t, http.MethodPost, srv.URL+"/config/allowlist", "*.example.onion\n")
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Wanted: %d Got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	if !s.policy.allows("www.example.onion") || s.policy.allows("other.onion") {
+		t.Error("allowlist has not been applied")
+	}
+	if config := getConfig(t, srv.URL); !reflect.DeepEqual(config.Allowlist, []string{"*.example.onion"}) {
+		t.Errorf("Got: %v", config.Allowlist)
+	}
+}
+
+func TestManagementReload(t *testing.T) {
+	path := writePatterns(t, "spam.onion\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	policy, err := loadURLPolicy(nil, "", path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	srv := httptest.NewServer(newConfigManager(newScheduler(&apiClientMock{}, withPolicy(policy))).handler())
+	defer srv.Close()
+
+	// Patterns set using the API are replaced on reload, as on SIGHUP
+	res := doRequest(t, http.MethodPost, srv.URL+"/config/blacklist", "other.onion\n")
+	_ = res.Body.Close()
+	if policy.allows("other.onion") || !policy.allows("spam.onion") {
+		t.Error("blacklist has not been applied")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("spam.onion\nhoneypot.onion\n"), 0644); err != nil {
+		t.FailNow()
+	}
+
+	res = doRequest(t, http.MethodPost, srv.URL+"/config/reload", "")
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Wanted: %d Got: %d", http.StatusNoContent, res.StatusCode)
+	}
+	if policy.allows("spam.onion") || policy.allows("honeypot.onion") || !policy.allows("other.onion") {
+		t.Error("blacklist has not been reloaded")
+	}
+
+	// Current patterns are kept if the file cannot be read
+	if err := ioutil.WriteFile(path, []byte("[invalid\n"), 0644); err != nil {
+		t.FailNow()
+	}
+	res = doRequest(t, http.MethodPost, srv.URL+"/config/reload", "")
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Wanted: %d Got: %d", http.StatusUnprocessableEntity, res.StatusCode)
+	}
+	if policy.allows("spam.onion") {
+		t.Error("blacklist should not have changed")
+	}
+}
+
+func TestManagementUpdateRefreshDelay(t *testing.T) {
+	srv, s := newTestManagementServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		body      string
+		wantCode  int
+		wantDelay time.Duration
+	}{
+		{`{"refresh_delay": "7d"}`, http.StatusNoContent, 7 * 24 * time.Hour},
+		{`{"refresh_delay": "soon"}`, http.StatusUnprocessableEntity, 7 * 24 * time.Hour},
+		{`not json`, http.StatusBadRequest, 7 * 24 * time.Hour},
+		{`{"refresh_delay": "12h"}`, http.StatusNoContent, 12 * time.Hour},
+		{`{"refresh_delay": ""}`, http.StatusNoContent, -1},
+	}
+	for _, test := range tests {
+		res := doRequest(t, http.MethodPut, srv.URL+"/config/refresh-delay", test.body)
+		_ = res.Body.Close()
+
+		if res.StatusCode != test.wantCode {
+			t.Errorf("%s: Wanted: %d Got: %d", test.body, test.wantCode, res.StatusCode)
+		}
+		if delay := s.refresh.delay("example.onion"); delay != test.wantDelay {
+			t.Errorf("%s: Wanted: %s Got: %s", test.body, test.wantDelay, delay)
+		}
+	}
+
+	if config := getConfig(t, srv.URL); config.RefreshDelay != "" {
+		t.Errorf("Refresh delay should be empty, got: %s", config.RefreshDelay)
+	}
+}
+
+func TestManagementUpdateRefreshDelayBloomFilter(t *testing.T) {
+	srv, s := newTestManagementServer(t, withBloomFilter(newBloomFilter(1000, 0.001)))
+	defer srv.Close()
+
+	res := doRequest(t, http.MethodPut, srv.URL+"/config/refresh-delay", `{"refresh_delay": "7d"}`)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("Wanted: %d Got: %d", http.StatusConflict, res.StatusCode)
+	}
+	if delay := s.refresh.delay("example.onion"); delay != -1 {
+		t.Errorf("Refresh delay should not have changed, got: %s", delay)
+	}
+}
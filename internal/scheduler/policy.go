@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"strings"
+	"sync"
+)
+
+// defaultTLD is the only pseudo-TLD allowed when none are configured
+const defaultTLD = "onion"
+
+// urlPolicy determinate which hostnames are allowed to be crawled
+type urlPolicy struct {
+	// tlds the allowed pseudo-TLDs (e.g: onion, i2p)
+	tlds map[string]bool
+	// allowlist if set, only matching hostnames are allowed
+	allowlist *hostPatterns
+	// blacklist matching hostnames are never allowed
+	blacklist *hostPatterns
+	// mutex protect the lists, which may be enabled using the management API
+	mutex sync.RWMutex
+}
+
+// loadURLPolicy create a policy allowing given pseudo-TLDs (only onion if empty),
+// using the patterns files located at given paths. empty path means the corresponding list is disabled
+func loadURLPolicy(tlds []string, allowlistPath, blacklistPath string) (*urlPolicy, error) {
+	p := &urlPolicy{tlds: map[string]bool{}}
+	for _, tld := range tlds {
+		tld = strings.Trim(strings.ToLower(strings.TrimSpace(tld)), ".")
+		if tld != "" {
+			p.tlds[tld] = true
+		}
+	}
+
+	if allowlistPath != "" {
+		allowlist, err := loadHostPatterns(allowlistPath)
+		if err != nil {
+			return nil, err
+		}
+		p.allowlist = allowlist
+	}
+
+	if blacklistPath != "" {
+		blacklist, err := loadHostPatterns(blacklistPath)
+		if err != nil {
+			return nil, err
+		}
+		p.blacklist = blacklist
+	}
+
+	return p, nil
+}
+
+// allows returns true if given hostname may be crawled according to the policy.
+// the allowlist is checked first, then the blacklist
+func (p *urlPolicy) allows(hostname string) bool {
+	if p == nil {
+		return true
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.allowlist != nil && !p.allowlist.matches(hostname) {
+		return false
+	}
+
+	return !p.blacklist.matches(hostname)
+}
+
+// setAllowlist replace the allowlist patterns, enabling it if needed
+func (p *urlPolicy) setAllowlist(patterns []string) {
+	p.setList(&p.allowlist, patterns)
+}
+
+// setBlacklist replace the blacklist patterns, enabling it if needed
+func (p *urlPolicy) setBlacklist(patterns []string) {
+	p.setList(&p.blacklist, patterns)
+}
+
+func (p *urlPolicy) setList(list **hostPatterns, patterns []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if *list == nil {
+		*list = &hostPatterns{}
+	}
+	(*list).set(patterns)
+}
+
+// allowsTLD returns true if the pseudo-TLD of given hostname is allowed, and the pseudo-TLD
+func (p *urlPolicy) allowsTLD(hostname string) (bool, string) {
+	tld := hostTLD(hostname)
+
+	if p == nil || len(p.tlds) == 0 {
+		return tld == defaultTLD, tld
+	}
+
+	return p.tlds[tld], tld
+}
+
+// lists returns the patterns lists used by the policy
+func (p *urlPolicy) lists() []*hostPatterns {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return []*hostPatterns{p.allowlist, p.blacklist}
+}
+
+// hostTLD returns the lowercase TLD of given hostname (e.g: example.onion -> onion)
+func hostTLD(hostname string) string {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+
+	idx := strings.LastIndex(hostname, ".")
+	if idx == -1 {
+		return ""
+	}
+
+	return hostname[idx+1:]
+}
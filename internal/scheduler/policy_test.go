@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestURLPolicyEmpty(t *testing.T) {
+	p, err := loadURLPolicy(nil, "", "")
+	if err != nil {
+		t.FailNow()
+	}
+
+	if !p.allows("example.onion") {
+		t.Fail()
+	}
+
+	var nilPolicy *urlPolicy
+	if !nilPolicy.allows("example.onion") {
+		t.Fail()
+	}
+}
+
+func TestURLPolicyAllowlist(t *testing.T) {
+	path := writePatterns(t, "*.seed.onion\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	p, err := loadURLPolicy(nil, path, "")
+	if err != nil {
+		t.FailNow()
+	}
+
+	if !p.allows("a.seed.onion") {
+		t.Fail()
+	}
+	if p.allows("example.onion") {
+		t.Fail()
+	}
+}
+
+func TestURLPolicyBlacklist(t *testing.T) {
+	path := writePatterns(t, "spam.onion\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	p, err := loadURLPolicy(nil, "", path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if p.allows("spam.onion") {
+		t.Fail()
+	}
+	if !p.allows("example.onion") {
+		t.Fail()
+	}
+}
+
+func TestURLPolicyBoth(t *testing.T) {
+	allowlistPath := writePatterns(t, "*.seed.onion\n")
+	defer os.RemoveAll(filepath.Dir(allowlistPath))
+	blacklistPath := writePatterns(t, "spam.seed.onion\n")
+	defer os.RemoveAll(filepath.Dir(blacklistPath))
+
+	p, err := loadURLPolicy(nil, allowlistPath, blacklistPath)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if !p.allows("a.seed.onion") {
+		t.Fail()
+	}
+	// allowed but blacklisted
+	if p.allows("spam.seed.onion") {
+		t.Fail()
+	}
+	// not allowed
+	if p.allows("example.onion") {
+		t.Fail()
+	}
+}
+
+func TestURLPolicyInvalid(t *testing.T) {
+	if _, err := loadURLPolicy(nil, "/does/not/exist", ""); err == nil {
+		t.Fail()
+	}
+	if _, err := loadURLPolicy(nil, "", "/does/not/exist"); err == nil {
+		t.Fail()
+	}
+}
+
+func TestHostTLD(t *testing.T) {
+	for hostname, want := range map[string]string{
+		"example.onion":      "onion",
+		"EXAMPLE.I2P":        "i2p",
+		"a.b.loki.":          "loki",
+		"localhost":          "",
+		"example.onion.com":  "com",
+		"onion.example.test": "test",
+	} {
+		if got := hostTLD(hostname); got != want {
+			t.Errorf("hostTLD(%s): Wanted: %s Got: %s", hostname, want, got)
+		}
+	}
+}
+
+func TestURLPolicyTLDs(t *testing.T) {
+	// Only .onion is allowed by default
+	var nilPolicy *urlPolicy
+	if allowed, _ := nilPolicy.allowsTLD("example.onion"); !allowed {
+		t.Fail()
+	}
+	if allowed, tld := nilPolicy.allowsTLD("example.i2p"); allowed || tld != "i2p" {
+		t.Fail()
+	}
+
+	p, err := loadURLPolicy([]string{"onion", " .I2P", "loki"}, "", "")
+	if err != nil {
+		t.FailNow()
+	}
+
+	for _, hostname := range []string{"example.onion", "example.i2p", "example.loki"} {
+		if allowed, _ := p.allowsTLD(hostname); !allowed {
+			t.Errorf("%s should be allowed", hostname)
+		}
+	}
+	for _, hostname := range []string{"example.com", "onion.example.com", "localhost"} {
+		if allowed, _ := p.allowsTLD(hostname); allowed {
+			t.Errorf("%s should not be allowed", hostname)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"sync"
+)
+
+var errQueueClosed = errors.New("priority queue is closed")
+
+// priorityQueue order the URLs to publish by priority: when URLs are scheduled faster than they can be
+// published, higher priority URLs are published first. at most size URLs are queued, push block when full
+type priorityQueue struct {
+	size   int
+	items  priorityHeap
+	seq    uint64
+	closed bool
+
+	mutex    sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+}
+
+type priorityItem struct {
+	// ctx carry the trace context to propagate
+	ctx      context.Context
+	msg      *messaging.URLTodoMsg
+	priority int
+	// seq keep the URLs of same priority in FIFO order
+	seq    uint64
+	result chan error
+}
+
+// priorityHeap is a min-heap whose minimum is the URL with the highest priority
+type priorityHeap []*priorityItem
+
+func (h priorityHeap) Len() int { return len(h) }
+
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *priorityHeap) Push(x interface{}) { *h = append(*h, x.(*priorityItem)) }
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newPriorityQueue(size int) *priorityQueue {
+	pq := &priorityQueue{size: size}
+	pq.notEmpty = sync.NewCond(&pq.mutex)
+	pq.notFull = sync.NewCond(&pq.mutex)
+	return pq
+}
+
+// push queue given message, blocking while the queue is full. the returned channel
+// receive the result of the publication once the message is published
+func (pq *priorityQueue) push(ctx context.Context, msg *messaging.URLTodoMsg, priority int) <-chan error {
+	result := make(chan error, 1)
+
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	for len(pq.items) >= pq.size && !pq.closed {
+		pq.notFull.Wait()
+	}
+	if pq.closed {
+		result <- errQueueClosed
+		return result
+	}
+
+	pq.seq++
+	heap.Push(&pq.items, &priorityItem{ctx: ctx, msg: msg, priority: priority, seq: pq.seq, result: result})
+	pq.notEmpty.Signal()
+
+	return result
+}
+
+// pop returns the highest priority item, blocking until there is one. nil is returned once closed
+func (pq *priorityQueue) pop() *priorityItem {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	for len(pq.items) == 0 && !pq.closed {
+		pq.notEmpty.Wait()
+	}
+	if len(pq.items) == 0 {
+		return nil
+	}
+
+	item := heap.Pop(&pq.items).(*priorityItem)
+	pq.notFull.Signal()
+
+	return item
+}
+
+// run publish the queued messages using given function until the queue is closed and drained
+func (pq *priorityQueue) run(publish func(ctx context.Context, msg natsutil.Msg) error) {
+	for item := pq.pop(); item != nil; item = pq.pop() {
+		item.result <- publish(item.ctx, item.msg)
+	}
+}
+
+// close stop accepting new messages, the queued ones are still published
+func (pq *priorityQueue) close() {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	pq.closed = true
+	pq.notEmpty.Broadcast()
+	pq.notFull.Broadcast()
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+// waitQueued wait until given number of URLs are queued
+func waitQueued(t *testing.T, pq *priorityQueue, count int) {
+	for i := 0; i < 100; i++ {
+		pq.mutex.Lock()
+		n := len(pq.items)
+		pq.mutex.Unlock()
+		if n == count {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.FailNow()
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	pq := newPriorityQueue(10)
+
+	// Queue URLs before the publisher is started, as if it was busy
+	var results []<-chan error
+	for _, item := range []struct {
+		url      string
+		priority int
+	}{
+		{"http://low.onion", 0},
+		{"http://other-low.onion", 0},
+		{"http://high.onion", 5},
+		{"http://medium.onion", 1},
+	} {
+		results = append(results, pq.push(context.Background(), &messaging.URLTodoMsg{URL: item.url}, item.priority))
+	}
+
+	var published []string
+	done := make(chan struct{})
+	go func() {
+		pq.run(func(ctx context.Context, msg natsutil.Msg) error {
+			published = append(published, msg.(*messaging.URLTodoMsg).URL)
+			return nil
+		})
+		close(done)
+	}()
+
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.FailNow()
+		}
+	}
+	pq.close()
+	<-done
+
+	want := []string{"http://high.onion", "http://medium.onion", "http://low.onion", "http://other-low.onion"}
+	if len(published) != len(want) {
+		t.Fatalf("Wanted: %v Got: %v", want, published)
+	}
+	for i := range want {
+		if published[i] != want[i] {
+			t.Errorf("Wanted: %v Got: %v", want, published)
+			break
+		}
+	}
+}
+
+func TestPriorityQueueFull(t *testing.T) {
+	pq := newPriorityQueue(1)
+	pq.push(context.Background(), &messaging.URLTodoMsg{URL: "http://first.onion"}, 0)
+
+	pushed := make(chan struct{})
+	go func() {
+		pq.push(context.Background(), &messaging.URLTodoMsg{URL: "http://second.onion"}, 0)
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if item := pq.pop(); item == nil || item.msg.URL != "http://first.onion" {
+		t.FailNow()
+	}
+
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Error("push should resume once the queue is not full")
+	}
+
+	// Closed queue should reject new messages
+	pq.close()
+	if err := <-pq.push(context.Background(), &messaging.URLTodoMsg{URL: "http://third.onion"}, 0); err != errQueueClosed {
+		t.Errorf("Wanted: %v Got: %v", errQueueClosed, err)
+	}
+	if item := pq.pop(); item == nil || item.msg.URL != "http://second.onion" {
+		t.Error("queued message should be kept once closed")
+	}
+	if pq.pop() != nil {
+		t.Error("drained closed queue should return nil")
+	}
+}
+
+func TestHandleMessagePriority(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	todoSub, err := nc.SubscribeSync(messaging.URLTodoSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	pq := newPriorityQueue(10)
+	handler := newScheduler(apiClient, withPriorityQueue(pq)).handleMessage
+
+	// Publisher is busy: URLs wait in the queue
+	errs := make(chan error, 2)
+	for i, msg := range []string{`{"url":"http://low.onion"}`, `{"url":"http://high.onion","priority":10}`} {
+		go func(msg string) {
+			errs <- handler(context.Background(), nc, &nats.Msg{Data: []byte(msg)})
+		}(msg)
+
+		waitQueued(t, pq, i+1)
+	}
+
+	go pq.run(func(ctx context.Context, msg natsutil.Msg) error {
+		return natsutil.PublishMsg(nc, msg)
+	})
+	defer pq.close()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.FailNow()
+		}
+	}
+
+	for _, want := range []string{"http://high.onion", "http://low.onion"} {
+		msg, err := todoSub.NextMsg(time.Second)
+		if err != nil {
+			t.FailNow()
+		}
+		var todoMsg messaging.URLTodoMsg
+		if err := natsutil.ReadJSON(msg, &todoMsg); err != nil {
+			t.FailNow()
+		}
+		if todoMsg.URL != want {
+			t.Errorf("Wanted: %s Got: %s", want, todoMsg.URL)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"fmt"
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/time/rate"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimiter throttle the scheduling of URLs on a per hostname basis. Only the most recently seen hostnames are
+// tracked
+type hostLimiter struct {
+	limit    rate.Limit
+	limiters *lru.Cache
+	mutex    sync.Mutex
+}
+
+func newHostLimiter(limit rate.Limit, maxHosts int) (*hostLimiter, error) {
+	// No limit: no need to track anything
+	if limit == rate.Inf {
+		return &hostLimiter{limit: limit}, nil
+	}
+
+	limiters, err := lru.New(maxHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostLimiter{limit: limit, limiters: limiters}, nil
+}
+
+// reserve take the token allowing given hostname to receive a new request. If none is available, the delay after
+// which one will be is returned instead, without taking it
+func (hl *hostLimiter) reserve(hostname string) time.Duration {
+	if hl.limit == rate.Inf {
+		return 0
+	}
+
+	now := time.Now()
+	reservation := hl.getLimiter(hostname).ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return delay
+	}
+
+	return 0
+}
+
+// getLimiter return the limiter associated to given hostname, creating it on first sight
+func (hl *hostLimiter) getLimiter(hostname string) *rate.Limiter {
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+
+	if limiter, exist := hl.limiters.Get(hostname); exist {
+		return limiter.(*rate.Limiter)
+	}
+
+	limiter := rate.NewLimiter(hl.limit, 1)
+	hl.limiters.Add(hostname, limiter)
+	return limiter
+}
+
+// parseRateLimit parse rate limit in the form N/unit (2/s, 30/m, ...)
+// empty value means no limit
+func parseRateLimit(limit string) (rate.Limit, error) {
+	if limit == "" {
+		return rate.Inf, nil
+	}
+
+	parts := strings.Split(limit, "/")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid rate limit %s: expected format N/unit", limit)
+	}
+
+	count, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || count <= 0 {
+		return 0, fmt.Errorf("invalid rate limit %s: invalid count", limit)
+	}
+
+	var per time.Duration
+	switch parts[1] {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return 0, fmt.Errorf("invalid rate limit %s: unknown unit %s", limit, parts[1])
+	}
+
+	return rate.Limit(count / per.Seconds()), nil
+}
@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	if val, err := parseRateLimit(""); err != nil || val != rate.Inf {
+		t.Fail()
+	}
+	if val, err := parseRateLimit("2/s"); err != nil || val != 2 {
+		t.Fail()
+	}
+	if val, err := parseRateLimit("60/m"); err != nil || val != 1 {
+		t.Fail()
+	}
+	if val, err := parseRateLimit("3600/h"); err != nil || val != 1 {
+		t.Fail()
+	}
+
+	for _, invalid := range []string{"2", "2/d", "a/s", "-1/s", "2/s/s"} {
+		if _, err := parseRateLimit(invalid); err == nil {
+			t.Errorf("%s should not be a valid rate limit", invalid)
+		}
+	}
+}
+
+func TestHostLimiterCreation(t *testing.T) {
+	hl, err := newHostLimiter(2, 2)
+	if err != nil {
+		t.FailNow()
+	}
+
+	l1 := hl.getLimiter("example.onion")
+	if l1 == nil {
+		t.FailNow()
+	}
+	if l1.Limit() != 2 {
+		t.Fail()
+	}
+
+	// Same hostname should reuse same bucket
+	if hl.getLimiter("example.onion") != l1 {
+		t.Fail()
+	}
+
+	// Other hostname should have its own bucket
+	if hl.getLimiter("other.onion") == l1 {
+		t.Fail()
+	}
+
+	if hl.limiters.Len() != 2 {
+		t.Fail()
+	}
+
+	// The least recently seen hostname is forgotten
+	hl.getLimiter("third.onion")
+	if hl.limiters.Len() != 2 || hl.limiters.Contains("example.onion") {
+		t.Errorf("Wanted: example.onion forgotten Got: %v", hl.limiters.Keys())
+	}
+}
+
+func TestHostLimiterReserve(t *testing.T) {
+	hl, err := newHostLimiter(10, 10)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if delay := hl.reserve("example.onion"); delay != 0 {
+		t.Errorf("Wanted: 0 Got: %s", delay)
+	}
+
+	// The next token is available in 100ms at 10/s: it is not taken
+	delay := hl.reserve("example.onion")
+	if delay <= 50*time.Millisecond || delay > 100*time.Millisecond {
+		t.Errorf("Wanted: ~100ms Got: %s", delay)
+	}
+	if again := hl.reserve("example.onion"); again <= 50*time.Millisecond || again > delay {
+		t.Errorf("Wanted: at most %s Got: %s", delay, again)
+	}
+
+	// Another host should not be impacted
+	if delay := hl.reserve("other.onion"); delay != 0 {
+		t.Errorf("Wanted: 0 Got: %s", delay)
+	}
+
+	time.Sleep(delay)
+	if delay := hl.reserve("example.onion"); delay != 0 {
+		t.Errorf("Wanted: 0 Got: %s", delay)
+	}
+}
+
+func TestHostLimiterUnlimited(t *testing.T) {
+	hl, err := newHostLimiter(rate.Inf, 0)
+	if err != nil {
+		t.FailNow()
+	}
+
+	for i := 0; i < 100; i++ {
+		if delay := hl.reserve("example.onion"); delay != 0 {
+			t.Errorf("Wanted: 0 Got: %s", delay)
+		}
+	}
+
+	// No bucket should be tracked
+	if hl.limiters != nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/util/duration"
+	"github.com/creekorful/trandoshan/internal/util/rules"
+	"regexp"
+	"time"
+)
+
+// refreshRule associate a refresh delay to the hostnames matching a pattern
+type refreshRule struct {
+	pattern *regexp.Regexp
+	delay   time.Duration
+}
+
+// refreshRules is an ordered list of refresh rules, the first matching rule wins
+type refreshRules []refreshRule
+
+// delay returns the refresh delay to apply to given hostname
+// defaultDelay is returned if no rule matches
+func (rules refreshRules) delay(hostname string, defaultDelay time.Duration) time.Duration {
+	for _, rule := range rules {
+		if rule.pattern.MatchString(hostname) {
+			return rule.delay
+		}
+	}
+
+	return defaultDelay
+}
+
+// loadRefreshRules read & parse the refresh rules file located at given path
+func loadRefreshRules(path string) (refreshRules, error) {
+	var loaded refreshRules
+	if err := rules.Load(path, "refresh", loaded.add); err != nil {
+		return nil, err
+	}
+
+	return loaded, nil
+}
+
+// parseRefreshRules parse given YAML (or JSON) content mapping hostname patterns to refresh delay.
+// order of the rules is preserved
+func parseRefreshRules(content []byte) (refreshRules, error) {
+	var parsed refreshRules
+	if err := rules.Parse(content, "refresh", parsed.add); err != nil {
+		return nil, err
+	}
+
+	return parsed, nil
+}
+
+// add append the rule applying given refresh delay to the hostnames matching given pattern
+func (rules *refreshRules) add(pattern *regexp.Regexp, value interface{}) error {
+	delay, err := duration.ParseStrict(fmt.Sprintf("%v", value))
+	if err != nil {
+		return err
+	}
+
+	*rules = append(*rules, refreshRule{pattern: pattern, delay: delay})
+	return nil
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"errors"
+	"github.com/creekorful/trandoshan/internal/util/rules"
+	"testing"
+	"time"
+)
+
+func TestParseRefreshRules(t *testing.T) {
+	rules, err := parseRefreshRules([]byte(`{".*forum.*": "2h", ".*paste.*": "30m", ".*": "1d"}`))
+	if err != nil {
+		t.FailNow()
+	}
+
+	if len(rules) != 3 {
+		t.FailNow()
+	}
+
+	// Order must be preserved
+	if rules[0].pattern.String() != ".*forum.*" || rules[0].delay != 2*time.Hour {
+		t.Fail()
+	}
+	if rules[1].pattern.String() != ".*paste.*" || rules[1].delay != 30*time.Minute {
+		t.Fail()
+	}
+	if rules[2].pattern.String() != ".*" || rules[2].delay != 24*time.Hour {
+		t.Fail()
+	}
+}
+
+func TestParseRefreshRulesYAML(t *testing.T) {
+	rules, err := parseRefreshRules([]byte("'.*forum.*': 2h\n'.*paste.*': 30m\n"))
+	if err != nil {
+		t.FailNow()
+	}
+
+	if len(rules) != 2 {
+		t.FailNow()
+	}
+	if rules[0].delay != 2*time.Hour || rules[1].delay != 30*time.Minute {
+		t.Fail()
+	}
+}
+
+func TestParseRefreshRulesInvalid(t *testing.T) {
+	_, err := parseRefreshRules([]byte(`{"[a-z": "2h"}`))
+	var ruleErr *rules.Error
+	if !errors.As(err, &ruleErr) {
+		t.FailNow()
+	}
+	if ruleErr.Pattern != "[a-z" {
+		t.Fail()
+	}
+
+	_, err = parseRefreshRules([]byte(`{".*": "2days"}`))
+	if !errors.As(err, &ruleErr) {
+		t.FailNow()
+	}
+	if ruleErr.Pattern != ".*" {
+		t.Fail()
+	}
+
+	if _, err := parseRefreshRules([]byte(`not a map`)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRefreshRulesDelay(t *testing.T) {
+	rules, err := parseRefreshRules([]byte(`{".*forum.*": "2h", ".*f.*": "30m"}`))
+	if err != nil {
+		t.FailNow()
+	}
+
+	// First matching rule wins
+	if rules.delay("myforum.onion", -1) != 2*time.Hour {
+		t.Fail()
+	}
+	if rules.delay("foo.onion", -1) != 30*time.Minute {
+		t.Fail()
+	}
+
+	// Fallback to default delay
+	if rules.delay("example.onion", time.Hour) != time.Hour {
+		t.Fail()
+	}
+	if rules.delay("example.onion", -1) != -1 {
+		t.Fail()
+	}
+
+	// No rules at all
+	var empty refreshRules
+	if empty.delay("example.onion", time.Minute) != time.Minute {
+		t.Fail()
+	}
+}
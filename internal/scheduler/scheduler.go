@@ -1,44 +1,285 @@
 package scheduler
 
 import (
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/creekorful/trandoshan/api"
 	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/circuitbreaker"
+	"github.com/creekorful/trandoshan/internal/util/duration"
+	"github.com/creekorful/trandoshan/internal/util/heartbeat"
 	"github.com/creekorful/trandoshan/internal/util/logging"
 	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/creekorful/trandoshan/internal/util/onion"
+	"github.com/creekorful/trandoshan/internal/util/retry"
+	"github.com/creekorful/trandoshan/internal/util/tracing"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
-	"github.com/xhit/go-str2duration/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"net"
+	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
+var tracer = otel.Tracer("github.com/creekorful/trandoshan/internal/scheduler")
+
 // GetApp return the scheduler app
 func GetApp() *cli.App {
 	return &cli.App{
 		Name:    "tdsh-scheduler",
-		Version: "0.4.0",
+		Version: "0.5.0",
 		Usage:   "Trandoshan scheduler process",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			tracing.GetOTELEndpointFlag(),
 			&cli.StringFlag{
 				Name:     "nats-uri",
-				Usage:    "URI to the NATS server",
+				Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
 				Required: true,
 			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			natsutil.GetClusterRoutesFlag(),
+			heartbeat.GetIntervalFlag(),
+			&cli.BoolFlag{
+				Name:  "use-jetstream",
+				Usage: "Use JetStream durable consumers to read found URLs",
+			},
+			&cli.DurationFlag{
+				Name:  "jetstream-nak-delay",
+				Usage: "Delay before redelivery of a message that failed to be processed (JetStream only)",
+				Value: 10 * time.Second,
+			},
+			&cli.StringSliceFlag{
+				Name:  "subjects",
+				Usage: "NATS subjects to read found URLs from (changes require a restart)",
+				Value: cli.NewStringSlice(messaging.URLFoundSubject),
+			},
 			&cli.StringFlag{
-				Name:     "api-uri",
-				Usage:    "URI to the API server",
-				Required: true,
+				Name:  "queue-group",
+				Usage: "NATS queue group (schedulers in the same group share the load, each group receive every URL)",
+				Value: "schedulers",
+			},
+			&cli.IntFlag{
+				Name:  "workers",
+				Usage: "Number of URLs processed concurrently",
+				Value: 1,
+			},
+			&cli.IntFlag{
+				Name:  "api-cache-size",
+				Usage: "Number of API search responses kept in memory for the URLs found repeatedly (0 = disabled)",
+			},
+			&cli.DurationFlag{
+				Name:  "api-cache-ttl",
+				Usage: "Duration for which the API search responses are kept in memory",
+				Value: time.Minute,
+			},
+			&cli.IntFlag{
+				Name:  "api-retry-count",
+				Usage: "Number of retries when an API call fails (the rate limited ones being retried by the client first)",
+				Value: 3,
+			},
+			&cli.DurationFlag{
+				Name:  "api-retry-max-delay",
+				Usage: "Maximum delay between two retries of an API call",
+				Value: 30 * time.Second,
+			},
+			&cli.IntFlag{
+				Name:  "api-cb-threshold",
+				Usage: "Number of consecutive API failures before deferring URLs (0 = disabled)",
+			},
+			&cli.DurationFlag{
+				Name:  "api-cb-timeout",
+				Usage: "Delay before trying to reach the API again once URLs are deferred",
+				Value: 30 * time.Second,
+			},
+			&cli.IntFlag{
+				Name:  "batch-size",
+				Usage: "Number of URLs to search for in a single bulk API call (1 = disabled)",
+				Value: 1,
+			},
+			&cli.DurationFlag{
+				Name:  "batch-timeout",
+				Usage: "Maximum time to wait for a batch to be filled before sending it",
+				Value: 100 * time.Millisecond,
+			},
+			&cli.DurationFlag{
+				Name:  "startup-batch-delay",
+				Usage: "Window after startup during which the received URLs are checked using bulk searches sent at its end (e.g: 500ms)",
+			},
+			&cli.StringFlag{
+				Name:  "cron-schedule",
+				Usage: "Cron expression of the start of the windows during which URLs are scheduled, the others being deferred (e.g: '0 22 * * *')",
+			},
+			&cli.DurationFlag{
+				Name:  "cron-window",
+				Usage: "Duration of the windows started by --cron-schedule",
+				Value: time.Hour,
+			},
+			&cli.DurationFlag{
+				Name:  "dedup-window",
+				Usage: "Duration during which an URL received again is ignored (0 = disabled)",
+				Value: 60 * time.Second,
+			},
+			&cli.IntFlag{
+				Name:  "dedup-size",
+				Usage: "Maximum number of URLs kept in the deduplication cache",
+				Value: 10000,
+			},
+			&cli.StringFlag{
+				Name:  "redis-uri",
+				Usage: "URI of the Redis server used to share the deduplication cache (e.g: redis://localhost:6379/0)",
+			},
+			&cli.StringFlag{
+				Name:  "state-bucket",
+				Usage: "JetStream key-value bucket used to persist the scheduled URLs across restarts (requires deduplication)",
+			},
+			&cli.BoolFlag{
+				Name:  "deduplicate-content",
+				Usage: "Do not refresh the URLs whose content has first been crawled at another URL (e.g: mirrors)",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-dead-urls",
+				Usage: "Do not schedule the URLs which have never returned a 200 (requires --record-crawls on the API)",
+			},
+			&cli.IntFlag{
+				Name:  "min-attempts",
+				Usage: "Number of crawls without a 200 after which an URL is considered dead",
+				Value: 3,
+			},
+			&cli.UintFlag{
+				Name:  "bloom-filter-capacity",
+				Usage: "Number of URLs remembered by the bloom filter checked before the API (0 = disabled, requires no refresh)",
+			},
+			&cli.Float64Flag{
+				Name:  "bloom-filter-fp-rate",
+				Usage: "False-positive rate of the bloom filter (i.e: ratio of new URLs wrongly skipped once it is full)",
+				Value: 0.001,
 			},
 			&cli.StringFlag{
 				Name:  "refresh-delay",
-				Usage: "Duration before allowing crawl of existing resource (none = never)",
+				Usage: "Duration before allowing crawl of existing resource, e.g: 7d or 12h (none = never)",
+			},
+			&cli.StringFlag{
+				Name:  "refresh-rules",
+				Usage: "Path to a YAML/JSON file mapping hostname patterns to refresh delay",
+			},
+			&cli.StringSliceFlag{
+				Name:  "allowed-schemes",
+				Usage: "Schemes of the URLs that may be crawled",
+				Value: cli.NewStringSlice("http", "https"),
+			},
+			&cli.StringSliceFlag{
+				Name:  "allowed-tlds",
+				Usage: "Pseudo-TLDs of the hostnames that may be crawled (e.g: onion,i2p,loki)",
+				Value: cli.NewStringSlice(defaultTLD),
+			},
+			&cli.StringFlag{
+				Name:  "blacklist",
+				Usage: "Path to a newline-delimited file of hostname patterns that should never be crawled (reloaded on SIGHUP)",
+			},
+			&cli.StringFlag{
+				Name:  "allowlist",
+				Usage: "Path to a newline-delimited file of the only hostname patterns that should be crawled (reloaded on SIGHUP)",
+			},
+			&cli.IntFlag{
+				Name:  "max-url-length",
+				Usage: "Maximum length (in bytes) of the URLs to crawl (0 = unlimited)",
+				Value: 2048,
+			},
+			&cli.IntFlag{
+				Name:  "max-depth",
+				Usage: "Maximum depth (number of links followed from the seed URL) of the URLs to crawl (-1 = unlimited)",
+				Value: -1,
+			},
+			&cli.StringFlag{
+				Name:  "rate-limit",
+				Usage: "Maximum number of URLs scheduled per hostname (e.g: 2/s, 30/m) (none = unlimited)",
+			},
+			&cli.IntFlag{
+				Name:  "rate-limit-max-hosts",
+				Usage: "Maximum number of hostnames tracked by the rate limit, the least recently seen being forgotten",
+				Value: 10000,
+			},
+			&cli.IntFlag{
+				Name:  "max-retries",
+				Usage: "Number of failures before publishing URL to the dead-letter queue (0 = disabled)",
+				Value: 3,
+			},
+			&cli.IntFlag{
+				Name:  "priority-queue-size",
+				Usage: "Maximum number of URLs waiting to be published, higher priority URLs are published first (0 = disabled)",
+				Value: 1000,
+			},
+			&cli.DurationFlag{
+				Name:  "publish-timeout",
+				Usage: "Maximum time to wait for NATS to confirm the publication of the scheduled URLs (0 = not confirmed)",
+				Value: 5 * time.Second,
+			},
+			&cli.Int64Flag{
+				Name:  "max-queue-depth",
+				Usage: "Maximum number of URLs waiting to be crawled before delaying the scheduling (0 = unlimited, requires crawlers using JetStream)",
+			},
+			&cli.DurationFlag{
+				Name:  "back-pressure-delay",
+				Usage: "Delay before checking the queue depth again once the maximum is reached",
+				Value: 5 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "shadow-subject",
+				Usage: "Subject to which the scheduled URLs are also published, to test a crawler configuration (e.g: url.shadow)",
+			},
+			&cli.StringFlag{
+				Name:  "seed-file",
+				Usage: "Path to a newline-delimited file of URLs to publish on startup (new URLs are published on change)",
 			},
-		},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Log scheduling decisions without publishing anything (summary is printed on SIGINT)",
+			},
+			&cli.DurationFlag{
+				Name:  "shutdown-timeout",
+				Usage: "Maximum time to wait for the in-flight messages to be processed on SIGTERM (or SIGINT in dry-run mode)",
+				Value: 30 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "health-addr",
+				Usage: "Address on which to expose the /healthz & /readyz endpoints",
+				Value: ":8080",
+			},
+			&cli.DurationFlag{
+				Name:  "health-timeout",
+				Usage: "Timeout of the health checks",
+				Value: 2 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "metrics-addr",
+				Usage: "Address on which to expose the prometheus metrics (e.g: :9090)",
+			},
+			&cli.StringFlag{
+				Name:  "mgmt-addr",
+				Usage: "Address on which to expose the management API changing the configuration (e.g: 127.0.0.1:8081)",
+			},
+		}, api.GetClientFlags()...),
 		Action: execute,
 	}
 }
@@ -46,95 +287,995 @@ func GetApp() *cli.App {
 func execute(ctx *cli.Context) error {
 	logging.ConfigureLogger(ctx)
 
+	shutdownTracer, err := tracing.ConfigureTracer(ctx, "tdsh-scheduler")
+	if err != nil {
+		return err
+	}
+	defer shutdownTracer()
+
 	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-scheduler")
 
 	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
 	log.Debug().Str("uri", ctx.String("api-uri")).Msg("Using API server")
 
-	refreshDelay := parseRefreshDelay(ctx.String("refresh-delay"))
+	refreshDelay, err := parseRefreshDelay(ctx.String("refresh-delay"))
+	if err != nil {
+		return err
+	}
 	if refreshDelay != -1 {
 		log.Debug().Stringer("delay", refreshDelay).Msg("Existing resources will be crawled again")
 	} else {
 		log.Debug().Msg("Existing resources will NOT be crawled again")
 	}
 
-	// Create the API client
-	apiClient := api.NewClient(ctx.String("api-uri"))
+	refreshRules, err := loadRefreshRules(ctx.String("refresh-rules"))
+	if err != nil {
+		return err
+	}
+	if len(refreshRules) > 0 {
+		log.Debug().Int("count", len(refreshRules)).Msg("Loaded refresh rules")
+	}
+
+	policy, err := loadURLPolicy(ctx.StringSlice("allowed-tlds"), ctx.String("allowlist"), ctx.String("blacklist"))
+	if err != nil {
+		return err
+	}
+	if path := ctx.String("allowlist"); path != "" {
+		log.Debug().Str("path", path).Msg("Loaded allowlist")
+	}
+	if path := ctx.String("blacklist"); path != "" {
+		log.Debug().Str("path", path).Msg("Loaded blacklist")
+	}
+
+	// Reload allowlist & blacklist on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reloadOnSignal(hup, policy.lists()...)
+
+	rateLimit, err := parseRateLimit(ctx.String("rate-limit"))
+	if err != nil {
+		return err
+	}
+	if ctx.String("rate-limit") != "" {
+		log.Debug().Str("limit", ctx.String("rate-limit")).Msg("Scheduling will be rate limited per hostname")
+	}
+	limiter, err := newHostLimiter(rateLimit, ctx.Int("rate-limit-max-hosts"))
+	if err != nil {
+		return err
+	}
+
+	// Each subject is processed sequentially, unless using workers
+	workers := ctx.Int("workers")
+	if workers < 1 {
+		return fmt.Errorf("--workers should be at least 1")
+	}
+	concurrency := len(ctx.StringSlice("subjects"))
+	if workers > 1 {
+		log.Debug().Int("workers", workers).Msg("Processing URLs concurrently")
+		concurrency = workers
+	}
+
+	// Create the API client, keeping an idle connection per concurrent handler
+	apiClient, err := api.NewClientFromContext(ctx,
+		api.WithTransport(concurrency, api.DefaultIdleConnTimeout),
+		api.WithRoundTripper(func(rt http.RoundTripper) http.RoundTripper {
+			return otelhttp.NewTransport(rt)
+		}),
+		api.WithCache(ctx.Int("api-cache-size"), ctx.Duration("api-cache-ttl")))
+	if err != nil {
+		return err
+	}
 
 	// Create the NATS subscriber
-	sub, err := natsutil.NewSubscriber(ctx.String("nats-uri"))
+	var sub *natsutil.Connection
+	if ctx.Bool("use-jetstream") {
+		log.Debug().Msg("Using JetStream")
+		sub, err = natsutil.NewJetStreamConnection(ctx.String("nats-uri"), ctx.Duration("jetstream-nak-delay"),
+			natsutil.GetOptions(ctx)...)
+	} else {
+		sub, err = natsutil.NewConnection(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	}
 	if err != nil {
 		return err
 	}
 	defer sub.Close()
 
+	defer heartbeat.Start(ctx, sub)()
+
+	retryOpts := retry.DefaultOptions()
+	retryOpts.Count = ctx.Int("api-retry-count")
+	retryOpts.MaxDelay = ctx.Duration("api-retry-max-delay")
+	retryOpts.DelayFor = rateLimitDelay(retryOpts.MaxDelay)
+
+	var breaker *circuitbreaker.CircuitBreaker
+	if threshold := ctx.Int("api-cb-threshold"); threshold > 0 {
+		log.Debug().Int("threshold", threshold).Msg("URLs will be deferred when API is unavailable")
+		breaker = circuitbreaker.New(threshold, ctx.Duration("api-cb-timeout"))
+	}
+
+	var report *dryRunReport
+	if ctx.Bool("dry-run") {
+		log.Info().Msg("Running in dry-run mode: nothing will be published")
+		report = newDryRunReport()
+	}
+
+	if maxDepth := ctx.Int("max-depth"); maxDepth != -1 {
+		log.Debug().Int("depth", maxDepth).Msg("URLs will be crawled up to max depth")
+	}
+
+	var batcher *searchBatcher
+	if batchSize := ctx.Int("batch-size"); batchSize > 1 {
+		log.Debug().Int("size", batchSize).Msg("Searching URLs in batch")
+		batcher = newSearchBatcher(apiClient, batchSize, ctx.Duration("batch-timeout"))
+	}
+
+	var warm *warmUp
+	if window := ctx.Duration("startup-batch-delay"); window > 0 && report == nil {
+		log.Debug().Stringer("window", window).Msg("Searching URLs received at startup in batch")
+		warm = newWarmUp(apiClient, window)
+	}
+
+	var dedup dedupCache
+	var state *schedulerState
+	if uri := ctx.String("redis-uri"); uri != "" {
+		if ctx.String("state-bucket") != "" {
+			return fmt.Errorf("--state-bucket cannot be used with --redis-uri")
+		}
+
+		opts, err := redis.ParseURL(uri)
+		if err != nil {
+			return fmt.Errorf("invalid --redis-uri: %s", err)
+		}
+
+		// URLs are ignored until they may be crawled again
+		ttl := ctx.Duration("dedup-window")
+		if refreshDelay != -1 {
+			ttl = refreshDelay
+		}
+
+		log.Debug().Str("addr", opts.Addr).Stringer("ttl", ttl).Msg("Using Redis deduplication cache")
+		dedup = newRedisDedupCache(redis.NewClient(opts), ttl)
+	} else if window := ctx.Duration("dedup-window"); window > 0 {
+		log.Debug().Stringer("window", window).Msg("Duplicate URLs will be ignored")
+		memoryCache, err := newMemoryDedupCache(ctx.Int("dedup-size"), window)
+		if err != nil {
+			return err
+		}
+		dedup = memoryCache
+
+		// Restore the recently scheduled URLs
+		if bucket := ctx.String("state-bucket"); bucket != "" {
+			// Entries expire once the URL may be crawled again
+			ttl := time.Duration(0)
+			if refreshDelay != -1 {
+				ttl = refreshDelay
+			}
+
+			kv, err := sub.KeyValue(bucket, ttl)
+			if err != nil {
+				return fmt.Errorf("error while opening state bucket: %s", err)
+			}
+			state = newSchedulerState(kv, ttl)
+
+			count, err := state.warm(memoryCache)
+			if err != nil {
+				return fmt.Errorf("error while loading state: %s", err)
+			}
+			log.Info().Str("bucket", bucket).Int("count", count).Msg("Restored scheduled URLs")
+		}
+	} else if ctx.String("state-bucket") != "" {
+		return fmt.Errorf("--state-bucket requires --dedup-window to be set")
+	}
+
+	// Skip the URLs known to be crawled without querying the API. Since URLs cannot be removed from
+	// a bloom filter, it cannot be used when URLs are crawled again
+	var bloom *bloomFilter
+	if capacity := ctx.Uint("bloom-filter-capacity"); capacity > 0 {
+		if refreshDelay != -1 || len(refreshRules) > 0 {
+			return fmt.Errorf("--bloom-filter-capacity cannot be used with --refresh-delay or --refresh-rules")
+		}
+
+		fpRate := ctx.Float64("bloom-filter-fp-rate")
+		if fpRate <= 0 || fpRate >= 1 {
+			return fmt.Errorf("--bloom-filter-fp-rate should be between 0 and 1")
+		}
+
+		log.Debug().Uint("capacity", capacity).Float64("fp-rate", fpRate).Msg("Using bloom filter")
+		bloom = newBloomFilter(capacity, fpRate)
+	}
+
+	var window *crawlWindow
+	if expr := ctx.String("cron-schedule"); expr != "" {
+		window, err = newCrawlWindow(expr, ctx.Duration("cron-window"))
+		if err != nil {
+			return fmt.Errorf("invalid --cron-schedule: %s", err)
+		}
+		log.Debug().Str("schedule", expr).Stringer("window", window.window).Msg("URLs will be scheduled within the crawl window")
+	}
+
+	// Wait for the scheduled URLs to be received by NATS (stored when using JetStream)
+	publish := sub.PublishMsgWithContext
+	if timeout := ctx.Duration("publish-timeout"); timeout > 0 {
+		log.Debug().Stringer("timeout", timeout).Msg("Scheduled URLs publication will be confirmed")
+		publish = func(ctx context.Context, msg natsutil.Msg) error {
+			return sub.PublishMsgConfirmed(ctx, msg, timeout)
+		}
+	}
+
+	// Publish higher priority URLs first
+	var queue *priorityQueue
+	if size := ctx.Int("priority-queue-size"); size > 0 && report == nil {
+		log.Debug().Int("size", size).Msg("Publishing URLs by priority")
+		queue = newPriorityQueue(size)
+		go queue.run(publish)
+		defer queue.close()
+	}
+
+	opts := []Option{
+		withRefresh(refreshDelay, refreshRules),
+		withPolicy(policy),
+		withMaxDepth(ctx.Int("max-depth")),
+		withMaxURLLength(ctx.Int("max-url-length")),
+		withLimiter(limiter),
+		withPriorityQueue(queue),
+		withPublisher(publish),
+		withRetry(retryOpts, breaker),
+		withBatcher(batcher),
+		withWarmUp(warm),
+		withReport(report),
+		withDedup(dedup, state),
+		withBloomFilter(bloom),
+		withCrawlWindow(window),
+		withOnionValidation(),
+		withAllowedSchemes(ctx.StringSlice("allowed-schemes")),
+	}
+	if ctx.Bool("deduplicate-content") {
+		log.Debug().Msg("Skipping URLs with duplicate content")
+		opts = append(opts, withContentDeduplication(apiClient))
+	}
+	if ctx.Bool("skip-dead-urls") {
+		minAttempts := ctx.Int("min-attempts")
+		if minAttempts < 1 {
+			return fmt.Errorf("--min-attempts should be at least 1")
+		}
+		log.Debug().Int("min-attempts", minAttempts).Msg("Skipping dead URLs")
+		opts = append(opts, withDeadURLFilter(apiClient, minAttempts))
+	}
+
+	if maxDepth := ctx.Int64("max-queue-depth"); maxDepth > 0 {
+		delay := ctx.Duration("back-pressure-delay")
+		if delay <= 0 {
+			return fmt.Errorf("--back-pressure-delay should be positive")
+		}
+		log.Debug().Int64("max", maxDepth).Stringer("delay", delay).Msg("Scheduling will back off when url.todo is full")
+		opts = append(opts, withBackPressure(&backPressure{
+			queueDepth: func() (int64, error) {
+				return sub.QueueDepth(messaging.URLTodoSubject, crawlersQueue)
+			},
+			maxDepth: maxDepth,
+			delay:    delay,
+		}))
+	}
+
+	if subject := ctx.String("shadow-subject"); subject != "" {
+		if subject == messaging.URLTodoSubject {
+			return fmt.Errorf("--shadow-subject should not be %s", messaging.URLTodoSubject)
+		}
+		log.Debug().Str("subject", subject).Msg("Publishing the scheduled URLs to the shadow subject")
+		opts = append(opts, withShadowSubject(subject))
+	}
+
+	sched := newScheduler(apiClient, opts...)
+	handler := natsutil.MsgHandler(sched.handleMessage)
+
+	// Publish failing URLs to the dead-letter queue
+	if maxRetries := ctx.Int("max-retries"); maxRetries > 0 && report == nil {
+		tracker, err := newFailureTracker(failureTrackerSize)
+		if err != nil {
+			return err
+		}
+
+		handler = withDeadLetter(handler, tracker, maxRetries)
+
+		// Keep the dead URLs until they are requeued
+		if err := sub.KeepUntilAcked(messaging.URLDeadSubject); err != nil {
+			log.Warn().Str("err", err.Error()).
+				Msg("Unable to create the dead-letter stream: dead URLs are lost unless dlq-requeue is running")
+		}
+	}
+
+	// Stop on SIGTERM once the in-flight messages are processed
+	inFlight := &inFlightTracker{}
+	process := inFlight.wrap(handler)
+	if workers > 1 {
+		pool := newWorkerPool(workers, handler, inFlight)
+		defer pool.close()
+
+		process = pool.dispatch
+	}
+
+	if warm != nil {
+		process = warm.wrap(handler, process, inFlight)
+		defer warm.close()
+	}
+	handler = process
+
+	shutdown := make(chan struct{})
+	terminate := make(chan os.Signal, 1)
+	signal.Notify(terminate, syscall.SIGTERM)
+	// Stop on SIGINT & print the summary when running in dry-run mode
+	if report != nil {
+		signal.Notify(terminate, os.Interrupt)
+	}
+	defer signal.Stop(terminate)
+	go func() {
+		shutdownOnSignal(terminate, sub, inFlight, ctx.Duration("shutdown-timeout"))
+		close(shutdown)
+	}()
+
+	if path := ctx.String("seed-file"); path != "" {
+		if report != nil {
+			log.Warn().Str("path", path).Msg("Seed file is ignored in dry-run mode")
+		} else if err := startSeedFile(path, sub); err != nil {
+			return err
+		}
+	}
+
+	if addr := ctx.String("metrics-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing metrics")
+		if err := natsutil.StartMetricsServer(addr, sub); err != nil {
+			return err
+		}
+	}
+
+	if addr := ctx.String("health-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing health endpoints")
+		startHealthServer(addr, newHealthChecker(sub, ctx.String("api-uri"), ctx.Duration("health-timeout")))
+	}
+
+	if addr := ctx.String("mgmt-addr"); addr != "" {
+		log.Debug().Str("addr", addr).Msg("Exposing management API")
+		startManagementServer(addr, newConfigManager(sched))
+	}
+
+	log.Debug().Strs("subjects", ctx.StringSlice("subjects")).Msg("Reading URLs from subjects")
 	log.Info().Msg("Successfully initialized tdsh-scheduler. Waiting for URLs")
 
-	if err := sub.QueueSubscribe(messaging.URLFoundSubject, "schedulers", handleMessage(apiClient, refreshDelay)); err != nil {
+	log.Debug().Str("group", ctx.String("queue-group")).Msg("Using queue group")
+	err = subscribeAll(sub, ctx.StringSlice("subjects"), ctx.String("queue-group"), handler)
+
+	// Subscriber has been stopped: wait for the shutdown to complete
+	if err == nil {
+		<-shutdown
+	}
+
+	if report != nil {
+		report.print(ctx.App.Writer)
+		if err == nats.ErrConnectionClosed {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// startSeedFile publish the seed URLs once subscribed (so the seeds are not lost), then watch for new seeds
+func startSeedFile(path string, sub *natsutil.Connection) error {
+	seeds := newSeedFile(path, sub)
+
+	// Make sure seed file is readable before starting
+	if _, err := readSeeds(path); err != nil {
 		return err
 	}
 
+	watcher, err := newSeedWatcher(path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for !sub.IsSubscribed() {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		count, err := seeds.publishNew()
+		if err != nil {
+			log.Err(err).Str("path", path).Msg("Error while publishing seed URLs")
+		}
+		log.Info().Str("path", path).Int("count", count).Msg("Published seed URLs")
+
+		seeds.watch(watcher)
+	}()
+
 	return nil
 }
 
-func handleMessage(apiClient api.Client, refreshDelay time.Duration) natsutil.MsgHandler {
-	return func(nc *nats.Conn, msg *nats.Msg) error {
-		var urlMsg messaging.URLFoundMsg
-		if err := natsutil.ReadJSON(msg, &urlMsg); err != nil {
-			return err
+// subscribeAll subscribe to each given subject using the same queue & handler
+// it blocks until one of the subscriptions terminates
+func subscribeAll(sub natsutil.Subscriber, subjects []string, queue string, handler natsutil.MsgHandler) error {
+	errs := make(chan error, len(subjects))
+	for _, subject := range subjects {
+		go func(subject string) {
+			errs <- sub.QueueSubscribe(subject, queue, handler)
+		}(subject)
+	}
+
+	return <-errs
+}
+
+// scheduler decide which URLs should be crawled
+type scheduler struct {
+	policy       *urlPolicy
+	maxURLLength int
+	limiter      *hostLimiter
+	queue        *priorityQueue
+	// publish the scheduled URLs when there is no priority queue (nil = using the handler connection)
+	publisher func(ctx context.Context, msg natsutil.Msg) error
+	report    *dryRunReport
+	dedup     dedupCache
+	state     *schedulerState
+	bloom     *bloomFilter
+	window    *crawlWindow
+	// shadowSubject is the subject the scheduled URLs are also published to (empty = disabled)
+	shadowSubject string
+	// validateOnion reject the .onion hostnames which are not valid v2 or v3 addresses
+	validateOnion bool
+	// allowedSchemes are the lowercase URL schemes which may be crawled (nil = any scheme)
+	allowedSchemes map[string]bool
+	// backPressure delay the scheduled URLs while url.todo is full (nil = never)
+	backPressure *backPressure
+
+	// depth & blacklist are applied before the custom filters, then deduplication, refresh after it
+	depth     *DepthFilter
+	blacklist *BlacklistFilter
+	filters   []Filter
+	refresh   *RefreshDelayFilter
+	content   *DuplicateContentFilter
+	dead      *DeadURLFilter
+	// guard retry the API calls of the filters, shared so that they open the same circuit breaker
+	guard *apiGuard
+}
+
+// Option configure the scheduler
+type Option func(s *scheduler)
+
+// WithFilters add given filters, called in order after the built-in ones
+func WithFilters(filters ...Filter) Option {
+	return func(s *scheduler) {
+		s.filters = append(s.filters, filters...)
+	}
+}
+
+func withMaxDepth(maxDepth int) Option {
+	return func(s *scheduler) {
+		s.depth = NewDepthFilter(maxDepth)
+	}
+}
+
+func withPolicy(policy *urlPolicy) Option {
+	return func(s *scheduler) {
+		s.policy = policy
+		s.blacklist = &BlacklistFilter{policy: policy}
+	}
+}
+
+func withRefresh(refreshDelay time.Duration, refreshRules refreshRules) Option {
+	return func(s *scheduler) {
+		s.refresh.refreshDelay = refreshDelay
+		s.refresh.refreshRules = refreshRules
+	}
+}
+
+func withRetry(retryOpts retry.Options, breaker *circuitbreaker.CircuitBreaker) Option {
+	return func(s *scheduler) {
+		s.guard.retryOpts = retryOpts
+		s.guard.breaker = breaker
+	}
+}
+
+// rateLimitDelay returns the function making the retries wait for the delay requested by the API
+// when rate limited, up to maxDelay (0 = no limit)
+func rateLimitDelay(maxDelay time.Duration) func(err error) (time.Duration, bool) {
+	return func(err error) (time.Duration, bool) {
+		var rateLimitedErr *api.RateLimitedError
+		if !errors.As(err, &rateLimitedErr) || rateLimitedErr.RetryAfter <= 0 {
+			return 0, false
+		}
+
+		if maxDelay > 0 && rateLimitedErr.RetryAfter > maxDelay {
+			return maxDelay, true
 		}
+		return rateLimitedErr.RetryAfter, true
+	}
+}
+
+func withBatcher(batcher *searchBatcher) Option {
+	return func(s *scheduler) {
+		s.refresh.batcher = batcher
+	}
+}
+
+func withWarmUp(warm *warmUp) Option {
+	return func(s *scheduler) {
+		s.refresh.warmUp = warm
+	}
+}
+
+func withMaxURLLength(maxURLLength int) Option {
+	return func(s *scheduler) {
+		s.maxURLLength = maxURLLength
+	}
+}
+
+func withLimiter(limiter *hostLimiter) Option {
+	return func(s *scheduler) {
+		s.limiter = limiter
+	}
+}
+
+func withPriorityQueue(queue *priorityQueue) Option {
+	return func(s *scheduler) {
+		s.queue = queue
+	}
+}
+
+func withPublisher(publisher func(ctx context.Context, msg natsutil.Msg) error) Option {
+	return func(s *scheduler) {
+		s.publisher = publisher
+	}
+}
+
+func withReport(report *dryRunReport) Option {
+	return func(s *scheduler) {
+		s.report = report
+	}
+}
+
+func withDedup(dedup dedupCache, state *schedulerState) Option {
+	return func(s *scheduler) {
+		s.dedup = dedup
+		s.state = state
+	}
+}
+
+func withContentDeduplication(apiClient api.Client) Option {
+	return func(s *scheduler) {
+		s.content = NewDuplicateContentFilter(apiClient)
+		s.content.guard = s.guard
+	}
+}
+
+func withDeadURLFilter(apiClient api.Client, minAttempts int) Option {
+	return func(s *scheduler) {
+		s.dead = NewDeadURLFilter(apiClient, minAttempts)
+		s.dead.guard = s.guard
+	}
+}
+
+func withCrawlWindow(window *crawlWindow) Option {
+	return func(s *scheduler) {
+		s.window = window
+	}
+}
+
+func withOnionValidation() Option {
+	return func(s *scheduler) {
+		s.validateOnion = true
+	}
+}
+
+func withAllowedSchemes(schemes []string) Option {
+	return func(s *scheduler) {
+		s.allowedSchemes = map[string]bool{}
+		for _, scheme := range schemes {
+			s.allowedSchemes[strings.ToLower(strings.TrimSpace(scheme))] = true
+		}
+	}
+}
+
+func withBackPressure(bp *backPressure) Option {
+	return func(s *scheduler) {
+		s.backPressure = bp
+	}
+}
+
+func withShadowSubject(subject string) Option {
+	return func(s *scheduler) {
+		s.shadowSubject = subject
+	}
+}
+
+func withBloomFilter(bloom *bloomFilter) Option {
+	return func(s *scheduler) {
+		s.bloom = bloom
+	}
+}
+
+// newScheduler create a scheduler using given API client. by default every URL is crawled once
+func newScheduler(apiClient api.Client, opts ...Option) *scheduler {
+	s := &scheduler{
+		limiter:   &hostLimiter{limit: rate.Inf},
+		depth:     NewDepthFilter(-1),
+		blacklist: &BlacklistFilter{},
+		refresh:   NewRefreshDelayFilter(apiClient, -1),
+		guard:     &apiGuard{},
+	}
+	s.refresh.guard = s.guard
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// crawledFilters returns the enabled filters applying to the crawled URLs, called after the refresh delay
+func (s *scheduler) crawledFilters() []Filter {
+	var filters []Filter
+	if s.content != nil {
+		filters = append(filters, s.content)
+	}
+	if s.dead != nil {
+		filters = append(filters, s.dead)
+	}
+	return filters
+}
+
+// handleMessage process an URL found message, tracing it using the trace context propagated in its headers
+func (s *scheduler) handleMessage(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+	ctx, span := tracer.Start(natsutil.ContextFromMsg(ctx, msg), "scheduler.handleMessage",
+		trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+
+	err := s.process(ctx, nc, msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+func (s *scheduler) process(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+	logger := messageLogger(msg)
+
+	var urlMsg messaging.URLFoundMsg
+	if err := natsutil.ReadJSON(msg, &urlMsg); err != nil {
+		schedulerErrors.WithLabelValues(errorKindDecode).Inc()
+		return err
+	}
+
+	urlsReceived.Inc()
+
+	// Correlate the messages published for the URL: the trace ID is generated if the URL has not been traced yet
+	traceID := urlMsg.TraceID
+	if traceID == "" {
+		traceID = natsutil.TraceIDFromContext(ctx)
+	}
+	if traceID == "" {
+		traceID = uuid.New().String()
+	}
+	ctx = natsutil.WithTraceID(ctx, traceID)
+	logger = logger.With().Str("trace_id", traceID).Logger()
+
+	if urlMsg.Source != "" {
+		logger = logger.With().Str("source", urlMsg.Source).Logger()
+	}
 
-		log.Debug().Str("url", urlMsg.URL).Msg("Processing URL")
+	logger.Debug().Str("url", urlMsg.URL).Int("depth", urlMsg.Depth).Msg("Processing URL")
 
-		u, err := url.Parse(urlMsg.URL)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("url", urlMsg.URL), attribute.Int("depth", urlMsg.Depth))
+	ctx = contextWithDepth(logger.WithContext(ctx), urlMsg.Depth)
+
+	u, err := url.Parse(urlMsg.URL)
+	if err != nil {
+		schedulerErrors.WithLabelValues(errorKindParse).Inc()
+		logger.Err(err).Msg("Error while parsing URL")
+		return err
+	}
+
+	// Make sure URL is not abnormally long
+	if s.maxURLLength > 0 && len(urlMsg.URL) > s.maxURLLength {
+		logger.Warn().Int("length", len(urlMsg.URL)).Int("max", s.maxURLLength).Msg("URL is too long")
+		urlsRejectedLength.Inc()
+		s.skip(ctx, nc, logger, urlMsg.URL, decisionSkipLength)
+		return nil
+	}
+
+	// Make sure URL scheme is allowed (e.g: not ftp:// or javascript:)
+	if s.allowedSchemes != nil && !s.allowedSchemes[u.Scheme] {
+		logger.Debug().Str("url", urlMsg.URL).Str("scheme", u.Scheme).Msgf("URL scheme %s is not allowed", u.Scheme)
+		s.skip(ctx, nc, logger, urlMsg.URL, decisionSkipScheme)
+		return nil
+	}
+
+	// Make sure URL TLD is allowed (e.g: .onion)
+	if allowed, tld := s.policy.allowsTLD(u.Hostname()); !allowed {
+		logger.Debug().Stringer("url", u).Str("tld", tld).Msgf("URL TLD .%s is not allowed", tld)
+		s.skip(ctx, nc, logger, urlMsg.URL, decisionSkipInvalid)
+		return nil
+	}
+
+	// Make sure the onion address is well-formed (e.g: foo.onion is not)
+	if s.validateOnion && hostTLD(u.Hostname()) == defaultTLD && !onion.IsValidHost(u.Hostname()) {
+		logger.Warn().Str("url", urlMsg.URL).Str("host", u.Hostname()).Msg("Invalid onion address")
+		invalidOnions.Inc()
+		s.skip(ctx, nc, logger, urlMsg.URL, decisionSkipOnion)
+		return nil
+	}
+
+	for _, filter := range append([]Filter{s.depth, s.blacklist}, s.filters...) {
+		ok, err := filter.ShouldSchedule(ctx, u)
 		if err != nil {
-			log.Err(err).Msg("Error while parsing URL")
+			schedulerErrors.WithLabelValues(errorKindFilter).Inc()
+			logger.Err(err).Msg("Error while filtering URL")
 			return err
 		}
+		if !ok {
+			s.skip(ctx, nc, logger, urlMsg.URL, filterDecision(filter))
+			return nil
+		}
+	}
 
-		// Make sure URL is valid .onion
-		if !strings.Contains(u.Host, ".onion") {
-			log.Debug().Stringer("url", u).Msg("URL is not a valid hidden service")
-			return err
+	// Outside of the crawl window: defer the URL
+	if !s.window.open() {
+		logger.Debug().Str("url", urlMsg.URL).Time("next", s.window.nextOpening()).Msg("Outside of crawl window, deferring URL")
+		return s.deferURL(ctx, nc, logger, msg, urlMsg.URL, decisionDeferWindow)
+	}
+
+	// Fragments target the same server-side resource
+	u.Fragment = ""
+
+	normalizedURL := normalizeURL(u)
+
+	// Make sure URL has not been received recently
+	if s.dedup != nil && s.dedup.seen(normalizedURL) {
+		logger.Trace().Str("url", normalizedURL).Msg("URL has been received recently")
+		s.skip(ctx, nc, logger, normalizedURL, decisionSkipDup)
+		urlsSkipped.Inc()
+		return nil
+	}
+	// URL has not been scheduled: allow it to be processed again
+	forget := func() {
+		if s.dedup != nil {
+			s.dedup.forget(normalizedURL)
 		}
+	}
 
-		// If we want to allow re-schedule of existing crawled resources we need to retrieve only resources
-		// that are newer than now-refreshDelay.
-		endDate := time.Time{}
-		if refreshDelay != -1 {
-			endDate = time.Now().Add(-refreshDelay)
+	// Probably crawled already: no need to query the API
+	if s.bloom != nil && s.bloom.test(normalizedURL) {
+		logger.Trace().Str("url", normalizedURL).Msg("URL is in the bloom filter")
+		s.skip(ctx, nc, logger, normalizedURL, decisionSkipBloom)
+		urlsSkipped.Inc()
+		return nil
+	}
+
+	normalized, err := url.Parse(normalizedURL)
+	if err != nil {
+		forget()
+		schedulerErrors.WithLabelValues(errorKindParse).Inc()
+		return err
+	}
+
+	ok, err := s.refresh.ShouldSchedule(ctx, normalized)
+	if err == circuitbreaker.ErrOpen {
+		// API is unavailable: defer the URL
+		logger.Debug().Str("url", urlMsg.URL).Msg("API unavailable, deferring URL")
+		forget()
+		return s.deferURL(ctx, nc, logger, msg, urlMsg.URL, decisionDeferUnavail)
+	}
+	if err != nil {
+		schedulerErrors.WithLabelValues(errorKindAPI).Inc()
+		forget()
+		logger.Err(err).Msg("Error while searching URL")
+		return err
+	}
+
+	// Already crawled: skip
+	if !ok {
+		if s.bloom != nil {
+			s.bloom.add(normalizedURL)
 		}
+		logger.Trace().Str("url", normalizedURL).Msg("URL should not be scheduled")
+		s.skip(ctx, nc, logger, normalizedURL, decisionSkipCrawled)
+		urlsSkipped.Inc()
+		return nil
+	}
 
-		b64URI := base64.URLEncoding.EncodeToString([]byte(u.String()))
-		urls, _, err := apiClient.SearchResources(b64URI, "", time.Time{}, endDate, 1, 1)
+	// Only known once crawled: checked after the refresh delay
+	for _, filter := range s.crawledFilters() {
+		ok, err := filter.ShouldSchedule(ctx, normalized)
+		if err == circuitbreaker.ErrOpen {
+			logger.Debug().Str("url", urlMsg.URL).Msg("API unavailable, deferring URL")
+			forget()
+			return s.deferURL(ctx, nc, logger, msg, urlMsg.URL, decisionDeferUnavail)
+		}
 		if err != nil {
-			log.Err(err).Msg("Error while searching URL")
+			schedulerErrors.WithLabelValues(errorKindAPI).Inc()
+			forget()
+			logger.Err(err).Msg("Error while filtering crawled URL")
 			return err
 		}
+		if !ok {
+			s.skip(ctx, nc, logger, normalizedURL, filterDecision(filter))
+			urlsSkipped.Inc()
+			return nil
+		}
+	}
 
-		// No matches: schedule!
-		if len(urls) == 0 {
-			log.Debug().Stringer("url", u).Msg("URL should be scheduled")
-			if err := natsutil.PublishMsg(nc, &messaging.URLTodoMsg{URL: urlMsg.URL}); err != nil {
-				return fmt.Errorf("error while publishing URL: %s", err)
-			}
-		} else {
-			log.Trace().Stringer("url", u).Msg("URL should not be scheduled")
+	logger.Debug().Str("url", normalizedURL).Msg("URL should be scheduled")
+	if s.report != nil {
+		logDecision(logger, s.report, normalizedURL, decisionSchedule)
+		return nil
+	}
+
+	// Make sure the crawlers are keeping up
+	if s.backPressure != nil {
+		if err := s.backPressure.wait(ctx, logger); err != nil {
+			forget()
+			return fmt.Errorf("error while waiting for queue depth: %s", err)
 		}
+	}
 
+	// Make sure we are not hammering the hidden service: the URL is delivered again once allowed
+	if delay := s.limiter.reserve(u.Hostname()); delay > 0 {
+		urlsRateLimited.Inc()
+		forget()
+		logger.Debug().Stringer("delay", delay).Msg("Hostname rate limited, requeuing URL")
+		return natsutil.Requeue(delay)
+	}
+
+	todoMsg := &messaging.URLTodoMsg{
+		URL:     normalizedURL,
+		Depth:   urlMsg.Depth,
+		Retries: urlMsg.Retries,
+		Source:  urlMsg.Source,
+		TraceID: traceID,
+	}
+	if err := s.publish(ctx, nc, todoMsg, urlMsg.Priority); err != nil {
+		schedulerErrors.WithLabelValues(errorKindPublish).Inc()
+		forget()
+		return fmt.Errorf("error while publishing URL: %s", err)
+	}
+
+	urlsPublished.Inc()
+	s.publishShadow(ctx, nc, logger, todoMsg)
+
+	if s.bloom != nil {
+		s.bloom.add(normalizedURL)
+	}
+
+	if err := s.state.save(normalizedURL, time.Now()); err != nil {
+		logger.Warn().Str("err", err.Error()).Msg("Error while saving scheduler state")
+	}
+
+	return nil
+}
+
+// publish given message, using the priority queue if any
+func (s *scheduler) publish(ctx context.Context, nc *nats.Conn, msg *messaging.URLTodoMsg, priority int) error {
+	ctx, span := tracer.Start(ctx, "nats.publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.destination", msg.Subject())))
+	defer span.End()
+
+	var err error
+	if s.queue != nil {
+		err = <-s.queue.push(ctx, msg, priority)
+	} else if s.publisher != nil {
+		err = s.publisher(ctx, msg)
+	} else {
+		err = natsutil.PublishMsgWithContext(ctx, nc, msg)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// skip publish given URL to url.skipped with the reason of given decision (only logged in dry-run mode)
+func (s *scheduler) skip(ctx context.Context, nc *nats.Conn, logger zerolog.Logger, url string, d decision) {
+	if s.report != nil {
+		logDecision(logger, s.report, url, d)
+		return
+	}
+
+	msg := &messaging.URLSkippedMsg{
+		URL:       url,
+		Reason:    skipReasons[d],
+		Timestamp: time.Now(),
+		TraceID:   natsutil.TraceIDFromContext(ctx),
+	}
+	if err := natsutil.PublishMsg(nc, msg); err != nil {
+		logger.Warn().Str("err", err.Error()).Msg("Error while publishing skipped URL")
+	}
+}
+
+// deferURL publish given message to url.deferred, for it to be scheduled later on
+func (s *scheduler) deferURL(ctx context.Context, nc *nats.Conn, logger zerolog.Logger, msg *nats.Msg, url string,
+	d decision) error {
+	if s.report != nil {
+		logDecision(logger, s.report, url, d)
 		return nil
 	}
+
+	// Keep the trace ID of the URL once scheduled later on
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	msg.Header.Set(natsutil.TraceIDHeader, natsutil.TraceIDFromContext(ctx))
+
+	if err := natsutil.Republish(nc, messaging.URLDeferredSubject, msg); err != nil {
+		schedulerErrors.WithLabelValues(errorKindPublish).Inc()
+		return fmt.Errorf("error while deferring URL: %s", err)
+	}
+	return nil
+}
+
+// logDecision log & record given decision when running in dry-run mode
+func logDecision(logger zerolog.Logger, report *dryRunReport, url string, d decision) {
+	if report == nil {
+		return
+	}
+
+	report.record(d)
+	logger.Info().Str("url", url).Str("decision", string(d)).Msg("Dry-run decision")
+}
+
+// messageLogger returns a logger enriched with the context of given message
+func messageLogger(msg *nats.Msg) zerolog.Logger {
+	ctx := log.With().
+		Str("nats_subject", msg.Subject).
+		Str("nats_reply", msg.Reply).
+		Str("msg_id", uuid.New().String())
+
+	// Sequence number is only available for JetStream messages
+	if meta, err := msg.Metadata(); err == nil {
+		ctx = ctx.Uint64("nats_seq", meta.Sequence.Stream)
+	}
+
+	return ctx.Logger()
+}
+
+// normalizeURL returns the canonical form of given URL, so that semantically identical URLs
+// are scheduled only once
+func normalizeURL(u *url.URL) string {
+	normalized := *u
+
+	// Lowercase scheme & host
+	normalized.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+
+	// Strip default ports
+	port := u.Port()
+	if (normalized.Scheme == "http" && port == "80") || (normalized.Scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	if port != "" {
+		normalized.Host = net.JoinHostPort(host, port)
+	} else {
+		normalized.Host = host
+	}
+
+	// Sort query parameters & remove empty query
+	normalized.RawQuery = u.Query().Encode()
+	normalized.ForceQuery = false
+
+	return normalized.String()
 }
 
-func parseRefreshDelay(delay string) time.Duration {
+// parseRefreshDelay parse given refresh delay, -1 meaning existing resources should never be crawled again
+func parseRefreshDelay(delay string) (time.Duration, error) {
 	if delay == "" {
-		return -1
+		return -1, nil
 	}
 
-	val, err := str2duration.ParseDuration(delay)
+	val, err := duration.ParseStrict(delay)
 	if err != nil {
-		return -1
+		return 0, fmt.Errorf("invalid refresh delay: %s", err)
 	}
 
-	return val
+	return val, nil
 }
@@ -1,24 +1,1276 @@
 package scheduler
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/circuitbreaker"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/creekorful/trandoshan/internal/util/retry"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// apiClientMock is a fake api.Client whose behavior is defined by the test
+type apiClientMock struct {
+	searchResources func(url, keyword string, startDate, endDate time.Time,
+		paginationPage, paginationSize int) ([]api.ResourceDto, int64, error)
+	searchResourcesBulk          func(urls []string, startDate, endDate time.Time) (map[string][]api.ResourceDto, error)
+	searchResourcesByContentHash func(contentHash string, size int) ([]api.ResourceDto, error)
+	getResource                  func(b64URL string) (*api.ResourceDto, error)
+	getCrawlHistory              func(b64URL string) (api.CrawlHistoryDto, error)
+}
+
+func (m *apiClientMock) SearchResources(opts api.SearchResourcesOptions,
+	paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+	return m.searchResources(opts.URL, opts.Keyword, opts.StartDate, opts.EndDate, paginationPage, paginationSize)
+}
+
+func (m *apiClientMock) Search(filter api.ResourceFilter) ([]api.ResourceDto, int64, error) {
+	page, size := filter.Pagination()
+	return m.SearchResources(filter.Options(), page, size)
+}
+
+func (m *apiClientMock) SearchResourcesAfter(cursor string, size int,
+	opts api.SearchResourcesOptions) ([]api.ResourceDto, string, error) {
+	return nil, "", nil
+}
+
+func (m *apiClientMock) SearchResourcesBulk(urls []string,
+	startDate, endDate time.Time) (map[string][]api.ResourceDto, error) {
+	return m.searchResourcesBulk(urls, startDate, endDate)
+}
+
+// GetResource use searchResources if getResource is not set
+func (m *apiClientMock) GetResource(b64URL string) (*api.ResourceDto, error) {
+	if m.getResource != nil {
+		return m.getResource(b64URL)
+	}
+
+	resources, _, err := m.searchResources(b64URL, "", time.Time{}, time.Time{}, 1, 1)
+	if err != nil || len(resources) == 0 {
+		return nil, err
+	}
+	return &resources[0], nil
+}
+
+func (m *apiClientMock) SearchResourcesByContentHash(contentHash string, size int) ([]api.ResourceDto, error) {
+	return m.searchResourcesByContentHash(contentHash, size)
+}
+
+func (m *apiClientMock) WatchResources(ctx context.Context,
+	filter api.ResourceFilter) (<-chan api.ResourceDto, error) {
+	return nil, nil
+}
+
+func (m *apiClientMock) Subscribe(ctx context.Context,
+	filter api.ResourceFilter) (<-chan api.ResourceDto, <-chan error) {
+	return nil, nil
+}
+
+func (m *apiClientMock) GetStats() (api.StatsDto, error) {
+	return api.StatsDto{}, nil
+}
+
+func (m *apiClientMock) ListHosts(page, size int) ([]api.HostDto, int64, error) {
+	return nil, 0, nil
+}
+
+// GetCrawlHistory returns no attempts if getCrawlHistory is not set
+func (m *apiClientMock) GetCrawlHistory(b64URL string) (api.CrawlHistoryDto, error) {
+	if m.getCrawlHistory != nil {
+		return m.getCrawlHistory(b64URL)
+	}
+	return api.CrawlHistoryDto{}, nil
+}
+
+func (m *apiClientMock) DeleteResource(b64URL string) error {
+	return nil
+}
+
+func (m *apiClientMock) GetResourceBody(b64URL string) (string, error) {
+	return "", nil
+}
+
+func (m *apiClientMock) SetResourceBodyURL(b64URL, bodyURL string) error {
+	return nil
+}
+
+func (m *apiClientMock) AddResource(res api.ResourceDto) (api.ResourceDto, error) {
+	return res, nil
+}
+
+func (m *apiClientMock) ScheduleURL(url string) error {
+	return nil
+}
+
 func TestParseRefreshDelay(t *testing.T) {
-	if parseRefreshDelay("") != -1 {
+	tests := map[string]time.Duration{
+		"":    -1,
+		"50s": time.Second * 50,
+		"50m": time.Minute * 50,
+		"50h": time.Hour * 50,
+		"50d": time.Hour * 24 * 50,
+	}
+	for delay, want := range tests {
+		if got, err := parseRefreshDelay(delay); err != nil || got != want {
+			t.Errorf("%s: Wanted: %s Got: %s (%v)", delay, want, got, err)
+		}
+	}
+
+	// Typos should not silently disable refreshing
+	for _, delay := range []string{"2days", "50", "-1h"} {
+		if _, err := parseRefreshDelay(delay); err == nil {
+			t.Errorf("%s: error should have been returned", delay)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"lowercase scheme", "HTTP://example.onion/path", "http://example.onion/path"},
+		{"lowercase host", "http://EXAMPLE.onion/path", "http://example.onion/path"},
+		{"keep path case", "http://example.onion/PATH", "http://example.onion/PATH"},
+		{"strip http default port", "http://example.onion:80/path", "http://example.onion/path"},
+		{"strip https default port", "https://example.onion:443/path", "https://example.onion/path"},
+		{"keep non default port", "http://example.onion:8080/path", "http://example.onion:8080/path"},
+		{"keep mismatched default port", "https://example.onion:80/path", "https://example.onion:80/path"},
+		{"sort query parameters", "http://example.onion/path?b=2&a=1", "http://example.onion/path?a=1&b=2"},
+		{"remove empty query", "http://example.onion/path?", "http://example.onion/path"},
+		{"remove empty fragment", "http://example.onion/path#", "http://example.onion/path"},
+		{"keep fragment", "http://example.onion/path#section", "http://example.onion/path#section"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.in)
+			if err != nil {
+				t.FailNow()
+			}
+
+			if val := normalizeURL(u); val != test.want {
+				t.Errorf("Wanted: %s Got: %s", test.want, val)
+			}
+		})
+	}
+}
+
+func TestHandleMessagePolicy(t *testing.T) {
+	path := writePatterns(t, "*.spam.onion\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	policy, err := loadURLPolicy(nil, "", path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	var searched []string
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			searched = append(searched, url)
+			return []api.ResourceDto{{}}, 1, nil
+		},
+	}
+
+	handler := newScheduler(apiClient, withPolicy(policy)).handleMessage
+
+	urls := []string{
+		"http://a.spam.onion/index.html", // blacklisted
+		"http://a.spam.com/index.html",   // not an hidden service
+		"http://example.onion/index.html",
+	}
+	for _, u := range urls {
+		if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(fmt.Sprintf(`{"url":"%s"}`, u))}); err != nil {
+			t.FailNow()
+		}
+	}
+
+	// Only the valid, non blacklisted hidden service should reach the API
+	if len(searched) != 1 {
+		t.FailNow()
+	}
+	if searched[0] != api.EncodeURL("http://example.onion/index.html") {
 		t.Fail()
 	}
-	if parseRefreshDelay("50s") != time.Second*50 {
+}
+
+func TestHandleMessageAllowedTLDs(t *testing.T) {
+	policy, err := loadURLPolicy([]string{"i2p", "loki"}, "", "")
+	if err != nil {
+		t.FailNow()
+	}
+
+	var searched []string
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			searched = append(searched, url)
+			return []api.ResourceDto{{}}, 1, nil
+		},
+	}
+
+	handler := newScheduler(apiClient, withPolicy(policy)).handleMessage
+
+	for _, u := range []string{"http://example.onion", "http://example.i2p", "http://example.loki", "http://example.com"} {
+		if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(fmt.Sprintf(`{"url":"%s"}`, u))}); err != nil {
+			t.FailNow()
+		}
+	}
+
+	if len(searched) != 2 {
+		t.Fatalf("Wanted: 2 searches Got: %d", len(searched))
+	}
+	if searched[0] != api.EncodeURL("http://example.i2p") ||
+		searched[1] != api.EncodeURL("http://example.loki") {
 		t.Fail()
 	}
-	if parseRefreshDelay("50m") != time.Minute*50 {
+}
+
+func TestSubscribeAll(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	sub, err := natsutil.NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	received := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- subscribeAll(sub, []string{"url.seed", "url.extracted"}, "schedulers",
+			func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+				received <- msg.Subject + ":" + string(msg.Data)
+				return nil
+			})
+	}()
+
+	// Wait for subscriptions to be active
+	time.Sleep(100 * time.Millisecond)
+
+	if err := nc.Publish("url.seed", []byte("a")); err != nil {
+		t.FailNow()
+	}
+	if err := nc.Publish("url.extracted", []byte("b")); err != nil {
+		t.FailNow()
+	}
+	if err := nc.Publish("url.other", []byte("c")); err != nil {
+		t.FailNow()
+	}
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case val := <-received:
+			got[val] = true
+		case <-time.After(time.Second):
+			t.FailNow()
+		}
+	}
+
+	if !got["url.seed:a"] || !got["url.extracted:b"] {
+		t.Errorf("Unexpected messages: %v", got)
+	}
+
+	// Message on not configured subject should not be processed
+	select {
+	case val := <-received:
+		t.Errorf("Unexpected message: %s", val)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing the subscriber should terminate the subscriptions
+	sub.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
 		t.Fail()
 	}
-	if parseRefreshDelay("50h") != time.Hour*50 {
+}
+
+// TestSchedulerIntegration run the scheduler against an embedded NATS server, the URLs being published to
+// url.found and the decisions read from url.todo & url.skipped
+func TestSchedulerIntegration(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	// Crawl time of the resources known by the API
+	crawled := map[string]time.Time{
+		"http://recent.onion":  time.Now().Add(-10 * time.Minute),
+		"http://old.onion":     time.Now().Add(-2 * time.Hour),
+		"http://archive.onion": time.Now().Add(-30 * 24 * time.Hour),
+	}
+	var mutex sync.Mutex
+	failures := map[string]int{"http://flaky.onion": 2}
+
+	apiClient := &apiClientMock{
+		searchResources: func(b64URL, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			u, err := api.DecodeURL(b64URL)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if failures[u] > 0 {
+				failures[u]--
+				return nil, 0, errors.New("api is down")
+			}
+
+			crawlTime, exists := crawled[u]
+			if !exists || (!startDate.IsZero() && crawlTime.Before(startDate)) ||
+				(!endDate.IsZero() && crawlTime.After(endDate)) {
+				return nil, 0, nil
+			}
+			return []api.ResourceDto{{URL: u, Time: crawlTime}}, 1, nil
+		},
+	}
+
+	policy, err := loadURLPolicy(nil, "", "")
+	if err != nil {
+		t.FailNow()
+	}
+	rules := refreshRules{{pattern: regexp.MustCompile(`^archive\.onion$`), delay: -1}}
+	retryOpts := retry.Options{Count: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, Multiplier: 2}
+
+	sched := newScheduler(apiClient, withPolicy(policy), withRefresh(time.Hour, rules), withRetry(retryOpts, nil))
+
+	sub, err := natsutil.NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	done := make(chan error)
+	go func() {
+		done <- subscribeAll(sub, []string{messaging.URLFoundSubject}, "schedulers", sched.handleMessage)
+	}()
+	defer func() {
+		sub.Close()
+		<-done
+	}()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	todoSub, err := nc.SubscribeSync(messaging.URLTodoSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	skippedSub, err := nc.SubscribeSync(messaging.URLSkippedSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// Wait for the scheduler subscription to be active
+	for !sub.IsSubscribed() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		reason messaging.SkipReason // empty if the URL should be scheduled
+	}{
+		{"not crawled", "http://new.onion", ""},
+		{"already crawled", "http://archive.onion", messaging.SkipReasonAlreadyCrawled},
+		{"refresh delay not expired", "http://recent.onion", messaging.SkipReasonAlreadyCrawled},
+		{"refresh delay expired", "http://old.onion", ""},
+		{"not onion", "http://example.com", messaging.SkipReasonTLDNotAllowed},
+		{"API error", "http://flaky.onion", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{URL: test.url}); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.reason == "" {
+				msg, err := todoSub.NextMsg(time.Second)
+				if err != nil {
+					t.Fatalf("%s should have been scheduled", test.url)
+				}
+				var todoMsg messaging.URLTodoMsg
+				if err := natsutil.ReadJSON(msg, &todoMsg); err != nil || todoMsg.URL != test.url {
+					t.Errorf("Wanted: %s Got: %s", test.url, todoMsg.URL)
+				}
+				return
+			}
+
+			msg, err := skippedSub.NextMsg(time.Second)
+			if err != nil {
+				t.Fatalf("%s should have been skipped", test.url)
+			}
+			var skippedMsg messaging.URLSkippedMsg
+			if err := natsutil.ReadJSON(msg, &skippedMsg); err != nil {
+				t.FailNow()
+			}
+			if skippedMsg.URL != test.url || skippedMsg.Reason != test.reason {
+				t.Errorf("Wanted: %s (%s) Got: %s (%s)", test.url, test.reason, skippedMsg.URL, skippedMsg.Reason)
+			}
+		})
+	}
+
+	// Nothing else should have been published
+	if _, err := todoSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("unexpected scheduled URL")
+	}
+	if _, err := skippedSub.NextMsg(10 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("unexpected skipped URL")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if failures["http://flaky.onion"] != 0 {
+		t.Error("API call should have been retried")
+	}
+}
+
+func TestHandleMessageAPIRetry(t *testing.T) {
+	calls := 0
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			calls++
+			if calls < 3 {
+				return nil, 0, fmt.Errorf("api is down")
+			}
+			return []api.ResourceDto{{}}, 1, nil
+		},
+	}
+
+	opts := retry.Options{Count: 2, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, Multiplier: 2}
+	handler := newScheduler(apiClient, withRetry(opts, nil)).handleMessage
+
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err != nil {
+		t.Errorf("API call should have been retried: %s", err)
+	}
+	if calls != 3 {
+		t.Errorf("Wanted: 3 calls Got: %d", calls)
+	}
+
+	// Retries exhausted
+	calls = -10
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err == nil {
 		t.Fail()
 	}
-	if parseRefreshDelay("50d") != time.Hour*24*50 {
+}
+
+func TestHandleMessageAPIRateLimited(t *testing.T) {
+	var calls []time.Time
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			calls = append(calls, time.Now())
+			if len(calls) == 1 {
+				return nil, 0, &api.RateLimitedError{RetryAfter: 50 * time.Millisecond}
+			}
+			return []api.ResourceDto{{}}, 1, nil
+		},
+	}
+
+	opts := retry.Options{Count: 2, InitialDelay: time.Millisecond, MaxDelay: time.Second, Multiplier: 2,
+		DelayFor: rateLimitDelay(time.Second)}
+	handler := newScheduler(apiClient, withRetry(opts, nil)).handleMessage
+
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err != nil {
+		t.Errorf("API call should have been retried: %s", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("Wanted: 2 calls Got: %d", len(calls))
+	}
+	if elapsed := calls[1].Sub(calls[0]); elapsed < 50*time.Millisecond {
+		t.Errorf("retry should have waited for the rate limit delay, waited %s", elapsed)
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	delayFor := rateLimitDelay(time.Minute)
+
+	tests := []struct {
+		err    error
+		want   time.Duration
+		wantOk bool
+	}{
+		{&api.RateLimitedError{RetryAfter: 10 * time.Second}, 10 * time.Second, true},
+		{fmt.Errorf("search: %w", &api.RateLimitedError{RetryAfter: time.Second}), time.Second, true},
+		{&api.RateLimitedError{RetryAfter: time.Hour}, time.Minute, true},
+		{&api.RateLimitedError{}, 0, false},
+		{&api.ServerError{StatusCode: 503}, 0, false},
+		{fmt.Errorf("api is down"), 0, false},
+	}
+
+	for _, test := range tests {
+		delay, ok := delayFor(test.err)
+		if delay != test.want || ok != test.wantOk {
+			t.Errorf("%s: Wanted: %s, %v Got: %s, %v", test.err, test.want, test.wantOk, delay, ok)
+		}
+	}
+}
+
+func TestHandleMessageStripFragment(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	todoSub, err := nc.SubscribeSync(messaging.URLTodoSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	var searched []string
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			searched = append(searched, url)
+			return nil, 0, nil
+		},
+	}
+
+	handler := newScheduler(apiClient).handleMessage
+
+	var scheduled []string
+	for _, u := range []string{"http://example.onion/page", "http://example.onion/page#section"} {
+		if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(fmt.Sprintf(`{"url":"%s"}`, u))}); err != nil {
+			t.FailNow()
+		}
+
+		msg, err := todoSub.NextMsg(time.Second)
+		if err != nil {
+			t.FailNow()
+		}
+
+		var todoMsg messaging.URLTodoMsg
+		if err := natsutil.ReadJSON(msg, &todoMsg); err != nil {
+			t.FailNow()
+		}
+		scheduled = append(scheduled, todoMsg.URL)
+	}
+
+	if len(searched) != 2 || searched[0] != searched[1] {
+		t.Errorf("URLs should be searched identically: %v", searched)
+	}
+	if scheduled[0] != "http://example.onion/page" || scheduled[1] != scheduled[0] {
+		t.Errorf("URLs should be scheduled identically: %v", scheduled)
+	}
+}
+
+func TestHandleMessagePublisher(t *testing.T) {
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	var published []natsutil.Msg
+	publishErr := error(nil)
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		published = append(published, msg)
+		return publishErr
+	}
+
+	handler := newScheduler(apiClient, withPublisher(publisher)).handleMessage
+
+	// Connection of the handler is not used
+	if err := handler(context.Background(), nil,
+		&nats.Msg{Data: []byte(`{"url":"http://example.onion","source":"seed"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0].(*messaging.URLTodoMsg).URL != "http://example.onion" ||
+		published[0].(*messaging.URLTodoMsg).Source != messaging.SourceSeed {
+		t.Errorf("Got: %v", published)
+	}
+
+	// URL is not scheduled if its publication is not confirmed
+	publishErr = errors.New("nats: timeout")
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"http://other.onion"}`)}); err == nil {
+		t.Error("handler should fail")
+	}
+}
+
+func TestHandleMessageHostRateLimited(t *testing.T) {
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	var published []natsutil.Msg
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		published = append(published, msg)
+		return nil
+	}
+
+	limiter, err := newHostLimiter(1, 10)
+	if err != nil {
+		t.FailNow()
+	}
+	handler := newScheduler(apiClient, withPublisher(publisher), withLimiter(limiter)).handleMessage
+
+	if err := handler(context.Background(), nil, foundMsg("http://example.onion/a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second URL of the hostname is requeued rather than waited for
+	start := time.Now()
+	err = handler(context.Background(), nil, foundMsg("http://example.onion/b"))
+	var requeueErr *natsutil.RequeueError
+	if !errors.As(err, &requeueErr) || requeueErr.Delay <= 0 || requeueErr.Delay > time.Second {
+		t.Errorf("Wanted: requeue within 1s Got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("handler should not block (elapsed: %s)", elapsed)
+	}
+
+	// ... while the other hostnames are not impacted
+	if err := handler(context.Background(), nil, foundMsg("http://other.onion")); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 2 {
+		t.Errorf("Wanted: 2 published URLs Got: %d", len(published))
+	}
+}
+
+func TestHandleMessageMaxDepth(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	todoSub, err := nc.SubscribeSync(messaging.URLTodoSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	handler := newScheduler(apiClient, withMaxDepth(2)).handleMessage
+
+	// URL at exactly the limit should be scheduled, with its depth
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion","depth":2}`)}); err != nil {
+		t.FailNow()
+	}
+	msg, err := todoSub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	var todoMsg messaging.URLTodoMsg
+	if err := natsutil.ReadJSON(msg, &todoMsg); err != nil {
+		t.FailNow()
+	}
+	if todoMsg.Depth != 2 {
+		t.Errorf("Wanted: 2 Got: %d", todoMsg.Depth)
+	}
+
+	// URL one beyond the limit should not
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion","depth":3}`)}); err != nil {
+		t.FailNow()
+	}
+	if _, err := todoSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("URL should not have been scheduled")
+	}
+
+	// Message without depth should be treated as depth 0
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err != nil {
+		t.FailNow()
+	}
+	msg, err = todoSub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	todoMsg = messaging.URLTodoMsg{}
+	if err := natsutil.ReadJSON(msg, &todoMsg); err != nil {
+		t.FailNow()
+	}
+	if todoMsg.Depth != 0 {
+		t.Fail()
+	}
+}
+
+func TestHandleMessageCircuitBreaker(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	deferredSub, err := nc.SubscribeSync(messaging.URLDeferredSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	calls := 0
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			calls++
+			return nil, 0, fmt.Errorf("api is down")
+		},
+	}
+
+	breaker := circuitbreaker.New(2, time.Minute)
+	handler := newScheduler(apiClient, withRetry(retry.Options{}, breaker)).handleMessage
+
+	// Drive the breaker open
+	for i := 0; i < 2; i++ {
+		if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err == nil {
+			t.FailNow()
+		}
+	}
+	if breaker.State() != circuitbreaker.Open {
+		t.FailNow()
+	}
+
+	// URL should now be deferred without calling the API
+	data := []byte(`{"url":"http://other.onion"}`)
+	if err := handler(context.Background(), nc, &nats.Msg{Data: data}); err != nil {
+		t.FailNow()
+	}
+
+	msg, err := deferredSub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	if string(msg.Data) != string(data) {
 		t.Fail()
 	}
+	if calls != 2 {
+		t.Errorf("Wanted: 2 calls Got: %d", calls)
+	}
+}
+
+func TestHandleMessageLoggerContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = logger }()
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return []api.ResourceDto{{}}, 1, nil
+		},
+	}
+
+	handler := newScheduler(apiClient).handleMessage
+	for i := 0; i < 2; i++ {
+		msg := &nats.Msg{Subject: "url.found", Reply: "reply.subject", Data: []byte(`{"url":"http://example.onion"}`)}
+		if err := handler(context.Background(), nil, msg); err != nil {
+			t.FailNow()
+		}
+	}
+
+	ids := map[string]bool{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var entry map[string]interface{}
+		if err := decoder.Decode(&entry); err != nil {
+			t.FailNow()
+		}
+
+		if entry["nats_subject"] != "url.found" {
+			t.Errorf("Missing nats_subject: %v", entry)
+		}
+		if entry["nats_reply"] != "reply.subject" {
+			t.Errorf("Missing nats_reply: %v", entry)
+		}
+		id, ok := entry["msg_id"].(string)
+		if !ok || id == "" {
+			t.Errorf("Missing msg_id: %v", entry)
+		}
+		ids[id] = true
+	}
+
+	// Each message should have its own ID
+	if len(ids) != 2 {
+		t.Errorf("Wanted: 2 message IDs Got: %d", len(ids))
+	}
+}
+
+func TestHandleMessageMaxURLLength(t *testing.T) {
+	const maxLength = 64
+
+	tests := []struct {
+		name     string
+		length   int
+		rejected bool
+	}{
+		{"below limit", maxLength - 1, false},
+		{"at limit", maxLength, false},
+		{"above limit", maxLength + 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			searched := false
+			apiClient := &apiClientMock{
+				searchResources: func(url, keyword string, startDate, endDate time.Time,
+					paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+					searched = true
+					return []api.ResourceDto{{}}, 1, nil
+				},
+			}
+
+			handler := newScheduler(apiClient, withMaxURLLength(maxLength)).handleMessage
+
+			prefix := "http://example.onion/"
+			u := prefix + strings.Repeat("a", test.length-len(prefix))
+			rejected := testutil.ToFloat64(urlsRejectedLength)
+
+			if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(fmt.Sprintf(`{"url":"%s"}`, u))}); err != nil {
+				t.FailNow()
+			}
+
+			if searched == test.rejected {
+				t.Errorf("URL of length %d: searched: %v", len(u), searched)
+			}
+			if test.rejected && testutil.ToFloat64(urlsRejectedLength) != rejected+1 {
+				t.Error("rejected URL should be counted")
+			}
+		})
+	}
+}
+
+func TestHandleMessageSkipReasons(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	skippedSub, err := nc.SubscribeSync(messaging.URLSkippedSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	path := writePatterns(t, "spam.onion\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	policy, err := loadURLPolicy(nil, "", path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	cache, err := newMemoryDedupCache(10, time.Minute)
+	if err != nil {
+		t.FailNow()
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			if url == api.EncodeURL("http://crawled.onion") {
+				return []api.ResourceDto{{}}, 1, nil
+			}
+			return nil, 0, nil
+		},
+	}
+
+	handler := newScheduler(apiClient, withPolicy(policy), withMaxDepth(1), withMaxURLLength(64),
+		withDedup(cache, nil), WithFilters(&hostFilter{word: "forum"})).handleMessage
+
+	longURL := "http://example.onion/" + strings.Repeat("a", 64)
+	tests := []struct {
+		msg    string
+		url    string
+		reason messaging.SkipReason
+	}{
+		{`{"url":"http://crawled.onion"}`, "http://crawled.onion", messaging.SkipReasonAlreadyCrawled},
+		{`{"url":"http://spam.onion"}`, "http://spam.onion", messaging.SkipReasonBlacklisted},
+		{`{"url":"http://deep.onion","depth":2}`, "http://deep.onion", messaging.SkipReasonTooDeep},
+		{`{"url":"http://example.com"}`, "http://example.com", messaging.SkipReasonTLDNotAllowed},
+		{`{"url":"` + longURL + `"}`, longURL, messaging.SkipReasonTooLong},
+		{`{"url":"http://forum.onion"}`, "http://forum.onion", messaging.SkipReasonFiltered},
+		{`{"url":"http://crawled.onion"}`, "http://crawled.onion", messaging.SkipReasonDuplicate},
+	}
+
+	for _, test := range tests {
+		before := time.Now()
+		if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(test.msg)}); err != nil {
+			t.FailNow()
+		}
+
+		msg, err := skippedSub.NextMsg(time.Second)
+		if err != nil {
+			t.Errorf("%s: skipped URL should have been published", test.url)
+			continue
+		}
+
+		var skippedMsg messaging.URLSkippedMsg
+		if err := natsutil.ReadJSON(msg, &skippedMsg); err != nil {
+			t.FailNow()
+		}
+		if skippedMsg.URL != test.url || skippedMsg.Reason != test.reason || skippedMsg.Timestamp.Before(before) {
+			t.Errorf("Wanted: %s (%s) Got: %+v", test.url, test.reason, skippedMsg)
+		}
+	}
+
+	// Scheduled URL should not be published as skipped
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://new.onion"}`)}); err != nil {
+		t.FailNow()
+	}
+	if _, err := skippedSub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Error("scheduled URL should not have been published as skipped")
+	}
+}
+
+func TestHandleMessageSkipDeadURLs(t *testing.T) {
+	histories := map[string]api.CrawlHistoryDto{
+		"http://dead.onion":  {Attempts: 3, StatusCodes: map[int]int64{404: 3}},
+		"http://flaky.onion": {Attempts: 3, StatusCodes: map[int]int64{404: 2, 200: 1}},
+	}
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+		getCrawlHistory: func(b64URL string) (api.CrawlHistoryDto, error) {
+			u, _ := api.DecodeURL(b64URL)
+			return histories[u], nil
+		},
+	}
+
+	var published []string
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		published = append(published, msg.(*messaging.URLTodoMsg).URL)
+		return nil
+	}
+
+	report := newDryRunReport()
+	handler := newScheduler(apiClient, withPublisher(publisher), withDeadURLFilter(apiClient, 3)).handleMessage
+
+	for _, u := range []string{"http://dead.onion", "http://flaky.onion", "http://new.onion"} {
+		// Connection of the handler is not used
+		if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"` + u + `"}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Always 404: skipped, sometimes 200 & never crawled: scheduled
+	if len(published) != 2 || published[0] != "http://flaky.onion" || published[1] != "http://new.onion" {
+		t.Errorf("Wanted: [http://flaky.onion http://new.onion] Got: %v", published)
+	}
+
+	handler = newScheduler(apiClient, withReport(report), withDeadURLFilter(apiClient, 3)).handleMessage
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"http://dead.onion"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if report.counts[decisionSkipDead] != 1 {
+		t.Errorf("Wanted: 1 Got: %d", report.counts[decisionSkipDead])
+	}
+}
+
+func TestHandleMessageInvalidOnion(t *testing.T) {
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	var published []string
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		published = append(published, msg.(*messaging.URLTodoMsg).URL)
+		return nil
+	}
+
+	policy, err := loadURLPolicy([]string{"onion", "i2p"}, "", "")
+	if err != nil {
+		t.FailNow()
+	}
+
+	v3 := "http://duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion"
+	subdomain := "http://www.duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion/index.html"
+	v2 := "http://3g2upl4pq6kufc4m.onion"
+
+	invalid := testutil.ToFloat64(invalidOnions)
+	report := newDryRunReport()
+
+	handler := newScheduler(apiClient, withPublisher(publisher), withPolicy(policy), withOnionValidation()).handleMessage
+	for _, u := range []string{"http://foo.onion", v3, subdomain, v2, "http://foo.i2p",
+		"http://duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczaa.onion"} {
+		// Connection of the handler is not used
+		if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"` + u + `"}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the onion addresses are validated
+	if strings.Join(published, ",") != strings.Join([]string{v3, subdomain, v2, "http://foo.i2p"}, ",") {
+		t.Errorf("Wanted: %v Got: %v", []string{v3, subdomain, v2, "http://foo.i2p"}, published)
+	}
+	if testutil.ToFloat64(invalidOnions) != invalid+2 {
+		t.Errorf("Wanted: %f Got: %f", invalid+2, testutil.ToFloat64(invalidOnions))
+	}
+
+	handler = newScheduler(apiClient, withReport(report), withOnionValidation()).handleMessage
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"http://foo.onion"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if report.counts[decisionSkipOnion] != 1 {
+		t.Errorf("Wanted: 1 Got: %d", report.counts[decisionSkipOnion])
+	}
+
+	// The validation is disabled by default
+	published = nil
+	handler = newScheduler(apiClient, withPublisher(publisher)).handleMessage
+	if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"http://foo.onion"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 {
+		t.Errorf("Wanted: [http://foo.onion] Got: %v", published)
+	}
+}
+
+func TestHandleMessageAllowedSchemes(t *testing.T) {
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	var published []string
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		published = append(published, msg.(*messaging.URLTodoMsg).URL)
+		return nil
+	}
+
+	urls := []string{"http://example.onion", "https://example.onion/index.html", "ftp://example.onion/",
+		"javascript:alert(1)", "data:text/html,hello", "HTTP://upper.onion"}
+
+	report := newDryRunReport()
+	for _, opt := range []Option{withPublisher(publisher), withReport(report)} {
+		handler := newScheduler(apiClient, opt, withAllowedSchemes([]string{"http", "HTTPS"})).handleMessage
+		for _, u := range urls {
+			// Connection of the handler is not used
+			if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"` + u + `"}`)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	wanted := []string{"http://example.onion", "https://example.onion/index.html", "http://upper.onion"}
+	if strings.Join(published, ",") != strings.Join(wanted, ",") {
+		t.Errorf("Wanted: %v Got: %v", wanted, published)
+	}
+	if report.counts[decisionSkipScheme] != 3 {
+		t.Errorf("Wanted: 3 Got: %d", report.counts[decisionSkipScheme])
+	}
+}
+
+func TestHandleMessageTraceID(t *testing.T) {
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	var published []*messaging.URLTodoMsg
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		published = append(published, msg.(*messaging.URLTodoMsg))
+		return nil
+	}
+
+	handler := newScheduler(apiClient, withPublisher(publisher)).handleMessage
+
+	// Trace ID of the found URL is preserved
+	data := []byte(`{"url":"http://traced.onion","trace_id":"0b8e4f6a-3c1d-4f2e-9a7b-8c5d6e1f2a3b"}`)
+	if err := handler(context.Background(), nil, &nats.Msg{Data: data}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Trace ID of the header is used if the message has none
+	header := nats.Header{}
+	header.Set(natsutil.TraceIDHeader, "5a1c9e7d-2b4f-4c8a-b6e3-1d0f9a8b7c6e")
+	data = []byte(`{"url":"http://header.onion"}`)
+	if err := handler(context.Background(), nil, &nats.Msg{Header: header, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Trace ID is generated otherwise
+	for _, u := range []string{"http://first.onion", "http://second.onion"} {
+		if err := handler(context.Background(), nil, &nats.Msg{Data: []byte(`{"url":"` + u + `"}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(published) != 4 {
+		t.Fatalf("Wanted: 4 Got: %d", len(published))
+	}
+	if published[0].TraceID != "0b8e4f6a-3c1d-4f2e-9a7b-8c5d6e1f2a3b" {
+		t.Errorf("Wanted: 0b8e4f6a-3c1d-4f2e-9a7b-8c5d6e1f2a3b Got: %s", published[0].TraceID)
+	}
+	if published[1].TraceID != "5a1c9e7d-2b4f-4c8a-b6e3-1d0f9a8b7c6e" {
+		t.Errorf("Wanted: 5a1c9e7d-2b4f-4c8a-b6e3-1d0f9a8b7c6e Got: %s", published[1].TraceID)
+	}
+	if _, err := uuid.Parse(published[2].TraceID); err != nil {
+		t.Errorf("Generated trace ID %s is not an UUID", published[2].TraceID)
+	}
+	if published[2].TraceID == published[3].TraceID {
+		t.Errorf("Each URL should get its own trace ID, Got: %s twice", published[2].TraceID)
+	}
+}
+
+func TestSkipTraceID(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync(messaging.URLSkippedSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	policy, err := loadURLPolicy([]string{"onion"}, "", "")
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := newScheduler(&apiClientMock{}, withPolicy(policy)).handleMessage
+	data := []byte(`{"url":"http://example.com","trace_id":"0b8e4f6a-3c1d-4f2e-9a7b-8c5d6e1f2a3b"}`)
+	if err := handler(context.Background(), nc, &nats.Msg{Data: data}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("skipped URL should have been published")
+	}
+
+	var skipped messaging.URLSkippedMsg
+	if err := natsutil.ReadJSON(msg, &skipped); err != nil {
+		t.FailNow()
+	}
+	if skipped.Reason != messaging.SkipReasonTLDNotAllowed || skipped.TraceID != "0b8e4f6a-3c1d-4f2e-9a7b-8c5d6e1f2a3b" {
+		t.Errorf("Wrong skipped message: %+v", skipped)
+	}
+}
+
+func TestHandleMessageTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	todoSub, err := nc.SubscribeSync(messaging.URLTodoSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	// Message published by a traced process
+	parentCtx, parent := provider.Tracer("test").Start(context.Background(), "extractor")
+	parent.End()
+	msg := nats.NewMsg(messaging.URLFoundSubject)
+	msg.Data = []byte(`{"url":"http://example.onion"}`)
+	otel.GetTextMapPropagator().Inject(parentCtx, propagation.HeaderCarrier(msg.Header))
+
+	if err := newScheduler(apiClient).handleMessage(context.Background(), nc, msg); err != nil {
+		t.FailNow()
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	root, ok := spans["scheduler.handleMessage"]
+	if !ok || root.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("message span should be a child of the propagated span")
+	}
+	for _, name := range []string{"api.search", "nats.publish"} {
+		span, ok := spans[name]
+		if !ok || span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("%s span should be a child of the message span", name)
+		}
+	}
+
+	// Trace context should be propagated to url.todo
+	todoMsg, err := todoSub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	propagated := trace.SpanContextFromContext(natsutil.ContextFromMsg(context.Background(), todoMsg))
+	if propagated.TraceID() != parent.SpanContext().TraceID() ||
+		propagated.SpanID() != spans["nats.publish"].SpanContext().SpanID() {
+		t.Error("trace context should have been propagated to the published message")
+	}
 }
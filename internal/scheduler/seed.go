@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// seedFile publish the URLs read from a newline-delimited file, each URL being published only once
+type seedFile struct {
+	path      string
+	publisher natsutil.Publisher
+	published map[string]bool
+	mutex     sync.Mutex
+}
+
+func newSeedFile(path string, publisher natsutil.Publisher) *seedFile {
+	return &seedFile{
+		path:      path,
+		publisher: publisher,
+		published: map[string]bool{},
+	}
+}
+
+// publishNew read the file and publish the URLs not published yet. returns the number of published URLs
+func (sf *seedFile) publishNew() (int, error) {
+	sf.mutex.Lock()
+	defer sf.mutex.Unlock()
+
+	urls, err := readSeeds(sf.path)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, u := range urls {
+		if sf.published[u] {
+			continue
+		}
+
+		if err := sf.publisher.PublishMsg(&messaging.URLFoundMsg{URL: u, Depth: 0, Source: messaging.SourceSeed}); err != nil {
+			return count, fmt.Errorf("error while publishing seed URL: %s", err)
+		}
+
+		sf.published[u] = true
+		count++
+	}
+
+	return count, nil
+}
+
+// watch publish the newly added URLs each time the file is written, until the watcher is closed
+func (sf *seedFile) watch(watcher *fsnotify.Watcher) {
+	// The directory is watched since editors may replace the file instead of writing it
+	name := filepath.Clean(sf.path)
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != name || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+
+			count, err := sf.publishNew()
+			if err != nil {
+				log.Err(err).Str("path", sf.path).Msg("Error while publishing seed URLs")
+				continue
+			}
+			if count > 0 {
+				log.Info().Str("path", sf.path).Int("count", count).Msg("Published new seed URLs")
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Err(err).Str("path", sf.path).Msg("Error while watching seed file")
+		}
+	}
+}
+
+// newSeedWatcher create a watcher notified when the file located at given path changes
+func newSeedWatcher(path string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+// readSeeds returns the deduplicated URLs read from the file located at given path
+func readSeeds(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening %s: %s", path, err)
+	}
+	defer f.Close()
+
+	var urls []string
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines, comments & duplicates
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+
+		seen[line] = true
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading %s: %s", path, err)
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadSeeds(t *testing.T) {
+	path := writePatterns(t, `
+# Seeds
+http://a.onion
+http://b.onion
+
+http://a.onion
+`)
+
+	urls, err := readSeeds(path)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if len(urls) != 2 || urls[0] != "http://a.onion" || urls[1] != "http://b.onion" {
+		t.Errorf("unexpected seeds: %v", urls)
+	}
+
+	if _, err := readSeeds(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fail()
+	}
+}
+
+type seedRecorder struct {
+	urls  []string
+	mutex sync.Mutex
+}
+
+func (sr *seedRecorder) PublishMsg(msg natsutil.Msg) error {
+	urlMsg := msg.(*messaging.URLFoundMsg)
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	sr.urls = append(sr.urls, urlMsg.URL)
+	return nil
+}
+
+func (sr *seedRecorder) count() int {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	return len(sr.urls)
+}
+
+func TestSeedFilePublishNew(t *testing.T) {
+	path := writePatterns(t, "http://a.onion\nhttp://b.onion\n")
+
+	rec := &seedRecorder{}
+	sf := newSeedFile(path, rec)
+
+	if count, err := sf.publishNew(); err != nil || count != 2 {
+		t.FailNow()
+	}
+
+	// Only new URLs should be published
+	if err := ioutil.WriteFile(path, []byte("http://a.onion\nhttp://b.onion\nhttp://c.onion\n"), 0600); err != nil {
+		t.FailNow()
+	}
+	if count, err := sf.publishNew(); err != nil || count != 1 {
+		t.FailNow()
+	}
+
+	if rec.count() != 3 || rec.urls[2] != "http://c.onion" {
+		t.Errorf("unexpected published URLs: %v", rec.urls)
+	}
+}
+
+func TestSeedFileWatch(t *testing.T) {
+	path := writePatterns(t, "http://a.onion\n")
+
+	rec := &seedRecorder{}
+	sf := newSeedFile(path, rec)
+	if _, err := sf.publishNew(); err != nil {
+		t.FailNow()
+	}
+
+	watcher, err := newSeedWatcher(path)
+	if err != nil {
+		t.FailNow()
+	}
+	defer watcher.Close()
+	go sf.watch(watcher)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.FailNow()
+	}
+	if _, err := f.WriteString("http://b.onion\n"); err != nil {
+		t.FailNow()
+	}
+	_ = f.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for rec.count() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec.count() != 2 {
+		t.Error("new seed should have been published")
+	}
+}
@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+// shadowMsg is a scheduled URL published to the shadow subject, its payload being the one published to url.todo
+type shadowMsg struct {
+	*messaging.URLTodoMsg
+	subject string
+}
+
+// Subject returns the shadow subject
+func (msg *shadowMsg) Subject() string {
+	return msg.subject
+}
+
+// publishShadow publish given scheduled URL to the shadow subject, if any. It is only called once the URL has been
+// published to url.todo, and never fails: the live crawl must not be affected by the shadow one
+func (s *scheduler) publishShadow(ctx context.Context, nc *nats.Conn, logger zerolog.Logger,
+	msg *messaging.URLTodoMsg) {
+	if s.shadowSubject == "" {
+		return
+	}
+
+	if err := natsutil.PublishMsgWithContext(ctx, nc, &shadowMsg{URLTodoMsg: msg, subject: s.shadowSubject}); err != nil {
+		schedulerErrors.WithLabelValues(errorKindShadow).Inc()
+		logger.Warn().Str("url", msg.URL).Str("err", err.Error()).Msg("Error while publishing URL to shadow subject")
+		return
+	}
+
+	shadowPublished.Inc()
+}
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+	"time"
+)
+
+func TestHandleMessageShadow(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	todoSub, err := nc.SubscribeSync(messaging.URLTodoSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	shadowSub, err := nc.SubscribeSync("url.shadow")
+	if err != nil {
+		t.FailNow()
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	published := testutil.ToFloat64(shadowPublished)
+
+	handler := newScheduler(apiClient, withShadowSubject("url.shadow")).handleMessage
+	if err := handler(context.Background(), nc,
+		&nats.Msg{Data: []byte(`{"url":"http://example.onion","depth":2,"source":"seed"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	todo, err := todoSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("URL should have been published to url.todo")
+	}
+	shadow, err := shadowSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("URL should have been published to the shadow subject")
+	}
+
+	// The shadow crawler receives the same message
+	if string(shadow.Data) != string(todo.Data) {
+		t.Errorf("Wanted: %s Got: %s", todo.Data, shadow.Data)
+	}
+	var msg messaging.URLTodoMsg
+	if err := natsutil.ReadJSON(shadow, &msg); err != nil {
+		t.FailNow()
+	}
+	if msg.URL != "http://example.onion" || msg.Depth != 2 || msg.Source != messaging.SourceSeed {
+		t.Errorf("invalid shadow message %+v", msg)
+	}
+
+	if testutil.ToFloat64(shadowPublished) != published+1 {
+		t.Errorf("Wanted: %f Got: %f", published+1, testutil.ToFloat64(shadowPublished))
+	}
+}
+
+func TestHandleMessageShadowFailure(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	// The shadow publication fails since the connection is closed
+	nc.Close()
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	var scheduled []string
+	publishErr := error(nil)
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		if publishErr == nil {
+			scheduled = append(scheduled, msg.(*messaging.URLTodoMsg).URL)
+		}
+		return publishErr
+	}
+
+	published := testutil.ToFloat64(shadowPublished)
+	failures := testutil.ToFloat64(schedulerErrors.WithLabelValues(errorKindShadow))
+
+	handler := newScheduler(apiClient, withPublisher(publisher), withShadowSubject("url.shadow")).handleMessage
+
+	// The failure of the shadow publication does not affect the real one
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://a.onion"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduled) != 1 || scheduled[0] != "http://a.onion" {
+		t.Errorf("Wanted: [http://a.onion] Got: %v", scheduled)
+	}
+	if testutil.ToFloat64(shadowPublished) != published {
+		t.Errorf("Wanted: %f Got: %f", published, testutil.ToFloat64(shadowPublished))
+	}
+	if testutil.ToFloat64(schedulerErrors.WithLabelValues(errorKindShadow)) != failures+1 {
+		t.Errorf("Wanted: %f Got: %f", failures+1, testutil.ToFloat64(schedulerErrors.WithLabelValues(errorKindShadow)))
+	}
+
+	// URLs which could not be published to url.todo are not published to the shadow subject either
+	publishErr = errors.New("not confirmed")
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://b.onion"}`)}); err == nil {
+		t.Error("publication error should have been returned")
+	}
+	if testutil.ToFloat64(schedulerErrors.WithLabelValues(errorKindShadow)) != failures+1 {
+		t.Error("URL should not have been published to the shadow subject")
+	}
+}
@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inFlightTracker keep track of the messages being processed
+type inFlightTracker struct {
+	wg    sync.WaitGroup
+	count int64
+}
+
+// wrap returns an handler tracking the messages processed by given handler
+func (ift *inFlightTracker) wrap(handler natsutil.MsgHandler) natsutil.MsgHandler {
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		defer ift.track()()
+
+		return handler(ctx, nc, msg)
+	}
+}
+
+// track start tracking a message, until the returned function is called
+func (ift *inFlightTracker) track() func() {
+	ift.wg.Add(1)
+	atomic.AddInt64(&ift.count, 1)
+
+	return func() {
+		atomic.AddInt64(&ift.count, -1)
+		ift.wg.Done()
+	}
+}
+
+// inFlight returns the number of messages being processed
+func (ift *inFlightTracker) inFlight() int64 {
+	return atomic.LoadInt64(&ift.count)
+}
+
+// wait block until all messages are processed, or until the context is done
+func (ift *inFlightTracker) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ift.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdownOnSignal stop the subscriber once a signal is received, waiting up to timeout
+// for the messages being processed before closing it (which cancel the remaining ones)
+func shutdownOnSignal(signals <-chan os.Signal, sub *natsutil.Connection, tracker *inFlightTracker,
+	timeout time.Duration) {
+	sig := <-signals
+
+	log.Info().Stringer("signal", sig).Int64("in_flight", tracker.inFlight()).Msg("Shutting down")
+	sub.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := tracker.wait(ctx); err != nil {
+		log.Warn().Int64("in_flight", tracker.inFlight()).Msg("Timeout while waiting for in-flight messages")
+	} else {
+		log.Info().Msg("All in-flight messages processed")
+	}
+
+	sub.Close()
+}
@@ -0,0 +1,140 @@
+package scheduler
+
+import (
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startSlowScheduler subscribe using an handler whose API calls take given delay
+func startSlowScheduler(t *testing.T, address string, delay time.Duration) (*natsutil.Connection, *inFlightTracker, chan error) {
+	sub, err := natsutil.NewConnection(address)
+	if err != nil {
+		t.FailNow()
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			time.Sleep(delay)
+			return nil, 0, nil
+		},
+	}
+
+	tracker := &inFlightTracker{}
+	handler := tracker.wrap(newScheduler(apiClient).handleMessage)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- subscribeAll(sub, []string{messaging.URLFoundSubject}, "schedulers", handler)
+	}()
+
+	return sub, tracker, done
+}
+
+// waitInFlight wait until a message is being processed
+func waitInFlight(t *testing.T, tracker *inFlightTracker) {
+	for i := 0; i < 100 && tracker.inFlight() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if tracker.inFlight() != 1 {
+		t.FailNow()
+	}
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	todoSub, err := nc.SubscribeSync(messaging.URLTodoSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	sub, tracker, done := startSlowScheduler(t, s.ClientURL(), 300*time.Millisecond)
+
+	for i := 0; i < 50 && !sub.IsSubscribed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{URL: "http://example.onion"}); err != nil {
+		t.FailNow()
+	}
+	waitInFlight(t, tracker)
+
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+	shutdownOnSignal(signals, sub, tracker, 5*time.Second)
+
+	// In-flight message should have been processed
+	if tracker.inFlight() != 0 {
+		t.Error("shutdown should wait for in-flight messages")
+	}
+	if _, err := todoSub.NextMsg(time.Second); err != nil {
+		t.Error("in-flight URL should have been scheduled")
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("stopped subscriber should not return error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("subscriber should have been stopped")
+	}
+
+	if sub.IsConnected() {
+		t.Error("subscriber should have been closed")
+	}
+}
+
+func TestShutdownOnSignalTimeout(t *testing.T) {
+	s := runNATSServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, tracker, _ := startSlowScheduler(t, s.ClientURL(), 500*time.Millisecond)
+
+	for i := 0; i < 50 && !sub.IsSubscribed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{URL: "http://example.onion"}); err != nil {
+		t.FailNow()
+	}
+	waitInFlight(t, tracker)
+
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+
+	// Once the timeout is elapsed the handlers context is cancelled,
+	// and closing the subscriber wait for the handlers to return
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		if tracker.inFlight() != 1 {
+			t.Error("message should still be in-flight")
+		}
+	}()
+	shutdownOnSignal(signals, sub, tracker, 100*time.Millisecond)
+
+	if tracker.inFlight() != 0 {
+		t.Error("shutdown should wait for the cancelled in-flight messages")
+	}
+	if sub.IsConnected() {
+		t.Error("subscriber should have been closed")
+	}
+}
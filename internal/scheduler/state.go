@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"time"
+)
+
+// schedulerState persist the scheduled URLs in a NATS key-value bucket, so that they are not scheduled again
+// after a restart. the URLs are base64 encoded to be used as key, the value being the scheduling time
+type schedulerState struct {
+	kv nats.KeyValue
+	// ttl is the expiration delay of the entries (0 = never)
+	ttl time.Duration
+}
+
+func newSchedulerState(kv nats.KeyValue, ttl time.Duration) *schedulerState {
+	return &schedulerState{kv: kv, ttl: ttl}
+}
+
+// save persist the scheduling time of given URL
+func (s *schedulerState) save(url string, scheduledAt time.Time) error {
+	if s == nil {
+		return nil
+	}
+
+	key := base64.RawURLEncoding.EncodeToString([]byte(url))
+	if _, err := s.kv.Put(key, []byte(scheduledAt.UTC().Format(time.RFC3339))); err != nil {
+		return fmt.Errorf("error while saving %s state: %s", url, err)
+	}
+
+	return nil
+}
+
+// warm mark the persisted URLs as seen in given cache, until their entry expire
+// (or until the dedup window expire if entries never expire). returns the number of URLs added
+func (s *schedulerState) warm(cache *memoryDedupCache) (int, error) {
+	w, err := s.kv.WatchAll(nats.IgnoreDeletes())
+	if err != nil {
+		return 0, err
+	}
+	defer w.Stop()
+
+	count := 0
+	now := cache.now()
+	for entry := range w.Updates() {
+		// nil entry means all existing values have been received
+		if entry == nil {
+			break
+		}
+
+		url, err := base64.RawURLEncoding.DecodeString(entry.Key())
+		if err != nil {
+			continue
+		}
+		scheduledAt, err := time.Parse(time.RFC3339, string(entry.Value()))
+		if err != nil {
+			continue
+		}
+
+		expiry := scheduledAt.Add(cache.window)
+		if s.ttl > 0 {
+			expiry = scheduledAt.Add(s.ttl)
+		}
+		if !now.Before(expiry) {
+			continue
+		}
+
+		cache.add(string(url), expiry)
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func runJetStreamServer(t *testing.T) *server.Server {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	return test.RunServer(&opts)
+}
+
+func TestSchedulerStateWarm(t *testing.T) {
+	s := runJetStreamServer(t)
+	defer s.Shutdown()
+
+	sub, err := natsutil.NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	kv, err := sub.KeyValue("scheduler", time.Hour)
+	if err != nil {
+		t.FailNow()
+	}
+	state := newSchedulerState(kv, time.Hour)
+
+	now := time.Now()
+	if err := state.save("http://recent.onion/index.html?a=b", now.Add(-time.Minute)); err != nil {
+		t.FailNow()
+	}
+	if err := state.save("http://old.onion", now.Add(-2*time.Hour)); err != nil {
+		t.FailNow()
+	}
+
+	cache, err := newMemoryDedupCache(10, time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+
+	count, err := state.warm(cache)
+	if err != nil {
+		t.FailNow()
+	}
+	if count != 1 {
+		t.Errorf("Wanted: 1 Got: %d", count)
+	}
+
+	// Recently scheduled URL should be kept until refresh delay is over, not only during dedup window
+	cache.now = func() time.Time { return now.Add(30 * time.Minute) }
+	if !cache.seen("http://recent.onion/index.html?a=b") {
+		t.Error("recently scheduled URL should have been restored")
+	}
+	if cache.seen("http://old.onion") {
+		t.Error("expired URL should not have been restored")
+	}
+}
+
+func TestSchedulerStateEmpty(t *testing.T) {
+	s := runJetStreamServer(t)
+	defer s.Shutdown()
+
+	sub, err := natsutil.NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	kv, err := sub.KeyValue("scheduler", 0)
+	if err != nil {
+		t.FailNow()
+	}
+
+	cache, err := newMemoryDedupCache(10, time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if count, err := newSchedulerState(kv, 0).warm(cache); err != nil || count != 0 {
+		t.Fail()
+	}
+
+	// Nil state should be a no-op
+	var nilState *schedulerState
+	if err := nilState.save("http://example.onion", time.Now()); err != nil {
+		t.Fail()
+	}
+}
+
+func TestHandleMessageSavesState(t *testing.T) {
+	s := runJetStreamServer(t)
+	defer s.Shutdown()
+
+	sub, err := natsutil.NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	kv, err := sub.KeyValue("scheduler", time.Hour)
+	if err != nil {
+		t.FailNow()
+	}
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			return nil, 0, nil
+		},
+	}
+
+	cache, err := newMemoryDedupCache(10, time.Minute)
+	if err != nil {
+		t.FailNow()
+	}
+
+	handler := newScheduler(apiClient, withDedup(cache, newSchedulerState(kv, time.Hour))).handleMessage
+
+	if err := handler(context.Background(), nc, &nats.Msg{Data: []byte(`{"url":"http://example.onion"}`)}); err != nil {
+		t.FailNow()
+	}
+
+	// Restarted scheduler should not schedule the URL again
+	restartedCache, err := newMemoryDedupCache(10, time.Minute)
+	if err != nil {
+		t.FailNow()
+	}
+	if count, err := newSchedulerState(kv, time.Hour).warm(restartedCache); err != nil || count != 1 {
+		t.FailNow()
+	}
+	if !restartedCache.seen("http://example.onion") {
+		t.Error("scheduled URL should have been persisted")
+	}
+}
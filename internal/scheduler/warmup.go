@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/creekorful/trandoshan/api"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// warmUpBatchSize is the maximum number of URLs checked by a single bulk search during the warm-up window
+const warmUpBatchSize = 1000
+
+// warmUp speed up the startup (e.g: when publishing a large seed file): the URLs received during the warm-up window
+// are processed concurrently and checked against the API using bulk searches sent at the end of the window,
+// instead of one search per URL
+type warmUp struct {
+	end     time.Time
+	batcher *searchBatcher
+	// pool process the messages received during the window, up to a batch at once
+	pool *workerPool
+}
+
+// newWarmUp returns the warm-up lasting given window from now
+func newWarmUp(apiClient api.Client, window time.Duration) *warmUp {
+	w := &warmUp{
+		end:     time.Now().Add(window),
+		batcher: newSearchBatcher(apiClient, warmUpBatchSize, window),
+	}
+
+	// Send the searches pending at the end of the window
+	time.AfterFunc(window, func() {
+		log.Debug().Msg("Warm-up window is over")
+		w.batcher.flush()
+	})
+
+	return w
+}
+
+// active returns true until the end of the warm-up window (false if there is no warm-up)
+func (w *warmUp) active() bool {
+	return w != nil && time.Now().Before(w.end)
+}
+
+// wrap returns an handler dispatching the messages received during the warm-up window to a pool of workers using
+// given handler, so that the next ones are received without waiting for the bulk search. The messages received
+// afterward are processed by next. The dispatched messages are tracked as in-flight until processed
+func (w *warmUp) wrap(handler, next natsutil.MsgHandler, tracker *inFlightTracker) natsutil.MsgHandler {
+	w.pool = newWorkerPool(warmUpBatchSize, handler, tracker)
+
+	return func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		if !w.active() {
+			return next(ctx, nc, msg)
+		}
+
+		return w.pool.dispatch(ctx, nc, msg)
+	}
+}
+
+// close stop the warm-up workers. the in-flight messages should be waited for beforehand
+func (w *warmUp) close() {
+	w.pool.close()
+}
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func foundMsg(url string) *nats.Msg {
+	return &nats.Msg{Data: []byte(fmt.Sprintf(`{"url":%q}`, url))}
+}
+
+func TestWarmUp(t *testing.T) {
+	var mutex sync.Mutex
+	var bulkCalls [][]string
+	searchCalls := 0
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			searchCalls++
+			return nil, 0, nil
+		},
+		searchResourcesBulk: func(urls []string, startDate, endDate time.Time) (map[string][]api.ResourceDto, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			bulkCalls = append(bulkCalls, urls)
+
+			resources := map[string][]api.ResourceDto{}
+			for _, u := range urls {
+				if rawURL, _ := api.DecodeURL(u); strings.Contains(rawURL, "crawled") {
+					resources[u] = []api.ResourceDto{{URL: rawURL}}
+				}
+			}
+			return resources, nil
+		},
+	}
+
+	var published []string
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		published = append(published, msg.(*messaging.URLTodoMsg).URL)
+		return nil
+	}
+
+	warm := newWarmUp(apiClient, 100*time.Millisecond)
+	handler := newScheduler(apiClient, withPublisher(publisher), withWarmUp(warm)).handleMessage
+	tracker := &inFlightTracker{}
+	handler = warm.wrap(handler, handler, tracker)
+	defer warm.close()
+
+	// URLs received during the window are not checked one by one
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		u := fmt.Sprintf("http://seed%d.onion", i)
+		if i == 5 {
+			u = "http://crawled.onion"
+		}
+		if err := handler(context.Background(), nil, foundMsg(u)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("handler should not wait for the end of the window (elapsed: %s)", elapsed)
+	}
+
+	if err := tracker.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bulkCalls) != 1 || len(bulkCalls[0]) != 10 {
+		t.Errorf("Wanted: a single bulk search with 10 URLs Got: %v", bulkCalls)
+	}
+	if searchCalls != 0 {
+		t.Errorf("Wanted: 0 search Got: %d", searchCalls)
+	}
+	if len(published) != 9 {
+		t.Errorf("Wanted: 9 published URLs Got: %v", published)
+	}
+	for _, u := range published {
+		if strings.Contains(u, "crawled") {
+			t.Errorf("%s should not have been published", u)
+		}
+	}
+
+	// URLs received after the window are checked one by one
+	if warm.active() {
+		t.Fatal("window should be over")
+	}
+	if err := handler(context.Background(), nil, foundMsg("http://late.onion")); err != nil {
+		t.Fatal(err)
+	}
+	if searchCalls != 1 || len(bulkCalls) != 1 || len(published) != 10 {
+		t.Errorf("unexpected calls: %d searches, %d bulk searches, %d published", searchCalls, len(bulkCalls), len(published))
+	}
+}
+
+func TestWarmUpNil(t *testing.T) {
+	var warm *warmUp
+	if warm.active() {
+		t.Error("missing warm-up should never be active")
+	}
+}
+
+// BenchmarkStartup compare the processing of the URLs received at startup checked one by one against the API,
+// and using a bulk search at the end of the warm-up window. Each API call takes 1ms
+func BenchmarkStartup(b *testing.B) {
+	const seedCount = 200
+	const latency = time.Millisecond
+
+	// Logging would dominate the measures
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer zerolog.SetGlobalLevel(level)
+
+	apiClient := &apiClientMock{
+		searchResources: func(url, keyword string, startDate, endDate time.Time,
+			paginationPage, paginationSize int) ([]api.ResourceDto, int64, error) {
+			time.Sleep(latency)
+			return nil, 0, nil
+		},
+		searchResourcesBulk: func(urls []string, startDate, endDate time.Time) (map[string][]api.ResourceDto, error) {
+			time.Sleep(latency)
+			return map[string][]api.ResourceDto{}, nil
+		},
+	}
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		return nil
+	}
+
+	msgs := make([]*nats.Msg, seedCount)
+	for i := range msgs {
+		msgs[i] = foundMsg(fmt.Sprintf("http://seed%d.onion", i))
+	}
+
+	b.Run("per-message", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			handler := newScheduler(apiClient, withPublisher(publisher)).handleMessage
+			for _, msg := range msgs {
+				_ = handler(context.Background(), nil, msg)
+			}
+		}
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			warm := newWarmUp(apiClient, 10*time.Millisecond)
+			handler := newScheduler(apiClient, withPublisher(publisher), withWarmUp(warm)).handleMessage
+			tracker := &inFlightTracker{}
+			handler = warm.wrap(handler, handler, tracker)
+			for _, msg := range msgs {
+				_ = handler(context.Background(), nil, msg)
+			}
+			_ = tracker.wait(context.Background())
+			warm.close()
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"sync"
+)
+
+// errPoolStopped is returned when dispatching a message to a stopped worker pool
+var errPoolStopped = errors.New("worker pool stopped")
+
+// job is a message waiting to be processed by a worker
+type job struct {
+	ctx  context.Context
+	nc   *nats.Conn
+	msg  *nats.Msg
+	ack  func(err error)
+	done func()
+}
+
+// workerPool process the received messages concurrently using a fixed number of workers, so that a slow API call
+// doesn't hold the next URLs. The acknowledgement of the messages is deferred until their handler returns: with
+// JetStream, they are redelivered on failure as when processed sequentially
+type workerPool struct {
+	jobs    chan job
+	stop    chan struct{}
+	tracker *inFlightTracker
+	workers sync.WaitGroup
+}
+
+// newWorkerPool starts given count of workers processing the messages using given handler.
+// the dispatched messages are tracked as in-flight until processed
+func newWorkerPool(count int, handler natsutil.MsgHandler, tracker *inFlightTracker) *workerPool {
+	p := &workerPool{
+		jobs:    make(chan job),
+		stop:    make(chan struct{}),
+		tracker: tracker,
+	}
+
+	for i := 0; i < count; i++ {
+		p.workers.Add(1)
+		go p.work(handler)
+	}
+
+	return p
+}
+
+func (p *workerPool) work(handler natsutil.MsgHandler) {
+	defer p.workers.Done()
+
+	for {
+		select {
+		case j := <-p.jobs:
+			j.ack(handler(j.ctx, j.nc, j.msg))
+			j.done()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// dispatch hand given message to the first available worker, blocking until one is available.
+// the message is acknowledged by the worker once processed
+func (p *workerPool) dispatch(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+	done := p.tracker.track()
+	ack := natsutil.DeferAck(ctx)
+
+	var err error
+	select {
+	case p.jobs <- job{ctx: ctx, nc: nc, msg: msg, ack: ack, done: done}:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-p.stop:
+		err = errPoolStopped
+	}
+
+	done()
+	ack(err)
+	return err
+}
+
+// close stop the workers once their current message is processed, and wait for them to terminate.
+// the in-flight messages should be waited for beforehand to drain the pool
+func (p *workerPool) close() {
+	close(p.stop)
+	p.workers.Wait()
+}
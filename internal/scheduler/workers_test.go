@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/creekorful/trandoshan/api"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+
+	handler := func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		<-release
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return fmt.Errorf("errors are given to the subscriber")
+	}
+
+	tracker := &inFlightTracker{}
+	pool := newWorkerPool(2, handler, tracker)
+	defer pool.close()
+
+	// The third message waits for a worker to be available
+	dispatched := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			dispatched <- pool.dispatch(context.Background(), nil, foundMsg("http://example.onion"))
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-dispatched; err != nil {
+			t.Errorf("Wanted: nil Got: %s", err)
+		}
+	}
+	select {
+	case <-dispatched:
+		t.Error("third message should wait for a worker")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if tracker.inFlight() != 3 {
+		t.Errorf("Wanted: 3 in-flight messages Got: %d", tracker.inFlight())
+	}
+
+	close(release)
+	if err := <-dispatched; err != nil {
+		t.Errorf("Wanted: nil Got: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tracker.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if maxRunning != 2 {
+		t.Errorf("Wanted: 2 concurrent messages Got: %d", maxRunning)
+	}
+}
+
+func TestWorkerPoolStopped(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		<-release
+		return nil
+	}
+
+	tracker := &inFlightTracker{}
+	pool := newWorkerPool(1, handler, tracker)
+
+	if err := pool.dispatch(context.Background(), nil, foundMsg("http://example.onion")); err != nil {
+		t.Fatal(err)
+	}
+
+	// No worker is available: the message is not processed once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pool.dispatch(ctx, nil, foundMsg("http://example.onion")); err != context.Canceled {
+		t.Errorf("Wanted: %s Got: %v", context.Canceled, err)
+	}
+	if tracker.inFlight() != 1 {
+		t.Errorf("Wanted: 1 in-flight message Got: %d", tracker.inFlight())
+	}
+
+	// Close wait for the message being processed
+	closed := make(chan struct{})
+	go func() {
+		pool.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Error("close should wait for the message being processed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-closed
+
+	if tracker.inFlight() != 0 {
+		t.Errorf("Wanted: 0 in-flight message Got: %d", tracker.inFlight())
+	}
+	if err := pool.dispatch(context.Background(), nil, foundMsg("http://example.onion")); err != errPoolStopped {
+		t.Errorf("Wanted: %s Got: %v", errPoolStopped, err)
+	}
+}
+
+func TestWorkerPoolAck(t *testing.T) {
+	s := runJetStreamServer(t)
+	defer s.Shutdown()
+
+	sub, err := natsutil.NewJetStreamConnection(s.ClientURL(), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	// The first processing fails: the message should be redelivered rather than acknowledged once dispatched
+	var mutex sync.Mutex
+	processed := make(chan struct{}, 10)
+	count := 0
+	handler := func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		mutex.Lock()
+		count++
+		fail := count == 1
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		processed <- struct{}{}
+		if fail {
+			return fmt.Errorf("api is down")
+		}
+		return nil
+	}
+
+	pool := newWorkerPool(2, handler, &inFlightTracker{})
+	defer pool.close()
+
+	go func() {
+		_ = sub.QueueSubscribe("url.found", "schedulers", pool.dispatch)
+	}()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := js.StreamInfo("URL_FOUND"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := nc.Publish("url.found", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-processed:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Wanted: 2 processings Got: %d", i)
+		}
+	}
+
+	select {
+	case <-processed:
+		t.Error("message should have been acknowledged")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// BenchmarkWorkers measure the scheduling throughput depending on the number of workers, against a mock API
+// server answering the searches after a fixed latency
+func BenchmarkWorkers(b *testing.B) {
+	const latency = 2 * time.Millisecond
+
+	// Logging would dominate the measures
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer zerolog.SetGlobalLevel(level)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+		w.Header().Set(api.PaginationCountHeader, "0")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	publisher := func(ctx context.Context, msg natsutil.Msg) error {
+		return nil
+	}
+
+	for _, workers := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			apiClient := api.NewClient(srv.URL, api.WithTransport(workers, api.DefaultIdleConnTimeout))
+
+			tracker := &inFlightTracker{}
+			pool := newWorkerPool(workers, newScheduler(apiClient, withPublisher(publisher)).handleMessage, tracker)
+			defer pool.close()
+
+			msgs := make([]*nats.Msg, b.N)
+			for i := range msgs {
+				msgs[i] = foundMsg(fmt.Sprintf("http://url%d.onion", i))
+			}
+
+			b.ResetTimer()
+			start := time.Now()
+			for _, msg := range msgs {
+				_ = pool.dispatch(context.Background(), nil, msg)
+			}
+			_ = tracker.wait(context.Background())
+
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "urls/s")
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package seedgenerator
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/creekorful/trandoshan/internal/util/onion"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// onionExp match the v2 & v3 onion addresses. subdomains are not captured
+var onionExp = regexp.MustCompile(`(?i)\b([a-z2-7]{56}|[a-z2-7]{16})\.onion\b`)
+
+// GetApp return the seed generator app
+func GetApp() *cli.App {
+	return &cli.App{
+		Name:    "tdsh-seed-generator",
+		Version: "0.5.0",
+		Usage:   "Trandoshan seed generator, publishing the onion addresses found in a text (e.g: a paste dump)",
+		Flags: []cli.Flag{
+			logging.GetLogFlag(),
+			logging.GetLogFormatFlag(),
+			&cli.StringFlag{
+				Name:  "nats-uri",
+				Usage: "URI to the NATS server (or comma separated list of cluster servers)",
+			},
+			natsutil.GetUserFlag(),
+			natsutil.GetPasswordFlag(),
+			natsutil.GetNKeySeedFlag(),
+			natsutil.GetCompressionFlag(),
+			natsutil.GetCompressThresholdFlag(),
+			&cli.StringFlag{
+				Name:  "input",
+				Usage: "Path to the text file to read the onion addresses from (- for stdin)",
+				Value: "-",
+			},
+			&cli.BoolFlag{
+				Name:  "v2-only",
+				Usage: "Only extract the v2 onion addresses (16 characters)",
+			},
+			&cli.BoolFlag{
+				Name:  "v3-only",
+				Usage: "Only extract the v3 onion addresses (56 characters)",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the extracted URLs instead of publishing them",
+			},
+		},
+		Action: execute,
+	}
+}
+
+func execute(ctx *cli.Context) error {
+	logging.ConfigureLogger(ctx)
+
+	log.Info().Str("ver", ctx.App.Version).Msg("Starting tdsh-seed-generator")
+
+	if ctx.Bool("v2-only") && ctx.Bool("v3-only") {
+		return fmt.Errorf("--v2-only cannot be used with --v3-only")
+	}
+	if !ctx.Bool("dry-run") && ctx.String("nats-uri") == "" {
+		return fmt.Errorf("--nats-uri is required unless running in dry-run mode")
+	}
+
+	in, err := openInput(ctx.String("input"))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	urls, err := extractURLs(in, !ctx.Bool("v3-only"), !ctx.Bool("v2-only"))
+	if err != nil {
+		return err
+	}
+	log.Debug().Int("count", len(urls)).Msg("Extracted onion URLs")
+
+	if ctx.Bool("dry-run") {
+		for _, u := range urls {
+			fmt.Println(u)
+		}
+		return nil
+	}
+
+	log.Debug().Str("uri", ctx.String("nats-uri")).Msg("Using NATS server")
+
+	nc, err := natsutil.Connect(ctx.String("nats-uri"), natsutil.GetOptions(ctx)...)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	for _, u := range urls {
+		if err := natsutil.PublishMsg(nc, &messaging.URLFoundMsg{URL: u, Source: messaging.SourceSeed}); err != nil {
+			return fmt.Errorf("error while publishing URL: %s", err)
+		}
+	}
+
+	// Make sure the URLs have been received before exiting
+	if err := nc.Flush(); err != nil {
+		return fmt.Errorf("error while publishing URLs: %s", err)
+	}
+
+	log.Info().Int("count", len(urls)).Msg("Successfully published seed URLs")
+
+	return nil
+}
+
+// openInput returns the reader of the file located at given path (stdin if -)
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	return os.Open(path)
+}
+
+// extractURLs returns the deduplicated URLs (http://<address>.onion) of the valid onion addresses
+// found in given text, in order of appearance
+func extractURLs(r io.Reader, withV2, withV3 bool) ([]string, error) {
+	var urls []string
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, match := range onionExp.FindAllStringSubmatch(scanner.Text(), -1) {
+			address := strings.ToLower(match[1])
+
+			switch len(address) {
+			case onion.V2Length:
+				if !withV2 {
+					continue
+				}
+			case onion.V3Length:
+				if !withV3 || !onion.IsValidV3Address(address) {
+					continue
+				}
+			}
+
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+
+			urls = append(urls, fmt.Sprintf("http://%s.onion", address))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading input: %s", err)
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,134 @@
+package seedgenerator
+
+import (
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	v3DuckDuckGo  = "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad"
+	v3TorProject  = "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid"
+	v2DuckDuckGo  = "3g2upl4pq6kufc4m"
+	v2HiddenWiki  = "zqktlwi4fecvo6ri"
+	v3BadChecksum = "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczaa"
+)
+
+var paste = `=== Fresh onion links 2021 ===
+DuckDuckGo: http://` + v3DuckDuckGo + `.onion/
+Tor Project -> https://www.` + v3TorProject + `.onion/download/?lang=en
+old ddg: ` + strings.ToUpper(v2DuckDuckGo) + `.onion
+hidden wiki (` + v2HiddenWiki + `.onion/wiki/index.php) | mirror: ` + v2HiddenWiki + `.onion:80
+duplicate: ` + v3DuckDuckGo + `.onion
+fake: ` + v3BadChecksum + `.onion
+too long: a` + v2DuckDuckGo + `.onion, too short: abcdefghijklmno.onion, bad alphabet: 0123456789abcdef.onion
+not onion: ` + v2DuckDuckGo + `.onions ` + v2DuckDuckGo + `.com
+`
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		withV2, withV3 bool
+		want           []string
+	}{
+		{true, true, []string{
+			"http://" + v3DuckDuckGo + ".onion",
+			"http://" + v3TorProject + ".onion",
+			"http://" + v2DuckDuckGo + ".onion",
+			"http://" + v2HiddenWiki + ".onion",
+		}},
+		{true, false, []string{"http://" + v2DuckDuckGo + ".onion", "http://" + v2HiddenWiki + ".onion"}},
+		{false, true, []string{"http://" + v3DuckDuckGo + ".onion", "http://" + v3TorProject + ".onion"}},
+	}
+
+	for _, test := range tests {
+		urls, err := extractURLs(strings.NewReader(paste), test.withV2, test.withV3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Join(urls, ",") != strings.Join(test.want, ",") {
+			t.Errorf("v2: %v v3: %v Wanted: %v Got: %v", test.withV2, test.withV3, test.want, urls)
+		}
+	}
+}
+
+func TestExtractURLsEmpty(t *testing.T) {
+	urls, err := extractURLs(strings.NewReader("nothing to see here\nhttp://example.com\n"), true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 0 {
+		t.Errorf("Got: %v", urls)
+	}
+}
+
+func TestPublishSeeds(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync(messaging.URLFoundSubject)
+	if err != nil {
+		t.FailNow()
+	}
+	if err := nc.Flush(); err != nil {
+		t.FailNow()
+	}
+
+	f, err := ioutil.TempFile("", "paste")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(paste); err != nil {
+		t.FailNow()
+	}
+	_ = f.Close()
+
+	if err := GetApp().Run([]string{"tdsh-seed-generator", "--nats-uri", s.ClientURL(), "--input", f.Name(),
+		"--v3-only"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"http://" + v3DuckDuckGo + ".onion", "http://" + v3TorProject + ".onion"} {
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var urlMsg messaging.URLFoundMsg
+		if err := natsutil.ReadMsg(msg, &urlMsg); err != nil {
+			t.FailNow()
+		}
+		if urlMsg.URL != want || urlMsg.Depth != 0 {
+			t.Errorf("Wanted: %s Got: %+v", want, urlMsg)
+		}
+	}
+	if _, err := sub.NextMsg(100 * time.Millisecond); err == nil {
+		t.Error("only v3 addresses should be published")
+	}
+}
+
+func TestInvalidFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"tdsh-seed-generator", "--v2-only", "--v3-only", "--dry-run"},
+		{"tdsh-seed-generator", "--input", "missing.txt"},
+	} {
+		if err := GetApp().Run(args); err == nil {
+			t.Errorf("%v should fail", args)
+		}
+	}
+}
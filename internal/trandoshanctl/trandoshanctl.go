@@ -3,26 +3,31 @@ package trandoshanctl
 import (
 	"fmt"
 	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
 	"github.com/creekorful/trandoshan/internal/util/logging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"io"
+	"os"
+	"text/tabwriter"
 	"time"
 )
 
+// dlqConsumer is the name of the durable consumer reading the dead-letter stream
+const dlqConsumer = "dlq-requeue"
+
 // GetApp returns the Trandoshan CLI app
 func GetApp() *cli.App {
 	return &cli.App{
 		Name:    "trandoshanctl",
-		Version: "0.4.0",
+		Version: "0.5.0",
 		Usage:   "Trandoshan CLI",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			logging.GetLogFlag(),
-			&cli.StringFlag{
-				Name:  "api-uri",
-				Usage: "URI to the API server",
-				Value: "http://localhost:15005",
-			},
-		},
+			logging.GetLogFormatFlag(),
+		}, api.GetLocalClientFlags()...),
 		Commands: []*cli.Command{
 			{
 				Name:      "schedule",
@@ -34,7 +39,64 @@ func GetApp() *cli.App {
 				Name:      "search",
 				Usage:     "Search for specific resources",
 				ArgsUsage: "keyword",
-				Action:    search,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "title",
+						Usage: "Only search for the resources whose title match given words",
+					},
+					&cli.StringFlag{
+						Name:  "language",
+						Usage: "Only search for the resources in given language (BCP-47 code, e.g: en)",
+					},
+					&cli.StringFlag{
+						Name:  "charset",
+						Usage: "Only search for the resources whose body has been decoded from given charset (e.g: windows-1252)",
+					},
+					&cli.StringFlag{
+						Name:  "source",
+						Usage: "Only search for the resources whose URL has been discovered by given source (crawler, seed or manual)",
+					},
+					&cli.IntFlag{
+						Name:  "response-code",
+						Usage: "Only search for the resources whose response had given HTTP status code",
+					},
+					&cli.Int64Flag{
+						Name:  "min-size",
+						Usage: "Only search for the resources whose body is at least given size (in bytes)",
+					},
+					&cli.Int64Flag{
+						Name:  "max-size",
+						Usage: "Only search for the resources whose body is at most given size (in bytes)",
+					},
+				},
+				Action: search,
+			},
+			{
+				Name:   "stats",
+				Usage:  "Display the crawl statistics",
+				Action: stats,
+			},
+			{
+				Name:  "dlq-requeue",
+				Usage: "Publish back the URLs from the dead-letter queue for scheduling",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "nats-uri",
+						Usage:    "URI to the NATS server (or comma separated list of cluster servers)",
+						Required: true,
+					},
+					natsutil.GetUserFlag(),
+					natsutil.GetPasswordFlag(),
+					natsutil.GetNKeySeedFlag(),
+					natsutil.GetCompressionFlag(),
+					natsutil.GetCompressThresholdFlag(),
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Stop once no dead URL has been received for given duration",
+						Value: 5 * time.Second,
+					},
+				},
+				Action: dlqRequeue,
 			},
 		},
 		Before: before,
@@ -52,7 +114,10 @@ func schedule(c *cli.Context) error {
 	}
 
 	url := c.Args().First()
-	apiClient := api.NewClient(c.String("api-uri"))
+	apiClient, err := api.NewClientFromContext(c)
+	if err != nil {
+		return err
+	}
 
 	if err := apiClient.ScheduleURL(url); err != nil {
 		log.Err(err).Str("url", url).Msg("Unable to schedule crawling for URL")
@@ -66,9 +131,22 @@ func schedule(c *cli.Context) error {
 
 func search(c *cli.Context) error {
 	keyword := c.Args().First()
-	apiClient := api.NewClient(c.String("api-uri"))
+	apiClient, err := api.NewClientFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	filter := api.NewFilter().
+		Keywords(keyword).
+		Title(c.String("title")).
+		Language(c.String("language")).
+		Charset(c.String("charset")).
+		Source(c.String("source")).
+		ResponseCode(c.Int("response-code")).
+		MinSize(c.Int64("min-size")).
+		MaxSize(c.Int64("max-size"))
 
-	res, count, err := apiClient.SearchResources("", keyword, time.Time{}, time.Time{}, 1, 20)
+	res, count, err := apiClient.Search(filter)
 	if err != nil {
 		log.Err(err).Str("keyword", keyword).Msg("Unable to search resources")
 		return err
@@ -87,3 +165,105 @@ func search(c *cli.Context) error {
 
 	return nil
 }
+
+func stats(c *cli.Context) error {
+	apiClient, err := api.NewClientFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	s, err := apiClient.GetStats()
+	if err != nil {
+		log.Err(err).Msg("Unable to get stats")
+		return err
+	}
+
+	return PrintStats(os.Stdout, s)
+}
+
+// PrintStats write given statistics as tables
+func PrintStats(out io.Writer, s api.StatsDto) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Resources\t%d\n", s.ResourceCount)
+	fmt.Fprintf(w, "Hosts\t%d\n", s.HostCount)
+	fmt.Fprintf(w, "Resources (last 24h)\t%d\n", s.ResourceCountLast24h)
+	fmt.Fprintf(w, "Resources (last 7d)\t%d\n", s.ResourceCountLast7d)
+	fmt.Fprintf(w, "Resources (last 30d)\t%d\n", s.ResourceCountLast30d)
+	fmt.Fprintf(w, "Average body size\t%.0f bytes\n", s.AverageBodySize)
+
+	if len(s.TopHosts) > 0 {
+		fmt.Fprintf(w, "\nTop hosts\tResources\n")
+		for _, host := range s.TopHosts {
+			fmt.Fprintf(w, "%s\t%d\n", host.Host, host.ResourceCount)
+		}
+	}
+
+	return w.Flush()
+}
+
+func dlqRequeue(c *cli.Context) error {
+	nc, err := natsutil.Connect(c.String("nats-uri"), natsutil.GetOptions(c)...)
+	if err != nil {
+		log.Err(err).Str("uri", c.String("nats-uri")).Msg("Error while connecting to NATS server")
+		return err
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		return err
+	}
+
+	sub, err := subscribeDeadURLs(js)
+	if err != nil {
+		log.Err(err).Msg("Unable to read the dead-letter queue (JetStream is required)")
+		return err
+	}
+
+	count, err := requeueDeadURLs(nc, sub, c.Duration("timeout"))
+	if err != nil {
+		log.Err(err).Msg("Unable to requeue dead URLs")
+		return err
+	}
+
+	log.Info().Int("count", count).Msg("Successfully requeued dead URLs")
+
+	return nil
+}
+
+// subscribeDeadURLs returns the subscription of the durable consumer reading the dead-letter stream,
+// creating the stream if needed
+func subscribeDeadURLs(js nats.JetStreamContext) (*nats.Subscription, error) {
+	stream, err := natsutil.EnsureStream(js, messaging.URLDeadSubject, nats.WorkQueuePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	return js.SubscribeSync(messaging.URLDeadSubject, nats.BindStream(stream), nats.Durable(dlqConsumer),
+		nats.AckExplicit(), nats.ManualAck())
+}
+
+// requeueDeadURLs publish the URLs received on given subscription back to the found subject, acknowledging them
+// once published, until no message is received for given timeout
+func requeueDeadURLs(nc *nats.Conn, sub *nats.Subscription, timeout time.Duration) (int, error) {
+	count := 0
+	for {
+		msg, err := sub.NextMsg(timeout)
+		if err == nats.ErrTimeout {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if err := natsutil.Republish(nc, messaging.URLFoundSubject, msg); err != nil {
+			_ = msg.Nak()
+			return count, err
+		}
+		if err := msg.AckSync(); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
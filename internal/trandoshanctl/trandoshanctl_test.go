@@ -0,0 +1,122 @@
+package trandoshanctl
+
+import (
+	"bytes"
+	"github.com/creekorful/trandoshan/api"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRequeueDeadURLs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trandoshan")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = dir
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.FailNow()
+	}
+
+	foundSub, err := nc.SubscribeSync(messaging.URLFoundSubject)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// The dead URLs are kept while nobody is reading them
+	stream, err := natsutil.EnsureStream(js, messaging.URLDeadSubject, nats.WorkQueuePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{`{"url":"http://a.onion"}`, `{"url":"http://b.onion"}`} {
+		if _, err := js.Publish(messaging.URLDeadSubject, []byte(u)); err != nil {
+			t.FailNow()
+		}
+	}
+
+	deadSub, err := subscribeDeadURLs(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := requeueDeadURLs(nc, deadSub, 100*time.Millisecond)
+	if err != nil {
+		t.FailNow()
+	}
+	if count != 2 {
+		t.Errorf("Wanted: 2 Got: %d", count)
+	}
+
+	for _, want := range []string{`{"url":"http://a.onion"}`, `{"url":"http://b.onion"}`} {
+		msg, err := foundSub.NextMsg(time.Second)
+		if err != nil {
+			t.FailNow()
+		}
+		if string(msg.Data) != want {
+			t.Errorf("Wanted: %s Got: %s", want, msg.Data)
+		}
+	}
+
+	// The requeued URLs are removed from the dead-letter queue
+	info, err := js.StreamInfo(stream)
+	if err != nil {
+		t.FailNow()
+	}
+	if info.State.Msgs != 0 {
+		t.Errorf("Wanted: 0 dead URLs Got: %d", info.State.Msgs)
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	var b bytes.Buffer
+	err := PrintStats(&b, api.StatsDto{
+		ResourceCount:        1500,
+		HostCount:            42,
+		ResourceCountLast24h: 10,
+		ResourceCountLast7d:  70,
+		ResourceCountLast30d: 300,
+		AverageBodySize:      2048.4,
+		TopHosts: []api.HostStatsDto{
+			{Host: "a.onion", ResourceCount: 900},
+			{Host: "longer-host.onion", ResourceCount: 100},
+		},
+	})
+	if err != nil {
+		t.FailNow()
+	}
+
+	want := `Resources             1500
+Hosts                 42
+Resources (last 24h)  10
+Resources (last 7d)   70
+Resources (last 30d)  300
+Average body size     2048 bytes
+
+Top hosts          Resources
+a.onion            900
+longer-host.onion  100
+`
+	if b.String() != want {
+		t.Errorf("Wanted: %s Got: %s", want, b.String())
+	}
+}
@@ -0,0 +1,120 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned when the circuit breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State represent the state of a circuit breaker
+type State int
+
+const (
+	// Closed means calls are allowed
+	Closed State = iota
+	// Open means calls are rejected
+	Open
+	// HalfOpen means a single trial call is allowed
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker prevent calls to a failing dependency.
+// it opens after threshold consecutive failures, and allows a trial call once timeout has elapsed
+type CircuitBreaker struct {
+	threshold int
+	timeout   time.Duration
+	now       func() time.Time
+
+	state    State
+	failures int
+	openedAt time.Time
+	mutex    sync.Mutex
+}
+
+// New create a new circuit breaker opening after threshold consecutive failures
+// and trying again after given timeout
+func New(threshold int, timeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		timeout:   timeout,
+		now:       time.Now,
+	}
+}
+
+// Execute call given function if the circuit breaker allows it, ErrOpen is returned otherwise.
+// a nil circuit breaker always allows calls
+func (cb *CircuitBreaker) Execute(f func() error) error {
+	if cb == nil {
+		return f()
+	}
+
+	if !cb.allow() {
+		return ErrOpen
+	}
+
+	err := f()
+	cb.record(err == nil)
+
+	return err
+}
+
+// State returns the current state of the circuit breaker
+func (cb *CircuitBreaker) State() State {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.state
+}
+
+func (cb *CircuitBreaker) allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case Open:
+		// Allow a single trial call once timeout has elapsed
+		if cb.now().Sub(cb.openedAt) >= cb.timeout {
+			cb.state = HalfOpen
+			return true
+		}
+		return false
+	case HalfOpen:
+		// Trial call in progress
+		return false
+	default:
+		return true
+	}
+}
+
+func (cb *CircuitBreaker) record(success bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if success {
+		cb.state = Closed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == HalfOpen || cb.failures >= cb.threshold {
+		cb.state = Open
+		cb.openedAt = cb.now()
+	}
+}
@@ -0,0 +1,92 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errFailure = errors.New("failure")
+
+func failure() error { return errFailure }
+func success() error { return nil }
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	cb := New(2, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	if cb.State() != Closed {
+		t.Fail()
+	}
+
+	// Should open after 2 consecutive failures
+	if err := cb.Execute(failure); err != errFailure {
+		t.Fail()
+	}
+	if cb.State() != Closed {
+		t.Fail()
+	}
+	if err := cb.Execute(failure); err != errFailure {
+		t.Fail()
+	}
+	if cb.State() != Open {
+		t.FailNow()
+	}
+
+	// Calls should be rejected while open
+	called := false
+	if err := cb.Execute(func() error { called = true; return nil }); err != ErrOpen {
+		t.Fail()
+	}
+	if called {
+		t.Fail()
+	}
+
+	// Failed trial call should open again
+	now = now.Add(time.Minute)
+	if err := cb.Execute(failure); err != errFailure {
+		t.Fail()
+	}
+	if cb.State() != Open {
+		t.FailNow()
+	}
+	if err := cb.Execute(success); err != ErrOpen {
+		t.Fail()
+	}
+
+	// Successful trial call should close it
+	now = now.Add(time.Minute)
+	if err := cb.Execute(success); err != nil {
+		t.Fail()
+	}
+	if cb.State() != Closed {
+		t.Fail()
+	}
+}
+
+func TestCircuitBreakerResetFailures(t *testing.T) {
+	cb := New(2, time.Minute)
+
+	_ = cb.Execute(failure)
+	_ = cb.Execute(success)
+	_ = cb.Execute(failure)
+
+	// Failures are not consecutive
+	if cb.State() != Closed {
+		t.Fail()
+	}
+}
+
+func TestCircuitBreakerNil(t *testing.T) {
+	var cb *CircuitBreaker
+	if err := cb.Execute(failure); err != errFailure {
+		t.Fail()
+	}
+}
+
+func TestStateString(t *testing.T) {
+	if Closed.String() != "closed" || Open.String() != "open" || HalfOpen.String() != "half-open" {
+		t.Fail()
+	}
+}
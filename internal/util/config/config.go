@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envRegex match the environment variables referenced in the configuration files
+var envRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)}`)
+
+// GetConfigFlag return the CLI flag parameter used to load the configuration file
+func GetConfigFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "config",
+		Usage: "Path to a YAML file setting the flags not given on the command line (keys are the flag names)",
+	}
+}
+
+// Load read the YAML file at given path into target, after replacing the ${VAR} references by the value of the
+// environment variables (empty if missing)
+func Load(path string, target interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	b = envRegex.ReplaceAllFunc(b, func(ref []byte) []byte {
+		return []byte(os.Getenv(string(envRegex.FindSubmatch(ref)[1])))
+	})
+
+	if err := yaml.UnmarshalStrict(b, target); err != nil {
+		return fmt.Errorf("error while parsing %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Setup add the --config flag to given app: the flags not set on the command line (or using their environment
+// variables) are read from the configuration file. The required flags may be set by the configuration file
+func Setup(app *cli.App) *cli.App {
+	// The required flags are checked by the app before reading the configuration file: check them afterwards instead
+	var required []string
+	for _, flag := range app.Flags {
+		if f, ok := flag.(*cli.StringFlag); ok && f.Required {
+			f.Required = false
+			f.Usage += " (required)"
+			required = append(required, f.Name)
+		}
+	}
+
+	app.Flags = append(app.Flags, GetConfigFlag())
+
+	before := app.Before
+	app.Before = func(ctx *cli.Context) error {
+		if path := ctx.String("config"); path != "" {
+			if err := apply(ctx, path); err != nil {
+				return err
+			}
+		}
+
+		var missing []string
+		for _, name := range required {
+			if !ctx.IsSet(name) {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) == 1 {
+			return fmt.Errorf("Required flag %q not set", missing[0])
+		}
+		if len(missing) > 1 {
+			return fmt.Errorf("Required flags %q not set", strings.Join(missing, ", "))
+		}
+
+		if before != nil {
+			return before(ctx)
+		}
+		return nil
+	}
+
+	return app
+}
+
+// apply set the flags not already set using the values of the configuration file at given path
+func apply(ctx *cli.Context, path string) error {
+	values := map[string]interface{}{}
+	if err := Load(path, &values); err != nil {
+		return err
+	}
+
+	flags := map[string]bool{}
+	for _, flag := range ctx.App.Flags {
+		for _, name := range flag.Names() {
+			flags[name] = true
+		}
+	}
+
+	for name, value := range values {
+		if !flags[name] || name == "config" {
+			return fmt.Errorf("unknown flag %s in %s", name, path)
+		}
+		if value == nil || ctx.IsSet(name) {
+			continue
+		}
+
+		// Lists set each value of a slice flag
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if err := ctx.Set(name, fmt.Sprint(item)); err != nil {
+				return fmt.Errorf("invalid value for %s in %s: %s", name, path, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"github.com/urfave/cli/v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	if err := os.Setenv("TDSH_TEST_PASSWORD", "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("TDSH_TEST_PASSWORD")
+
+	path := writeConfig(t, `nats-uri: nats://${TDSH_TEST_USER}nats:4222
+nats-pass: ${TDSH_TEST_PASSWORD}
+nats-user: $TDSH_TEST_PASSWORD
+`)
+
+	var values map[string]string
+	if err := Load(path, &values); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"nats-uri":  "nats://nats:4222",
+		"nats-pass": "s3cr3t",
+		"nats-user": "$TDSH_TEST_PASSWORD",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Wanted: %v Got: %v", expected, values)
+	}
+
+	if err := Load(writeConfig(t, "nats-uri: [nats"), &values); err == nil {
+		t.Error("invalid YAML should be rejected")
+	}
+	if err := Load(filepath.Join(t.TempDir(), "missing.yml"), &values); err == nil {
+		t.Error("missing file should be rejected")
+	}
+}
+
+type testConfig struct {
+	natsURI  string
+	subjects []string
+	workers  int
+	timeout  time.Duration
+	dryRun   bool
+}
+
+// runApp run an app using given arguments, returning the configuration read from its flags
+func runApp(args ...string) (testConfig, error) {
+	var conf testConfig
+	app := Setup(&cli.App{
+		Name:   "tdsh-test",
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "nats-uri", Required: true},
+			&cli.StringSliceFlag{Name: "subjects", Value: cli.NewStringSlice("url.found")},
+			&cli.IntFlag{Name: "workers", Value: 1},
+			&cli.DurationFlag{Name: "timeout", Value: time.Second},
+			&cli.BoolFlag{Name: "dry-run"},
+		},
+		Action: func(ctx *cli.Context) error {
+			conf = testConfig{
+				natsURI:  ctx.String("nats-uri"),
+				subjects: ctx.StringSlice("subjects"),
+				workers:  ctx.Int("workers"),
+				timeout:  ctx.Duration("timeout"),
+				dryRun:   ctx.Bool("dry-run"),
+			}
+			return nil
+		},
+	})
+
+	err := app.Run(append([]string{"tdsh-test"}, args...))
+	return conf, err
+}
+
+func TestSetup(t *testing.T) {
+	path := writeConfig(t, `nats-uri: nats://nats:4222
+subjects:
+  - url.seed
+  - url.canonical
+workers: 8
+timeout: 1m
+dry-run: true
+`)
+
+	// Values are read from the configuration file
+	conf, err := runApp("--config", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testConfig{
+		natsURI:  "nats://nats:4222",
+		subjects: []string{"url.seed", "url.canonical"},
+		workers:  8,
+		timeout:  time.Minute,
+		dryRun:   true,
+	}
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("Wanted: %+v Got: %+v", expected, conf)
+	}
+
+	// Flags override the configuration file, including slices
+	conf, err = runApp("--config", path, "--nats-uri", "nats://other:4222", "--subjects", "url.found",
+		"--workers", "2", "--dry-run=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = testConfig{
+		natsURI:  "nats://other:4222",
+		subjects: []string{"url.found"},
+		workers:  2,
+		timeout:  time.Minute,
+		dryRun:   false,
+	}
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("Wanted: %+v Got: %+v", expected, conf)
+	}
+
+	// Defaults are kept without configuration file
+	conf, err = runApp("--nats-uri", "nats://nats:4222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = testConfig{
+		natsURI:  "nats://nats:4222",
+		subjects: []string{"url.found"},
+		workers:  1,
+		timeout:  time.Second,
+	}
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("Wanted: %+v Got: %+v", expected, conf)
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	// Required flags should be set by the configuration file or the command line
+	if _, err := runApp("--config", writeConfig(t, "workers: 2")); err == nil ||
+		err.Error() != `Required flag "nats-uri" not set` {
+		t.Errorf("Wanted: missing nats-uri Got: %v", err)
+	}
+
+	if _, err := runApp("--config", writeConfig(t, "nats-uri: nats://nats:4222\nunknown: true")); err == nil {
+		t.Error("unknown flag should be rejected")
+	}
+
+	if _, err := runApp("--config", writeConfig(t, "nats-uri: nats://nats:4222\nworkers: many")); err == nil {
+		t.Error("invalid value should be rejected")
+	}
+}
@@ -0,0 +1,31 @@
+package duration
+
+import (
+	"fmt"
+	"github.com/xhit/go-str2duration/v2"
+	"strings"
+	"time"
+)
+
+// units is the list of the supported duration units
+var units = []string{"ns", "us", "µs", "ms", "s", "m", "h", "d", "w"}
+
+// ParseStrict parse given duration (e.g: 30s, 2h45m, 7d, 1w) returning a descriptive error
+// if it is empty, negative or malformed (e.g: 2days)
+func ParseStrict(s string) (time.Duration, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	val, err := str2duration.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (%s): expected a number followed by a unit among %s (e.g: 2d, 1h30m)",
+			s, strings.TrimPrefix(err.Error(), "time: "), strings.Join(units, ", "))
+	}
+
+	if val < 0 {
+		return 0, fmt.Errorf("invalid duration %q: should not be negative", s)
+	}
+
+	return val, nil
+}
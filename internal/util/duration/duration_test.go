@@ -0,0 +1,61 @@
+package duration
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStrict(t *testing.T) {
+	valid := map[string]time.Duration{
+		"10ns":   10 * time.Nanosecond,
+		"10us":   10 * time.Microsecond,
+		"10µs":   10 * time.Microsecond,
+		"10ms":   10 * time.Millisecond,
+		"50s":    50 * time.Second,
+		"50m":    50 * time.Minute,
+		"50h":    50 * time.Hour,
+		"2d":     48 * time.Hour,
+		"1w":     7 * 24 * time.Hour,
+		"1d12h":  36 * time.Hour,
+		"1.5h":   90 * time.Minute,
+		"0s":     0,
+		"+2d":    48 * time.Hour,
+		"1w2d3h": (9*24 + 3) * time.Hour,
+	}
+
+	for s, want := range valid {
+		got, err := ParseStrict(s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", s, err)
+		}
+		if got != want {
+			t.Errorf("%s: Wanted: %s Got: %s", s, want, got)
+		}
+	}
+}
+
+func TestParseStrictInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"":      "empty duration",
+		"  ":    "empty duration",
+		"2days": `unknown unit "days"`,
+		"2":     "missing unit",
+		"d":     "invalid duration",
+		"2y":    `unknown unit "y"`,
+		"-1h":   "should not be negative",
+		"1h 2m": "invalid duration",
+		"abc":   "invalid duration",
+	}
+
+	for s, want := range invalid {
+		_, err := ParseStrict(s)
+		if err == nil {
+			t.Errorf("%q: error should have been returned", s)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: Wanted: %s Got: %s", s, want, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package heartbeat
+
+import (
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"os"
+	"time"
+)
+
+// DefaultInterval is the default delay between two heartbeats
+const DefaultInterval = 30 * time.Second
+
+// GetIntervalFlag return the CLI flag parameter used to setup the delay between two heartbeats
+func GetIntervalFlag() *cli.DurationFlag {
+	return &cli.DurationFlag{
+		Name:  "heartbeat-interval",
+		Usage: "Delay between two heartbeats published to service.heartbeat (0 = disabled)",
+		Value: DefaultInterval,
+	}
+}
+
+// Start publish the heartbeats of the application using given publisher every --heartbeat-interval (read from cli
+// context), starting now. The returned function stop the publication, and returns once stopped
+func Start(ctx *cli.Context, publisher natsutil.Publisher) func() {
+	hostname, _ := os.Hostname()
+	msg := messaging.HeartbeatMsg{
+		Service:  ctx.App.Name,
+		Version:  ctx.App.Version,
+		Hostname: hostname,
+		PID:      os.Getpid(),
+	}
+
+	return start(msg, ctx.Duration("heartbeat-interval"), publisher.PublishMsg)
+}
+
+func start(msg messaging.HeartbeatMsg, interval time.Duration, publish func(msg natsutil.Msg) error) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	log.Debug().Stringer("interval", interval).Msg("Publishing heartbeats")
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			msg.Timestamp = time.Now()
+			hb := msg
+			if err := publish(&hb); err != nil {
+				log.Warn().Str("err", err.Error()).Msg("Error while publishing heartbeat")
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
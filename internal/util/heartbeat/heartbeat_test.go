@@ -0,0 +1,63 @@
+package heartbeat
+
+import (
+	"fmt"
+	"github.com/creekorful/trandoshan/internal/messaging"
+	natsutil "github.com/creekorful/trandoshan/internal/util/nats"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStart(t *testing.T) {
+	var mutex sync.Mutex
+	var published []messaging.HeartbeatMsg
+	publish := func(msg natsutil.Msg) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		published = append(published, *msg.(*messaging.HeartbeatMsg))
+		return fmt.Errorf("errors are ignored")
+	}
+
+	stop := start(messaging.HeartbeatMsg{Service: "tdsh-crawler", PID: 42}, 20*time.Millisecond, publish)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	mutex.Lock()
+	count := len(published)
+	mutex.Unlock()
+
+	// Published right away, then every interval
+	if count < 2 || count > 4 {
+		t.Errorf("Wanted: about 3 heartbeats Got: %d", count)
+	}
+	for _, msg := range published {
+		if msg.Service != "tdsh-crawler" || msg.PID != 42 || msg.Timestamp.IsZero() {
+			t.Errorf("unexpected heartbeat: %+v", msg)
+		}
+	}
+	if len(published) > 1 && !published[1].Timestamp.After(published[0].Timestamp) {
+		t.Error("heartbeats should be timestamped when published")
+	}
+
+	// Nothing is published once stopped
+	time.Sleep(50 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(published) != count {
+		t.Errorf("Wanted: %d heartbeats Got: %d", count, len(published))
+	}
+}
+
+func TestStartDisabled(t *testing.T) {
+	published := 0
+	stop := start(messaging.HeartbeatMsg{}, 0, func(msg natsutil.Msg) error {
+		published++
+		return nil
+	})
+	stop()
+
+	if published != 0 {
+		t.Errorf("Wanted: 0 heartbeat Got: %d", published)
+	}
+}
@@ -0,0 +1,180 @@
+package html
+
+import (
+	"golang.org/x/net/html"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// linkAttributes are the attributes containing a link, by element
+var linkAttributes = map[string]string{
+	"a":      "href",
+	"link":   "href",
+	"script": "src",
+	"img":    "src",
+}
+
+// textlessElements are the elements whose content is not displayed as text
+var textlessElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+}
+
+// ExtractLinks returns the absolute http(s) links found in given HTML document.
+// Relative links are resolved against the document <base> if any, otherwise against given base URL.
+// Malformed links are ignored and each link is only returned once, without its fragment
+func ExtractLinks(body io.Reader, base *url.URL) ([]string, error) {
+	doc, err := html.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first <base href> applies to the whole document, even to the links preceding it
+	if href, exists := findBase(doc); exists {
+		if baseURL, err := base.Parse(href); err == nil {
+			base = baseURL
+		}
+	}
+
+	var links []string
+	seen := map[string]bool{}
+
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if href, exists := attr(n, linkAttributes[n.Data]); exists {
+				if link, ok := resolveLink(base, href); ok && !seen[link] {
+					seen[link] = true
+					links = append(links, link)
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+
+	return links, nil
+}
+
+// ExtractTitle returns the <title> of given HTML document with its whitespaces collapsed, empty if missing
+func ExtractTitle(body io.Reader) (string, error) {
+	doc, err := html.Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	title := findTitle(doc)
+	if title == nil {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	for c := title.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	}
+
+	return strings.Join(strings.Fields(sb.String()), " "), nil
+}
+
+// ExtractText returns the text of given HTML document with its whitespaces collapsed,
+// ignoring the content of the scripts, styles & templates
+func ExtractText(body io.Reader) (string, error) {
+	doc, err := html.Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	var words []string
+
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && textlessElements[n.Data] {
+			return
+		}
+		if n.Type == html.TextNode {
+			words = append(words, strings.Fields(n.Data)...)
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+
+	return strings.Join(words, " "), nil
+}
+
+// findTitle returns the first HTML title element, ignoring the ones of embedded SVG
+func findTitle(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode && n.Data == "title" && n.Namespace == "" {
+		return n
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if title := findTitle(c); title != nil {
+			return title
+		}
+	}
+
+	return nil
+}
+
+func findBase(n *html.Node) (string, bool) {
+	if n.Type == html.ElementNode && n.Data == "base" {
+		if href, exists := attr(n, "href"); exists {
+			return href, true
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if href, exists := findBase(c); exists {
+			return href, true
+		}
+	}
+
+	return "", false
+}
+
+func attr(n *html.Node, name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+func resolveLink(base *url.URL, href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return "", false
+	}
+
+	u, err := base.Parse(href)
+	if err != nil {
+		return "", false
+	}
+
+	// Ignore javascript:, mailto:, data:, etc...
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", false
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	return u.String(), true
+}
@@ -0,0 +1,139 @@
+package html
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	base, _ := url.Parse("http://example.onion/dir/page.html")
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "absolute",
+			body: `<a href="http://other.onion/">other</a><a href="https://secure.onion/a">secure</a>`,
+			want: []string{"http://other.onion/", "https://secure.onion/a"},
+		},
+		{
+			name: "relative",
+			body: `<a href="about.html">a</a><a href="/root.html">b</a><a href="../up.html">c</a>` +
+				`<a href="//proto.onion/x">d</a><a href="?q=1">e</a>`,
+			want: []string{"http://example.onion/dir/about.html", "http://example.onion/root.html",
+				"http://example.onion/up.html", "http://proto.onion/x", "http://example.onion/dir/page.html?q=1"},
+		},
+		{
+			name: "elements",
+			body: `<html><head><link rel="stylesheet" href="style.css"><script src="app.js"></script></head>` +
+				`<body><img src="logo.png"><form action="ignored.php"></form></body></html>`,
+			want: []string{"http://example.onion/dir/style.css", "http://example.onion/dir/app.js",
+				"http://example.onion/dir/logo.png"},
+		},
+		{
+			name: "malformed",
+			body: `<a href="http://[::1">bad host</a><a href="%zz">bad escape</a><a href="">empty</a><a>missing</a>` +
+				`<a href="javascript:alert(1)">js</a><a href="mailto:a@b.onion">mail</a>` +
+				`<img src="data:image/png;base64,AAAA"><a href="  ok.html  ">ok</a>`,
+			want: []string{"http://example.onion/dir/ok.html"},
+		},
+		{
+			name: "fragments and duplicates",
+			body: `<a href="#top">top</a><a href="a.html#one">one</a><a href="a.html#two">two</a>`,
+			want: []string{"http://example.onion/dir/page.html", "http://example.onion/dir/a.html"},
+		},
+		{
+			name: "base",
+			body: `<html><head><base href="http://cdn.onion/static/"></head>` +
+				`<body><a href="img.png">a</a><a href="/abs">b</a><a href="http://other.onion">c</a></body></html>`,
+			want: []string{"http://cdn.onion/static/img.png", "http://cdn.onion/abs", "http://other.onion"},
+		},
+		{
+			name: "relative base",
+			body: `<a href="before.html">before</a><base href="/sub/"><base href="http://ignored.onion/">` +
+				`<a href="after.html">after</a>`,
+			want: []string{"http://example.onion/sub/before.html", "http://example.onion/sub/after.html"},
+		},
+	}
+
+	for _, test := range tests {
+		links, err := ExtractLinks(strings.NewReader(test.body), base)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if len(links) != len(test.want) {
+			t.Errorf("%s: Wanted: %v Got: %v", test.name, test.want, links)
+			continue
+		}
+		for i := range test.want {
+			if links[i] != test.want[i] {
+				t.Errorf("%s: Wanted: %v Got: %v", test.name, test.want, links)
+				break
+			}
+		}
+	}
+}
+
+func TestExtractTitle(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`<html><head><title>Example</title></head></html>`, "Example"},
+		{`<TITLE>Upper case</TITLE>`, "Upper case"},
+		{`<title>  Spaces
+	and   lines </title>`, "Spaces and lines"},
+		{`<title>Escaped &amp; &lt;b&gt;</title>`, "Escaped & <b>"},
+		{`<html><head><title>Unclosed`, "Unclosed"},
+		{`<title>First</title><title>Second</title>`, "First"},
+		{`<body><svg><title>Icon</title></svg><title>Page</title></body>`, "Page"},
+		{`<html><head><title></title></head></html>`, ""},
+		{`<html><body>no title</body></html>`, ""},
+		{`<<<>>>`, ""},
+		{``, ""},
+	}
+
+	for _, test := range tests {
+		title, err := ExtractTitle(strings.NewReader(test.body))
+		if err != nil {
+			t.Errorf("%q: %s", test.body, err)
+			continue
+		}
+		if title != test.want {
+			t.Errorf("%q: Wanted: %q Got: %q", test.body, test.want, title)
+		}
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`<html><head><title>Example</title></head><body><p>Hello <b>world</b></p></body></html>`, "Example Hello world"},
+		{`<p>  Spaces
+	and   lines </p>`, "Spaces and lines"},
+		{`<p>Escaped &amp; &lt;b&gt;</p>`, "Escaped & <b>"},
+		{`<body>Visible<script>var hidden = 1;</script><style>p { color: red; }</style></body>`, "Visible"},
+		{`<body><noscript>Enable JS</noscript><template><p>Row</p></template>Text</body>`, "Text"},
+		{`<!-- comment --><p>Text</p>`, "Text"},
+		{`plain text`, "plain text"},
+		{``, ""},
+	}
+
+	for _, test := range tests {
+		text, err := ExtractText(strings.NewReader(test.body))
+		if err != nil {
+			t.Errorf("%q: %s", test.body, err)
+			continue
+		}
+		if text != test.want {
+			t.Errorf("%q: Wanted: %q Got: %q", test.body, test.want, text)
+		}
+	}
+}
@@ -4,9 +4,17 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
+	"io"
 	"os"
 )
 
+const (
+	// JSONFormat output one JSON object per log entry, suitable for log aggregators
+	JSONFormat = "json"
+	// TextFormat output human readable log entries
+	TextFormat = "text"
+)
+
 // GetLogFlag return the CLI flag parameter used to setup application log level
 func GetLogFlag() *cli.StringFlag {
 	return &cli.StringFlag{
@@ -16,9 +24,23 @@ func GetLogFlag() *cli.StringFlag {
 	}
 }
 
-// ConfigureLogger configure the logger using given log level (read from cli context)
+// GetLogFormatFlag return the CLI flag parameter used to setup application log format
+func GetLogFormatFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "log-format",
+		Usage: "Set the application log format (json or text, default: text if attached to a terminal, json otherwise)",
+	}
+}
+
+// ConfigureLogger configure the logger using given log level & format (read from cli context)
 func ConfigureLogger(ctx *cli.Context) {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	format := ctx.String("log-format")
+	if format == "" {
+		format = defaultFormat(os.Stderr)
+	}
+
+	hostname, _ := os.Hostname()
+	log.Logger = newLogger(os.Stderr, format, ctx.App.Name, ctx.App.Version, hostname)
 
 	// Set application log level
 	if lvl, err := zerolog.ParseLevel(ctx.String("log-level")); err == nil {
@@ -27,5 +49,31 @@ func ConfigureLogger(ctx *cli.Context) {
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 
-	log.Debug().Stringer("lvl", zerolog.GlobalLevel()).Msg("Setting log level")
+	if format != JSONFormat && format != TextFormat {
+		log.Warn().Str("format", format).Msg("Unknown log format, using text")
+	}
+
+	log.Debug().Stringer("lvl", zerolog.GlobalLevel()).Str("format", format).Msg("Setting log level")
+}
+
+// newLogger returns the logger writing to out using given format. In JSON format every entry
+// is tagged with the service, its version and the hostname so that they can be told apart once aggregated
+func newLogger(out io.Writer, format, service, version, hostname string) zerolog.Logger {
+	if format == JSONFormat {
+		return zerolog.New(out).With().Timestamp().
+			Str("service", service).
+			Str("version", version).
+			Str("hostname", hostname).
+			Logger()
+	}
+
+	return zerolog.New(zerolog.ConsoleWriter{Out: out}).With().Timestamp().Logger()
+}
+
+// defaultFormat returns the text format if f is a terminal and the JSON format otherwise
+func defaultFormat(f *os.File) string {
+	if stat, err := f.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		return TextFormat
+	}
+	return JSONFormat
 }
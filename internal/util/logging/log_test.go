@@ -1,6 +1,11 @@
 package logging
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -16,3 +21,71 @@ func TestGetLogFlag(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestGetLogFormatFlag(t *testing.T) {
+	flag := GetLogFormatFlag()
+	if flag.Name != "log-format" {
+		t.Fail()
+	}
+	if flag.Value != "" {
+		t.Fail()
+	}
+}
+
+func TestNewLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, JSONFormat, "tdsh-crawler", "0.5.0", "host-1")
+	logger.Info().Str("url", "https://example.onion").Msg("Hello")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry should be valid JSON: %s", err)
+	}
+
+	want := map[string]string{
+		"service":  "tdsh-crawler",
+		"version":  "0.5.0",
+		"hostname": "host-1",
+		"level":    "info",
+		"url":      "https://example.onion",
+		"message":  "Hello",
+	}
+	for field, value := range want {
+		if entry[field] != value {
+			t.Errorf("%s: Wanted: %s Got: %v", field, value, entry[field])
+		}
+	}
+	if _, exists := entry["time"]; !exists {
+		t.Error("time field should be present")
+	}
+}
+
+func TestNewLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, TextFormat, "tdsh-crawler", "0.5.0", "host-1")
+	logger.Info().Str("url", "https://example.onion").Msg("Hello")
+
+	output := buf.String()
+	if json.Valid(buf.Bytes()) {
+		t.Errorf("log entry should not be JSON: %s", output)
+	}
+	if !strings.Contains(output, "Hello") || !strings.Contains(output, "https://example.onion") {
+		t.Errorf("unexpected log entry: %s", output)
+	}
+	if strings.Contains(output, "host-1") {
+		t.Errorf("hostname should not be logged in text format: %s", output)
+	}
+}
+
+func TestDefaultFormat(t *testing.T) {
+	f, err := ioutil.TempFile("", "trandoshan-log")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if format := defaultFormat(f); format != JSONFormat {
+		t.Errorf("Wanted: %s Got: %s", JSONFormat, format)
+	}
+}
@@ -0,0 +1,211 @@
+package nats
+
+import (
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/urfave/cli/v2"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// connect is the function used to dial with the NATS server
+var connect = nats.Connect
+
+// Option configure the connection to the NATS server
+type Option func(opts *options) error
+
+// options are the settings applied when connecting to the NATS server
+type options struct {
+	natsOpts []nats.Option
+	// compress is true if the published payloads larger than compressThreshold are gzip compressed
+	compress          bool
+	compressThreshold int
+	// routes are the servers of the other regions, used once the given ones are unavailable
+	routes []string
+}
+
+// WithUserPassword authenticate using given username & password
+func WithUserPassword(user, password string) Option {
+	return func(opts *options) error {
+		opts.natsOpts = append(opts.natsOpts, nats.UserInfo(user, password))
+		return nil
+	}
+}
+
+// WithNKey authenticate using the NKey seed read from the file located at given path
+func WithNKey(seedFile string) Option {
+	return func(opts *options) error {
+		natsOpt, err := nats.NkeyOptionFromSeed(seedFile)
+		if err != nil {
+			return err
+		}
+		opts.natsOpts = append(opts.natsOpts, natsOpt)
+		return nil
+	}
+}
+
+// WithClusterRoutes fail over to the NATS servers of given semicolon separated list
+// (e.g: nats://eu1:4222;nats://us1:4222) once every server the connection is made to is unavailable
+func WithClusterRoutes(routes string) Option {
+	return func(opts *options) error {
+		uris, err := ParseURIs(strings.ReplaceAll(routes, ";", ","))
+		if err != nil {
+			return fmt.Errorf("invalid cluster routes: %s", err)
+		}
+		opts.routes = append(opts.routes, uris...)
+		return nil
+	}
+}
+
+// ParseURIs returns the URIs of given comma separated list of NATS servers (e.g: nats://host1:4222,nats://host2:4222).
+// URIs without scheme use nats://
+func ParseURIs(address string) ([]string, error) {
+	var uris []string
+	for _, uri := range strings.Split(address, ",") {
+		uri = strings.TrimSpace(uri)
+		if uri == "" {
+			return nil, fmt.Errorf("invalid NATS server URI list %q: empty URI", address)
+		}
+
+		raw := uri
+		if !strings.Contains(raw, "://") {
+			raw = "nats://" + raw
+		}
+
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NATS server URI %s: %s", uri, err)
+		}
+
+		switch u.Scheme {
+		case "nats", "tls", "ws", "wss":
+		default:
+			return nil, fmt.Errorf("invalid NATS server URI %s: unsupported scheme %s", uri, u.Scheme)
+		}
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid NATS server URI %s: missing host", uri)
+		}
+		if port := u.Port(); port != "" {
+			if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+				return nil, fmt.Errorf("invalid NATS server URI %s: invalid port %s", uri, port)
+			}
+		}
+
+		uris = append(uris, uri)
+	}
+
+	return uris, nil
+}
+
+// Connect dial with the NATS server located at given address, using given options.
+// the address may be a comma separated list of servers (e.g: cluster members): the connection fails over
+// to the other servers if the one in use is unavailable
+func Connect(address string, opts ...Option) (*nats.Conn, error) {
+	uris, err := ParseURIs(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var o options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	// The servers are tried in order so that the routes are only used once the given servers are unavailable:
+	// the load is spread over the given servers by shuffling them beforehand
+	if len(o.routes) > 0 {
+		rand.Shuffle(len(uris), func(i, j int) { uris[i], uris[j] = uris[j], uris[i] })
+		uris = append(uris, o.routes...)
+		o.natsOpts = append(o.natsOpts, nats.DontRandomize())
+	}
+
+	if !o.compress {
+		return connect(strings.Join(uris, ","), o.natsOpts...)
+	}
+
+	// Forget the compression settings of the connection once closed
+	natsOpts := append(o.natsOpts, nats.ClosedHandler(func(nc *nats.Conn) {
+		compressThresholds.Delete(nc)
+	}))
+
+	nc, err := connect(strings.Join(uris, ","), natsOpts...)
+	if err != nil || nc == nil {
+		return nc, err
+	}
+	compressThresholds.Store(nc, o.compressThreshold)
+
+	return nc, nil
+}
+
+// GetUserFlag return the CLI flag parameter used to set the NATS username
+func GetUserFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "nats-user",
+		Usage: "Username used to authenticate against the NATS server",
+	}
+}
+
+// GetPasswordFlag return the CLI flag parameter used to set the NATS password
+func GetPasswordFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "nats-password",
+		Usage: "Password used to authenticate against the NATS server",
+	}
+}
+
+// GetNKeySeedFlag return the CLI flag parameter used to set the NATS NKey seed file
+func GetNKeySeedFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "nats-nkey-seed",
+		Usage: "Path to the file containing the NKey seed used to authenticate against the NATS server",
+	}
+}
+
+// GetCompressionFlag return the CLI flag parameter used to enable the gzip compression of the published payloads
+func GetCompressionFlag() *cli.BoolFlag {
+	return &cli.BoolFlag{
+		Name:  "nats-compression",
+		Usage: "Gzip compress the published payloads larger than --compress-threshold (consumers must be able to decompress them)",
+	}
+}
+
+// GetCompressThresholdFlag return the CLI flag parameter used to set the size from which the payloads are compressed
+func GetCompressThresholdFlag() *cli.IntFlag {
+	return &cli.IntFlag{
+		Name:  "compress-threshold",
+		Usage: "Size (in bytes) from which the published payloads are compressed, when using --nats-compression",
+		Value: DefaultCompressThreshold,
+	}
+}
+
+// GetClusterRoutesFlag return the CLI flag parameter used to set the NATS servers of the other regions
+func GetClusterRoutesFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "nats-cluster-routes",
+		Usage: "NATS servers of the other regions (separated by ;) used once the --nats-uri ones are unavailable",
+	}
+}
+
+// GetOptions return the connection options matching the authentication, compression & cluster routes flags
+// (read from cli context)
+func GetOptions(ctx *cli.Context) []Option {
+	var opts []Option
+	if routes := ctx.String("nats-cluster-routes"); routes != "" {
+		opts = append(opts, WithClusterRoutes(routes))
+	}
+	if user := ctx.String("nats-user"); user != "" {
+		opts = append(opts, WithUserPassword(user, ctx.String("nats-password")))
+	}
+	if seedFile := ctx.String("nats-nkey-seed"); seedFile != "" {
+		opts = append(opts, WithNKey(seedFile))
+	}
+	if ctx.Bool("nats-compression") {
+		opts = append(opts, WithGzipCompression(ctx.Int("compress-threshold")))
+	}
+
+	return opts
+}
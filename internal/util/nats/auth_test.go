@@ -0,0 +1,209 @@
+package nats
+
+import (
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// mockConnect replace the connect function by one recording the options applied
+func mockConnect(t *testing.T) *nats.Options {
+	var opts nats.Options
+	connect = func(url string, options ...nats.Option) (*nats.Conn, error) {
+		opts = nats.GetDefaultOptions()
+		for _, opt := range options {
+			if err := opt(&opts); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	t.Cleanup(func() { connect = nats.Connect })
+
+	return &opts
+}
+
+func TestConnectWithUserPassword(t *testing.T) {
+	opts := mockConnect(t)
+
+	if _, err := Connect("nats://localhost:4222", WithUserPassword("scheduler", "secret")); err != nil {
+		t.FailNow()
+	}
+
+	if opts.User != "scheduler" || opts.Password != "secret" {
+		t.Errorf("wrong credentials: %s/%s", opts.User, opts.Password)
+	}
+	if opts.Nkey != "" {
+		t.Fail()
+	}
+}
+
+func TestConnectWithNKey(t *testing.T) {
+	opts := mockConnect(t)
+
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.FailNow()
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		t.FailNow()
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		t.FailNow()
+	}
+
+	seedFile := filepath.Join(t.TempDir(), "user.nk")
+	if err := ioutil.WriteFile(seedFile, seed, 0600); err != nil {
+		t.FailNow()
+	}
+
+	if _, err := Connect("nats://localhost:4222", WithNKey(seedFile)); err != nil {
+		t.FailNow()
+	}
+
+	if opts.Nkey != pub {
+		t.Errorf("Wanted: %s Got: %s", pub, opts.Nkey)
+	}
+	if opts.SignatureCB == nil {
+		t.Error("nonce should be signed using the seed")
+	}
+	if opts.User != "" {
+		t.Fail()
+	}
+}
+
+func TestConnectWithInvalidNKey(t *testing.T) {
+	mockConnect(t)
+
+	if _, err := Connect("nats://localhost:4222", WithNKey(filepath.Join(t.TempDir(), "missing.nk"))); err == nil {
+		t.Error("missing seed file should fail")
+	}
+}
+
+func TestConnectWithoutOptions(t *testing.T) {
+	opts := mockConnect(t)
+
+	if _, err := Connect("nats://localhost:4222"); err != nil {
+		t.FailNow()
+	}
+
+	if opts.User != "" || opts.Password != "" || opts.Nkey != "" {
+		t.Fail()
+	}
+}
+
+func TestParseURIs(t *testing.T) {
+	valid := map[string]int{
+		"nats://localhost:4222":                    1,
+		"nats://host1:4222,nats://host2:4222":      2,
+		" nats://host1:4222 , tls://host2:4222 ":   2,
+		"localhost:4222":                           1,
+		"ws://host1:8080,wss://host2,nats://host3": 3,
+	}
+	for address, count := range valid {
+		uris, err := ParseURIs(address)
+		if err != nil {
+			t.Errorf("%s: %s", address, err)
+			continue
+		}
+		if len(uris) != count {
+			t.Errorf("%s: Wanted: %d URIs Got: %v", address, count, uris)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"nats://host1:4222,",
+		"nats://host1:4222,,nats://host2:4222",
+		"http://localhost:4222",
+		"nats://:4222",
+		"nats://localhost:99999",
+		"nats://localhost:port",
+	}
+	for _, address := range invalid {
+		if _, err := ParseURIs(address); err == nil {
+			t.Errorf("%q should be invalid", address)
+		}
+	}
+}
+
+func TestConnectFailover(t *testing.T) {
+	// Reserve a port then release it so that nothing is listening on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+	unavailable := "nats://" + l.Addr().String()
+	_ = l.Close()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := Connect(unavailable + "," + s.ClientURL())
+	if err != nil {
+		t.Fatalf("should have connected to the second server: %s", err)
+	}
+	defer nc.Close()
+
+	if nc.ConnectedUrl() != s.ClientURL() {
+		t.Errorf("Wanted: %s Got: %s", s.ClientURL(), nc.ConnectedUrl())
+	}
+
+	// Invalid URIs should be rejected before connecting
+	if _, err := Connect(s.ClientURL() + ",http://localhost"); err == nil {
+		t.Error("invalid URI should be rejected")
+	}
+}
+
+func TestConnectWithClusterRoutes(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+	unavailable := "nats://" + l.Addr().String()
+	_ = l.Close()
+
+	localOpts := test.DefaultTestOptions
+	localOpts.Port = -1
+	local := test.RunServer(&localOpts)
+	defer local.Shutdown()
+
+	remoteOpts := test.DefaultTestOptions
+	remoteOpts.Port = -1
+	remote := test.RunServer(&remoteOpts)
+	defer remote.Shutdown()
+
+	// The routes are only used once the given servers are unavailable
+	for i := 0; i < 5; i++ {
+		nc, err := Connect(unavailable+","+local.ClientURL(), WithClusterRoutes(remote.ClientURL()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nc.ConnectedUrl() != local.ClientURL() {
+			t.Errorf("Wanted: %s Got: %s", local.ClientURL(), nc.ConnectedUrl())
+		}
+		nc.Close()
+	}
+
+	nc, err := Connect(unavailable, WithClusterRoutes(unavailable+";"+remote.ClientURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	if nc.ConnectedUrl() != remote.ClientURL() {
+		t.Errorf("Wanted: %s Got: %s", remote.ClientURL(), nc.ConnectedUrl())
+	}
+
+	if _, err := Connect(local.ClientURL(), WithClusterRoutes(remote.ClientURL()+";;")); err == nil {
+		t.Error("invalid routes should be rejected")
+	}
+}
@@ -0,0 +1,93 @@
+package nats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"io/ioutil"
+	"sync"
+)
+
+const (
+	// DefaultCompressThreshold is the default size (in bytes) from which the payloads are compressed
+	DefaultCompressThreshold = 1024
+
+	contentEncodingHeader = "Content-Encoding"
+	gzipEncoding          = "gzip"
+)
+
+// compressThresholds hold the compression threshold of the connections using gzip compression
+var compressThresholds sync.Map
+
+// WithGzipCompression gzip compress the published payloads larger than threshold bytes.
+// the compressed messages carry a Content-Encoding: gzip header and are transparently decompressed by ReadJSON
+func WithGzipCompression(threshold int) Option {
+	return func(opts *options) error {
+		if threshold < 0 {
+			return fmt.Errorf("invalid compression threshold %d: must be positive", threshold)
+		}
+
+		opts.compress = true
+		opts.compressThreshold = threshold
+		return nil
+	}
+}
+
+// compressMsg gzip compress the payload of given message if the connection uses compression
+// and the payload is larger than the compression threshold
+func compressMsg(nc *nats.Conn, msg *nats.Msg) error {
+	threshold, ok := compressThresholds.Load(nc)
+	if !ok || len(msg.Data) <= threshold.(int) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(msg.Data); err != nil {
+		return fmt.Errorf("error while compressing message: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error while compressing message: %s", err)
+	}
+
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	msg.Header.Set(contentEncodingHeader, gzipEncoding)
+	msg.Data = buf.Bytes()
+
+	return nil
+}
+
+// msgPayload returns the payload of given message, decompressed according to its Content-Encoding header
+func msgPayload(msg *nats.Msg) ([]byte, error) {
+	if msg.Header == nil {
+		return msg.Data, nil
+	}
+
+	switch encoding := msg.Header.Get(contentEncodingHeader); encoding {
+	case "":
+		return msg.Data, nil
+	case gzipEncoding:
+		r, err := gzip.NewReader(bytes.NewReader(msg.Data))
+		if err != nil {
+			return nil, fmt.Errorf("error while decompressing message: %s", err)
+		}
+		defer r.Close()
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("error while decompressing message: %s", err)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unsupported message content encoding: %s", encoding)
+	}
+}
+
+// Republish publish the payload of given received message to given subject, keeping its headers
+// so that compressed payloads can still be decompressed
+func Republish(nc *nats.Conn, subject string, msg *nats.Msg) error {
+	return nc.PublishMsg(&nats.Msg{Subject: subject, Header: msg.Header, Data: msg.Data})
+}
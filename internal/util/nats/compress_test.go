@@ -0,0 +1,171 @@
+package nats
+
+import (
+	"context"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGzipCompressionRoundTrip(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := Connect(s.ClientURL(), WithGzipCompression(DefaultCompressThreshold))
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("url.test")
+	if err != nil {
+		t.FailNow()
+	}
+
+	small := "http://example.onion"
+	large := "http://example.onion/" + strings.Repeat("a", 4*DefaultCompressThreshold)
+
+	tests := []struct {
+		url          string
+		publish      func(msg Msg) error
+		wantEncoding string
+	}{
+		{small, func(msg Msg) error { return PublishMsg(nc, msg) }, ""},
+		{large, func(msg Msg) error { return PublishMsg(nc, msg) }, gzipEncoding},
+		{small, func(msg Msg) error { return PublishMsgWithContext(context.Background(), nc, msg) }, ""},
+		{large, func(msg Msg) error { return PublishMsgWithContext(context.Background(), nc, msg) }, gzipEncoding},
+	}
+	for _, test := range tests {
+		if err := test.publish(&testMsg{URL: test.url}); err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if encoding := msg.Header.Get(contentEncodingHeader); encoding != test.wantEncoding {
+			t.Errorf("Wanted: %q Got: %q", test.wantEncoding, encoding)
+		}
+		if test.wantEncoding != "" && len(msg.Data) >= len(test.url) {
+			t.Errorf("payload should have been compressed (%d bytes)", len(msg.Data))
+		}
+
+		var got testMsg
+		if err := ReadJSON(msg, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.URL != test.url {
+			t.Errorf("Wanted: %d bytes URL Got: %d bytes URL", len(test.url), len(got.URL))
+		}
+	}
+}
+
+func TestGzipCompressionDisabled(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("url.test")
+	if err != nil {
+		t.FailNow()
+	}
+
+	url := "http://example.onion/" + strings.Repeat("a", 4*DefaultCompressThreshold)
+	if err := PublishMsg(nc, &testMsg{URL: url}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get(contentEncodingHeader) != "" {
+		t.Error("payload should not have been compressed")
+	}
+	if string(msg.Data) != `{"url":"`+url+`"}` {
+		t.Errorf("Got: %s", msg.Data)
+	}
+}
+
+func TestRepublishCompressedMsg(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := Connect(s.ClientURL(), WithGzipCompression(0))
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("url.test")
+	if err != nil {
+		t.FailNow()
+	}
+	republished, err := nc.SubscribeSync("url.republished")
+	if err != nil {
+		t.FailNow()
+	}
+
+	if err := PublishMsg(nc, &testMsg{URL: "http://example.onion"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Republish(nc, "url.republished", msg); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = republished.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got testMsg
+	if err := ReadJSON(msg, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "http://example.onion" {
+		t.Errorf("Wanted: http://example.onion Got: %s", got.URL)
+	}
+}
+
+func TestReadJSONInvalidEncoding(t *testing.T) {
+	msg := nats.NewMsg("url.test")
+	msg.Data = []byte(`{"url":"http://example.onion"}`)
+
+	msg.Header.Set(contentEncodingHeader, gzipEncoding)
+	var got testMsg
+	if err := ReadJSON(msg, &got); err == nil {
+		t.Error("invalid gzip payload should fail")
+	}
+
+	msg.Header.Set(contentEncodingHeader, "br")
+	if err := ReadJSON(msg, &got); err == nil {
+		t.Error("unsupported encoding should fail")
+	}
+}
+
+func TestWithGzipCompressionInvalidThreshold(t *testing.T) {
+	mockConnect(t)
+
+	if _, err := Connect("nats://localhost:4222", WithGzipCompression(-1)); err == nil {
+		t.Error("negative threshold should be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"time"
+)
+
+// PublishMsgConfirmed publish given Msg, propagating the trace context of ctx in the message headers,
+// and wait up to timeout for the NATS server to confirm it has been received.
+// Core NATS servers don't acknowledge messages: the connection is flushed instead, so that once it returns
+// the server has processed the message (it is still lost if nobody is subscribed)
+func PublishMsgConfirmed(ctx context.Context, nc *nats.Conn, msg Msg, timeout time.Duration) error {
+	natsMsg, err := newTracedMsg(ctx, nc, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := nc.PublishMsg(natsMsg); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := nc.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("error while waiting for publication confirmation: %s", err)
+	}
+
+	return nil
+}
+
+// PublishMsgConfirmed publish given message using the connection, propagating the trace context of ctx
+// in the message headers, and wait up to timeout for the NATS server to confirm it has been received.
+// When using JetStream, the message is published to its stream and the server acknowledges it once stored
+func (c *Connection) PublishMsgConfirmed(ctx context.Context, msg Msg, timeout time.Duration) error {
+	if c.js == nil {
+		return PublishMsgConfirmed(ctx, c.nc, msg, timeout)
+	}
+
+	natsMsg, err := newTracedMsg(ctx, c.nc, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if _, err := c.js.PublishMsg(natsMsg, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("error while publishing to JetStream: %s", err)
+	}
+
+	return nil
+}
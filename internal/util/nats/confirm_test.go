@@ -0,0 +1,76 @@
+package nats
+
+import (
+	"context"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func TestPublishMsgConfirmed(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+
+	sub, err := nc.SubscribeSync("url.test")
+	if err != nil {
+		t.FailNow()
+	}
+
+	if err := PublishMsgConfirmed(context.Background(), nc, &testMsg{URL: "http://example.onion"}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Message has been processed by the server once confirmed
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != `{"url":"http://example.onion"}` {
+		t.Errorf("Got: %s", msg.Data)
+	}
+
+	nc.Close()
+	if err := PublishMsgConfirmed(context.Background(), nc, &testMsg{URL: "http://example.onion"}, time.Second); err == nil {
+		t.Error("publication on closed connection should fail")
+	}
+}
+
+func TestConnectionPublishMsgConfirmedJetStream(t *testing.T) {
+	s, shutdown := runJetStreamServer(t)
+	defer shutdown()
+
+	sub, err := NewJetStreamConnection(s.ClientURL(), time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	// No stream is storing the subject: nothing acknowledges the message
+	if err := sub.PublishMsgConfirmed(context.Background(), &testMsg{URL: "http://example.onion"}, time.Second); err == nil {
+		t.Error("publication without stream should fail")
+	}
+
+	if _, err := sub.js.AddStream(&nats.StreamConfig{Name: streamName("url.test"), Subjects: []string{"url.test"}}); err != nil {
+		t.FailNow()
+	}
+
+	if err := sub.PublishMsgConfirmed(context.Background(), &testMsg{URL: "http://example.onion"}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := sub.js.StreamInfo(streamName("url.test"))
+	if err != nil {
+		t.FailNow()
+	}
+	if info.State.Msgs != 1 {
+		t.Errorf("Wanted: 1 stored message Got: %d", info.State.Msgs)
+	}
+}
@@ -0,0 +1,407 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MsgHandler represent an handler for a NATS subscriber.
+// the context is cancelled once the subscriber is closed: long operations should be interrupted
+type MsgHandler func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error
+
+// Publisher publish messages to NATS
+type Publisher interface {
+	// PublishMsg publish given message on its subject
+	PublishMsg(msg Msg) error
+}
+
+// Subscriber process the messages received from NATS
+type Subscriber interface {
+	// QueueSubscribe process the messages of given subject using given handler, with given queue.
+	// it blocks until the subscription terminates
+	QueueSubscribe(subject, queue string, handler MsgHandler) error
+}
+
+// connPublisher is a Publisher using an existing NATS connection
+type connPublisher struct {
+	nc *nats.Conn
+}
+
+// NewPublisher returns a Publisher using given connection (e.g: the one given to a MsgHandler)
+func NewPublisher(nc *nats.Conn) Publisher {
+	return &connPublisher{nc: nc}
+}
+
+func (p *connPublisher) PublishMsg(msg Msg) error {
+	return PublishMsg(p.nc, msg)
+}
+
+// Connection represent a connection to a NATS server, used both as Publisher and Subscriber
+type Connection struct {
+	nc *nats.Conn
+	// js is only set when using JetStream
+	js       nats.JetStreamContext
+	nakDelay time.Duration
+
+	subs      []*nats.Subscription
+	subsMutex sync.Mutex
+
+	// ctx is cancelled once the connection is stopped
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// handlerCtx is given to the handlers and cancelled once the subscriber is closed
+	handlerCtx    context.Context
+	handlerCancel context.CancelFunc
+	// handlers keep track of the messages being processed. they are only added while the connection is not closed
+	handlers      sync.WaitGroup
+	handlersMutex sync.Mutex
+	closed        bool
+}
+
+func newConnection(nc *nats.Conn, js nats.JetStreamContext, nakDelay time.Duration) *Connection {
+	ctx, cancel := context.WithCancel(context.Background())
+	handlerCtx, handlerCancel := context.WithCancel(context.Background())
+
+	return &Connection{
+		nc:            nc,
+		js:            js,
+		nakDelay:      nakDelay,
+		ctx:           ctx,
+		cancel:        cancel,
+		handlerCtx:    handlerCtx,
+		handlerCancel: handlerCancel,
+	}
+}
+
+// NewConnection create a new connection to given NATS server
+func NewConnection(address string, opts ...Option) (*Connection, error) {
+	nc, err := Connect(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConnection(nc, nil, 0), nil
+}
+
+// NewJetStreamConnection create a new connection using JetStream durable consumers for message delivery.
+// messages are acknowledged once successfully processed, and redelivered after nakDelay otherwise
+func NewJetStreamConnection(address string, nakDelay time.Duration, opts ...Option) (*Connection, error) {
+	nc, err := Connect(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return newConnection(nc, js, nakDelay), nil
+}
+
+// QueueSubscribe subscribe to given subject, with given queue
+// it blocks until the connection is stopped (nil is returned) or the subscription terminates
+func (c *Connection) QueueSubscribe(subject, queue string, handler MsgHandler) error {
+	// Create the subscription
+	sub, err := c.subscribe(subject, queue)
+	if err != nil {
+		return err
+	}
+
+	c.subsMutex.Lock()
+	c.subs = append(c.subs, sub)
+	c.subsMutex.Unlock()
+
+	for {
+		// Read incoming message
+		msg, err := sub.NextMsgWithContext(c.ctx)
+		if c.ctx.Err() != nil {
+			return nil
+		}
+		if err == nats.ErrConnectionClosed || err == nats.ErrBadSubscription {
+			return err
+		}
+		if err != nil {
+			log.Warn().Str("err", err.Error()).Msg("Skipping current message because of error")
+			continue
+		}
+
+		// ... And process it
+		c.handle(handler, msg)
+	}
+}
+
+// handle process given message using given handler, acknowledging it on success or delivering it again when the
+// handler returns a RequeueError, unless the handler took over its acknowledgement using DeferAck
+func (c *Connection) handle(handler MsgHandler, msg *nats.Msg) {
+	// The message may have been received while closing: it is not processed (but redelivered with JetStream)
+	c.handlersMutex.Lock()
+	if c.closed {
+		c.handlersMutex.Unlock()
+		c.nak(msg)
+		return
+	}
+	c.handlers.Add(1)
+	c.handlersMutex.Unlock()
+
+	d := &deferredAck{settle: func(err error) {
+		defer c.handlers.Done()
+
+		var requeueErr *RequeueError
+		if errors.As(err, &requeueErr) {
+			c.requeue(msg, requeueErr.Delay)
+			return
+		}
+
+		if err != nil {
+			log.Warn().Str("error", err.Error()).Msg("Skipping current message because of error")
+			c.nak(msg)
+			return
+		}
+
+		c.ack(msg)
+	}}
+
+	if err := handler(context.WithValue(c.handlerCtx, deferredAckKey{}, d), c.nc, msg); !d.isDeferred() {
+		d.settle(err)
+	}
+}
+
+// deferredAckKey is the context key of the acknowledgement of the message being handled
+type deferredAckKey struct{}
+
+// deferredAck is the acknowledgement of a message, settled once every deferrer has released it
+type deferredAck struct {
+	settle func(err error)
+
+	mutex    sync.Mutex
+	deferred bool
+	pending  int
+	err      error
+}
+
+func (d *deferredAck) isDeferred() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.deferred
+}
+
+func (d *deferredAck) take() func(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.deferred = true
+	d.pending++
+	return d.release
+}
+
+func (d *deferredAck) release(err error) {
+	d.mutex.Lock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.pending--
+	pending, err := d.pending, d.err
+	d.mutex.Unlock()
+
+	if pending == 0 {
+		d.settle(err)
+	}
+}
+
+// DeferAck take over the acknowledgement of the message handled using given context, to process it asynchronously:
+// the message is not acknowledged once the handler returns, the returned function should be called exactly once when
+// the message is processed instead, with the processing error (nil to acknowledge it). When deferred multiple times
+// (e.g: by nested handlers), the message is settled once every returned function has been called. The subscriber
+// waits for it before being closed. The returned function does nothing if the context is not one of a subscriber
+func DeferAck(ctx context.Context) func(err error) {
+	d, ok := ctx.Value(deferredAckKey{}).(*deferredAck)
+	if !ok {
+		return func(err error) {}
+	}
+
+	return d.take()
+}
+
+// PublishMsg publish given message using the connection
+func (c *Connection) PublishMsg(msg Msg) error {
+	return PublishMsg(c.nc, msg)
+}
+
+// KeyValue returns the JetStream key-value bucket with given name, creating it if missing.
+// entries of a created bucket expire after ttl (0 = never)
+func (c *Connection) KeyValue(bucket string, ttl time.Duration) (nats.KeyValue, error) {
+	js := c.js
+	if js == nil {
+		var err error
+		if js, err = c.nc.JetStream(); err != nil {
+			return nil, err
+		}
+	}
+
+	kv, err := js.KeyValue(bucket)
+	if err == nats.ErrBucketNotFound {
+		return js.CreateKeyValue(&nats.KeyValueConfig{Bucket: bucket, TTL: ttl})
+	}
+
+	return kv, err
+}
+
+// IsConnected returns true if the connection to the NATS server is alive
+func (c *Connection) IsConnected() bool {
+	return c.nc.IsConnected()
+}
+
+// IsSubscribed returns true if the connection has active subscriptions
+func (c *Connection) IsSubscribed() bool {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	if len(c.subs) == 0 {
+		return false
+	}
+
+	for _, sub := range c.subs {
+		if !sub.IsValid() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Stop stop receiving new messages. the messages being processed are not interrupted
+func (c *Connection) Stop() {
+	c.cancel()
+
+	// JetStream subscriptions are kept since unsubscribing would delete the durable consumers.
+	// messages already delivered to them will be redelivered once the ack wait is over
+	if c.js != nil {
+		return
+	}
+
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	for _, sub := range c.subs {
+		if err := sub.Unsubscribe(); err != nil {
+			log.Warn().Str("err", err.Error()).Str("subject", sub.Subject).Msg("Error while unsubscribing")
+		}
+	}
+}
+
+// Close stop receiving new messages, cancel the context of the messages being processed
+// and wait for their handlers to return before terminating the connection to the NATS server
+func (c *Connection) Close() {
+	c.cancel()
+	c.handlerCancel()
+
+	c.handlersMutex.Lock()
+	c.closed = true
+	c.handlersMutex.Unlock()
+	c.handlers.Wait()
+
+	c.nc.Close()
+}
+
+func (c *Connection) subscribe(subject, queue string) (*nats.Subscription, error) {
+	if c.js == nil {
+		return c.nc.QueueSubscribeSync(subject, queue)
+	}
+
+	// Make sure the stream exist
+	stream, err := EnsureStream(c.js, subject, nats.LimitsPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.js.QueueSubscribeSync(subject, queue, nats.BindStream(stream), nats.Durable(queue),
+		nats.AckExplicit(), nats.ManualAck())
+}
+
+func (c *Connection) ack(msg *nats.Msg) {
+	if c.js == nil {
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		log.Warn().Str("err", err.Error()).Msg("Error while acknowledging message")
+	}
+}
+
+func (c *Connection) nak(msg *nats.Msg) {
+	if c.js == nil {
+		return
+	}
+
+	if err := msg.NakWithDelay(c.nakDelay); err != nil {
+		log.Warn().Str("err", err.Error()).Msg("Error while negatively acknowledging message")
+	}
+}
+
+// QueueDepth returns the number of messages of given subject not yet processed by the JetStream durable consumer
+// of given queue (pending or being processed). 0 is returned while the stream or the consumer doesn't exist
+func (c *Connection) QueueDepth(subject, queue string) (int64, error) {
+	js := c.js
+	if js == nil {
+		var err error
+		if js, err = c.nc.JetStream(); err != nil {
+			return 0, err
+		}
+	}
+
+	info, err := js.ConsumerInfo(streamName(subject), queue)
+	if err == nats.ErrStreamNotFound || err == nats.ErrConsumerNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(info.NumPending) + int64(info.NumAckPending), nil
+}
+
+// KeepUntilAcked make the JetStream server store the messages published to given subject until a durable consumer
+// acknowledges them (work queue), even while no subscriber is connected.
+// nats.ErrJetStreamNotEnabled is returned if the server doesn't support JetStream
+func (c *Connection) KeepUntilAcked(subject string) error {
+	js := c.js
+	if js == nil {
+		var err error
+		if js, err = c.nc.JetStream(); err != nil {
+			return err
+		}
+	}
+
+	_, err := EnsureStream(js, subject, nats.WorkQueuePolicy)
+	return err
+}
+
+// EnsureStream create the JetStream stream storing the messages of given subject with given retention policy if it
+// doesn't exist yet, and returns its name
+func EnsureStream(js nats.JetStreamContext, subject string, retention nats.RetentionPolicy) (string, error) {
+	stream := streamName(subject)
+	if _, err := js.StreamInfo(stream); err == nats.ErrStreamNotFound {
+		if _, err := js.AddStream(&nats.StreamConfig{Name: stream, Subjects: []string{subject},
+			Retention: retention}); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	return stream, nil
+}
+
+// streamName returns the name of the JetStream stream used for given subject (url.found -> URL_FOUND)
+func streamName(subject string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "*", "ANY", ">", "ALL").Replace(subject))
+}
@@ -0,0 +1,537 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func runJetStreamServer(t *testing.T) (*server.Server, func()) {
+	dir, err := ioutil.TempDir("", "trandoshan")
+	if err != nil {
+		t.FailNow()
+	}
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = dir
+	s := test.RunServer(&opts)
+
+	return s, func() {
+		s.Shutdown()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// waitForStream wait until the stream used for given subject exist
+func waitForStream(t *testing.T, nc *nats.Conn, subject string) {
+	js, err := nc.JetStream()
+	if err != nil {
+		t.FailNow()
+	}
+
+	for i := 0; i < 50; i++ {
+		if _, err := js.StreamInfo(streamName(subject)); err == nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.FailNow()
+}
+
+func TestStreamName(t *testing.T) {
+	if streamName("url.found") != "URL_FOUND" {
+		t.Fail()
+	}
+	if streamName("url.*") != "URL_ANY" {
+		t.Fail()
+	}
+}
+
+func TestJetStreamConnectionNak(t *testing.T) {
+	s, shutdown := runJetStreamServer(t)
+	defer shutdown()
+
+	sub, err := NewJetStreamConnection(s.ClientURL(), 10*time.Millisecond)
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	calls := make(chan string, 10)
+	count := 0
+	go func() {
+		_ = sub.QueueSubscribe("url.found", "schedulers", func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+			count++
+			calls <- string(msg.Data)
+			if count == 1 {
+				return errors.New("api is down")
+			}
+			return nil
+		})
+	}()
+
+	waitForStream(t, nc, "url.found")
+
+	if err := nc.Publish("url.found", []byte("hello")); err != nil {
+		t.FailNow()
+	}
+
+	// Message should be redelivered once after the failure
+	for i := 0; i < 2; i++ {
+		select {
+		case val := <-calls:
+			if val != "hello" {
+				t.Fail()
+			}
+		case <-time.After(2 * time.Second):
+			t.FailNow()
+		}
+	}
+
+	// ... and not anymore once acknowledged
+	select {
+	case <-calls:
+		t.Error("message should have been acknowledged")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestJetStreamConnectionDeferAck(t *testing.T) {
+	s, shutdown := runJetStreamServer(t)
+	defer shutdown()
+
+	sub, err := NewJetStreamConnection(s.ClientURL(), 10*time.Millisecond)
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	// The message is processed in background, failing the first time
+	calls := make(chan string, 10)
+	count := 0
+	go func() {
+		_ = sub.QueueSubscribe("url.found", "schedulers", func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+			count++
+			ack := DeferAck(ctx)
+			fail := count == 1
+
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				calls <- string(msg.Data)
+				if fail {
+					ack(errors.New("api is down"))
+				} else {
+					ack(nil)
+				}
+			}()
+
+			return nil
+		})
+	}()
+
+	waitForStream(t, nc, "url.found")
+
+	if err := nc.Publish("url.found", []byte("hello")); err != nil {
+		t.FailNow()
+	}
+
+	// Message should be redelivered once after the failure
+	for i := 0; i < 2; i++ {
+		select {
+		case val := <-calls:
+			if val != "hello" {
+				t.Fail()
+			}
+		case <-time.After(2 * time.Second):
+			t.FailNow()
+		}
+	}
+
+	// ... and not anymore once acknowledged
+	select {
+	case <-calls:
+		t.Error("message should have been acknowledged")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDeferAckNested(t *testing.T) {
+	var settled []error
+	d := &deferredAck{settle: func(err error) {
+		settled = append(settled, err)
+	}}
+	ctx := context.WithValue(context.Background(), deferredAckKey{}, d)
+
+	outer := DeferAck(ctx)
+	inner := DeferAck(ctx)
+
+	// The outer handler returns once the message is handed to the inner one
+	outer(nil)
+	if len(settled) != 0 {
+		t.Errorf("Wanted: no settlement Got: %v", settled)
+	}
+
+	inner(errors.New("api is down"))
+	if len(settled) != 1 || settled[0] == nil || !d.isDeferred() {
+		t.Errorf("Wanted: one failed settlement Got: %v", settled)
+	}
+
+	// Outside of a subscriber handler
+	DeferAck(context.Background())(nil)
+}
+
+func TestJetStreamConnectionDurable(t *testing.T) {
+	s, shutdown := runJetStreamServer(t)
+	defer shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.FailNow()
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: streamName("url.found"), Subjects: []string{"url.found"}}); err != nil {
+		t.FailNow()
+	}
+
+	// Message published while no scheduler is running should not be lost
+	if err := nc.Publish("url.found", []byte("hello")); err != nil {
+		t.FailNow()
+	}
+
+	sub, err := NewJetStreamConnection(s.ClientURL(), time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		_ = sub.QueueSubscribe("url.found", "schedulers", func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+			received <- string(msg.Data)
+			return nil
+		})
+	}()
+
+	select {
+	case val := <-received:
+		if val != "hello" {
+			t.Fail()
+		}
+	case <-time.After(2 * time.Second):
+		t.Fail()
+	}
+}
+
+func TestConnectionQueueDepth(t *testing.T) {
+	s, shutdown := runJetStreamServer(t)
+	defer shutdown()
+
+	conn, err := NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	// Neither stream nor consumer yet
+	if depth, err := conn.QueueDepth("url.todo", "crawlers"); err != nil || depth != 0 {
+		t.Errorf("Wanted: 0 Got: %d (%v)", depth, err)
+	}
+
+	js, err := conn.nc.JetStream()
+	if err != nil {
+		t.FailNow()
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: streamName("url.todo"), Subjects: []string{"url.todo"}}); err != nil {
+		t.FailNow()
+	}
+	if depth, err := conn.QueueDepth("url.todo", "crawlers"); err != nil || depth != 0 {
+		t.Errorf("Wanted: 0 Got: %d (%v)", depth, err)
+	}
+
+	if _, err := js.AddConsumer(streamName("url.todo"), &nats.ConsumerConfig{
+		Durable:   "crawlers",
+		AckPolicy: nats.AckExplicitPolicy,
+	}); err != nil {
+		t.FailNow()
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := js.Publish("url.todo", []byte("hello")); err != nil {
+			t.FailNow()
+		}
+	}
+
+	if depth, err := conn.QueueDepth("url.todo", "crawlers"); err != nil || depth != 3 {
+		t.Errorf("Wanted: 3 Got: %d (%v)", depth, err)
+	}
+}
+
+func TestConnectionKeepUntilAcked(t *testing.T) {
+	s, shutdown := runJetStreamServer(t)
+	defer shutdown()
+
+	conn, err := NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	// Created once, then kept as is
+	for i := 0; i < 2; i++ {
+		if err := conn.KeepUntilAcked("url.dead"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	js, err := conn.nc.JetStream()
+	if err != nil {
+		t.FailNow()
+	}
+	if _, err := js.Publish("url.dead", []byte("hello")); err != nil {
+		t.FailNow()
+	}
+
+	info, err := js.StreamInfo(streamName("url.dead"))
+	if err != nil {
+		t.FailNow()
+	}
+	if info.Config.Retention != nats.WorkQueuePolicy || info.State.Msgs != 1 {
+		t.Errorf("Wanted: work queue with 1 message Got: %s with %d", info.Config.Retention, info.State.Msgs)
+	}
+
+	// Not supported by the server
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	coreServer := test.RunServer(&opts)
+	defer coreServer.Shutdown()
+
+	coreConn, err := NewConnection(coreServer.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer coreConn.Close()
+
+	if err := coreConn.KeepUntilAcked("url.dead"); err == nil {
+		t.Error("error should be returned without JetStream")
+	}
+}
+
+func TestConnectionQueueGroups(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	received := make(chan string, 10)
+	for _, queue := range []string{"schedulers", "schedulers", "priority"} {
+		sub, err := NewConnection(s.ClientURL())
+		if err != nil {
+			t.FailNow()
+		}
+		defer sub.Close()
+
+		go func(queue string) {
+			_ = sub.QueueSubscribe("url.found", queue, func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+				received <- queue
+				return nil
+			})
+		}(queue)
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	// Wait for the subscriptions to be registered
+	for i := 0; i < 50 && s.NumSubscriptions() < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := nc.Publish("url.found", []byte("hello")); err != nil {
+		t.FailNow()
+	}
+
+	// Each group should receive the message once
+	counts := map[string]int{}
+	for i := 0; i < 2; i++ {
+		select {
+		case queue := <-received:
+			counts[queue]++
+		case <-time.After(2 * time.Second):
+			t.FailNow()
+		}
+	}
+	select {
+	case queue := <-received:
+		counts[queue]++
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if counts["schedulers"] != 1 || counts["priority"] != 1 {
+		t.Errorf("unexpected deliveries: %v", counts)
+	}
+}
+
+func TestConnectionCloseCancelsHandlers(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	sub, err := NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+
+	started := make(chan struct{})
+	var finished bool
+	go func() {
+		_ = sub.QueueSubscribe("url.found", "schedulers", func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+			close(started)
+
+			// Simulate a long operation interrupted by the cancellation
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+				t.Error("context should have been cancelled")
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			finished = true
+			return ctx.Err()
+		})
+	}()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	for i := 0; i < 50 && s.NumSubscriptions() < 1; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := nc.Publish("url.found", []byte("hello")); err != nil {
+		t.FailNow()
+	}
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.FailNow()
+	}
+
+	// Close should wait for the in-flight handler to return
+	sub.Close()
+	if !finished {
+		t.Error("Close should wait for in-flight handlers")
+	}
+}
+
+func TestConnectionHandleWhileClosing(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	sub, err := NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+
+	// Messages received concurrently with Close are either processed before it returns or not at all
+	var calls int32
+	var closed int32
+	handler := func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+		if atomic.LoadInt32(&closed) == 1 {
+			t.Error("handler should not run once closed")
+		}
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				sub.handle(handler, &nats.Msg{Subject: "url.found"})
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	sub.Close()
+	atomic.StoreInt32(&closed, 1)
+	wg.Wait()
+
+	// Once closed, messages are not processed anymore
+	count := atomic.LoadInt32(&calls)
+	sub.handle(handler, &nats.Msg{Subject: "url.found"})
+	if atomic.LoadInt32(&calls) != count {
+		t.Error("message should not be processed once closed")
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("url.test")
+	if err != nil {
+		t.FailNow()
+	}
+
+	var publisher Publisher = NewPublisher(nc)
+	if err := publisher.PublishMsg(&testMsg{URL: "http://example.onion"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got testMsg
+	if err := ReadMsg(msg, &got); err != nil || got.URL != "http://example.onion" {
+		t.Errorf("Wanted: http://example.onion Got: %s (%v)", got.URL, err)
+	}
+}
@@ -23,12 +23,23 @@ func PublishJSON(nc *nats.Conn, subject string, msg interface{}) error {
 		return fmt.Errorf("error while encoding message: %s", err)
 	}
 
-	return nc.Publish(subject, msgBytes)
+	natsMsg := &nats.Msg{Subject: subject, Data: msgBytes}
+	if err := compressMsg(nc, natsMsg); err != nil {
+		return err
+	}
+
+	return nc.PublishMsg(natsMsg)
 }
 
-// ReadJSON read given encoded json message and deserialize into into given structure
+// ReadJSON read given encoded json message and deserialize into into given structure.
+// gzip compressed payloads are decompressed first
 func ReadJSON(msg *nats.Msg, body interface{}) error {
-	if err := json.Unmarshal(msg.Data, body); err != nil {
+	payload, err := msgPayload(msg)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(payload, body); err != nil {
 		return fmt.Errorf("error while decoding message: %s", err)
 	}
 
@@ -0,0 +1,46 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// RequeueError is returned by an handler to have the message delivered again after Delay rather than processed now
+type RequeueError struct {
+	Delay time.Duration
+}
+
+// Requeue returns the error having the handled message delivered again after given delay
+func Requeue(delay time.Duration) error {
+	return &RequeueError{Delay: delay}
+}
+
+func (e *RequeueError) Error() string {
+	return fmt.Sprintf("message requeued for %s", e.Delay)
+}
+
+// IsRequeue returns true if given error requests the handled message to be delivered again
+func IsRequeue(err error) bool {
+	var requeueErr *RequeueError
+	return errors.As(err, &requeueErr)
+}
+
+// requeue deliver again given message after given delay: using a negative acknowledgement with JetStream,
+// otherwise by publishing it back to its subject, in which case it is lost if the connection is closed meanwhile
+func (c *Connection) requeue(msg *nats.Msg, delay time.Duration) {
+	if c.js != nil {
+		if err := msg.NakWithDelay(delay); err != nil {
+			log.Warn().Str("err", err.Error()).Msg("Error while negatively acknowledging message")
+		}
+		return
+	}
+
+	time.AfterFunc(delay, func() {
+		if err := Republish(c.nc, msg.Subject, msg); err != nil {
+			log.Warn().Str("err", err.Error()).Str("subject", msg.Subject).Msg("Error while requeuing message")
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+func TestIsRequeue(t *testing.T) {
+	if !IsRequeue(Requeue(time.Second)) || !IsRequeue(fmt.Errorf("wrapped: %w", Requeue(time.Second))) {
+		t.Error("requeue error should be detected")
+	}
+	if IsRequeue(nil) || IsRequeue(fmt.Errorf("api is down")) {
+		t.Error("other errors should not be requeue errors")
+	}
+}
+
+// testRequeue check that a message requeued by the handler of given subscriber is delivered again after the delay.
+// ready should wait for the subscription to be active
+func testRequeue(t *testing.T, sub *Connection, nc *nats.Conn, ready func()) {
+	received := make(chan time.Time, 10)
+	count := 0
+	go func() {
+		_ = sub.QueueSubscribe("url.found", "schedulers", func(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+			count++
+			received <- time.Now()
+			if count == 1 {
+				return Requeue(100 * time.Millisecond)
+			}
+			return nil
+		})
+	}()
+
+	ready()
+
+	if err := nc.Publish("url.found", []byte("hello")); err != nil {
+		t.FailNow()
+	}
+
+	// Message should be delivered again once the delay is over
+	var times []time.Time
+	for i := 0; i < 2; i++ {
+		select {
+		case at := <-received:
+			times = append(times, at)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Wanted: 2 deliveries Got: %d", i)
+		}
+	}
+	if delay := times[1].Sub(times[0]); delay < 90*time.Millisecond {
+		t.Errorf("Wanted: delivered again after 100ms Got: %s", delay)
+	}
+
+	select {
+	case <-received:
+		t.Error("message should have been acknowledged")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestConnectionRequeue(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	sub, err := NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	testRequeue(t, sub, nc, func() {
+		for i := 0; i < 50 && !sub.IsSubscribed(); i++ {
+			time.Sleep(20 * time.Millisecond)
+		}
+		// Make sure the subscription has been processed by the server
+		if err := sub.nc.Flush(); err != nil {
+			t.FailNow()
+		}
+	})
+}
+
+func TestJetStreamConnectionRequeue(t *testing.T) {
+	s, shutdown := runJetStreamServer(t)
+	defer shutdown()
+
+	// The nak delay of the failures should not be used
+	sub, err := NewJetStreamConnection(s.ClientURL(), time.Hour)
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	testRequeue(t, sub, nc, func() {
+		waitForStream(t, nc, "url.found")
+	})
+}
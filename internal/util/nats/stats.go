@@ -0,0 +1,91 @@
+package nats
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+// Stats returns the statistics of the connection
+func (c *Connection) Stats() nats.Statistics {
+	return c.nc.Stats()
+}
+
+// Dropped returns the number of messages dropped by the subscriptions because their consumer was too slow
+func (c *Connection) Dropped() int64 {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	var dropped int64
+	for _, sub := range c.subs {
+		// Fail once the subscription is closed
+		if n, err := sub.Dropped(); err == nil {
+			dropped += int64(n)
+		}
+	}
+
+	return dropped
+}
+
+// StatsHandler returns an handler serving the statistics of the connection as JSON
+func StatsHandler(sub *Connection) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(sub.Stats()); err != nil {
+			log.Err(err).Msg("Error while writing NATS statistics")
+		}
+	})
+}
+
+// RegisterStatsMetrics register the prometheus gauges exposing the statistics of the connection
+func RegisterStatsMetrics(reg prometheus.Registerer, sub *Connection) error {
+	gauges := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "nats_reconnects_total",
+			Help: "The total number of reconnections to the NATS server",
+		}, func() float64 { return float64(sub.Stats().Reconnects) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "nats_in_msgs_total",
+			Help: "The total number of messages received from the NATS server",
+		}, func() float64 { return float64(sub.Stats().InMsgs) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "nats_out_msgs_total",
+			Help: "The total number of messages published to the NATS server",
+		}, func() float64 { return float64(sub.Stats().OutMsgs) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "nats_dropped_msgs_total",
+			Help: "The total number of messages dropped because of slow consumption",
+		}, func() float64 { return float64(sub.Dropped()) }),
+	}
+
+	for _, gauge := range gauges {
+		if err := reg.Register(gauge); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartMetricsServer expose the prometheus metrics (/metrics) and the statistics of the connection
+// connection (/metrics/nats) on given address
+func StartMetricsServer(addr string, sub *Connection) error {
+	if err := RegisterStatsMetrics(prometheus.DefaultRegisterer, sub); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics/nats", StatsHandler(sub))
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Err(err).Str("addr", addr).Msg("Error while serving metrics")
+		}
+	}()
+
+	return nil
+}
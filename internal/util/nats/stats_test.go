@@ -0,0 +1,74 @@
+package nats
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	sub, err := NewConnection(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer sub.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := sub.nc.Publish("url.found", []byte("{}")); err != nil {
+			t.FailNow()
+		}
+	}
+	if err := sub.nc.Flush(); err != nil {
+		t.FailNow()
+	}
+
+	// JSON endpoint
+	rec := httptest.NewRecorder()
+	StatsHandler(sub).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/nats", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.FailNow()
+	}
+
+	var stats nats.Statistics
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.FailNow()
+	}
+	if stats.OutMsgs != 3 {
+		t.Errorf("Wanted: 3 Got: %d", stats.OutMsgs)
+	}
+
+	// Prometheus gauges
+	reg := prometheus.NewRegistry()
+	if err := RegisterStatsMetrics(reg, sub); err != nil {
+		t.FailNow()
+	}
+
+	want := `
+# HELP nats_out_msgs_total The total number of messages published to the NATS server
+# TYPE nats_out_msgs_total gauge
+nats_out_msgs_total 3
+# HELP nats_dropped_msgs_total The total number of messages dropped because of slow consumption
+# TYPE nats_dropped_msgs_total gauge
+nats_dropped_msgs_total 0
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"nats_out_msgs_total", "nats_dropped_msgs_total"); err != nil {
+		t.Error(err)
+	}
+
+	// Registering twice should fail
+	if err := RegisterStatsMetrics(reg, sub); err == nil {
+		t.Error("gauges should not be registered twice")
+	}
+}
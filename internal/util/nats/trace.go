@@ -0,0 +1,77 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// TraceIDHeader is the header carrying the trace ID correlating the messages published for the same URL
+const TraceIDHeader = "X-Trace-ID"
+
+type traceIDKey struct{}
+
+// WithTraceID returns a context derived from ctx carrying given trace ID, propagated by PublishMsgWithContext
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceIDFromContext returns the trace ID carried by given context (empty if none)
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
+
+// PublishMsgWithContext publish given Msg, propagating the trace context of ctx in the message headers
+func PublishMsgWithContext(ctx context.Context, nc *nats.Conn, msg Msg) error {
+	natsMsg, err := newTracedMsg(ctx, nc, msg)
+	if err != nil {
+		return err
+	}
+
+	return nc.PublishMsg(natsMsg)
+}
+
+// newTracedMsg returns the NATS message of given Msg, carrying the trace context of ctx in its headers.
+// the payload is compressed if nc uses compression
+func newTracedMsg(ctx context.Context, nc *nats.Conn, msg Msg) (*nats.Msg, error) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	natsMsg := nats.NewMsg(msg.Subject())
+	natsMsg.Data = b
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(natsMsg.Header))
+	if traceID := TraceIDFromContext(ctx); traceID != "" {
+		natsMsg.Header.Set(TraceIDHeader, traceID)
+	}
+
+	if err := compressMsg(nc, natsMsg); err != nil {
+		return nil, err
+	}
+
+	return natsMsg, nil
+}
+
+// ContextFromMsg returns a context derived from ctx carrying the trace context (and trace ID) propagated
+// in the headers of given message
+func ContextFromMsg(ctx context.Context, msg *nats.Msg) context.Context {
+	if msg.Header == nil {
+		return ctx
+	}
+
+	if traceID := msg.Header.Get(TraceIDHeader); traceID != "" {
+		ctx = WithTraceID(ctx, traceID)
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(msg.Header))
+}
+
+// PublishMsgWithContext publish given message using the connection,
+// propagating the trace context of ctx in the message headers
+func (c *Connection) PublishMsgWithContext(ctx context.Context, msg Msg) error {
+	return PublishMsgWithContext(ctx, c.nc, msg)
+}
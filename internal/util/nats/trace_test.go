@@ -0,0 +1,117 @@
+package nats
+
+import (
+	"context"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+	"time"
+)
+
+type testMsg struct {
+	URL string `json:"url"`
+}
+
+func (msg *testMsg) Subject() string {
+	return "url.test"
+}
+
+func TestPublishMsgWithContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("url.test")
+	if err != nil {
+		t.FailNow()
+	}
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "publish")
+	defer span.End()
+
+	if err := PublishMsgWithContext(ctx, nc, &testMsg{URL: "http://example.onion"}); err != nil {
+		t.FailNow()
+	}
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	if msg.Header.Get("Traceparent") == "" {
+		t.Error("traceparent header should have been set")
+	}
+
+	var body testMsg
+	if err := ReadJSON(msg, &body); err != nil || body.URL != "http://example.onion" {
+		t.Error("message body should have been published")
+	}
+
+	propagated := trace.SpanContextFromContext(ContextFromMsg(context.Background(), msg))
+	if !propagated.IsRemote() || propagated.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("Wanted trace: %s Got: %s", span.SpanContext().TraceID(), propagated.TraceID())
+	}
+
+	// Message without headers
+	if trace.SpanContextFromContext(ContextFromMsg(context.Background(), &nats.Msg{})).IsValid() {
+		t.Error("message without headers should not carry a trace context")
+	}
+}
+
+func TestTraceIDHeader(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.FailNow()
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("url.test")
+	if err != nil {
+		t.FailNow()
+	}
+
+	ctx := WithTraceID(context.Background(), "d9b1b4a4-2c5e-4d3f-9a0e-6f1c2b3a4d5e")
+	if err := PublishMsgWithContext(ctx, nc, &testMsg{URL: "http://example.onion"}); err != nil {
+		t.FailNow()
+	}
+	if err := PublishMsgWithContext(context.Background(), nc, &testMsg{URL: "http://example.onion"}); err != nil {
+		t.FailNow()
+	}
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	if msg.Header.Get(TraceIDHeader) != "d9b1b4a4-2c5e-4d3f-9a0e-6f1c2b3a4d5e" {
+		t.Errorf("Wanted: d9b1b4a4-2c5e-4d3f-9a0e-6f1c2b3a4d5e Got: %s", msg.Header.Get(TraceIDHeader))
+	}
+	if traceID := TraceIDFromContext(ContextFromMsg(context.Background(), msg)); traceID != msg.Header.Get(TraceIDHeader) {
+		t.Errorf("Wanted: %s Got: %s", msg.Header.Get(TraceIDHeader), traceID)
+	}
+
+	// No trace ID to propagate
+	msg, err = sub.NextMsg(time.Second)
+	if err != nil {
+		t.FailNow()
+	}
+	if traceID := TraceIDFromContext(ContextFromMsg(context.Background(), msg)); traceID != "" {
+		t.Errorf("Wanted: no trace ID Got: %s", traceID)
+	}
+}
@@ -0,0 +1,85 @@
+package onion
+
+import (
+	"bytes"
+	"encoding/base32"
+	"golang.org/x/crypto/sha3"
+	"strings"
+)
+
+const (
+	// V2Length is the length of the base32 part of a v2 onion address (80 bits hash of the public key)
+	V2Length = 16
+	// V3Length is the length of the base32 part of a v3 onion address (public key, checksum & version)
+	V3Length = 56
+	// v3Version is the version byte ending v3 onion addresses
+	v3Version = 0x03
+)
+
+// IsValidHost returns true if given hostname is a v2 or v3 onion address (e.g: <56 base32 chars>.onion), optionally
+// prefixed by subdomains (e.g: www.<56 base32 chars>.onion). The checksum of the v3 addresses is verified
+func IsValidHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !strings.HasSuffix(host, ".onion") {
+		return false
+	}
+
+	labels := strings.Split(strings.TrimSuffix(host, ".onion"), ".")
+	for _, label := range labels[:len(labels)-1] {
+		if label == "" {
+			return false
+		}
+	}
+
+	address := labels[len(labels)-1]
+	switch len(address) {
+	case V2Length:
+		return isBase32(address)
+	case V3Length:
+		return IsValidV3Address(address)
+	default:
+		return false
+	}
+}
+
+// IsValidV3Address returns true if given v3 address (without .onion) has a valid version & checksum
+func IsValidV3Address(address string) bool {
+	b, err := base32.StdEncoding.DecodeString(strings.ToUpper(address))
+	if err != nil || len(b) != 35 {
+		return false
+	}
+
+	pubKey, checksum, version := b[:32], b[32:34], b[34]
+	if version != v3Version {
+		return false
+	}
+
+	return bytes.Equal(v3Checksum(pubKey), checksum)
+}
+
+// V3Address returns the v3 address (without .onion) of given ed25519 public key (32 bytes)
+func V3Address(pubKey []byte) string {
+	b := append(append(append([]byte{}, pubKey...), v3Checksum(pubKey)...), v3Version)
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b))
+}
+
+// v3Checksum returns the checksum of the v3 address of given public key
+func v3Checksum(pubKey []byte) []byte {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pubKey)
+	h.Write([]byte{v3Version})
+
+	return h.Sum(nil)[:2]
+}
+
+// isBase32 returns true if given lowercase string only contains base32 characters (a-z, 2-7)
+func isBase32(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < '2' || c > '7') {
+			return false
+		}
+	}
+
+	return true
+}
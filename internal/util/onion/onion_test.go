@@ -0,0 +1,101 @@
+package onion
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+)
+
+const (
+	v3DuckDuckGo  = "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad"
+	v3TorProject  = "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid"
+	v2DuckDuckGo  = "3g2upl4pq6kufc4m"
+	v3BadChecksum = "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczaa"
+)
+
+func TestIsValidHost(t *testing.T) {
+	tests := map[string]bool{
+		// v3
+		v3DuckDuckGo + ".onion":                  true,
+		v3TorProject + ".onion":                  true,
+		strings.ToUpper(v3DuckDuckGo) + ".ONION": true,
+		v3DuckDuckGo + ".onion.":                 true,
+		v3BadChecksum + ".onion":                 false,
+		strings.Repeat("a", 56) + ".onion":       false,
+		v3DuckDuckGo[1:] + ".onion":              false,
+		v3DuckDuckGo + "a.onion":                 false,
+		// v2
+		v2DuckDuckGo + ".onion":                  true,
+		strings.ToUpper(v2DuckDuckGo) + ".onion": true,
+		"abcdefghijklmnop.onion":                 true,
+		"abcdefghijklmno.onion":                  false,
+		"abcdefghijklmnopq.onion":                false,
+		"0123456789abcdef.onion":                 false,
+		"abcdefghijklmn8p.onion":                 false,
+		"abcdefghijklmn-p.onion":                 false,
+		// Subdomains
+		"www." + v3DuckDuckGo + ".onion":   true,
+		"a.b.c." + v3TorProject + ".onion": true,
+		"sub." + v2DuckDuckGo + ".onion":   true,
+		v3DuckDuckGo + ".example.onion":    false,
+		"." + v3DuckDuckGo + ".onion":      false,
+		"a.." + v3DuckDuckGo + ".onion":    false,
+		"www." + v3BadChecksum + ".onion":  false,
+		v2DuckDuckGo + "." + v2DuckDuckGo:  false,
+		// Invalid hosts
+		"foo.onion":                         false,
+		"example.onion":                     false,
+		".onion":                            false,
+		"onion":                             false,
+		"":                                  false,
+		v3DuckDuckGo:                        false,
+		v3DuckDuckGo + ".com":               false,
+		v3DuckDuckGo + ".onions":            false,
+		v3DuckDuckGo + ".onion.com":         false,
+		v3DuckDuckGo + "onion":              false,
+		v3DuckDuckGo + ".onion:80":          false,
+		"http://" + v2DuckDuckGo + ".onion": false,
+	}
+
+	for host, want := range tests {
+		if got := IsValidHost(host); got != want {
+			t.Errorf("%s: Wanted: %v Got: %v", host, want, got)
+		}
+	}
+}
+
+func TestIsValidV3Address(t *testing.T) {
+	tests := map[string]bool{
+		v3DuckDuckGo:  true,
+		v3TorProject:  true,
+		v3BadChecksum: false,
+		// Wrong version & checksum
+		strings.Repeat("a", 56): false,
+		// Not base32
+		strings.Repeat("1", 56): false,
+		v2DuckDuckGo:            false,
+		"":                      false,
+	}
+
+	for address, want := range tests {
+		if got := IsValidV3Address(address); got != want {
+			t.Errorf("%s: Wanted: %v Got: %v", address, want, got)
+		}
+	}
+}
+
+func TestV3Address(t *testing.T) {
+	address := V3Address(make([]byte, 32))
+	if len(address) != V3Length || !IsValidV3Address(address) {
+		t.Errorf("invalid address %s", address)
+	}
+
+	// The address of the DuckDuckGo public key is the DuckDuckGo one
+	b, err := base32.StdEncoding.DecodeString(strings.ToUpper(v3DuckDuckGo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := V3Address(b[:32]); got != v3DuckDuckGo {
+		t.Errorf("Wanted: %s Got: %s", v3DuckDuckGo, got)
+	}
+}
@@ -0,0 +1,72 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+var (
+	// sleep & random are replaced in tests
+	sleep  = time.Sleep
+	random = rand.Float64
+)
+
+// Options configure the retry behavior
+type Options struct {
+	// Count is the maximum number of retries (0 = no retry)
+	Count int
+	// InitialDelay is the delay before the first retry
+	InitialDelay time.Duration
+	// MaxDelay is the maximum delay between two attempts
+	MaxDelay time.Duration
+	// Multiplier is applied to the delay after each attempt
+	Multiplier float64
+	// Jitter is the random variation applied to each delay (0.2 = ±20%)
+	Jitter float64
+	// DelayFor returns the delay to wait after given error if it imposes one (e.g: rate limiting),
+	// instead of the backoff delay. nil means the backoff delay is always used
+	DelayFor func(err error) (time.Duration, bool)
+}
+
+// DefaultOptions returns the default retry options
+func DefaultOptions() Options {
+	return Options{
+		Count:        3,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// Do call given function until it succeed or the maximum number of retries is reached,
+// using truncated exponential backoff with jitter between the attempts.
+// the last error is returned
+func Do(f func() error, opts Options) error {
+	delay := opts.InitialDelay
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= opts.Count {
+			return err
+		}
+
+		if opts.MaxDelay > 0 && delay > opts.MaxDelay {
+			delay = opts.MaxDelay
+		}
+
+		wait := withJitter(delay, opts.Jitter)
+		if opts.DelayFor != nil {
+			if d, ok := opts.DelayFor(err); ok {
+				wait = d
+			}
+		}
+		sleep(wait)
+
+		delay = time.Duration(float64(delay) * opts.Multiplier)
+	}
+}
+
+// withJitter randomly vary given delay by ±jitter
+func withJitter(delay time.Duration, jitter float64) time.Duration {
+	return time.Duration(float64(delay) * (1 + jitter*(2*random()-1)))
+}
@@ -0,0 +1,168 @@
+package retry
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// mockTime replace sleep & random with deterministic implementations
+// and returns the recorded delays
+func mockTime(randomValue float64) *[]time.Duration {
+	var delays []time.Duration
+
+	sleep = func(d time.Duration) {
+		delays = append(delays, d)
+	}
+	random = func() float64 {
+		return randomValue
+	}
+
+	return &delays
+}
+
+func restoreTime() {
+	sleep = time.Sleep
+	random = rand.Float64
+}
+
+func TestDoDelaySequence(t *testing.T) {
+	delays := mockTime(0.5) // no jitter
+	defer restoreTime()
+
+	calls := 0
+	err := Do(func() error {
+		calls++
+		return errors.New("failure")
+	}, Options{
+		Count:        5,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	})
+	if err == nil {
+		t.FailNow()
+	}
+
+	if calls != 6 {
+		t.Errorf("Wanted: 6 calls Got: %d", calls)
+	}
+
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second, // truncated
+	}
+	if len(*delays) != len(want) {
+		t.FailNow()
+	}
+	for i, d := range want {
+		if (*delays)[i] != d {
+			t.Errorf("Delay %d: Wanted: %s Got: %s", i, d, (*delays)[i])
+		}
+	}
+}
+
+func TestDoJitter(t *testing.T) {
+	opts := Options{Count: 1, InitialDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2, Jitter: 0.2}
+	failure := func() error { return errors.New("failure") }
+
+	delays := mockTime(0)
+	_ = Do(failure, opts)
+	if (*delays)[0] != 800*time.Millisecond {
+		t.Errorf("Wanted: 800ms Got: %s", (*delays)[0])
+	}
+
+	delays = mockTime(1)
+	_ = Do(failure, opts)
+	if (*delays)[0] != 1200*time.Millisecond {
+		t.Errorf("Wanted: 1.2s Got: %s", (*delays)[0])
+	}
+
+	restoreTime()
+}
+
+func TestDoSuccess(t *testing.T) {
+	delays := mockTime(0.5)
+	defer restoreTime()
+
+	calls := 0
+	err := Do(func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("failure")
+		}
+		return nil
+	}, DefaultOptions())
+	if err != nil {
+		t.FailNow()
+	}
+
+	if calls != 3 {
+		t.Fail()
+	}
+	if len(*delays) != 2 || (*delays)[0] != 100*time.Millisecond || (*delays)[1] != 200*time.Millisecond {
+		t.Fail()
+	}
+}
+
+func TestDoNoRetry(t *testing.T) {
+	delays := mockTime(0.5)
+	defer restoreTime()
+
+	calls := 0
+	if err := Do(func() error {
+		calls++
+		return errors.New("failure")
+	}, Options{}); err == nil {
+		t.Fail()
+	}
+
+	if calls != 1 || len(*delays) != 0 {
+		t.Fail()
+	}
+}
+
+func TestDoDelayFor(t *testing.T) {
+	delays := mockTime(0.5) // no jitter
+	defer restoreTime()
+
+	errRateLimited := errors.New("rate limited")
+
+	calls := 0
+	err := Do(func() error {
+		calls++
+		if calls == 2 {
+			return errRateLimited
+		}
+		return errors.New("failure")
+	}, Options{
+		Count:        3,
+		InitialDelay: 100 * time.Millisecond,
+		Multiplier:   2,
+		DelayFor: func(err error) (time.Duration, bool) {
+			if err == errRateLimited {
+				return 5 * time.Second, true
+			}
+			return 0, false
+		},
+	})
+	if err == nil {
+		t.FailNow()
+	}
+
+	// The backoff goes on after the imposed delay
+	want := []time.Duration{100 * time.Millisecond, 5 * time.Second, 400 * time.Millisecond}
+	if len(*delays) != len(want) {
+		t.Fatalf("Wanted: %v Got: %v", want, *delays)
+	}
+	for i := range want {
+		if (*delays)[i] != want[i] {
+			t.Errorf("delay %d: Wanted: %s Got: %s", i, want[i], (*delays)[i])
+		}
+	}
+}
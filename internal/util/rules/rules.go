@@ -0,0 +1,67 @@
+package rules
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+)
+
+// Error is returned when a rule cannot be parsed
+type Error struct {
+	// Name is the kind of the rule (e.g: refresh)
+	Name    string
+	Pattern string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s rule %s: %s", e.Name, e.Pattern, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ParseFunc parse the value of the rule applying to the hostnames matching given pattern.
+// value is a scalar, or a yaml.MapSlice if the rule maps several values
+type ParseFunc func(pattern *regexp.Regexp, value interface{}) error
+
+// Load read & parse the rules file located at given path, if any. name is the kind of the rules used in the errors
+func Load(path, name string, parse ParseFunc) error {
+	if path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error while reading %s rules: %s", name, err)
+	}
+
+	return Parse(b, name, parse)
+}
+
+// Parse parse given YAML (or JSON) content mapping hostname patterns to values, calling given function for each
+// rule in the order of the content (the first matching rule should win)
+func Parse(content []byte, name string, parse ParseFunc) error {
+	// Use MapSlice to keep rules ordering
+	var entries yaml.MapSlice
+	if err := yaml.Unmarshal(content, &entries); err != nil {
+		return fmt.Errorf("error while decoding %s rules: %s", name, err)
+	}
+
+	for _, entry := range entries {
+		pattern := fmt.Sprintf("%v", entry.Key)
+
+		exp, err := regexp.Compile(pattern)
+		if err != nil {
+			return &Error{Name: name, Pattern: pattern, Err: err}
+		}
+
+		if err := parse(exp, entry.Value); err != nil {
+			return &Error{Name: name, Pattern: pattern, Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var patterns, values []string
+	err := Parse([]byte("'.*forum.*': 2h\n'.*': {request: 1m}\n"), "test", func(pattern *regexp.Regexp,
+		value interface{}) error {
+		patterns = append(patterns, pattern.String())
+		values = append(values, fmt.Sprintf("%v", value))
+		return nil
+	})
+	if err != nil {
+		t.FailNow()
+	}
+
+	// Order of the rules is preserved
+	if len(patterns) != 2 || patterns[0] != ".*forum.*" || patterns[1] != ".*" {
+		t.Errorf("Wanted: [.*forum.* .*] Got: %v", patterns)
+	}
+	if len(values) != 2 || values[0] != "2h" || values[1] != "[{request 1m}]" {
+		t.Errorf("Wanted: [2h [{request 1m}]] Got: %v", values)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	noop := func(pattern *regexp.Regexp, value interface{}) error { return nil }
+
+	err := Parse([]byte(`{"[a-z": "2h"}`), "test", noop)
+	var ruleErr *Error
+	if !errors.As(err, &ruleErr) {
+		t.FailNow()
+	}
+	if ruleErr.Pattern != "[a-z" || ruleErr.Name != "test" {
+		t.Errorf("Wanted: test [a-z Got: %s %s", ruleErr.Name, ruleErr.Pattern)
+	}
+
+	valueErr := errors.New("invalid value")
+	err = Parse([]byte(`{".*": "2h"}`), "test", func(pattern *regexp.Regexp, value interface{}) error {
+		return valueErr
+	})
+	if !errors.As(err, &ruleErr) || !errors.Is(err, valueErr) {
+		t.FailNow()
+	}
+	if err.Error() != "invalid test rule .*: invalid value" {
+		t.Errorf("Wanted: invalid test rule .*: invalid value Got: %s", err)
+	}
+
+	if err := Parse([]byte(`not a map`), "test", noop); err == nil {
+		t.Fail()
+	}
+}
+
+func TestLoadNoFile(t *testing.T) {
+	err := Load("", "test", func(pattern *regexp.Regexp, value interface{}) error {
+		t.Error("no rule should have been parsed")
+		return nil
+	})
+	if err != nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,138 @@
+package tfidf
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxTerms is the default number of distinct terms whose document frequency is kept
+const DefaultMaxTerms = 100000
+
+// stopWords are the common english words which are never keywords, shorter words being usually
+// excluded by the minimum keyword length
+var stopWords = map[string]bool{
+	"about": true, "after": true, "again": true, "also": true, "been": true, "before": true, "being": true,
+	"below": true, "between": true, "both": true, "could": true, "does": true, "doing": true, "down": true,
+	"during": true, "each": true, "from": true, "further": true, "have": true, "having": true, "here": true,
+	"into": true, "just": true, "like": true, "more": true, "most": true, "once": true, "only": true, "other": true,
+	"over": true, "same": true, "should": true, "some": true, "such": true, "than": true, "that": true,
+	"their": true, "theirs": true, "them": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "those": true, "through": true, "under": true, "until": true, "very": true, "were": true,
+	"what": true, "when": true, "where": true, "which": true, "while": true, "will": true, "with": true,
+	"would": true, "your": true, "yours": true,
+}
+
+// Corpus keep the document frequency of the terms of the documents seen so far, used to weight the terms
+// of the next ones: the terms found in most documents are not keywords.
+// it is safe for concurrent use
+type Corpus struct {
+	// maxTerms is the number of distinct terms above which the frequencies are halved, forgetting the rare terms
+	maxTerms int
+	docs     int
+	df       map[string]int
+	mutex    sync.Mutex
+}
+
+// NewCorpus returns an empty corpus keeping the frequency of at most about maxTerms distinct terms
+func NewCorpus(maxTerms int) *Corpus {
+	return &Corpus{maxTerms: maxTerms, df: map[string]int{}}
+}
+
+// Keywords add given plain text to the corpus and returns its count terms of at least minLen characters
+// with the highest TF-IDF score, best first. Terms are lower cased
+func (c *Corpus) Keywords(text string, count, minLen int) []string {
+	terms := Tokenize(text, minLen)
+	if len(terms) == 0 || count <= 0 {
+		return nil
+	}
+
+	tf := map[string]int{}
+	for _, term := range terms {
+		tf[term]++
+	}
+
+	idf := c.add(tf)
+
+	type scoredTerm struct {
+		term  string
+		score float64
+	}
+	scored := make([]scoredTerm, 0, len(tf))
+	for term, freq := range tf {
+		scored = append(scored, scoredTerm{term, float64(freq) / float64(len(terms)) * idf[term]})
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
+		}
+		return scored[i].term < scored[j].term
+	})
+
+	if len(scored) > count {
+		scored = scored[:count]
+	}
+
+	keywords := make([]string, len(scored))
+	for i, st := range scored {
+		keywords[i] = st.term
+	}
+	return keywords
+}
+
+// add record the document with given term frequencies and returns the inverse document frequency of its terms
+func (c *Corpus) add(tf map[string]int) map[string]float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.docs++
+	for term := range tf {
+		c.df[term]++
+	}
+
+	// Smoothed so that the terms of a single document are weighted by their frequency only
+	idf := make(map[string]float64, len(tf))
+	for term := range tf {
+		idf[term] = math.Log(float64(1+c.docs)/float64(1+c.df[term])) + 1
+	}
+
+	if c.maxTerms > 0 && len(c.df) > c.maxTerms {
+		c.decay()
+	}
+
+	return idf
+}
+
+// decay halve the frequencies, which keeps the weights while forgetting the terms found in a single document
+func (c *Corpus) decay() {
+	c.docs = (c.docs + 1) / 2
+	for term, freq := range c.df {
+		if freq /= 2; freq == 0 {
+			delete(c.df, term)
+		} else {
+			c.df[term] = freq
+		}
+	}
+}
+
+// Tokenize returns the lower cased words of given plain text having at least minLen characters,
+// ignoring the numbers and the common english words
+func Tokenize(text string, minLen int) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var terms []string
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < minLen || stopWords[word] || strings.IndexFunc(word, unicode.IsLetter) < 0 {
+			continue
+		}
+		terms = append(terms, word)
+	}
+
+	return terms
+}
@@ -0,0 +1,58 @@
+package tfidf
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	terms := Tokenize("Welcome to THE market: 2021 bitcoin, café & l33t forums. Would you like more?", 4)
+	want := []string{"welcome", "market", "bitcoin", "café", "l33t", "forums"}
+	if fmt.Sprint(terms) != fmt.Sprint(want) {
+		t.Errorf("Wanted: %v Got: %v", want, terms)
+	}
+}
+
+func TestCorpusKeywords(t *testing.T) {
+	c := NewCorpus(DefaultMaxTerms)
+
+	// First page: weighted by term frequency only
+	keywords := c.Keywords("Hidden market selling books. Books are shipped worldwide, "+
+		"every market order is encrypted. Welcome to the market!", 3, 4)
+	if want := []string{"market", "books", "encrypted"}; fmt.Sprint(keywords) != fmt.Sprint(want) {
+		t.Errorf("Wanted: %v Got: %v", want, keywords)
+	}
+
+	// Terms found in the previous pages are weighted down: welcome is more frequent than forum
+	keywords = c.Keywords("Welcome to the forum. The forum is about privacy: privacy tools, privacy guides, "+
+		"privacy news. Forum rules: welcome, welcome, welcome!", 2, 4)
+	if want := []string{"privacy", "forum"}; fmt.Sprint(keywords) != fmt.Sprint(want) {
+		t.Errorf("Wanted: %v Got: %v", want, keywords)
+	}
+
+	// Fewer terms than requested
+	keywords = c.Keywords("Onion mirror", 10, 4)
+	if want := []string{"mirror", "onion"}; fmt.Sprint(keywords) != fmt.Sprint(want) {
+		t.Errorf("Wanted: %v Got: %v", want, keywords)
+	}
+
+	if keywords := c.Keywords("to be or not to be", 10, 4); len(keywords) != 0 {
+		t.Errorf("Wanted: no keywords Got: %v", keywords)
+	}
+}
+
+func TestCorpusDecay(t *testing.T) {
+	c := NewCorpus(4)
+
+	c.Keywords("alpha beta gamma", 3, 4)
+	c.Keywords("alpha delta", 3, 4)
+	if c.docs != 2 || len(c.df) != 4 {
+		t.Errorf("Wanted: 2 documents & 4 terms Got: %d & %v", c.docs, c.df)
+	}
+
+	// Above the maximum: the terms found once are forgotten
+	c.Keywords("alpha epsilon", 3, 4)
+	if c.docs != 2 || len(c.df) != 1 || c.df["alpha"] != 1 {
+		t.Errorf("Wanted: 2 documents & alpha Got: %d & %v", c.docs, c.df)
+	}
+}
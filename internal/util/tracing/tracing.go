@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// GetOTELEndpointFlag return the CLI flag parameter used to setup the OTLP exporter endpoint
+func GetOTELEndpointFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "otel-endpoint",
+		Usage: "Address of the OTLP/HTTP endpoint to export the traces to (e.g: localhost:4318). Tracing is disabled if empty",
+	}
+}
+
+// ConfigureTracer configure the global tracer provider to export the traces of given service
+// to the OTLP endpoint (read from cli context). the returned function flush the pending traces
+func ConfigureTracer(ctx *cli.Context, serviceName string) (func(), error) {
+	// The W3C trace context is propagated even if tracing is disabled
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	endpoint := ctx.String("otel-endpoint")
+	if endpoint == "" {
+		return func() {}, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpoint(endpoint),
+		otlptracehttp.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Debug().Str("endpoint", endpoint).Msg("Exporting traces")
+
+	return func() {
+		if err := provider.Shutdown(context.Background()); err != nil {
+			log.Warn().Str("err", err.Error()).Msg("Error while flushing traces")
+		}
+	}, nil
+}
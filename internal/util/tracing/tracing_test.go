@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"flag"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"testing"
+)
+
+func TestGetOTELEndpointFlag(t *testing.T) {
+	flag := GetOTELEndpointFlag()
+	if flag.Name != "otel-endpoint" {
+		t.Fail()
+	}
+	if flag.Value != "" {
+		t.Fail()
+	}
+}
+
+func TestConfigureTracerDisabled(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("otel-endpoint", "", "")
+
+	shutdown, err := ConfigureTracer(cli.NewContext(cli.NewApp(), set, nil), "tdsh-test")
+	if err != nil || shutdown == nil {
+		t.FailNow()
+	}
+	shutdown()
+
+	// Trace context should be propagated anyway
+	if _, ok := otel.GetTextMapPropagator().(propagation.TraceContext); !ok {
+		t.Error("W3C trace context propagator should have been set")
+	}
+}